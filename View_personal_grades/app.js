@@ -2,6 +2,7 @@ require('dotenv').config();
 const amqp = require('amqplib');
 const mysql = require('mysql2/promise');
 const XLSX = require('xlsx');
+const { loadWorkbook } = require('./blob');
 
 const {
   MYSQL_URI,
@@ -79,12 +80,8 @@ const log = (...args) => console.log(`[${new Date().toISOString()}]`, ...args);
     log('📩 Received XLSX grade message');
     const reply = makeReply(msg);
 
-    const ct = (msg.properties.contentType || '').toLowerCase().trim();
-    const buffer = (ct.includes('spreadsheet') || ct === 'application/octet-stream')
-      ? msg.content
-      : Buffer.from(msg.content.toString(), 'base64');
-
     try {
+      const buffer = await loadWorkbook(msg);   // claim check → .xlsx bytes
       const wb = XLSX.read(buffer, { type: 'buffer' });
       const rows = XLSX.utils.sheet_to_json(wb.Sheets[wb.SheetNames[0]], {
         header: 1,
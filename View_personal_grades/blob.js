@@ -0,0 +1,29 @@
+// blob.js
+//
+// Grade workbooks reach us as a claim check: the orchestrator keeps the
+// .xlsx in its blob store and the message only carries
+// { sha256, size, url, filename, content_type }. Fetch the bytes from the
+// orchestrator's internal endpoint and make sure they match the hash.
+// Raw spreadsheets and base64 bodies from older publishers still work.
+const crypto = require('crypto');
+
+const INTERNAL_API_TOKEN = process.env.INTERNAL_API_TOKEN || '';
+
+async function loadWorkbook(msg) {
+  const ct = (msg.properties.contentType || '').toLowerCase().trim();
+  if (ct.includes('spreadsheet') || ct === 'application/octet-stream') return msg.content;
+  if (ct !== 'application/json') return Buffer.from(msg.content.toString(), 'base64');
+
+  const ref = JSON.parse(msg.content.toString());
+  const res = await fetch(ref.url, {
+    headers: { Authorization: `Bearer ${INTERNAL_API_TOKEN}` }
+  });
+  if (!res.ok) throw new Error(`Blob ${ref.sha256} download failed: HTTP ${res.status}`);
+
+  const buffer = Buffer.from(await res.arrayBuffer());
+  const sum = crypto.createHash('sha256').update(buffer).digest('hex');
+  if (sum !== ref.sha256) throw new Error(`Blob ${ref.sha256} checksum mismatch`);
+  return buffer;
+}
+
+module.exports = { loadWorkbook };
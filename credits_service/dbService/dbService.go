@@ -2,10 +2,13 @@ package dbService
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 
+	"credits_service/metrics"
+
 	"github.com/jackc/pgx"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
@@ -42,6 +45,7 @@ func Diminish(inst_name string, credits int) (bool, error) {
 	tx, err := Pool.Begin(ctx)
 	if err != nil {
 		log.Printf("[Diminish] Failed to begin transaction: %v", err)
+		metrics.DBError("diminish")
 		return false, err
 	}
 	defer tx.Rollback(ctx) // automatic rollback on error
@@ -56,6 +60,7 @@ func Diminish(inst_name string, credits int) (bool, error) {
 			return false, fmt.Errorf("institution '%s' not found", inst_name)
 		}
 		log.Printf("[Diminish] Failed to check credits: %v", err)
+		metrics.DBError("diminish")
 		return false, err
 	}
 	log.Printf("[Diminish] Current credits for %s: %d", inst_name, current_credits)
@@ -71,6 +76,7 @@ func Diminish(inst_name string, credits int) (bool, error) {
 	res, err := tx.Exec(ctx, updateQuery, credits, inst_name)
 	if err != nil {
 		log.Printf("[Diminish] Failed to decrement credits: %v", err)
+		metrics.DBError("diminish")
 		return false, err
 	}
 
@@ -83,6 +89,7 @@ func Diminish(inst_name string, credits int) (bool, error) {
 	// 5. Commit
 	if err := tx.Commit(ctx); err != nil {
 		log.Printf("[Diminish] Failed to commit transaction: %v", err)
+		metrics.DBError("diminish")
 		return false, err
 	}
 
@@ -90,105 +97,124 @@ func Diminish(inst_name string, credits int) (bool, error) {
 	return true, nil
 }
 
-func BuyCredits(instName string, credits int) (bool, error) {
+// BuyCredits adds credits to an institution's account. Accounts are only
+// opened by the institution's approval (NewInstitution), so an institution
+// without one gets ErrUnknownInstitution. A non-empty purchaseID is
+// credited once: repeating it returns ErrPurchaseApplied.
+func BuyCredits(instName string, credits int, purchaseID string) (bool, error) {
 	ctx := context.Background()
 
 	tx, err := Pool.Begin(ctx)
 	if err != nil {
 		log.Printf("Failed to begin transaction: %v", err)
+		metrics.DBError("buy_credits")
 		return false, err
 	}
 	defer tx.Rollback(ctx)
 
-	// Step 1: Ensure the record exists, insert with 50 credits if not
-	insertQuery := `
-        INSERT INTO credits_inst (name, credits)
-        VALUES ($1, 50)
-        ON CONFLICT (name) DO NOTHING
-    `
-	if _, err := tx.Exec(ctx, insertQuery, instName); err != nil {
-		log.Printf("Failed to insert default credits: %v", err)
-		return false, err
+	if purchaseID != "" {
+		const recordQuery = `
+            INSERT INTO credit_purchases (id, name, amount)
+            VALUES ($1, $2, $3)
+            ON CONFLICT (id) DO NOTHING
+        `
+		res, err := tx.Exec(ctx, recordQuery, purchaseID, instName, credits)
+		if err != nil {
+			log.Printf("Failed to record purchase %s: %v", purchaseID, err)
+			metrics.DBError("buy_credits")
+			return false, err
+		}
+		if res.RowsAffected() == 0 {
+			log.Printf("Purchase %s for %q already applied", purchaseID, instName)
+			return false, fmt.Errorf("%w: %s", ErrPurchaseApplied, purchaseID)
+		}
 	}
 
-	// Step 2: Add the requested credits
 	updateQuery := `
         UPDATE credits_inst
         SET credits = credits + $2
         WHERE name = $1
     `
-	if _, err := tx.Exec(ctx, updateQuery, instName, credits); err != nil {
+	res, err := tx.Exec(ctx, updateQuery, instName, credits)
+	if err != nil {
 		log.Printf("Failed to update credits: %v", err)
+		metrics.DBError("buy_credits")
 		return false, err
 	}
+	if res.RowsAffected() == 0 {
+		log.Printf("No credits account for %q", instName)
+		return false, fmt.Errorf("%w: %s", ErrUnknownInstitution, instName)
+	}
 
 	if err := tx.Commit(ctx); err != nil {
-		log.Printf("Failed to commit transaction: %v", err)
+		log.Printf("Failed to commit purchase: %v", err)
+		metrics.DBError("buy_credits")
 		return false, err
 	}
-
 	return true, nil
 }
 
+// AvailableCredits is an institution's balance, or ErrUnknownInstitution
+// if it has no account (it is not approved).
 func AvailableCredits(instName string) (int, error) {
 	ctx := context.Background()
 
 	const selectQuery = `
-        SELECT credits
+        SELECT COUNT(*), COALESCE(MAX(credits), 0)
         FROM credits_inst
         WHERE name = $1
     `
 
-	var current int
-	err := Pool.QueryRow(ctx, selectQuery, instName).Scan(&current)
-	if err == nil {
-		return current, nil
+	var found, current int
+	if err := Pool.QueryRow(ctx, selectQuery, instName).Scan(&found, &current); err != nil {
+		log.Printf("Unexpected error fetching credits: %v", err)
+		metrics.DBError("available_credits")
+		return 0, err
 	}
-
-	if err != nil {
-		log.Printf("Institution %q not found, inserting with 0 credits", instName)
-
-		const insertQuery = `
-            INSERT INTO credits_inst (name, credits)
-            VALUES ($1, 50)
-        `
-		if _, insertErr := Pool.Exec(ctx, insertQuery, instName); insertErr != nil {
-			return 0, insertErr
-		}
-		return 50, nil
+	if found == 0 {
+		log.Printf("No credits account for %q", instName)
+		return 0, fmt.Errorf("%w: %s", ErrUnknownInstitution, instName)
 	}
-
-	log.Printf("Unexpected error fetching credits: %v", err)
-	return current, err
+	return current, nil
 }
 
+// ErrInstitutionExists is returned by NewInstitution when the institution
+// already has an account.
+var ErrInstitutionExists = errors.New("institution already exists")
+
 func NewInstitution(instName string, initialCredits int) (bool, error) {
 	ctx := context.Background()
 
 	tx, err := Pool.Begin(ctx)
 	if err != nil {
 		log.Printf("Failed to begin transaction: %v", err)
+		metrics.DBError("new_institution")
 		return false, err
 	}
 	defer tx.Rollback(ctx) // Ensures rollback on failure
 
-	const checkQuery = `SELECT 1 FROM credits_inst WHERE name = $1`
-	var exists int
-	err = tx.QueryRow(ctx, checkQuery, instName).Scan(&exists)
-	if err == nil {
+	const checkQuery = `SELECT EXISTS (SELECT 1 FROM credits_inst WHERE name = $1)`
+	var exists bool
+	if err := tx.QueryRow(ctx, checkQuery, instName).Scan(&exists); err != nil {
 		log.Printf("Error checking institution existence: %v", err)
-		return false, fmt.Errorf("institution %q already exists", instName)
+		metrics.DBError("new_institution")
+		return false, err
+	}
+	if exists {
+		return false, fmt.Errorf("%w: %q", ErrInstitutionExists, instName)
 	}
 
 	const insertQuery = `INSERT INTO credits_inst (name, credits) VALUES ($1, $2)`
 	_, err = tx.Exec(ctx, insertQuery, instName, initialCredits)
 	if err != nil {
 		log.Printf("Failed to insert new institution: %v", err)
+		metrics.DBError("new_institution")
 		return false, err
 	}
 
 	if err := tx.Commit(ctx); err != nil {
 		log.Printf("Failed to commit transaction: %v", err)
+		metrics.DBError("new_institution")
 		return false, err
 	}
 
@@ -0,0 +1,294 @@
+package dbService
+
+// Credit holds back the orchestrator's final-grades saga: credits are
+// reserved (taken from the balance) before the grades are published, then
+// either committed or released. Every operation is keyed by the caller's
+// hold ID and safe to repeat. A release that arrives before its hold leaves
+// a tombstone so the late hold is refused instead of reserving credits
+// nobody will release.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"credits_service/metrics"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	HoldHeld      = "held"
+	HoldCommitted = "committed"
+	HoldReleased  = "released"
+)
+
+var (
+	ErrUnknownInstitution = errors.New("institution not found")
+	ErrInsufficient       = errors.New("insufficient credits")
+	ErrHoldNotFound       = errors.New("hold not found")
+	ErrHoldMismatch       = errors.New("hold id reused for a different reservation")
+	ErrHoldReleased       = errors.New("hold was released")
+	ErrHoldCommitted      = errors.New("hold was committed")
+)
+
+// Hold is one reservation.
+type Hold struct {
+	ID        string
+	Name      string
+	Amount    int
+	Status    string
+	ExpiresAt time.Time
+}
+
+// EnsureHoldsTable creates credit_holds on databases initialised before
+// holds existed.
+func EnsureHoldsTable() error {
+	_, err := Pool.Exec(context.Background(), `
+        CREATE TABLE IF NOT EXISTS credit_holds (
+            id         varchar(64) PRIMARY KEY,
+            name       varchar(255) NOT NULL,
+            amount     integer NOT NULL CHECK (amount >= 0),
+            status     varchar(16) NOT NULL,
+            expires_at timestamptz NOT NULL,
+            created_at timestamptz NOT NULL DEFAULT now(),
+            updated_at timestamptz NOT NULL DEFAULT now()
+        );
+        CREATE INDEX IF NOT EXISTS credit_holds_expiry ON credit_holds (expires_at) WHERE status = 'held';
+    `)
+	return err
+}
+
+// PlaceHold reserves amount credits of instName under id for ttl and
+// returns the balance left. Repeating it returns the existing hold (and a
+// balance of 0, as nothing new was read).
+func PlaceHold(id, instName string, amount int, ttl time.Duration) (*Hold, int, error) {
+	ctx := context.Background()
+	tx, err := Pool.Begin(ctx)
+	if err != nil {
+		metrics.DBError("place_hold")
+		return nil, 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Holds are always locked before the wallet, as in ReleaseHold
+	h, err := lockHold(ctx, tx, id)
+	switch {
+	case err == nil:
+		if h.Status == HoldReleased {
+			return h, 0, ErrHoldReleased
+		}
+		if h.Name != instName || h.Amount != amount {
+			return h, 0, ErrHoldMismatch
+		}
+		return h, 0, nil
+	case !errors.Is(err, ErrHoldNotFound):
+		metrics.DBError("place_hold")
+		return nil, 0, err
+	}
+
+	var current int
+	err = tx.QueryRow(ctx, `SELECT credits FROM credits_inst WHERE name = $1 FOR UPDATE`, instName).Scan(&current)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, 0, fmt.Errorf("%w: %s", ErrUnknownInstitution, instName)
+	}
+	if err != nil {
+		metrics.DBError("place_hold")
+		return nil, 0, err
+	}
+
+	if current < amount {
+		log.Printf("[PlaceHold] %s has %d credits, hold %s needs %d", instName, current, id, amount)
+		return nil, current, fmt.Errorf("%w (current: %d)", ErrInsufficient, current)
+	}
+	if _, err := tx.Exec(ctx, `UPDATE credits_inst SET credits = credits - $1 WHERE name = $2`, amount, instName); err != nil {
+		metrics.DBError("place_hold")
+		return nil, 0, err
+	}
+	h = &Hold{ID: id, Name: instName, Amount: amount, Status: HoldHeld, ExpiresAt: time.Now().Add(ttl)}
+	if _, err := tx.Exec(ctx,
+		`INSERT INTO credit_holds (id, name, amount, status, expires_at) VALUES ($1, $2, $3, $4, $5)`,
+		h.ID, h.Name, h.Amount, h.Status, h.ExpiresAt); err != nil {
+		metrics.DBError("place_hold")
+		return nil, 0, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		metrics.DBError("place_hold")
+		return nil, 0, err
+	}
+	log.Printf("[PlaceHold] %s: %d credits of %s held until %s", id, amount, instName, h.ExpiresAt.Format(time.RFC3339))
+	return h, current - amount, nil
+}
+
+// CommitHold turns a hold into a spend. Committing twice is a no-op.
+func CommitHold(id string) (*Hold, error) {
+	ctx := context.Background()
+	tx, err := Pool.Begin(ctx)
+	if err != nil {
+		metrics.DBError("commit_hold")
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	h, err := lockHold(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	switch h.Status {
+	case HoldCommitted:
+		return h, nil
+	case HoldReleased:
+		return h, ErrHoldReleased
+	}
+	if err := setHoldStatus(ctx, tx, id, HoldCommitted); err != nil {
+		metrics.DBError("commit_hold")
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		metrics.DBError("commit_hold")
+		return nil, err
+	}
+	h.Status = HoldCommitted
+	log.Printf("[CommitHold] %s: %d credits of %s spent", id, h.Amount, h.Name)
+	return h, nil
+}
+
+// ReleaseHold gives the held credits back. Releasing twice, or a hold
+// that never arrived, is a no-op.
+func ReleaseHold(id string) (*Hold, error) {
+	ctx := context.Background()
+	tx, err := Pool.Begin(ctx)
+	if err != nil {
+		metrics.DBError("release_hold")
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	h, err := lockHold(ctx, tx, id)
+	switch {
+	case errors.Is(err, ErrHoldNotFound):
+		// Tombstone: a late credits.hold for this id must not reserve anything
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO credit_holds (id, name, amount, status, expires_at) VALUES ($1, '', 0, $2, now())`,
+			id, HoldReleased); err != nil {
+			metrics.DBError("release_hold")
+			return nil, err
+		}
+		return &Hold{ID: id, Status: HoldReleased}, tx.Commit(ctx)
+	case err != nil:
+		metrics.DBError("release_hold")
+		return nil, err
+	}
+
+	switch h.Status {
+	case HoldReleased:
+		return h, nil
+	case HoldCommitted:
+		return h, ErrHoldCommitted
+	}
+	if err := releaseLocked(ctx, tx, h); err != nil {
+		metrics.DBError("release_hold")
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		metrics.DBError("release_hold")
+		return nil, err
+	}
+	log.Printf("[ReleaseHold] %s: %d credits returned to %s", id, h.Amount, h.Name)
+	return h, nil
+}
+
+// ExpireHolds releases holds past their expiry and reports how many.
+func ExpireHolds() (int, error) {
+	ctx := context.Background()
+	tx, err := Pool.Begin(ctx)
+	if err != nil {
+		metrics.DBError("expire_holds")
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+        SELECT id, name, amount, status, expires_at FROM credit_holds
+        WHERE status = $1 AND expires_at < now()
+        FOR UPDATE SKIP LOCKED`, HoldHeld)
+	if err != nil {
+		metrics.DBError("expire_holds")
+		return 0, err
+	}
+	var expired []Hold
+	for rows.Next() {
+		var h Hold
+		if err := rows.Scan(&h.ID, &h.Name, &h.Amount, &h.Status, &h.ExpiresAt); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		expired = append(expired, h)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for i := range expired {
+		if err := releaseLocked(ctx, tx, &expired[i]); err != nil {
+			metrics.DBError("expire_holds")
+			return 0, err
+		}
+		log.Printf("[ExpireHolds] %s expired: %d credits returned to %s", expired[i].ID, expired[i].Amount, expired[i].Name)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		metrics.DBError("expire_holds")
+		return 0, err
+	}
+	return len(expired), nil
+}
+
+// SweepHolds runs ExpireHolds every interval until ctx ends.
+func SweepHolds(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if _, err := ExpireHolds(); err != nil {
+				log.Printf("[ExpireHolds] sweep failed: %v", err)
+			}
+		}
+	}
+}
+
+func lockHold(ctx context.Context, tx pgx.Tx, id string) (*Hold, error) {
+	var h Hold
+	err := tx.QueryRow(ctx,
+		`SELECT id, name, amount, status, expires_at FROM credit_holds WHERE id = $1 FOR UPDATE`, id).
+		Scan(&h.ID, &h.Name, &h.Amount, &h.Status, &h.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrHoldNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// releaseLocked returns a locked, held hold's credits to its institution.
+func releaseLocked(ctx context.Context, tx pgx.Tx, h *Hold) error {
+	if _, err := tx.Exec(ctx, `UPDATE credits_inst SET credits = credits + $1 WHERE name = $2`, h.Amount, h.Name); err != nil {
+		return err
+	}
+	if err := setHoldStatus(ctx, tx, h.ID, HoldReleased); err != nil {
+		return err
+	}
+	h.Status = HoldReleased
+	return nil
+}
+
+func setHoldStatus(ctx context.Context, tx pgx.Tx, id, status string) error {
+	_, err := tx.Exec(ctx, `UPDATE credit_holds SET status = $1, updated_at = now() WHERE id = $2`, status, id)
+	return err
+}
@@ -0,0 +1,28 @@
+package dbService
+
+// Purchases carry an ID derived from the client's Idempotency-Key. A
+// purchase redelivered by the broker, or retried after the orchestrator
+// timed out waiting for the reply, is recorded once and credited once.
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrPurchaseApplied is returned by BuyCredits for a purchase ID it has
+// already credited.
+var ErrPurchaseApplied = errors.New("purchase already applied")
+
+// EnsurePurchasesTable creates credit_purchases on databases initialised
+// before purchase IDs existed.
+func EnsurePurchasesTable() error {
+	_, err := Pool.Exec(context.Background(), `
+        CREATE TABLE IF NOT EXISTS credit_purchases (
+            id         varchar(64) PRIMARY KEY,
+            name       varchar(255) NOT NULL,
+            amount     integer NOT NULL,
+            created_at timestamptz NOT NULL DEFAULT now()
+        );
+    `)
+	return err
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+
+	"credits_service/dbService"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// InstitutionApprovedEvent is published when a platform admin approves an
+// institution's registration (institution.approved).
+type InstitutionApprovedEvent struct {
+	Name            string `json:"name"`
+	StartingCredits int    `json:"starting_credits"`
+}
+
+// InstitutionApprovedHandler opens the credits account of a newly approved
+// institution and replies once it is open. The event may be delivered more
+// than once, so an account that already exists is left as it is.
+func InstitutionApprovedHandler(d amqp.Delivery, ch *amqp.Channel) {
+	var ev InstitutionApprovedEvent
+	if err := json.Unmarshal(d.Body, &ev); err != nil || ev.Name == "" || ev.StartingCredits < 0 {
+		log.Printf("Invalid institution.approved event (%v): %s", err, d.Body)
+		d.Nack(false, false)
+		return
+	}
+
+	_, err := dbService.NewInstitution(ev.Name, ev.StartingCredits)
+	switch {
+	case errors.Is(err, dbService.ErrInstitutionExists):
+		log.Printf("Account for %q already open", ev.Name)
+	case err != nil:
+		log.Printf("DB error opening account for %q: %v", ev.Name, err)
+		publishReply(ch, d, Response{Status: "error", Message: "Could not open the institution's account"})
+		// The caller retries with backoff; requeueing here would spin on a
+		// failing database
+		if d.ReplyTo != "" {
+			d.Ack(false)
+		} else {
+			d.Nack(false, false)
+		}
+		return
+	default:
+		log.Printf("Opened account for %q with %d credits", ev.Name, ev.StartingCredits)
+	}
+	publishReply(ch, d, Response{Status: "ok", Message: "Institution account open"})
+	d.Ack(false)
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 
 	"credits_service/dbService"
@@ -34,6 +35,18 @@ func AvailableHandler(d amqp.Delivery, ch *amqp.Channel) {
 	}
 
 	credits, err := dbService.AvailableCredits(req.Name)
+	if errors.Is(err, dbService.ErrUnknownInstitution) {
+		// not worth a retry or the DLQ: the institution is not approved
+		if pubErr := publishAvailableReply(ch, d, AvailableResp{
+			Status:      "error",
+			Message:     "No credits account: the institution is not approved",
+			ErrorDetail: err.Error(),
+		}); pubErr != nil {
+			log.Printf("Failed to publish reply: %v", pubErr)
+		}
+		d.Ack(false)
+		return
+	}
 	if err != nil {
 		log.Printf("DB error in AvailableHandler: %v", err)
 		sendAvailableReplyAndNack(ch, d, AvailableResp{
@@ -3,6 +3,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 
 	"credits_service/dbService"
@@ -14,6 +15,8 @@ import (
 type BuyReq struct {
 	Name   string `json:"name"`
 	Amount int    `json:"amount"`
+	// PurchaseID makes a repeated purchase a no-op (optional)
+	PurchaseID string `json:"purchase_id,omitempty"`
 }
 
 type BuyResponse struct {
@@ -35,7 +38,27 @@ func HandleBuy(d amqp.Delivery, ch *amqp.Channel) {
 		return
 	}
 
-	success, err := dbService.BuyCredits(req.Name, req.Amount)
+	success, err := dbService.BuyCredits(req.Name, req.Amount, req.PurchaseID)
+	if errors.Is(err, dbService.ErrPurchaseApplied) {
+		// a redelivery or a retry: the first delivery credited the account
+		if pubErr := publishBuyReply(ch, d, BuyResponse{Status: "ok", Message: "Credits purchased successfully"}); pubErr != nil {
+			log.Printf("Failed to publish reply: %v", pubErr)
+		}
+		d.Ack(false)
+		return
+	}
+	if errors.Is(err, dbService.ErrUnknownInstitution) {
+		// not worth a retry or the DLQ: the institution is not approved
+		if pubErr := publishBuyReply(ch, d, BuyResponse{
+			Status:      "error",
+			Message:     "No credits account: the institution is not approved",
+			ErrorDetail: err.Error(),
+		}); pubErr != nil {
+			log.Printf("Failed to publish reply: %v", pubErr)
+		}
+		d.Ack(false)
+		return
+	}
 	if err != nil {
 		log.Printf("DB error during BuyCredits: %v", err)
 		sendBuyReplyAndNack(ch, d, BuyResponse{
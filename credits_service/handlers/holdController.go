@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"credits_service/dbService"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// defaultHoldTTL applies when credits.hold does not say how long to keep
+// the reservation.
+const defaultHoldTTL = 30 * time.Minute
+
+// HoldReq reserves credits (credits.hold).
+type HoldReq struct {
+	HoldID     string `json:"hold_id"`
+	Name       string `json:"name"`
+	Amount     int    `json:"amount"`
+	TTLSeconds int    `json:"ttl_seconds,omitempty"`
+}
+
+// HoldRefReq names the hold to commit or release (credits.hold.commit,
+// credits.hold.release).
+type HoldRefReq struct {
+	HoldID string `json:"hold_id"`
+}
+
+// HoldResponse reports the hold's state. Status is "ok", "insufficient"
+// (not enough credits to hold), "conflict" (the hold cannot make that
+// transition) or "error" (worth retrying).
+type HoldResponse struct {
+	Status    string `json:"status"`
+	Message   string `json:"message"`
+	HoldID    string `json:"hold_id"`
+	State     string `json:"state,omitempty"`
+	Amount    int    `json:"amount,omitempty"`
+	Available *int   `json:"available,omitempty"`
+}
+
+// HoldHandler places a hold.
+func HoldHandler(d amqp.Delivery, ch *amqp.Channel) {
+	defer d.Ack(false)
+
+	var req HoldReq
+	if err := json.Unmarshal(d.Body, &req); err != nil || req.HoldID == "" || req.Amount <= 0 {
+		publishHoldReply(ch, d, HoldResponse{Status: "conflict", Message: "invalid hold request", HoldID: req.HoldID})
+		return
+	}
+	ttl := time.Duration(req.TTLSeconds) * time.Second
+	if ttl <= 0 {
+		ttl = defaultHoldTTL
+	}
+
+	h, available, err := dbService.PlaceHold(req.HoldID, req.Name, req.Amount, ttl)
+	res := holdResponse(req.HoldID, h, err)
+	if errors.Is(err, dbService.ErrInsufficient) || (err == nil && available > 0) {
+		res.Available = &available
+	}
+	publishHoldReply(ch, d, res)
+}
+
+// CommitHoldHandler turns a hold into a spend.
+func CommitHoldHandler(d amqp.Delivery, ch *amqp.Channel) {
+	defer d.Ack(false)
+
+	var req HoldRefReq
+	if err := json.Unmarshal(d.Body, &req); err != nil || req.HoldID == "" {
+		publishHoldReply(ch, d, HoldResponse{Status: "conflict", Message: "invalid hold reference"})
+		return
+	}
+	h, err := dbService.CommitHold(req.HoldID)
+	publishHoldReply(ch, d, holdResponse(req.HoldID, h, err))
+}
+
+// ReleaseHoldHandler gives a hold's credits back.
+func ReleaseHoldHandler(d amqp.Delivery, ch *amqp.Channel) {
+	defer d.Ack(false)
+
+	var req HoldRefReq
+	if err := json.Unmarshal(d.Body, &req); err != nil || req.HoldID == "" {
+		publishHoldReply(ch, d, HoldResponse{Status: "conflict", Message: "invalid hold reference"})
+		return
+	}
+	h, err := dbService.ReleaseHold(req.HoldID)
+	publishHoldReply(ch, d, holdResponse(req.HoldID, h, err))
+}
+
+func holdResponse(id string, h *dbService.Hold, err error) HoldResponse {
+	res := HoldResponse{HoldID: id}
+	if h != nil {
+		res.State, res.Amount = h.Status, h.Amount
+	}
+	switch {
+	case err == nil:
+		res.Status, res.Message = "ok", "hold "+res.State
+	case errors.Is(err, dbService.ErrInsufficient):
+		res.Status, res.Message = "insufficient", err.Error()
+	case errors.Is(err, dbService.ErrUnknownInstitution),
+		errors.Is(err, dbService.ErrHoldNotFound),
+		errors.Is(err, dbService.ErrHoldMismatch),
+		errors.Is(err, dbService.ErrHoldReleased),
+		errors.Is(err, dbService.ErrHoldCommitted):
+		res.Status, res.Message = "conflict", err.Error()
+	default:
+		log.Printf("[Hold] %s: %v", id, err)
+		res.Status, res.Message = "error", "could not update the hold"
+	}
+	return res
+}
+
+func publishHoldReply(ch *amqp.Channel, d amqp.Delivery, res HoldResponse) {
+	if d.ReplyTo == "" {
+		return
+	}
+	body, err := json.Marshal(res)
+	if err != nil {
+		log.Printf("[Hold] Failed to marshal response: %v", err)
+		return
+	}
+	if err := ch.Publish("", d.ReplyTo, false, false, amqp.Publishing{
+		ContentType:   "application/json",
+		CorrelationId: d.CorrelationId,
+		Body:          body,
+	}); err != nil {
+		log.Printf("[Hold] Failed to publish reply: %v", err)
+	}
+}
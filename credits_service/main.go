@@ -2,12 +2,17 @@
 package main
 
 import (
+	"context"
 	"credits_service/dbService"
 	"credits_service/handlers"
+	"credits_service/health"
+	"credits_service/metrics"
+	"credits_service/tracing"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
 	amqp "github.com/rabbitmq/amqp091-go"
@@ -24,7 +29,18 @@ func main() {
 		log.Println("No .env file found; relying on system enviroment variables")
 	}
 
+	defer tracing.Init()()
+	metrics.Serve()
+
 	dbService.InitDB()
+	if err := dbService.EnsureHoldsTable(); err != nil {
+		log.Fatalf("Failed to create credit_holds: %v", err)
+	}
+	if err := dbService.EnsurePurchasesTable(); err != nil {
+		log.Fatalf("Failed to create credit_purchases: %v", err)
+	}
+	// Holds the orchestrator never settles are released after they expire
+	go dbService.SweepHolds(context.Background(), time.Minute)
 
 	rmqURL := os.Getenv("RABBITMQ_URL")
 
@@ -46,6 +62,10 @@ func main() {
 		"credits.purchased",
 		"credits.avail",
 		"add.new",
+		"credits.hold",
+		"credits.hold.commit",
+		"credits.hold.release",
+		"institution.approved",
 	}
 
 	err = ch.ExchangeDeclare(
@@ -117,6 +137,12 @@ func main() {
 func worker(id int, msgs <-chan amqp.Delivery, ch *amqp.Channel) {
 	log.Printf("Worker %d ready", id)
 	for d := range msgs {
+		if health.IsPing(d) {
+			health.Pong(ch, d)
+			continue
+		}
+		_, span := tracing.StartConsume(d)
+		done := metrics.Track(&d)
 		switch d.RoutingKey {
 		case "credits.spent":
 			handlers.Spending(d, ch)
@@ -126,9 +152,19 @@ func worker(id int, msgs <-chan amqp.Delivery, ch *amqp.Channel) {
 			handlers.AvailableHandler(d, ch)
 		case "add.new":
 			handlers.AddInstitutionHandler(d, ch)
+		case "credits.hold":
+			handlers.HoldHandler(d, ch)
+		case "credits.hold.commit":
+			handlers.CommitHoldHandler(d, ch)
+		case "credits.hold.release":
+			handlers.ReleaseHoldHandler(d, ch)
+		case "institution.approved":
+			handlers.InstitutionApprovedHandler(d, ch)
 		default:
 			log.Printf("Worker %d: unknown key %q", id, d.RoutingKey)
 			d.Nack(false, false)
 		}
+		done()
+		span.End()
 	}
 }
@@ -10,6 +10,7 @@ const amqp           = require('amqplib');
 const mongoose       = require('mongoose');
 const { MongoClient } = require('mongodb');
 const XLSX           = require('xlsx');
+const { loadWorkbook } = require('./blob');
 
 /* const {
   MONGO_URI,
@@ -70,14 +71,22 @@ if (missingVars.length > 0) {
   const creditsDb = creditsClient.db('final_grades');
   const creditsColl = creditsDb.collection('credits');
 
-  const Grade = mongoose.model('Grade', new mongoose.Schema({
+  const gradeSchema = new mongoose.Schema({
     AM: String, name: String, email: String,
     declarationPeriod: String, classTitle: String,
     gradingScale: String, grade: Number,
     Q1: Number, Q2: Number, Q3: Number, Q4: Number,
     Q5: Number, Q6: Number, Q7: Number, Q8: Number,
-    Q9: Number, Q10: Number
-  }));
+    Q9: Number, Q10: Number,
+    // sheets sent by the orchestrator's saga: one row per (sagaId, row)
+    sagaId: String, row: Number
+  });
+  gradeSchema.index(
+    { sagaId: 1, row: 1 },
+    { unique: true, partialFilterExpression: { sagaId: { $exists: true } } }
+  );
+  const Grade = mongoose.model('Grade', gradeSchema);
+  await Grade.syncIndexes();
 
   // Connect to RabbitMQ
   let conn, channel;
@@ -91,6 +100,17 @@ if (missingVars.length > 0) {
     process.exit(1);
   }
 
+  // The orchestrator sends a sheet again under the same saga_id when it got
+  // no answer; those rows are upserted so a resend stores nothing twice.
+  const sagaIdOf = msg => {
+    if ((msg.properties.contentType || '').toLowerCase().trim() !== 'application/json') return '';
+    try {
+      return JSON.parse(msg.content.toString()).saga_id || '';
+    } catch {
+      return '';
+    }
+  };
+
   const makeReply = msg => payload => {
     const { replyTo, correlationId } = msg.properties;
     if (!replyTo) return;
@@ -118,12 +138,8 @@ if (missingVars.length > 0) {
       console.log('📩  Received grade message');
       const reply = makeReply(msg);
 
-      const ct = (msg.properties.contentType || '').toLowerCase().trim();
-      const buffer = (ct.includes('spreadsheet') || ct === 'application/octet-stream')
-        ? msg.content
-        : Buffer.from(msg.content.toString(), 'base64');
-
       try {
+        const buffer = await loadWorkbook(msg);   // claim check → .xlsx bytes
         const wb   = XLSX.read(buffer, { type: 'buffer' });
         const rows = XLSX.utils.sheet_to_json(wb.Sheets[wb.SheetNames[0]], {
           header: 1, raw: false
@@ -160,27 +176,26 @@ if (missingVars.length > 0) {
           return d;
         });
 
-        const firstAM = docs[0]?.AM || '';
-        let org = null;
-        if (firstAM.startsWith('031')) org = 'NTUA';
-        else if (firstAM.startsWith('022')) org = 'EKPA';
-
-        if (org) {
-          const upd = await creditsColl.updateOne(
-            { name: org }, { $inc: { cred: -1 } }
-          );
-          console.log(upd.matchedCount
-            ? `➖  Decremented credit for ${org}`
-            : `⚠️  No credit document for ${org}`);
+        // Publication is paid for by the orchestrator's credit hold; this
+        // worker no longer charges anything itself
+        const sagaId = sagaIdOf(msg);
+        if (sagaId) {
+          const res = await Grade.bulkWrite(docs.map((d, row) => ({
+            updateOne: {
+              filter: { sagaId, row },
+              update: { $setOnInsert: { ...d, sagaId, row } },
+              upsert: true
+            }
+          })), { ordered: false });
+          const already = docs.length - res.upsertedCount;
+          console.log(`✅  Inserted ${res.upsertedCount} grades for saga ${sagaId}` +
+            (already ? ` (${already} already stored)` : ''));
+          reply({ status: 'ok', message: `Inserted ${res.upsertedCount}` });
         } else {
-          console.warn('⚠️  Unknown organization for AM:', firstAM);
+          const res = await Grade.insertMany(docs, { ordered: false });
+          console.log(`✅  Inserted ${res.length} grades`);
+          reply({ status: 'ok', message: `Inserted ${res.length}` });
         }
-
-        // const upd = await creditsColl.updateOne(
-        //     { name: "NTUA" }, { $inc: { cred: -1 } })
-        const res = await Grade.insertMany(docs, { ordered: false });
-        console.log(`✅  Inserted ${res.length} grades`);
-        reply({ status: 'ok', message: `Inserted ${res.length}` });
         channel.ack(msg);
 
       } catch (err) {
@@ -2,12 +2,12 @@
 
 // NOTE: in your browser, "orchestrator" isn't a DNS name.
 // Use localhost:8080 (or adjust if you run the orchestrator elsewhere).
-const API_BASE = 'http://localhost:8080';
+export const API_BASE = 'http://localhost:8080';
 
 /**
  * Read the JWT from localStorage (or cookie fallback).
  */
-function getJWT() {
+export function getJWT() {
   const fromLS = window.localStorage?.getItem('jwt');
   if (fromLS) return fromLS;
   const m = document.cookie.match(/(?:^|;\s*)jwt=([^;]+)/);
@@ -52,7 +52,10 @@ export async function request(path, { method = 'GET', body, headers } = {}) {
   const json = await res.json().catch(() => ({}));
 
   if (!res.ok) {
-    throw new Error(json.message || json.error || res.statusText);
+    const err = new Error(json.message || json.error || res.statusText);
+    err.status = res.status;
+    err.body = json;                               // e.g. the 422 cell report
+    throw err;
   }
   return json;
 }
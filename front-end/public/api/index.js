@@ -5,3 +5,4 @@ export * from './personal.js';
 export * from './student.js';
 export * from './instructor.js';
 export * from './users.js';
+export * from './jobs.js';
@@ -13,6 +13,39 @@ export const uploadInitialGrades = file => {
   return request('/upload_init', { method: 'POST', body: fd });
 };
 
-// ← new helper:
-export const getInstitutions = () =>
-  request('/institutions', { method: 'GET' });
+/**
+ * One page of the institution directory:
+ * { institutions, total, page, page_size }.
+ * params: { search, sort, order, page, page_size }
+ */
+export const getInstitutions = (params = {}) =>
+  request('/institutions', { method: 'GET', body: params });
+
+export const getInstitution = name =>
+  request(`/institutions/${encodeURIComponent(name)}`, { method: 'GET' });
+
+/**
+ * Every registered institution, by name, fetched page by page.
+ */
+export const getAllInstitutions = async () => {
+  const all = [];
+  for (let page = 1; ; page++) {
+    const res = await getInstitutions({ page, page_size: 100 });
+    all.push(...res.institutions);
+    if (!res.institutions.length || all.length >= res.total) return all;
+  }
+};
+
+/**
+ * Add a student or instructor to the caller's own institution, which the
+ * server reads from the caller's account.
+ * @param {{ username: string, password: string, role: string, student_id?: string }} payload
+ */
+export const createMember = ({ username, password, role, student_id }) =>
+  request('/institution/users', {
+    method: 'POST',
+    body  : { username, password, role, student_id }
+  }).then(response => {
+    if (response.error) throw new Error(response.error);
+    return response;
+  });
@@ -0,0 +1,17 @@
+// jobs.js
+import { request } from './_request.js';
+
+/**
+ * Poll an upload job until it succeeds or fails.
+ * (EventSource cannot send the JWT header, so we poll GET /jobs/:id.)
+ * @param {string} id          job_id from the 202 response
+ * @param {(job) => void} [onUpdate]  called with every state seen
+ */
+export async function waitForJob(id, onUpdate = () => {}, intervalMs = 1000) {
+  for (;;) {
+    const job = await request(`/jobs/${encodeURIComponent(id)}`);
+    onUpdate(job);
+    if (job.state === 'succeeded' || job.state === 'failed') return job;
+    await new Promise(r => setTimeout(r, intervalMs));
+  }
+}
@@ -0,0 +1,45 @@
+// notifications.js
+import { API_BASE, getJWT } from './_request.js';
+
+/**
+ * Follow the caller's live notifications.
+ * orchestrator: GET /notifications/stream (server-sent "notification" events)
+ * (EventSource cannot send the JWT header, so the stream is read with fetch.)
+ * Resolves when the stream ends; rejects with err.status on HTTP errors.
+ * @param {(notification) => void} onNotification
+ * @param {AbortSignal} [signal]
+ */
+export async function streamNotifications(onNotification, signal) {
+  const res = await fetch(API_BASE + '/notifications/stream', {
+    headers: { Authorization: `Bearer ${getJWT()}`, Accept: 'text/event-stream' },
+    signal
+  });
+  if (!res.ok) {
+    const err = new Error(res.statusText);
+    err.status = res.status;
+    throw err;
+  }
+
+  const reader = res.body.pipeThrough(new TextDecoderStream()).getReader();
+  let buffer = '';
+  for (;;) {
+    const { value, done } = await reader.read();
+    if (done) return;
+    buffer += value;
+    // events are separated by a blank line
+    let end;
+    while ((end = buffer.indexOf('\n\n')) >= 0) {
+      const block = buffer.slice(0, end);
+      buffer = buffer.slice(end + 2);
+      let event = 'message';
+      const data = [];
+      for (const line of block.split('\n')) {
+        if (line.startsWith('event:')) event = line.slice(6).trim();
+        else if (line.startsWith('data:')) data.push(line.slice(5).trimStart());
+      }
+      if (event === 'notification' && data.length) {
+        try { onNotification(JSON.parse(data.join('\n'))); } catch { /* malformed */ }
+      }
+    }
+  }
+}
@@ -4,6 +4,8 @@
 // ────────────────────────────────────────────────────────────────
 import { flash }    from '../../script.js';
 import { request }  from '../../api/_request.js';   // ✅ helper injects JWT
+import { waitForJob } from '../../api/jobs.js';
+import { showSheetErrors } from './sheet-errors.js';
 
 const form = document.querySelector('#upload-final-form');
 
@@ -12,20 +14,31 @@ form.addEventListener('submit', async (e) => {
 
   const fileInput = form.querySelector('input[type="file"]');
   if (!fileInput.files.length) {
-    return flash('Please select an XLSX file.');
+    return flash('Please select an XLSX, ODS or CSV file.');
   }
 
   const fd = new FormData();
   fd.append('file', fileInput.files[0]);            // ↔ name="file" in the form
 
+  showSheetErrors(null);
+
   try {
     // ────────────────────────────────────────────────────────────
     // •  PATCH /postFinalGrades  (route guarded for instructors)
     // •  request() adds  Authorization: Bearer <jwt>
     // ────────────────────────────────────────────────────────────
-    await request('/postFinalGrades', { method: 'PATCH', body: fd });
+    // 202 → the sheet is processed in the background; follow the job
+    const { job_id } = await request('/postFinalGrades', { method: 'PATCH', body: fd });
+    flash('Upload queued, processing…');
+    const job = await waitForJob(job_id);
+    if (job.state === 'failed') throw new Error(job.error || 'Upload failed');
     flash('Final grades uploaded ✔');
   } catch (err) {
+    showSheetErrors(err);
+    if (err.status === 402 && err.body) {
+      const { institution, rows, required, available } = err.body;
+      return flash(`Not enough credits: ${rows} rows cost ${required}, ${institution} has ${available}.`);
+    }
     flash(err.message || 'Upload failed');
   }
 });
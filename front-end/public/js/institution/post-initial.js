@@ -4,6 +4,8 @@
 // ─────────────────────────────────────────────────────────────
 import { flash }   from '../../script.js';
 import { request } from '../../api/_request.js';   // ← adds the JWT
+import { waitForJob } from '../../api/jobs.js';
+import { showSheetErrors } from './sheet-errors.js';
 
 const form = document.querySelector('#upload-init-form');
 
@@ -12,17 +14,24 @@ form.addEventListener('submit', async (e) => {
 
   const fileInput = form.querySelector('input[type="file"]');
   if (!fileInput.files.length) {
-    return flash('Please select an XLSX file.');
+    return flash('Please select an XLSX, ODS or CSV file.');
   }
 
   const fd = new FormData();
   fd.append('file', fileInput.files[0]);           // name="file" matches Gin handler
 
+  showSheetErrors(null);
+
   try {
     // The Orchestrator route is a **POST /upload_init** (instructor-only)
-    await request('/upload_init', { method: 'POST', body: fd });
+    // 202 → the sheet is processed in the background; follow the job
+    const { job_id } = await request('/upload_init', { method: 'POST', body: fd });
+    flash('Upload queued, processing…');
+    const job = await waitForJob(job_id);
+    if (job.state === 'failed') throw new Error(job.error || 'Upload failed');
     flash('Initial grades uploaded ✔');
   } catch (err) {
+    showSheetErrors(err);
     flash(err.message || 'Upload failed');
   }
 });
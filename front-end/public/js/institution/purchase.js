@@ -1,14 +1,14 @@
 // public/js/institution/purchase.js
 import { flash } from '../../script.js';
 import { purchaseCredits } from '../../api/credits.js';
-import { getInstitutions } from '../../api/institution.js';
+import { getAllInstitutions } from '../../api/institution.js';
 
 console.log('🛠️ purchase.js loaded');
 
 async function populateInstitutions() {
   const select = document.querySelector('#inst-name');
   try {
-    const list = await getInstitutions();
+    const list = await getAllInstitutions();
     // clear placeholder
     select.innerHTML = '<option value="">– choose an institution –</option>';
     list.forEach(inst => {
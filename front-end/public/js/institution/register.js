@@ -14,7 +14,7 @@ form.addEventListener('submit', async e => {
   try {
     // pass a plain object—let your _request.js helper JSON.stringify it
     await registerInstitution({ name, email, director });
-    flash('Institution registered!');
+    flash('Registration submitted; you will be notified once a platform admin reviews it.');
   } catch (err) {
     flash(err.message);
   }
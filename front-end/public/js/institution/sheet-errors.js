@@ -0,0 +1,29 @@
+// front-end/public/js/institution/sheet-errors.js
+//
+// Lists the cells the orchestrator rejected (422) under the upload form
+// ─────────────────────────────────────────────────────────────
+
+/**
+ * Render err.body.errors into #sheet-errors, or clear the list when err
+ * carries no report (pass null before a new upload).
+ */
+export function showSheetErrors(err) {
+  const list = document.querySelector('#sheet-errors');
+  if (!list) return;
+  list.replaceChildren();
+
+  const errors = err?.status === 422 ? err.body?.errors || [] : [];
+  list.hidden = errors.length === 0;
+
+  for (const e of errors) {
+    const li = document.createElement('li');
+    const where = e.cell ? `${e.cell} (${e.column})` : `Row ${e.row}`;
+    li.textContent = `${where}: ${e.message}` + (e.value ? ` – “${e.value}”` : '');
+    list.appendChild(li);
+  }
+  if (err?.body?.truncated) {
+    const li = document.createElement('li');
+    li.textContent = '… more problems not shown; fix these and upload again.';
+    list.appendChild(li);
+  }
+}
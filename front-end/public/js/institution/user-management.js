@@ -1,5 +1,6 @@
 import { flash } from '../../script.js';
-import { registerUser, changePassword } from '../../api/users.js';
+import { changePassword } from '../../api/users.js';
+import { createMember } from '../../api/institution.js';
 
 const form            = document.querySelector('#user-mgmt-form');
 const roleSelect      = document.querySelector('#role');
@@ -27,7 +28,8 @@ form.addEventListener('submit', async e => {
   }
 
   try {
-    await registerUser({ username, password, role, student_id });
+    // Uploads by the new user are billed to the representative's institution
+    await createMember({ username, password, role, student_id });
     flash('User added!');
     form.reset();
     studentIdGroup.style.display = 'none';
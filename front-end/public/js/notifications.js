@@ -0,0 +1,28 @@
+// front-end/public/js/notifications.js
+// Shows live notifications (review replies, new review requests, published
+// grades, low credits) on every page of a logged-in user.
+import { flash } from '../script.js';
+import { getJWT } from '../api/_request.js';
+import { streamNotifications } from '../api/notifications.js';
+
+const MAX_DELAY = 30000;
+
+async function follow() {
+  let delay = 1000;
+  while (getJWT()) {
+    try {
+      await streamNotifications(n => {
+        delay = 1000;
+        flash(n.message);
+      });
+    } catch (err) {
+      // expired or missing token: stop until the next login
+      if (err.status === 401 || err.status === 403) return;
+      console.warn('[notifications]', err.message);
+    }
+    await new Promise(r => setTimeout(r, delay));
+    delay = Math.min(delay * 2, MAX_DELAY);
+  }
+}
+
+window.addEventListener('DOMContentLoaded', follow);
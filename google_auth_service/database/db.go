@@ -1,6 +1,7 @@
 package database
 
 import (
+	"google_auth_service/metrics"
 	"log"
 
 	"gorm.io/driver/sqlite"
@@ -15,6 +16,7 @@ func ConnectDatabase() {
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
+	metrics.WatchGorm(DB)
 
 	// Migrate the User model with student_id field
 	DB.AutoMigrate(&User{})
@@ -40,12 +40,7 @@ func init() {
 
 // helper to validate role - default Google users to representative
 func normalizeRole(r string) string {
-	switch r {
-	case "student", "instructor", "institution_representative":
-		return r
-	default:
-		return "institution_representative" // Changed from "student" to "institution_representative"
-	}
+	return utils.SignupRole(r)
 }
 
 // generateStudentID creates a unique student ID for new student users
@@ -123,18 +118,22 @@ func GoogleCallbackHandler(w http.ResponseWriter, r *http.Request) {
 	if result.Error != nil {
 		// Create new user - no student_id for representatives
 		user = database.User{
-			Email:     email,
-			Name:      name,
-			Picture:   picture,
-			Provider:  "google",
-			Role:      role,
-			StudentID: studentID, // Will be empty for representatives
+			Email:       email,
+			Name:        name,
+			Picture:     picture,
+			Provider:    "google",
+			Role:        role,
+			StudentID:   studentID, // Will be empty for representatives
+			Institution: utils.InstitutionFor(email),
 		}
 		database.DB.Create(&user)
 	} else {
 		// Update existing user
 		user.Name = name
 		user.Picture = picture
+		if user.Institution == "" {
+			user.Institution = utils.InstitutionFor(email)
+		}
 		if user.Role != role {
 			user.Role = role
 			// Only generate student_id if role is student
@@ -151,7 +150,7 @@ func GoogleCallbackHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Generate JWT with student_id only for students
 	userIDStr := strconv.Itoa(int(user.ID))
-	jwtToken, err := utils.GenerateJWT(userIDStr, email, user.Role, studentID)
+	jwtToken, err := utils.GenerateJWT(userIDStr, email, user.Role, studentID, user.Institution)
 	if err != nil {
 		http.Error(w, "Failed to generate JWT: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -180,9 +179,10 @@ func GoogleCallbackHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	upsertPayload := map[string]interface{}{
-		"username":   email, // Use email as username for Google users
-		"role":       user.Role,
-		"student_id": user.StudentID,
+		"username":    email, // Use email as username for Google users
+		"role":        user.Role,
+		"student_id":  user.StudentID,
+		"institution": user.Institution,
 	}
 
 	buf, _ := json.Marshal(upsertPayload)
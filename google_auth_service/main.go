@@ -8,8 +8,10 @@ import (
 
 	"google_auth_service/database"
 	"google_auth_service/handlers"
+	"google_auth_service/metrics"
 	"google_auth_service/middlewares"
 	"google_auth_service/rabbitmq"
+	"google_auth_service/tracing"
 
 	"github.com/joho/godotenv"
 )
@@ -38,6 +40,9 @@ func main() {
 	log.Printf("Google Client ID: %s", os.Getenv("GOOGLE_CLIENT_ID"))
 	log.Printf("Redirect URL: %s", os.Getenv("GOOGLE_REDIRECT_URL"))
 
+	defer tracing.Init()()
+	metrics.Serve()
+
 	database.ConnectDatabase()
 	rabbitmq.Connect()
 	rabbitmq.StartGoogleAuthConsumer()
@@ -0,0 +1,104 @@
+package metrics
+
+// Consumer metrics of google_auth_service (handling time and settlement per routing
+// key) and failed gorm statements, served at /metrics on METRICS_ADDR
+// (default :9100).
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var (
+	labels = prometheus.Labels{"service": "google_auth_service"}
+
+	handleDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace:   "clearsky",
+		Subsystem:   "consumer",
+		Name:        "handle_duration_seconds",
+		Help:        "Time spent handling one delivery, by routing key.",
+		ConstLabels: labels,
+		Buckets:     prometheus.DefBuckets,
+	}, []string{"routing_key"})
+
+	deliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   "clearsky",
+		Subsystem:   "consumer",
+		Name:        "deliveries_total",
+		Help:        "Deliveries settled, by routing key and outcome (ack, nack, requeue).",
+		ConstLabels: labels,
+	}, []string{"routing_key", "outcome"})
+
+	dbErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   "clearsky",
+		Subsystem:   "db",
+		Name:        "errors_total",
+		Help:        "Failed database operations.",
+		ConstLabels: labels,
+	}, []string{"operation"})
+)
+
+// Serve exposes /metrics in the background.
+func Serve() {
+	addr := os.Getenv("METRICS_ADDR")
+	if addr == "" {
+		addr = ":9100"
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	go func() {
+		log.Printf("[Metrics] serving /metrics on %s", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Printf("[Metrics] server stopped: %v", err)
+		}
+	}()
+}
+
+// Track counts how d is settled and returns the function recording its
+// handling time. Call it before dispatching d.
+func Track(d *amqp.Delivery) func() {
+	start := time.Now()
+	d.Acknowledger = &counter{Acknowledger: d.Acknowledger, key: d.RoutingKey}
+	return func() {
+		handleDuration.WithLabelValues(d.RoutingKey).Observe(time.Since(start).Seconds())
+	}
+}
+
+// dbError counts a failed database operation.
+func dbError(operation string) {
+	dbErrors.WithLabelValues(operation).Inc()
+}
+
+type counter struct {
+	amqp.Acknowledger
+	key string
+}
+
+func (c *counter) Ack(tag uint64, multiple bool) error {
+	deliveries.WithLabelValues(c.key, "ack").Inc()
+	return c.Acknowledger.Ack(tag, multiple)
+}
+
+func (c *counter) Nack(tag uint64, multiple, requeue bool) error {
+	deliveries.WithLabelValues(c.key, outcome(requeue)).Inc()
+	return c.Acknowledger.Nack(tag, multiple, requeue)
+}
+
+func (c *counter) Reject(tag uint64, requeue bool) error {
+	deliveries.WithLabelValues(c.key, outcome(requeue)).Inc()
+	return c.Acknowledger.Reject(tag, requeue)
+}
+
+func outcome(requeue bool) string {
+	if requeue {
+		return "requeue"
+	}
+	return "nack"
+}
@@ -4,6 +4,9 @@ import (
 	"context"
 	"encoding/json"
 	"google_auth_service/database"
+	"google_auth_service/health"
+	"google_auth_service/metrics"
+	"google_auth_service/tracing"
 	"google_auth_service/utils"
 	"log"
 	"net/http"
@@ -76,8 +79,16 @@ func StartGoogleAuthConsumer() {
 
 	go func() {
 		for d := range msgs {
+			if health.IsPing(d) {
+				health.Pong(ch, d)
+				continue
+			}
+			ctx, span := tracing.StartConsume(d)
+			done := metrics.Track(&d)
 			var req GoogleAuthRequest
 			if err := json.Unmarshal(d.Body, &req); err != nil {
+				done()
+				tracing.End(span, err)
 				continue
 			}
 
@@ -94,10 +105,7 @@ func StartGoogleAuthConsumer() {
 				var user database.User
 				result := database.DB.First(&user, "email = ?", email)
 
-				role := req.Role
-				if role == "" {
-					role = "institution_representative" // Default for Google users
-				}
+				role := utils.SignupRole(req.Role) // institution_representative by default
 
 				var studentID string
 				if result.Error != nil {
@@ -106,13 +114,19 @@ func StartGoogleAuthConsumer() {
 						studentID = generateStudentID()
 					}
 					user = database.User{
-						Email:     email,
-						Role:      role,
-						StudentID: studentID,
-						Provider:  "google",
+						Email:       email,
+						Role:        role,
+						StudentID:   studentID,
+						Provider:    "google",
+						Institution: utils.InstitutionFor(email),
 					}
 					database.DB.Create(&user)
 				} else {
+					if user.Institution == "" {
+						if user.Institution = utils.InstitutionFor(email); user.Institution != "" {
+							database.DB.Save(&user)
+						}
+					}
 					// Only use student_id for students
 					if user.Role == "student" {
 						studentID = user.StudentID
@@ -125,7 +139,7 @@ func StartGoogleAuthConsumer() {
 				}
 
 				userIDStr := strconv.Itoa(int(user.ID))
-				token, _ := utils.GenerateJWT(userIDStr, email, role, studentID)
+				token, _ := utils.GenerateJWT(userIDStr, email, role, studentID, user.Institution)
 				resp.Status = "ok"
 				resp.Token = token
 				resp.Email = email
@@ -138,6 +152,7 @@ func StartGoogleAuthConsumer() {
 				ch.Publish(
 					"", d.ReplyTo, false, false,
 					amqp.Publishing{
+						Headers:       tracing.Inject(ctx, nil),
 						ContentType:   "application/json",
 						CorrelationId: d.CorrelationId,
 						Body:          body,
@@ -145,6 +160,8 @@ func StartGoogleAuthConsumer() {
 				)
 			}
 			d.Ack(false)
+			done()
+			span.End()
 		}
 	}()
 }
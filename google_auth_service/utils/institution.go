@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"os"
+	"strings"
+)
+
+// InstitutionFor maps the email domain to an institution using
+// INSTITUTION_DOMAINS, e.g. "ntua.gr=NTUA,uoa.gr=UoA". Subdomains match
+// their parent (mail.ntua.gr → NTUA); unknown domains give "".
+func InstitutionFor(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return ""
+	}
+	domain := strings.ToLower(email[at+1:])
+	for _, pair := range strings.Split(os.Getenv("INSTITUTION_DOMAINS"), ",") {
+		d, name, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			continue
+		}
+		d = strings.ToLower(strings.TrimSpace(d))
+		if domain == d || strings.HasSuffix(domain, "."+d) {
+			return strings.TrimSpace(name)
+		}
+	}
+	return ""
+}
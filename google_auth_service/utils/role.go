@@ -0,0 +1,13 @@
+package utils
+
+// SignupRole returns r if a Google user may pick it, and
+// institution_representative, the Google default, otherwise. platform_admin
+// is never granted by signing in.
+func SignupRole(r string) string {
+	switch r {
+	case "student", "instructor", "institution_representative":
+		return r
+	default:
+		return "institution_representative"
+	}
+}
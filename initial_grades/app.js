@@ -7,6 +7,7 @@ const amqp           = require('amqplib');
 const mongoose       = require('mongoose');
 const { MongoClient } = require('mongodb');
 const XLSX           = require('xlsx');
+const { loadWorkbook } = require('./blob');
 
 
 
@@ -119,12 +120,8 @@ if (missingVars.length > 0) {
       console.log('📩  Received grade message');
       const reply = makeReply(msg);
 
-      const ct = (msg.properties.contentType || '').toLowerCase().trim();
-      const buffer = (ct.includes('spreadsheet') || ct === 'application/octet-stream')
-        ? msg.content
-        : Buffer.from(msg.content.toString(), 'base64');
-
       try {
+        const buffer = await loadWorkbook(msg);   // claim check → .xlsx bytes
         const wb   = XLSX.read(buffer, { type: 'buffer' });
         const rows = XLSX.utils.sheet_to_json(wb.Sheets[wb.SheetNames[0]], {
           header: 1, raw: false
@@ -0,0 +1,49 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"instructor_review_reply_service/db"
+	"instructor_review_reply_service/metrics"
+)
+
+// GetCourseInstructors lists the instructors of a course, so the
+// orchestrator can notify them about new review requests.
+func GetCourseInstructors(body map[string]interface{}) (string, error) {
+
+	// input send by orchestrator in json form like:
+	//{
+	//"body": {
+	//  "course_id": "101"
+	//}
+	//
+	// output: {"instructors": ["instructor"]}
+
+	courseID, ok := body["course_id"].(string)
+	if !ok {
+		return "", fmt.Errorf("missing course_id")
+	}
+
+	rows, err := db.DB.Query(`SELECT DISTINCT instructor_name FROM instructors WHERE course_id = $1`, courseID)
+	if err != nil {
+		metrics.DBError("get_course_instructors")
+		return "", fmt.Errorf("failed to query instructors")
+	}
+	defer rows.Close()
+
+	instructors := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return "", fmt.Errorf("failed to read instructors")
+		}
+		instructors = append(instructors, name)
+	}
+	if err := rows.Err(); err != nil {
+		metrics.DBError("get_course_instructors")
+		return "", fmt.Errorf("failed to read instructors")
+	}
+
+	resBytes, _ := json.Marshal(map[string]interface{}{"instructors": instructors})
+	return string(resBytes), nil
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"instructor_review_reply_service/db"
+	"instructor_review_reply_service/metrics"
 	"log"
 )
 
@@ -29,6 +30,7 @@ func GetReviewRequestList(body map[string]interface{}) (string, error) {
 	`
 	rows, err := db.DB.Query(q, username)
 	if err != nil {
+		metrics.DBError("review_request_list")
 		log.Printf("GetReviewRequestList: course_id query error: %v", err)
 		return "", fmt.Errorf("course_id query error: %v", err)
 	}
@@ -44,6 +46,7 @@ func GetReviewRequestList(body map[string]interface{}) (string, error) {
 		courseIDs = append(courseIDs, cid)
 	}
 	if err := rows.Err(); err != nil {
+		metrics.DBError("review_request_list")
 		log.Printf("GetReviewRequestList: course_id rows iteration error: %v", err)
 	}
 
@@ -73,6 +76,7 @@ func GetReviewRequestList(body map[string]interface{}) (string, error) {
 
 		reviewRows, err := db.DB.Query(reviewQuery, courseID)
 		if err != nil {
+			metrics.DBError("review_request_list")
 			log.Printf("GetReviewRequestList: review query error for course_id=%s: %v", courseID, err)
 			continue
 		}
@@ -88,6 +92,7 @@ func GetReviewRequestList(body map[string]interface{}) (string, error) {
 			log.Printf("GetReviewRequestList: found request: %+v", summary)
 		}
 		if err := reviewRows.Err(); err != nil {
+			metrics.DBError("review_request_list")
 			log.Printf("GetReviewRequestList: rows iteration error for course_id=%s: %v", courseID, err)
 		}
 		reviewRows.Close()
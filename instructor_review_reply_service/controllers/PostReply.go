@@ -2,8 +2,10 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"instructor_review_reply_service/db"
+	"instructor_review_reply_service/metrics"
 	"log"
 )
 
@@ -67,6 +69,32 @@ func PostReply(body map[string]interface{}) (string, error) {
 
 	log.Printf("PostReply: updating review for student_id=%s, course_id=%s, exam_period=%s", userID, courseID, examPeriod)
 
+	// journalled update for the orchestrator's review workflow
+	if opID := operationID(body); opID != "" {
+		err := replyOnce(opID, instructorReply, instructorAction, userID, courseID, examPeriod)
+		switch {
+		case errors.Is(err, errReviewNotFound), errors.Is(err, errOperationReverted):
+			log.Printf("PostReply: %s: %v", opID, err)
+			failResponse := map[string]interface{}{
+				"error":   err.Error(),
+				"message": "Failed to update instructor response in database on instructor end.",
+			}
+			failRespBytes, _ := json.Marshal(failResponse) // nolint: errcheck
+			return string(failRespBytes), nil
+		case err != nil:
+			metrics.DBError("post_reply")
+			log.Printf("PostReply: update error: %v", err)
+			return "", fmt.Errorf("PostReply: failed to update review: %v", err)
+		}
+		successResponse := map[string]interface{}{
+			"message":      "Instructor response updated successfully on instructor end.",
+			"operation_id": opID,
+		}
+		respBytes, _ := json.Marshal(successResponse) // nolint: errcheck
+		log.Println("PostReply: returning success response to orchestrator")
+		return string(respBytes), nil
+	}
+
 	query := `
 		UPDATE reviews 
 		SET instructor_reply_message = $1,
@@ -77,6 +105,7 @@ func PostReply(body map[string]interface{}) (string, error) {
 	`
 	result, err := db.DB.Exec(query, instructorReply, instructorAction, userID, courseID, examPeriod)
 	if err != nil {
+		metrics.DBError("post_reply")
 		log.Printf("PostReply: update error: %v", err)
 		return "", fmt.Errorf("PostReply: failed to update review: %v", err)
 	}
@@ -85,7 +114,8 @@ func PostReply(body map[string]interface{}) (string, error) {
 	if rowsAffected == 0 {
 		log.Println("PostReply: no rows updated, possible invalid identifiers")
 		failResponse := map[string]interface{}{
-			"message": "Failed to update instructor response in database on student end.",
+			"error":   "Review not found",
+			"message": "Failed to update instructor response in database on instructor end.",
 		}
 		failRespBytes, _ := json.Marshal(failResponse) // nolint: errcheck
 		log.Println("PostReply: returning failure response to orchestrator")
@@ -122,6 +152,9 @@ EXAMPLE OUTPUT
  OR
 
 {
+  "error": "Review not found",
   "message": "Failed to update instructor response in database on instructor end."
 }
+
+With an "operation_id" the update is journalled (see operations.go).
 */
@@ -2,8 +2,10 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"instructor_review_reply_service/db"
+	"instructor_review_reply_service/metrics"
 )
 
 func InsertStudentRequest(body map[string]interface{}) (string, error) {
@@ -14,7 +16,8 @@ func InsertStudentRequest(body map[string]interface{}) (string, error) {
 	//     "exam_period": "spring 2025",
 	//     "course_id": "101",
 	//     "user_id": 42,
-	//     "student_message": "Please recheck my assignment."
+	//     "student_message": "Please recheck my assignment.",
+	//     "operation_id": "6f1c..."   (optional, see operations.go)
 	//   }
 	// }
 
@@ -39,10 +42,35 @@ func InsertStudentRequest(body map[string]interface{}) (string, error) {
 		return "", fmt.Errorf("missing or invalid student_message")
 	}
 
+	// journalled insert for the orchestrator's review workflow
+	if opID := operationID(body); opID != "" {
+		err := insertReviewOnce(opID, userID, courseID, examPeriod, studentMessage)
+		if errors.Is(err, errOperationReverted) {
+			failResponse := map[string]interface{}{
+				"error":   "Insert failed",
+				"message": "Review request was cancelled on instructor end.",
+			}
+			failRespBytes, _ := json.Marshal(failResponse)
+			return string(failRespBytes), nil
+		}
+		if err != nil {
+			metrics.DBError("insert_student_request")
+			fmt.Println("Insert error:", err)
+			return "", fmt.Errorf("failed to insert review")
+		}
+		response := map[string]interface{}{
+			"message":      "Review request submitted successfully on instructor end.",
+			"operation_id": opID,
+		}
+		respBytes, _ := json.Marshal(response)
+		return string(respBytes), nil
+	}
+
 	// add review to db
 	query := `INSERT INTO reviews (student_id, course_id, exam_period, student_message) VALUES ($1, $2, $3, $4)`
 	result, err := db.DB.Exec(query, userID, courseID, examPeriod, studentMessage)
 	if err != nil {
+		metrics.DBError("insert_student_request")
 		fmt.Println("Insert error:", err)
 		return "", fmt.Errorf("failed to insert review")
 	}
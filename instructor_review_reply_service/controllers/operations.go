@@ -0,0 +1,215 @@
+package controllers
+
+// Writes sent by the orchestrator's review workflow carry an operation_id.
+// The first write under an ID is journalled in review_operations together
+// with what it replaced: repeating it is a no-op, and the revertOperation
+// request puts the review back as it was. Reverting an ID that never
+// arrived leaves a tombstone, so the late write is refused instead of
+// landing after the workflow gave up on it.
+//
+// student_request_review_service and instructor_review_reply_service keep
+// identical copies of this file and of db/operations.go, differing only in
+// their imports and operationSide: each service is built as its own module
+// from its own directory (the Dockerfile runs go mod init there), so a
+// package outside it cannot be imported. Change both copies together.
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"instructor_review_reply_service/db"
+	"instructor_review_reply_service/metrics"
+	"log"
+)
+
+// operationSide names this service in revert replies.
+const operationSide = "instructor"
+
+var (
+	errOperationReverted = errors.New("operation was reverted")
+	errReviewNotFound    = errors.New("review not found")
+)
+
+// operationID returns the optional operation_id of a write.
+func operationID(body map[string]interface{}) string {
+	id, _ := body["operation_id"].(string)
+	return id
+}
+
+// beginOperation locks opID's journal entry; done reports that the write
+// was already applied.
+func beginOperation(tx *sql.Tx, opID string) (done bool, err error) {
+	var reverted bool
+	err = tx.QueryRow(`SELECT reverted FROM review_operations WHERE operation_id = $1 FOR UPDATE`, opID).Scan(&reverted)
+	switch {
+	case err == sql.ErrNoRows:
+		return false, nil
+	case err != nil:
+		return false, err
+	case reverted:
+		return true, errOperationReverted
+	}
+	return true, nil
+}
+
+// insertReviewOnce adds a review under opID.
+func insertReviewOnce(opID, userID, courseID, examPeriod, studentMessage string) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	done, err := beginOperation(tx, opID)
+	if err != nil || done {
+		return err
+	}
+
+	var reviewID int
+	err = tx.QueryRow(
+		`INSERT INTO reviews (student_id, course_id, exam_period, student_message) VALUES ($1, $2, $3, $4) RETURNING review_id`,
+		userID, courseID, examPeriod, studentMessage).Scan(&reviewID)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(
+		`INSERT INTO review_operations (operation_id, kind, review_id) VALUES ($1, 'insert', $2)`,
+		opID, reviewID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// replyOnce records the instructor's reply under opID, keeping the reply it
+// replaces.
+func replyOnce(opID, reply, action, userID, courseID, examPeriod string) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	done, err := beginOperation(tx, opID)
+	if err != nil || done {
+		return err
+	}
+
+	var (
+		reviewID   int
+		status     sql.NullString
+		prevReply  sql.NullString
+		prevAction sql.NullString
+		reviewedAt sql.NullTime
+	)
+	err = tx.QueryRow(`
+		SELECT review_id, status, instructor_reply_message, instructor_action, reviewed_at
+		FROM reviews
+		WHERE student_id = $1 AND course_id = $2 AND exam_period = $3
+		LIMIT 1
+		FOR UPDATE`, userID, courseID, examPeriod).
+		Scan(&reviewID, &status, &prevReply, &prevAction, &reviewedAt)
+	if err == sql.ErrNoRows {
+		return errReviewNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO review_operations (operation_id, kind, review_id, prev_status, prev_reply_message, prev_action, prev_reviewed_at)
+		VALUES ($1, 'reply', $2, $3, $4, $5, $6)`,
+		opID, reviewID, status, prevReply, prevAction, reviewedAt); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		UPDATE reviews
+		SET instructor_reply_message = $1,
+			instructor_action = $2,
+			status = 'reviewed',
+			reviewed_at = CURRENT_TIMESTAMP
+		WHERE review_id = $3`, reply, action, reviewID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RevertOperation undoes the write journalled under operation_id.
+func RevertOperation(body map[string]interface{}) (string, error) {
+	opID := operationID(body)
+	if opID == "" {
+		return "", fmt.Errorf("missing or invalid operation_id")
+	}
+
+	if err := revertOnce(opID); err != nil {
+		metrics.DBError("revert_operation")
+		log.Printf("RevertOperation: %s: %v", opID, err)
+		return "", fmt.Errorf("failed to revert operation %s", opID)
+	}
+
+	response := map[string]interface{}{
+		"message":      "Operation reverted on " + operationSide + " end.",
+		"operation_id": opID,
+	}
+	respBytes, _ := json.Marshal(response)
+	return string(respBytes), nil
+}
+
+func revertOnce(opID string) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var (
+		kind       string
+		reviewID   sql.NullInt64
+		status     sql.NullString
+		prevReply  sql.NullString
+		prevAction sql.NullString
+		reviewedAt sql.NullTime
+		reverted   bool
+	)
+	err = tx.QueryRow(`
+		SELECT kind, review_id, prev_status, prev_reply_message, prev_action, prev_reviewed_at, reverted
+		FROM review_operations
+		WHERE operation_id = $1
+		FOR UPDATE`, opID).
+		Scan(&kind, &reviewID, &status, &prevReply, &prevAction, &reviewedAt, &reverted)
+	switch {
+	case err == sql.ErrNoRows:
+		log.Printf("RevertOperation: %s never arrived, leaving a tombstone", opID)
+		if _, err := tx.Exec(
+			`INSERT INTO review_operations (operation_id, kind, reverted) VALUES ($1, 'tombstone', TRUE)`,
+			opID); err != nil {
+			return err
+		}
+		return tx.Commit()
+	case err != nil:
+		return err
+	case reverted:
+		return nil
+	}
+
+	switch kind {
+	case "insert":
+		_, err = tx.Exec(`DELETE FROM reviews WHERE review_id = $1`, reviewID)
+	case "reply":
+		_, err = tx.Exec(`
+			UPDATE reviews
+			SET status = COALESCE($1, 'pending'),
+				instructor_reply_message = $2,
+				instructor_action = $3,
+				reviewed_at = $4
+			WHERE review_id = $5`, status, prevReply, prevAction, reviewedAt, reviewID)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE review_operations SET reverted = TRUE WHERE operation_id = $1`, opID); err != nil {
+		return err
+	}
+	log.Printf("RevertOperation: %s (%s) reverted", opID, kind)
+	return tx.Commit()
+}
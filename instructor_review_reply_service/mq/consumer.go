@@ -3,7 +3,10 @@ package mq
 import (
 	"fmt"
 
+	"instructor_review_reply_service/health"
+	"instructor_review_reply_service/metrics"
 	"instructor_review_reply_service/routes"
+	"instructor_review_reply_service/tracing"
 
 	"github.com/streadway/amqp"
 )
@@ -24,6 +27,8 @@ func StartConsumer() {
 		"instructor.getRequestsList",
 		"instructor.getRequestInfo",
 		"instructor.insertStudentRequest",
+		"instructor.revertOperation",
+		"instructor.getCourseInstructors",
 		"instructor.addCourse",
 	}
 
@@ -79,6 +84,12 @@ func StartConsumer() {
 
 	go func() {
 		for d := range msgs {
+			if health.IsPing(d) {
+				health.Pong(Mqch, d)
+				continue
+			}
+			ctx, span := tracing.StartConsume(d)
+			done := metrics.Track(&d)
 			fmt.Printf("Received message: %s", d.Body)
 
 			response, err := routes.Routing(d.RoutingKey, d.Body)
@@ -97,6 +108,7 @@ func StartConsumer() {
 				amqp.Publishing{
 					ContentType:   "application/json",
 					CorrelationId: d.CorrelationId,
+					Headers:       tracing.Inject(ctx, nil),
 					Body:          []byte(response),
 				},
 			)
@@ -109,6 +121,8 @@ func StartConsumer() {
 				fmt.Printf("Sent reply to %s\n", d.ReplyTo)
 				d.Ack(false)
 			}
+			done()
+			tracing.End(span, err)
 		}
 	}()
 }
@@ -50,6 +50,12 @@ func Routing(routingKey string, messageBody []byte) (string, error) {
 	case "instructor.insertStudentRequest":
 		return controllers.InsertStudentRequest(msg.Body)
 
+	case "instructor.revertOperation":
+		return controllers.RevertOperation(msg.Body)
+
+	case "instructor.getCourseInstructors":
+		return controllers.GetCourseInstructors(msg.Body)
+
 	// route for updating instructors table
 	/* 	case "instructor.addCourse":
 	courseID := msg.Params["course_id"]         // COURSE NAME FROM UPLOAD
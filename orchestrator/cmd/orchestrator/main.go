@@ -1,35 +1,124 @@
 package main
 
 import (
+	"context"
 	"log"
+	"time"
 
+	"orchestrator/internal/blobstore"
 	"orchestrator/internal/config"
+	"orchestrator/internal/events"
+	"orchestrator/internal/handlers"
+	"orchestrator/internal/idempotency"
+	"orchestrator/internal/jobs"
+	"orchestrator/internal/notify"
+	"orchestrator/internal/openapi"
+	"orchestrator/internal/pricing"
 	"orchestrator/internal/rabbitmq"
+	"orchestrator/internal/rbac"
 	"orchestrator/internal/routes"
+	"orchestrator/internal/rpc"
+	"orchestrator/internal/saga"
+	"orchestrator/internal/sessions"
+	"orchestrator/internal/statcache"
+	"orchestrator/internal/telemetry"
+	"orchestrator/internal/workflow"
 )
 
 func main() {
 	// Load config (auto via init)
 	log.Println("Starting Orchestrator...")
 
-	// Connect to RabbitMQ
-	conn, ch := rabbitmq.Connect()
-	defer conn.Close()
-	defer ch.Close()
-
-	// Setup exchanges, queues, bindings
-	if err := rabbitmq.SetupMessaging(ch); err != nil {
-		log.Fatalf("SetupMessaging failed: %v", err)
+	// Tracing: exporter selected by OTEL_TRACES_EXPORTER (otlp, file, none)
+	shutdownTracing, err := telemetry.Init(context.Background(), "orchestrator")
+	if err != nil {
+		log.Fatalf("Tracing setup failed: %v", err)
 	}
+	defer shutdownTracing(context.Background())
+
+	// Connection manager: reconnects with backoff and re-runs the hooks
+	mgr := rabbitmq.NewManager(config.Cfg.RabbitMQ.URL)
+
+	// Shared RPC client used by every HTTP handler; calls to a worker that
+	// stopped answering fail fast once its circuit opens
+	client := rpc.NewClient(mgr, rpc.NewBreakers(config.Cfg.Breakers))
+
+	// Domain event handlers run by the orchestrator consumer
+	reg := events.NewRegistry(config.Cfg.Queue.Name, client)
+	handlers.RegisterEventHandlers(reg, client)
+
+	// Live notifications: this replica's queue is bound to the users with
+	// an open stream here
+	hub := notify.NewHub(config.Cfg.Notifications.Exchange)
 
-	// Start consuming
-	if err := rabbitmq.StartOrchestratorConsumer(ch); err != nil {
-		log.Fatalf("Consumer failed: %v", err)
+	// Grade distributions are cached until a sheet is imported; this
+	// replica hears of imports on its own queue
+	stats, err := statcache.New(config.Cfg.StatsCache)
+	if err != nil {
+		log.Fatalf("Stats cache setup failed: %v", err)
 	}
 
+	// Setup exchanges, queues, bindings and the consumer, then attach the
+	// RPC client, the notifications hub and the stats cache, on every
+	// (re)connect
+	mgr.OnConnect(rabbitmq.Setup(reg))
+	mgr.OnConnect(client.Attach)
+	mgr.OnConnect(hub.Setup)
+	mgr.OnConnect(stats.Setup)
+	go mgr.Run()
+
 	log.Printf("Orchestrator listening on exchange '%s', queue '%s'...", config.Cfg.Exchange.Name, config.Cfg.Queue.Name)
 
-	router := routes.SetupRouter(ch)
+	// Admin access to the dead-letter queue
+	dlq := rabbitmq.NewDLQ(mgr, config.Cfg.Queue.DLX)
+
+	// Grade-sheet uploads run in the background: 4 at a time, 5 minutes
+	// each, and their status is kept for a day
+	uploads := jobs.NewStore(4, 5*time.Minute, 24*time.Hour)
+
+	// Uploaded workbooks are kept here; messages only carry references
+	blobs, err := blobstore.New(config.Cfg.Blobs)
+	if err != nil {
+		log.Fatalf("Blob store setup failed: %v", err)
+	}
+
+	// Responses to requests sent with an Idempotency-Key are replayed to
+	// retries for a day
+	keys := idempotency.NewStore(24 * time.Hour)
+
+	// Final uploads are charged per graded row to the uploader's institution
+	pricer := pricing.New(config.Cfg.Pricing)
+
+	// Final grades are published by a saga that holds the credits first;
+	// sagas cut short by a crash or an outage are finished in the background
+	sagaStore, err := saga.NewStore(config.Cfg.Sagas.Dir)
+	if err != nil {
+		log.Fatalf("Saga store setup failed: %v", err)
+	}
+	sagas := saga.NewRunner(sagaStore, handlers.FinalGradesSteps(client, config.Cfg.Sagas.HoldTTL))
+	go sagas.Run(context.Background(), time.Minute)
+
+	// Review requests and replies are written to both review services or
+	// to neither; interrupted ones are reverted in the background
+	workflowStore, err := workflow.NewStore(config.Cfg.Workflows.Dir)
+	if err != nil {
+		log.Fatalf("Workflow store setup failed: %v", err)
+	}
+	ops := workflow.NewRunner(workflowStore, handlers.ReviewTransport(client))
+	go ops.Run(context.Background(), time.Minute)
+
+	// Who may call which route: the RBAC policy, reloaded when edited
+	authz, err := rbac.Load(config.Cfg.RBAC.Policy, openapi.PolicyRoutes(openapi.Routes))
+	if err != nil {
+		log.Fatalf("RBAC policy setup failed: %v", err)
+	}
+	go authz.Watch(context.Background(), config.Cfg.RBAC.ReloadInterval)
+
+	// Tokens of locked accounts, or issued before a lock or password reset,
+	// are refused although still signed
+	checker := sessions.New(handlers.SessionLookup(client), config.Cfg.Sessions.CacheTTL)
+
+	router := routes.SetupRouter(client, mgr, dlq, uploads, blobs, keys, pricer, sagas, ops, hub, authz, stats, checker)
 
 	// 6. Start Gin (blocks here)
 	log.Println("HTTP server running on :8080")
@@ -0,0 +1,35 @@
+// Command schemagen writes the JSON Schema of every catalogued event to
+// <out>/<routing key>.v<version>.json. Run it through `go generate
+// ./internal/types` after changing a payload struct.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"orchestrator/internal/types"
+)
+
+func main() {
+	out := flag.String("out", "schemas", "output directory")
+	flag.Parse()
+
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		log.Fatalf("create %s: %v", *out, err)
+	}
+	for _, e := range types.Entries() {
+		data, err := json.MarshalIndent(e.Schema, "", "  ")
+		if err != nil {
+			log.Fatalf("marshal %s: %v", e.Key, err)
+		}
+		name := filepath.Join(*out, fmt.Sprintf("%s.v%d.json", e.Key, e.Version))
+		if err := os.WriteFile(name, append(data, '\n'), 0o644); err != nil {
+			log.Fatalf("write %s: %v", name, err)
+		}
+	}
+	log.Printf("wrote %d schemas to %s", len(types.Entries()), *out)
+}
@@ -0,0 +1,104 @@
+package blobstore
+
+// Content-addressed storage for uploaded grade workbooks (claim check).
+// A workbook is stored once under its SHA-256; AMQP messages carry a
+// types.GradeSheetRef instead of the bytes and workers fetch the blob from
+// GET /internal/blobs/:sha256. The bytes live on the local filesystem or
+// in an S3-compatible bucket, selected by the blobs section of the config.
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"orchestrator/internal/config"
+	"orchestrator/internal/types"
+)
+
+var (
+	// ErrNotFound is returned for hashes the store does not hold.
+	ErrNotFound = errors.New("blob not found")
+	// ErrBadHash is returned for keys that are not a hex SHA-256.
+	ErrBadHash = errors.New("not a sha256 hex digest")
+)
+
+var hashPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// Backend keeps blobs by key. Put must be idempotent: the same key always
+// carries the same bytes.
+type Backend interface {
+	Put(ctx context.Context, key string, data []byte) error
+	Get(ctx context.Context, key string) (io.ReadCloser, int64, error)
+}
+
+// Store hashes blobs into a Backend and builds the references sent to
+// workers.
+type Store struct {
+	backend Backend
+	baseURL string
+}
+
+// defaultBaseURL is how the workers reach the orchestrator in compose.
+const defaultBaseURL = "http://orchestrator:8080"
+
+// New builds the store described by cfg: backend "fs" (the default) or "s3".
+func New(cfg config.Blobs) (*Store, error) {
+	base := strings.TrimRight(cfg.BaseURL, "/")
+	if base == "" {
+		base = defaultBaseURL
+	}
+
+	var (
+		b   Backend
+		err error
+	)
+	switch cfg.Backend {
+	case "", "fs":
+		b, err = NewFS(cfg.Dir)
+	case "s3":
+		b, err = NewS3(S3Config{
+			Endpoint:  cfg.S3.Endpoint,
+			Region:    cfg.S3.Region,
+			Bucket:    cfg.S3.Bucket,
+			Prefix:    cfg.S3.Prefix,
+			AccessKey: os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		})
+	default:
+		err = fmt.Errorf("unknown blob backend %q", cfg.Backend)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Store{backend: b, baseURL: base}, nil
+}
+
+// Put stores data and returns the reference workers use to fetch it.
+func (s *Store) Put(ctx context.Context, filename, contentType string, data []byte) (types.GradeSheetRef, error) {
+	sum := sha256.Sum256(data)
+	key := hex.EncodeToString(sum[:])
+	if err := s.backend.Put(ctx, key, data); err != nil {
+		return types.GradeSheetRef{}, fmt.Errorf("store blob %s: %w", key, err)
+	}
+	return types.GradeSheetRef{
+		SHA256:      key,
+		Size:        int64(len(data)),
+		URL:         s.baseURL + "/internal/blobs/" + key,
+		Filename:    filename,
+		ContentType: contentType,
+	}, nil
+}
+
+// Open returns the blob stored under sum and its size.
+func (s *Store) Open(ctx context.Context, sum string) (io.ReadCloser, int64, error) {
+	if !hashPattern.MatchString(sum) {
+		return nil, 0, ErrBadHash
+	}
+	return s.backend.Get(ctx, sum)
+}
@@ -0,0 +1,75 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// defaultDir is used when the config names no directory.
+const defaultDir = "data/blobs"
+
+// FS keeps blobs as files under a directory, sharded by the first two
+// characters of the key so no directory grows too large.
+type FS struct {
+	dir string
+}
+
+// NewFS returns a filesystem backend rooted at dir, creating it if needed.
+func NewFS(dir string) (*FS, error) {
+	if dir == "" {
+		dir = defaultDir
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	return &FS{dir: dir}, nil
+}
+
+func (b *FS) path(key string) string {
+	return filepath.Join(b.dir, key[:2], key)
+}
+
+// Put writes data atomically; a key already present is left alone.
+func (b *FS) Put(_ context.Context, key string, data []byte) error {
+	dst := b.path(key)
+	if _, err := os.Stat(dst); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o750); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dst), key+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+// Get opens the blob stored under key.
+func (b *FS) Get(_ context.Context, key string) (io.ReadCloser, int64, error) {
+	f, err := os.Open(b.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, 0, ErrNotFound
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, st.Size(), nil
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"io/ioutil"
 	"os"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -20,6 +21,166 @@ type Config struct {
 		DLX  string `yaml:"dlx"`
 	} `yaml:"queue"`
 	Bindings []string `yaml:"bindings"`
+	// Handlers overrides the processing policy of individual event
+	// handlers, keyed by routing key.
+	Handlers map[string]HandlerPolicy `yaml:"handlers"`
+	// Readiness lists the downstream services /readyz waits for.
+	Readiness struct {
+		Timeout      time.Duration `yaml:"timeout"`
+		Dependencies []Dependency  `yaml:"dependencies"`
+	} `yaml:"readiness"`
+	// Blobs configures where uploaded workbooks are kept for the workers.
+	Blobs Blobs `yaml:"blobs"`
+	// Pricing sets what a final grade upload costs the uploader's
+	// institution.
+	Pricing Pricing `yaml:"pricing"`
+	// Sagas configures the final-grades publication saga.
+	Sagas Sagas `yaml:"sagas"`
+	// Workflows configures multi-service writes such as review requests.
+	Workflows Workflows `yaml:"workflows"`
+	// Notifications configures the live notifications pushed to browsers.
+	Notifications Notifications `yaml:"notifications"`
+	// Onboarding configures the approval of institution registrations.
+	Onboarding Onboarding `yaml:"onboarding"`
+	// RBAC names the access policy file.
+	RBAC RBAC `yaml:"rbac"`
+	// API configures the retirement of the unversioned routes.
+	API API `yaml:"api"`
+	// StatsCache configures the cache of grade distributions.
+	StatsCache StatsCache `yaml:"stats_cache"`
+	// Breakers guards the RPC routing keys against unresponsive workers.
+	Breakers Breakers `yaml:"breakers"`
+	// Sessions configures the check of tokens against their account.
+	Sessions Sessions `yaml:"sessions"`
+}
+
+// Sessions reuses an account's lookup (auth.session) for CacheTTL (5
+// seconds when unset): a lock or password reset takes that long at most to
+// revoke the tokens already issued.
+type Sessions struct {
+	CacheTTL time.Duration `yaml:"cache_ttl"`
+}
+
+// Breakers sets the circuit breaker and bulkhead of every RPC routing key;
+// Keys overrides them for single routing keys. Unset fields keep the
+// defaults of rpc.DefaultBreakerPolicy.
+type Breakers struct {
+	BreakerPolicy `yaml:",inline"`
+	Keys          map[string]BreakerPolicy `yaml:"keys"`
+}
+
+// BreakerPolicy opens a circuit after FailureThreshold reply timeouts in a
+// row, keeps it open for OpenFor, then lets HalfOpenProbes trial calls
+// through. At most MaxConcurrent calls wait for a reply at once.
+type BreakerPolicy struct {
+	FailureThreshold int           `yaml:"failure_threshold"`
+	OpenFor          time.Duration `yaml:"open_for"`
+	HalfOpenProbes   int           `yaml:"half_open_probes"`
+	MaxConcurrent    int           `yaml:"max_concurrent"`
+}
+
+// StatsCache keeps grade distributions between grade imports. Backend is
+// memory (the default), redis or off; entries expire after TTL (10
+// minutes when unset). The Redis password is read from REDIS_PASSWORD.
+type StatsCache struct {
+	Backend    string        `yaml:"backend"`
+	TTL        time.Duration `yaml:"ttl"`
+	MaxEntries int           `yaml:"max_entries"` // memory backend, 1000 when unset
+	Redis      struct {
+		Addr   string `yaml:"addr"`
+		DB     int    `yaml:"db"`
+		Prefix string `yaml:"prefix"`
+	} `yaml:"redis"`
+}
+
+// API sets the date (YYYY-MM-DD) sent in the Sunset header of the legacy
+// routes that have an /api/v1 successor; no Sunset header when unset.
+type API struct {
+	LegacySunset string `yaml:"legacy_sunset"`
+}
+
+// RBAC is the access policy file, checked for changes every
+// ReloadInterval (10 seconds when unset).
+type RBAC struct {
+	Policy         string        `yaml:"policy"`
+	ReloadInterval time.Duration `yaml:"reload_interval"`
+}
+
+// Onboarding sets the balance an institution's credits account opens with
+// once its registration is approved.
+type Onboarding struct {
+	StartingCredits int `yaml:"starting_credits"`
+}
+
+// Notifications names the exchange notifications travel on
+// (clearsky.notifications when unset) and the balance below which an
+// institution is warned after a final upload (0: never).
+type Notifications struct {
+	Exchange   string `yaml:"exchange"`
+	CreditsLow int    `yaml:"credits_low"`
+}
+
+// Workflows says where workflow operations are kept.
+type Workflows struct {
+	Dir string `yaml:"dir"`
+}
+
+// Sagas says where saga state is kept and how long credits_service holds
+// the credits reserved for one (30 minutes when unset).
+type Sagas struct {
+	Dir     string        `yaml:"dir"`
+	HoldTTL time.Duration `yaml:"hold_ttl"`
+}
+
+// Pricing charges PerRow credits for every graded row, rounded up and at
+// least Minimum. Institutions overrides either value for one institution,
+// keyed by its name in credits_service.
+type Pricing struct {
+	PerRow       float64         `yaml:"per_row"`
+	Minimum      int             `yaml:"minimum"`
+	Institutions map[string]Rate `yaml:"institutions"`
+}
+
+// Rate is a per-institution override; unset fields keep the defaults.
+type Rate struct {
+	PerRow  *float64 `yaml:"per_row"`
+	Minimum *int     `yaml:"minimum"`
+}
+
+// Blobs selects the blob store backend. S3 credentials are read from
+// S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY.
+type Blobs struct {
+	Backend string `yaml:"backend"` // fs (default) or s3
+	Dir     string `yaml:"dir"`
+	// BaseURL is the orchestrator address workers fetch blobs from.
+	BaseURL string `yaml:"base_url"`
+	S3      struct {
+		Endpoint string `yaml:"endpoint"`
+		Region   string `yaml:"region"`
+		Bucket   string `yaml:"bucket"`
+		Prefix   string `yaml:"prefix"`
+	} `yaml:"s3"`
+}
+
+// Dependency is one downstream service checked by /readyz.
+type Dependency struct {
+	Name string `yaml:"name"`
+	// Ping lists routing keys on clearSky.events that must reach a worker
+	// answering system.ping.
+	Ping []string `yaml:"ping"`
+	// Queues must each have at least one consumer (for services that do
+	// not answer system.ping).
+	Queues []string `yaml:"queues"`
+}
+
+// HandlerPolicy mirrors events.Policy; unset fields keep the handler's
+// built-in values.
+type HandlerPolicy struct {
+	Concurrency int           `yaml:"concurrency"`
+	MaxRetries  *int          `yaml:"max_retries"`
+	RetryDelay  time.Duration `yaml:"retry_delay"`
+	Timeout     time.Duration `yaml:"timeout"`
+	AckEarly    *bool         `yaml:"ack_early"`
 }
 
 var Cfg Config
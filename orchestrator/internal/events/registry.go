@@ -0,0 +1,308 @@
+package events
+
+// Registry of domain event handlers driven by the orchestrator consumer.
+// Every routing key gets its own worker pool, sized by its Policy, so each
+// workflow's parallelism is tuned independently. Handlers return an error to
+// request a retry; Permanent errors and exhausted retries are
+// dead-lettered.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"orchestrator/internal/metrics"
+	"orchestrator/internal/telemetry"
+	"orchestrator/internal/types"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// HeaderRetryCount counts how many times a delivery has been retried.
+const HeaderRetryCount = "x-retry-count"
+
+// Handler processes one delivery. The registry acks or retries it based on
+// the returned error, so handlers must not ack themselves.
+type Handler func(ctx context.Context, d amqp.Delivery) error
+
+// Policy controls how a handler's deliveries are processed.
+type Policy struct {
+	// Concurrency is the number of deliveries handled in parallel.
+	Concurrency int
+	// MaxRetries is how often a failed delivery is re-queued before it is
+	// dead-lettered. Zero dead-letters on the first failure.
+	MaxRetries int
+	// RetryDelay is the wait before the first retry; it doubles each time.
+	RetryDelay time.Duration
+	// Timeout bounds a single handler invocation.
+	Timeout time.Duration
+	// AckEarly acks before the handler runs (at-most-once delivery) for
+	// events where losing one is cheaper than handling it twice.
+	AckEarly bool
+}
+
+// DefaultPolicy supplies Concurrency, RetryDelay and Timeout when they are
+// left zero, and MaxRetries for handlers that do not choose their own.
+var DefaultPolicy = Policy{
+	Concurrency: 1,
+	MaxRetries:  3,
+	RetryDelay:  time.Second,
+	Timeout:     30 * time.Second,
+}
+
+// Publisher re-publishes deliveries for retry.
+type Publisher interface {
+	Publish(ctx context.Context, exchange, routingKey string, msg amqp.Publishing) error
+}
+
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying.
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+type route struct {
+	key     string
+	handler Handler
+	policy  Policy
+	queue   chan amqp.Delivery
+}
+
+// Registry maps routing keys to handlers.
+type Registry struct {
+	queue string
+	pub   Publisher
+
+	mu     sync.RWMutex
+	routes map[string]*route
+}
+
+// NewRegistry returns an empty registry. Retries are published through pub
+// straight back to queue.
+func NewRegistry(queue string, pub Publisher) *Registry {
+	return &Registry{
+		queue:  queue,
+		pub:    pub,
+		routes: make(map[string]*route),
+	}
+}
+
+// Handle registers h for key and starts its workers. Registering the same
+// key twice panics, as it would silently shadow a workflow.
+func (r *Registry) Handle(key string, h Handler, p Policy) {
+	p = withDefaults(p)
+	rt := &route{
+		key:     key,
+		handler: h,
+		policy:  p,
+		queue:   make(chan amqp.Delivery, p.Concurrency),
+	}
+
+	r.mu.Lock()
+	if _, dup := r.routes[key]; dup {
+		r.mu.Unlock()
+		panic(fmt.Sprintf("events: handler for %q registered twice", key))
+	}
+	r.routes[key] = rt
+	r.mu.Unlock()
+
+	for i := 0; i < p.Concurrency; i++ {
+		go r.work(rt)
+	}
+	log.Printf("[Events] Registered %s (concurrency=%d, retries=%d)", key, p.Concurrency, p.MaxRetries)
+}
+
+// Keys returns the routing keys that have a handler.
+func (r *Registry) Keys() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	keys := make([]string, 0, len(r.routes))
+	for k := range r.routes {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// Prefetch is the channel QoS that keeps every worker busy.
+func (r *Registry) Prefetch() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	n := 0
+	for _, rt := range r.routes {
+		n += 2 * rt.policy.Concurrency // one in flight plus one buffered
+	}
+	if n == 0 {
+		n = 1
+	}
+	return n
+}
+
+// EventKey is the logical routing key of d. Retried deliveries travel via
+// the default exchange, so the original key is carried in a header.
+func EventKey(d amqp.Delivery) string {
+	if key, ok := d.Headers[types.HeaderEventType].(string); ok && key != "" {
+		return key
+	}
+	return d.RoutingKey
+}
+
+// Dispatch hands d to its handler's workers without blocking the consumer
+// loop; the channel prefetch bounds how many deliveries can be waiting.
+// Deliveries without a handler are dead-lettered.
+func (r *Registry) Dispatch(d amqp.Delivery) {
+	key := EventKey(d)
+	r.mu.RLock()
+	rt, ok := r.routes[key]
+	r.mu.RUnlock()
+	if !ok {
+		log.Printf("[Events] No handler for %s; dead-lettering", key)
+		d.Nack(false, false)
+		return
+	}
+	select {
+	case rt.queue <- d:
+	default:
+		go func() { rt.queue <- d }()
+	}
+}
+
+func (r *Registry) work(rt *route) {
+	for d := range rt.queue {
+		r.process(rt, d)
+	}
+}
+
+func (r *Registry) process(rt *route, d amqp.Delivery) {
+	if rt.policy.AckEarly {
+		if err := d.Ack(false); err != nil {
+			log.Printf("[Events] %s: ack failed: %v", rt.key, err)
+		}
+	}
+
+	ctx, span := telemetry.StartConsume(d, rt.key)
+	ctx, cancel := context.WithTimeout(ctx, rt.policy.Timeout)
+	start := time.Now()
+	err := safeCall(ctx, rt.handler, d)
+	elapsed := time.Since(start)
+	cancel()
+	telemetry.End(span, err)
+
+	if rt.policy.AckEarly {
+		outcome := "ack"
+		if err != nil {
+			outcome = "dropped"
+		}
+		metrics.ObserveEvent(rt.key, outcome, elapsed)
+		if err != nil {
+			log.Printf("[Events] %s failed (already acked): %v", rt.key, err)
+		}
+		return
+	}
+	if err == nil {
+		metrics.ObserveEvent(rt.key, result(nil, false), elapsed)
+		if err := d.Ack(false); err != nil {
+			log.Printf("[Events] %s: ack failed: %v", rt.key, err)
+		}
+		return
+	}
+
+	attempt := retryCount(d)
+	var perm permanentError
+	final := errors.As(err, &perm) || attempt >= rt.policy.MaxRetries
+	metrics.ObserveEvent(rt.key, result(err, final), elapsed)
+	if final {
+		log.Printf("[Events] %s failed after %d attempt(s); dead-lettering: %v", rt.key, attempt+1, err)
+		d.Nack(false, false)
+		return
+	}
+
+	delay := rt.policy.RetryDelay << attempt
+	log.Printf("[Events] %s failed (attempt %d), retrying in %s: %v", rt.key, attempt+1, delay, err)
+	time.Sleep(delay)
+	if err := r.retry(rt.key, d, attempt+1); err != nil {
+		log.Printf("[Events] %s: re-queue failed, returning to broker: %v", rt.key, err)
+		d.Nack(false, true)
+		return
+	}
+	d.Ack(false)
+}
+
+// result names the outcome of a handler call for metrics.
+func result(err error, final bool) string {
+	switch {
+	case err == nil:
+		return "ack"
+	case final:
+		return "dead_letter"
+	default:
+		return "retry"
+	}
+}
+
+// retry re-publishes d to the orchestrator queue with a bumped retry count.
+func (r *Registry) retry(key string, d amqp.Delivery, attempt int) error {
+	headers := amqp.Table{}
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+	headers[types.HeaderEventType] = key
+	headers[HeaderRetryCount] = int32(attempt)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return r.pub.Publish(ctx, "", r.queue, amqp.Publishing{
+		Headers:       headers,
+		ContentType:   d.ContentType,
+		DeliveryMode:  amqp.Persistent,
+		CorrelationId: d.CorrelationId,
+		MessageId:     d.MessageId,
+		Timestamp:     d.Timestamp,
+		Body:          d.Body,
+	})
+}
+
+// safeCall turns a handler panic into an error so one bad message cannot
+// kill a worker.
+func safeCall(ctx context.Context, h Handler, d amqp.Delivery) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = Permanent(fmt.Errorf("handler panic: %v", p))
+		}
+	}()
+	return h(ctx, d)
+}
+
+func retryCount(d amqp.Delivery) int {
+	switch n := d.Headers[HeaderRetryCount].(type) {
+	case int32:
+		return int(n)
+	case int64:
+		return int(n)
+	case int:
+		return n
+	}
+	return 0
+}
+
+func withDefaults(p Policy) Policy {
+	if p.Concurrency <= 0 {
+		p.Concurrency = DefaultPolicy.Concurrency
+	}
+	if p.MaxRetries < 0 {
+		p.MaxRetries = 0
+	}
+	if p.RetryDelay <= 0 {
+		p.RetryDelay = DefaultPolicy.RetryDelay
+	}
+	if p.Timeout <= 0 {
+		p.Timeout = DefaultPolicy.Timeout
+	}
+	return p
+}
@@ -0,0 +1,111 @@
+package gradesheet
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// delimiters are tried in this order; Greek-locale Excel and LibreOffice
+// export with ';', most LMSs with ','.
+var delimiters = []rune{',', ';', '\t', '|'}
+
+// sniffLines is how many lines are looked at to pick the delimiter.
+const sniffLines = 20
+
+// decimalComma matches a number written with a decimal comma, as
+// Greek-locale exports do when ',' is not the delimiter.
+var decimalComma = regexp.MustCompile(`^-?[0-9]+,[0-9]+$`)
+
+// readCSV decodes and splits a CSV export.
+func readCSV(data []byte) ([][]string, error) {
+	text, err := decodeText(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnreadable, err)
+	}
+
+	r := csv.NewReader(bytes.NewReader(text))
+	r.Comma = sniffDelimiter(text)
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnreadable, err)
+	}
+
+	if r.Comma != ',' {
+		for _, row := range rows {
+			for i, v := range row {
+				if decimalComma.MatchString(v) {
+					row[i] = strings.Replace(v, ",", ".", 1)
+				}
+			}
+		}
+	}
+	return rows, nil
+}
+
+// decodeText returns data as UTF-8. A UTF-16 byte-order mark selects
+// UTF-16, valid UTF-8 is kept (minus its BOM) and anything else is taken
+// to be Windows-1253, the Greek ANSI code page.
+func decodeText(data []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}), bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		return unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM).NewDecoder().Bytes(data)
+	case utf8.Valid(data):
+		return bytes.TrimPrefix(data, []byte("\xEF\xBB\xBF")), nil
+	default:
+		return charmap.Windows1253.NewDecoder().Bytes(data)
+	}
+}
+
+// sniffDelimiter picks the candidate found on the most of the first
+// lines, then the one found most often; quoted text is skipped.
+func sniffDelimiter(text []byte) rune {
+	lines := make(map[rune]int)
+	total := make(map[rune]int)
+	seen := make(map[rune]bool)
+	inQuotes, n := false, 0
+	for _, c := range string(text) {
+		switch {
+		case c == '"':
+			inQuotes = !inQuotes
+		case inQuotes:
+		case c == '\n':
+			for d := range seen {
+				lines[d]++
+			}
+			clear(seen)
+			if n++; n == sniffLines {
+				return best(lines, total)
+			}
+		default:
+			for _, d := range delimiters {
+				if c == d {
+					seen[d] = true
+					total[d]++
+				}
+			}
+		}
+	}
+	for d := range seen {
+		lines[d]++
+	}
+	return best(lines, total)
+}
+
+func best(lines, total map[rune]int) rune {
+	pick := delimiters[0]
+	for _, d := range delimiters[1:] {
+		if lines[d] > lines[pick] || (lines[d] == lines[pick] && total[d] > total[pick]) {
+			pick = d
+		}
+	}
+	return pick
+}
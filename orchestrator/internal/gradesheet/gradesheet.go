@@ -0,0 +1,352 @@
+package gradesheet
+
+// Parser and validator for the grade-sheet template the grade workers
+// import. Sheets may be uploaded as .xlsx, .ods or .csv; the first
+// worksheet (or the CSV file) is laid out as
+//
+//	row 1    free text (title)
+//	row 2    question weights, under the question columns
+//	row 3    header row with the Greek column titles below
+//	row 4+   one student per row
+//
+// and question scores sit in the ten columns starting at I, which is
+// where the workers read them from. Parse reports every problem it finds
+// as a per-cell error so the instructor can fix the sheet in one pass.
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Column titles of the template's header row.
+const (
+	ColAM     = "Αριθμός Μητρώου"
+	ColName   = "Ονοματεπώνυμο"
+	ColEmail  = "Ακαδημαϊκό E-mail"
+	ColPeriod = "Περίοδος δήλωσης"
+	ColCourse = "Τμήμα Τάξης"
+	ColScale  = "Κλίμακα βαθμολόγησης"
+	ColGrade  = "Βαθμολογία"
+)
+
+var requiredColumns = []string{ColAM, ColName, ColEmail, ColPeriod, ColCourse, ColScale, ColGrade}
+
+const (
+	weightRow = 1 // zero-based
+	headerRow = 2
+	firstData = 3
+
+	// firstQuestion is the zero-based column of Q1 (column I).
+	firstQuestion = 8
+	questions     = 10
+
+	// maxErrors bounds the report; a sheet in the wrong template would
+	// otherwise produce one error per cell.
+	maxErrors = 200
+)
+
+var (
+	amPattern    = regexp.MustCompile(`^[0-9]{8,9}$`)
+	emailPattern = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+	scalePattern = regexp.MustCompile(`^\s*([0-9]+(?:\.[0-9]+)?)\s*-\s*([0-9]+(?:\.[0-9]+)?)\s*$`)
+)
+
+// Sheet is a validated grade sheet.
+type Sheet struct {
+	Course string
+	Period string
+	Rows   []Row
+}
+
+// Row is one student's line.
+type Row struct {
+	Line      int // 1-based spreadsheet row
+	AM        string
+	Name      string
+	Email     string
+	Scale     Scale
+	Grade     float64
+	Questions [questions]*float64
+}
+
+// Scale is a grading scale such as 0-10.
+type Scale struct {
+	Min, Max float64
+}
+
+func (s Scale) String() string {
+	return strconv.FormatFloat(s.Min, 'f', -1, 64) + "-" + strconv.FormatFloat(s.Max, 'f', -1, 64)
+}
+
+// CellError is one violation. Row is the 1-based spreadsheet row; Cell is
+// the A1 reference when the problem is in a single cell.
+type CellError struct {
+	Row     int    `json:"row"`
+	Column  string `json:"column,omitempty"`
+	Cell    string `json:"cell,omitempty"`
+	Value   string `json:"value,omitempty"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists everything wrong with a sheet.
+type ValidationError struct {
+	Errors []CellError
+	// Truncated is set when more than maxErrors problems were found.
+	Truncated bool
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("grade sheet has %d problem(s)", len(e.Errors))
+}
+
+// ErrUnreadable is returned when the file cannot be read in its format.
+var ErrUnreadable = errors.New("unreadable grade sheet")
+
+// Parse reads and validates the first worksheet of an .xlsx workbook.
+// Template violations are returned as a *ValidationError.
+func Parse(r io.Reader) (*Sheet, error) {
+	rows, err := readXLSX(r)
+	if err != nil {
+		return nil, err
+	}
+	sheet, _, err := validate(rows)
+	return sheet, err
+}
+
+func readXLSX(r io.Reader) ([][]string, error) {
+	f, err := excelize.OpenReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnreadable, err)
+	}
+	defer f.Close()
+
+	sheets := f.GetSheetList()
+	if len(sheets) == 0 {
+		return nil, &ValidationError{Errors: []CellError{{Row: 1, Message: "workbook has no worksheets"}}}
+	}
+	rows, err := f.GetRows(sheets[0])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnreadable, err)
+	}
+	return rows, nil
+}
+
+// validate checks rows against the template and also returns the
+// parser, which knows where the columns are.
+func validate(rows [][]string) (*Sheet, *parser, error) {
+	p := &parser{rows: rows}
+	sheet := p.parse()
+	if len(p.errs) > 0 {
+		return nil, p, &ValidationError{Errors: p.errs, Truncated: p.truncated}
+	}
+	return sheet, p, nil
+}
+
+type parser struct {
+	rows      [][]string
+	cols      map[string]int
+	errs      []CellError
+	truncated bool
+}
+
+func (p *parser) fail(row, col int, value, format string, args ...interface{}) {
+	if len(p.errs) >= maxErrors {
+		p.truncated = true
+		return
+	}
+	e := CellError{Row: row + 1, Value: value, Message: fmt.Sprintf(format, args...)}
+	if col >= 0 {
+		e.Cell, _ = excelize.CoordinatesToCellName(col+1, row+1)
+		e.Column = p.title(col)
+	}
+	p.errs = append(p.errs, e)
+}
+
+// title names column col by its header, or by its letter.
+func (p *parser) title(col int) string {
+	if headerRow < len(p.rows) && col < len(p.rows[headerRow]) {
+		if t := strings.TrimSpace(p.rows[headerRow][col]); t != "" {
+			return t
+		}
+	}
+	name, _ := excelize.ColumnNumberToName(col + 1)
+	return name
+}
+
+func (p *parser) cell(row, col int) string {
+	if row >= len(p.rows) || col < 0 || col >= len(p.rows[row]) {
+		return ""
+	}
+	return strings.TrimSpace(p.rows[row][col])
+}
+
+func (p *parser) parse() *Sheet {
+	if len(p.rows) <= firstData {
+		p.fail(len(p.rows), -1, "", "template too short: expected a title row, a weight row, a header row and at least one student")
+		return nil
+	}
+	if !p.readHeader() {
+		return nil
+	}
+	p.checkWeights()
+
+	sheet := &Sheet{}
+	seen := map[string]int{}
+	for i := firstData; i < len(p.rows); i++ {
+		if p.blank(i) {
+			continue
+		}
+		row := p.readRow(i)
+		if row.AM != "" {
+			if first, dup := seen[row.AM]; dup {
+				p.fail(i, p.cols[ColAM], row.AM, "duplicate AM (first seen on row %d)", first)
+			} else {
+				seen[row.AM] = i + 1
+			}
+		}
+		p.checkMeta(sheet, i)
+		sheet.Rows = append(sheet.Rows, row)
+	}
+	if len(sheet.Rows) == 0 {
+		p.fail(firstData, -1, "", "sheet contains no student rows")
+	}
+	return sheet
+}
+
+// readHeader locates the required columns; without them nothing else
+// can be checked.
+func (p *parser) readHeader() bool {
+	p.cols = map[string]int{}
+	for i, t := range p.rows[headerRow] {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		if _, dup := p.cols[t]; dup {
+			p.fail(headerRow, i, t, "column %q appears twice", t)
+			continue
+		}
+		p.cols[t] = i
+	}
+	ok := true
+	for _, name := range requiredColumns {
+		if _, found := p.cols[name]; !found {
+			p.fail(headerRow, -1, "", "missing column %q", name)
+			ok = false
+		}
+	}
+	return ok
+}
+
+func (p *parser) checkWeights() {
+	for q := 0; q < questions; q++ {
+		col := firstQuestion + q
+		if v := p.cell(weightRow, col); v != "" {
+			if w, err := strconv.ParseFloat(v, 64); err != nil || w < 0 {
+				p.fail(weightRow, col, v, "question weight must be a non-negative number")
+			}
+		}
+	}
+}
+
+func (p *parser) blank(row int) bool {
+	for _, v := range p.rows[row] {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *parser) readRow(i int) Row {
+	row := Row{Line: i + 1}
+	required := func(name string) string {
+		v := p.cell(i, p.cols[name])
+		if v == "" {
+			p.fail(i, p.cols[name], "", "empty cell")
+		}
+		return v
+	}
+
+	row.AM = required(ColAM)
+	if row.AM != "" && !amPattern.MatchString(row.AM) {
+		p.fail(i, p.cols[ColAM], row.AM, "AM must be 8 or 9 digits")
+	}
+	row.Name = required(ColName)
+	row.Email = required(ColEmail)
+	if row.Email != "" && !emailPattern.MatchString(row.Email) {
+		p.fail(i, p.cols[ColEmail], row.Email, "not a valid e-mail address")
+	}
+	required(ColPeriod)
+	required(ColCourse)
+
+	scaleOK := false
+	if v := required(ColScale); v != "" {
+		if m := scalePattern.FindStringSubmatch(v); m == nil {
+			p.fail(i, p.cols[ColScale], v, "grading scale must look like 0-10")
+		} else {
+			row.Scale.Min, _ = strconv.ParseFloat(m[1], 64)
+			row.Scale.Max, _ = strconv.ParseFloat(m[2], 64)
+			if row.Scale.Min >= row.Scale.Max {
+				p.fail(i, p.cols[ColScale], v, "grading scale minimum must be below its maximum")
+			} else {
+				scaleOK = true
+			}
+		}
+	}
+
+	if v := required(ColGrade); v != "" {
+		g, err := strconv.ParseFloat(v, 64)
+		switch {
+		case err != nil:
+			p.fail(i, p.cols[ColGrade], v, "grade must be a number (use a dot for decimals)")
+		case scaleOK && (g < row.Scale.Min || g > row.Scale.Max):
+			p.fail(i, p.cols[ColGrade], v, "grade outside the %s scale", row.Scale)
+		default:
+			row.Grade = g
+		}
+	}
+
+	for q := 0; q < questions; q++ {
+		col := firstQuestion + q
+		v := p.cell(i, col)
+		if v == "" {
+			continue
+		}
+		s, err := strconv.ParseFloat(v, 64)
+		switch {
+		case err != nil:
+			p.fail(i, col, v, "question score must be a number (use a dot for decimals)")
+		case s < 0 || (scaleOK && s > row.Scale.Max):
+			p.fail(i, col, v, "question score outside the %s scale", row.Scale)
+		default:
+			row.Questions[q] = &s
+		}
+	}
+	return row
+}
+
+// checkMeta makes every row agree on the course and exam period: one
+// sheet is one course in one period.
+func (p *parser) checkMeta(sheet *Sheet, i int) {
+	course, period := p.cell(i, p.cols[ColCourse]), p.cell(i, p.cols[ColPeriod])
+	if course == "" || period == "" {
+		return // already reported as empty
+	}
+	if sheet.Course == "" {
+		sheet.Course, sheet.Period = course, period
+		return
+	}
+	if course != sheet.Course {
+		p.fail(i, p.cols[ColCourse], course, "course differs from the rest of the sheet (%q)", sheet.Course)
+	}
+	if period != sheet.Period {
+		p.fail(i, p.cols[ColPeriod], period, "exam period differs from the rest of the sheet (%q)", sheet.Period)
+	}
+}
@@ -0,0 +1,112 @@
+package gradesheet
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Extensions are the upload formats Load understands.
+var Extensions = []string{".xlsx", ".ods", ".csv"}
+
+// Supported reports whether filename has one of the Extensions.
+func Supported(filename string) bool {
+	ext := strings.ToLower(filepath.Ext(filename))
+	for _, e := range Extensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// Upload is a validated sheet in the canonical form the grade workers,
+// statistics and view services consume: an .xlsx workbook.
+type Upload struct {
+	Sheet *Sheet
+	// Name is the uploaded filename with an .xlsx extension.
+	Name string
+	// Data is the workbook; an uploaded .xlsx is passed through untouched.
+	Data []byte
+}
+
+// Load reads filename's contents in whichever supported format its
+// extension names, validates it and converts it to .xlsx.
+func Load(filename string, data []byte) (*Upload, error) {
+	var (
+		rows [][]string
+		err  error
+	)
+	ext := strings.ToLower(filepath.Ext(filename))
+	switch ext {
+	case ".xlsx":
+		rows, err = readXLSX(bytes.NewReader(data))
+	case ".ods":
+		rows, err = readODS(data)
+	case ".csv":
+		rows, err = readCSV(data)
+	default:
+		return nil, fmt.Errorf("%w: unsupported extension %q", ErrUnreadable, ext)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sheet, p, err := validate(rows)
+	if err != nil {
+		return nil, err
+	}
+	up := &Upload{Sheet: sheet, Name: strings.TrimSuffix(filename, filepath.Ext(filename)) + ".xlsx", Data: data}
+	if ext != ".xlsx" {
+		if up.Data, err = p.workbook(); err != nil {
+			return nil, err
+		}
+	}
+	return up, nil
+}
+
+// workbook writes the validated rows as a single-sheet .xlsx. Weights,
+// grades and question scores become numbers as they would be in a sheet
+// saved from Excel; everything else, the AM's leading zero included,
+// stays text.
+func (p *parser) workbook() ([]byte, error) {
+	f := excelize.NewFile()
+	defer f.Close()
+	sheet := f.GetSheetName(0)
+
+	numeric := map[int]bool{p.cols[ColGrade]: true}
+	for q := 0; q < questions; q++ {
+		numeric[firstQuestion+q] = true
+	}
+	for r, row := range p.rows {
+		for c, v := range row {
+			v = strings.TrimSpace(v)
+			if v == "" {
+				continue
+			}
+			cell, err := excelize.CoordinatesToCellName(c+1, r+1)
+			if err != nil {
+				return nil, err
+			}
+			n, nerr := strconv.ParseFloat(v, 64)
+			if (r == weightRow || r >= firstData) && numeric[c] && nerr == nil {
+				err = f.SetCellFloat(sheet, cell, n, -1, 64)
+			} else {
+				err = f.SetCellStr(sheet, cell, v)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	buf, err := f.WriteToBuffer()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
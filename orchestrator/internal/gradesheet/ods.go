@@ -0,0 +1,194 @@
+package gradesheet
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxContentXML bounds the decompressed content.xml.
+	maxContentXML = 64 << 20
+	// maxRepeat bounds how far a repeated row or cell is expanded;
+	// LibreOffice pads sheets with blank cells repeated to the sheet edge.
+	maxRepeat = 1024
+	// maxRows bounds the rows kept from one table.
+	maxRows = 100000
+)
+
+// readODS reads the first table of an OpenDocument spreadsheet. Numeric
+// cells give their office:value, everything else its displayed text.
+func readODS(data []byte) ([][]string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnreadable, err)
+	}
+	var content *zip.File
+	for _, f := range zr.File {
+		if f.Name == "content.xml" {
+			content = f
+		}
+	}
+	if content == nil {
+		return nil, fmt.Errorf("%w: content.xml missing", ErrUnreadable)
+	}
+	rc, err := content.Open()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnreadable, err)
+	}
+	defer rc.Close()
+
+	rows, err := parseODSContent(io.LimitReader(rc, maxContentXML))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnreadable, err)
+	}
+	return rows, nil
+}
+
+type odsCell struct {
+	value  string
+	text   strings.Builder
+	paras  int
+	repeat int
+}
+
+func parseODSContent(r io.Reader) ([][]string, error) {
+	var (
+		rows      [][]string
+		row       []string
+		rowRepeat int
+		blankRows int // pending blank rows, kept only if data follows
+		blankCols int // pending blank cells, same
+		cell      *odsCell
+		tables    int
+		inTable   bool
+		inNote    bool // cell comments carry their own text:p
+	)
+
+	dec := xml.NewDecoder(r)
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "table":
+				if tables++; tables > 1 {
+					return rows, nil // first sheet only
+				}
+				inTable = true
+			case "table-row":
+				if inTable {
+					row, blankCols = nil, 0
+					rowRepeat = repeat(attr(t, "number-rows-repeated"))
+				}
+			case "table-cell", "covered-table-cell":
+				if inTable {
+					cell = &odsCell{repeat: repeat(attr(t, "number-columns-repeated"))}
+					switch attr(t, "value-type") {
+					case "float", "percentage", "currency":
+						cell.value = attr(t, "value")
+					}
+				}
+			case "annotation":
+				inNote = true
+			case "p":
+				if cell != nil && !inNote {
+					if cell.paras++; cell.paras > 1 {
+						cell.text.WriteByte('\n')
+					}
+				}
+			case "s":
+				if cell != nil && !inNote {
+					cell.text.WriteString(strings.Repeat(" ", repeat(attr(t, "c"))))
+				}
+			case "tab":
+				if cell != nil && !inNote {
+					cell.text.WriteByte('\t')
+				}
+			case "line-break":
+				if cell != nil && !inNote {
+					cell.text.WriteByte('\n')
+				}
+			}
+
+		case xml.CharData:
+			if cell != nil && cell.paras > 0 && !inNote {
+				cell.text.Write(t)
+			}
+
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "annotation":
+				inNote = false
+			case "table":
+				inTable = false
+			case "table-cell", "covered-table-cell":
+				if cell == nil {
+					continue
+				}
+				v := cell.value
+				if v == "" {
+					v = cell.text.String()
+				}
+				if strings.TrimSpace(v) == "" {
+					blankCols += cell.repeat
+				} else {
+					for ; blankCols > 0 && len(row) < maxRepeat; blankCols-- {
+						row = append(row, "")
+					}
+					for i := 0; i < cell.repeat && len(row) < maxRepeat; i++ {
+						row = append(row, v)
+					}
+				}
+				cell = nil
+			case "table-row":
+				if !inTable {
+					continue
+				}
+				if len(row) == 0 {
+					blankRows += rowRepeat
+					continue
+				}
+				for ; blankRows > 0 && len(rows) < maxRows; blankRows-- {
+					rows = append(rows, nil)
+				}
+				for i := 0; i < rowRepeat && len(rows) < maxRows; i++ {
+					rows = append(rows, row)
+				}
+			}
+		}
+	}
+	return rows, nil
+}
+
+func attr(e xml.StartElement, local string) string {
+	for _, a := range e.Attr {
+		if a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func repeat(s string) int {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return 1
+	}
+	if n > maxRepeat {
+		return maxRepeat
+	}
+	return n
+}
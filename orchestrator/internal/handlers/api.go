@@ -0,0 +1,262 @@
+package handlers
+
+// Handlers of the /api/v1 routes that do not map one-to-one onto a legacy
+// endpoint: reads that the legacy API took as PATCH bodies are GETs with
+// query parameters here, and institutions are addressed by the path.
+// Error replies are wrapped by middleware.ErrorEnvelope.
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"orchestrator/internal/idempotency"
+	"orchestrator/internal/middleware"
+	"orchestrator/internal/rpc"
+	"orchestrator/internal/statcache"
+	"orchestrator/internal/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiV1 is the prefix of the versioned API.
+const apiV1 = "/api/v1"
+
+// isV1 reports whether c is a request to the versioned API, whose writes
+// answer 201 and whose Location headers point into /api/v1.
+func isV1(c *gin.Context) bool {
+	return strings.HasPrefix(c.FullPath(), apiV1+"/")
+}
+
+// Review is a grade review request. Students see the instructor's answer;
+// the instructor's list holds pending requests only.
+type Review struct {
+	StudentID              string     `json:"student_id"`
+	CourseID               string     `json:"course_id"`
+	ExamPeriod             string     `json:"exam_period"`
+	StudentMessage         string     `json:"student_message"`
+	Status                 string     `json:"status"`
+	InstructorReplyMessage *string    `json:"instructor_reply_message,omitempty"`
+	InstructorAction       *string    `json:"instructor_action,omitempty"`
+	CreatedAt              time.Time  `json:"review_created_at"`
+	ReviewedAt             *time.Time `json:"reviewed_at,omitempty"`
+}
+
+// ReviewList is the reply of GET /api/v1/reviews.
+type ReviewList struct {
+	Reviews []Review `json:"reviews"`
+}
+
+// HandleListReviews lists review requests: a student's own request for one
+// course and period, or the requests pending on an instructor's courses,
+// optionally narrowed to one course and period. Callers holding both roles
+// pick one with as: GET /api/v1/reviews?course=&period=&as=student|instructor
+func HandleListReviews(c *gin.Context, client *rpc.Client) {
+	as, ok := reviewView(c)
+	if !ok {
+		return
+	}
+	course, period := c.Query("course"), c.Query("period")
+
+	ctx, cancel := rpcContext(c, rpcTimeout)
+	defer cancel()
+
+	var raw json.RawMessage
+	var err error
+	if as == "student" {
+		if course == "" || period == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "course and period are required"})
+			return
+		}
+		studentID := middleware.GetStudentID(c)
+		err = client.CallJSON(ctx, eventsExchange, "student.getRequestStatus", types.ReviewStatusRequest{Body: types.ReviewStatusBody{
+			ExamPeriod: period,
+			CourseID:   course,
+			UserID:     studentID,
+			StudentID:  studentID,
+		}}, &raw)
+	} else {
+		err = client.CallJSON(ctx, eventsExchange, "instructor.getRequestsList",
+			types.ReviewListRequest{Body: types.ReviewListBody{Username: middleware.GetUsername(c)}}, &raw)
+	}
+	if err != nil {
+		log.Printf("[Reviews] ❌ listing %s reviews: %v", as, err)
+		c.JSON(rpcStatus(c, err), gin.H{"error": err.Error()})
+		return
+	}
+	if msg := replyError(raw); msg != "" {
+		log.Printf("[Reviews] ⚠ %s review service: %s", as, msg)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "review service error: " + msg})
+		return
+	}
+
+	list := ReviewList{Reviews: []Review{}}
+	if as == "student" {
+		// One review, or {"message": "No review found ..."}
+		var r Review
+		if err := json.Unmarshal(raw, &r); err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "malformed reply from review service"})
+			return
+		}
+		if r.StudentID != "" {
+			list.Reviews = append(list.Reviews, r)
+		}
+	} else {
+		var reply struct {
+			Data []Review `json:"data"`
+		}
+		if err := json.Unmarshal(raw, &reply); err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "malformed reply from review service"})
+			return
+		}
+		for _, r := range reply.Data {
+			if (course == "" || r.CourseID == course) && (period == "" || r.ExamPeriod == period) {
+				r.Status = "pending"
+				list.Reviews = append(list.Reviews, r)
+			}
+		}
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// reviewView decides whose reviews GET /api/v1/reviews lists.
+func reviewView(c *gin.Context) (string, bool) {
+	student, instructor := middleware.HasRole(c, "student"), middleware.HasRole(c, "instructor")
+	as := c.Query("as")
+	switch {
+	case as == "" && student && !instructor:
+		return "student", true
+	case as == "" && instructor && !student:
+		return "instructor", true
+	case as == "":
+		c.JSON(http.StatusBadRequest, gin.H{"error": "as must be student or instructor"})
+	case as != "student" && as != "instructor":
+		c.JSON(http.StatusBadRequest, gin.H{"error": "as must be student or instructor"})
+	case (as == "student" && !student) || (as == "instructor" && !instructor):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access restricted: you do not hold the " + as + " role"})
+	default:
+		return as, true
+	}
+	return "", false
+}
+
+// InstitutionCredits is an institution's credit balance.
+type InstitutionCredits struct {
+	Institution string `json:"institution"`
+	Credits     int    `json:"credits"`
+}
+
+// CreditPurchase is the body of POST /api/v1/institutions/:name/credits/purchases.
+type CreditPurchase struct {
+	Amount int `json:"amount" binding:"required,gt=0" minimum:"1"`
+}
+
+// CreditPurchaseReceipt is the 201 reply to a credit purchase.
+type CreditPurchaseReceipt struct {
+	Institution string `json:"institution"`
+	Amount      int    `json:"amount"`
+	Message     string `json:"message"`
+}
+
+// HandleInstitutionCredits returns the balance of the institution in the
+// path: GET /api/v1/institutions/:name/credits
+func HandleInstitutionCredits(c *gin.Context, client *rpc.Client) {
+	name, ok := creditsInstitution(c, client)
+	if !ok {
+		return
+	}
+	ctx, cancel := rpcContext(c, rpcTimeout)
+	defer cancel()
+
+	credits, err := creditBalance(ctx, client, name)
+	if err != nil {
+		log.Printf("[Credits] ❌ balance of %s: %v", name, err)
+		c.JSON(rpcStatus(c, err), gin.H{"error": "could not read the institution's credits"})
+		return
+	}
+	c.JSON(http.StatusOK, InstitutionCredits{Institution: name, Credits: credits})
+}
+
+// HandleInstitutionPurchase buys credits for the institution in the path:
+// POST /api/v1/institutions/:name/credits/purchases {"amount": n}
+func HandleInstitutionPurchase(c *gin.Context, client *rpc.Client) {
+	var body CreditPurchase
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	name, ok := creditsInstitution(c, client)
+	if !ok {
+		return
+	}
+	ev := types.CreditsPurchasedEvent{Name: name, Amount: body.Amount, PurchaseID: idempotency.RequestID(c)}
+
+	ctx, cancel := rpcContext(c, rpcTimeout)
+	defer cancel()
+
+	var resp PurchaseResponse
+	if err := client.CallJSON(ctx, eventsExchange, "credits.purchased", ev, &resp); err != nil {
+		log.Printf("[Credits] ❌ purchase for %s: %v", name, err)
+		c.JSON(rpcStatus(c, err), gin.H{"error": "credits request failed: " + err.Error()})
+		return
+	}
+	if resp.Status != "ok" {
+		log.Printf("[Credits] ⚠ purchase for %s refused: %s %s", name, resp.Message, resp.Error)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "credits service error: " + resp.Message})
+		return
+	}
+	if err := publishEvent(ctx, client, "credits.purchased", ev); err != nil {
+		log.Printf("[Credits] ❌ credits.purchased event publish failed: %v", err)
+	}
+	log.Printf("[Credits] 💳 %s bought %d credits", name, body.Amount)
+	c.JSON(http.StatusCreated, CreditPurchaseReceipt{Institution: name, Amount: body.Amount, Message: resp.Message})
+}
+
+// creditsInstitution returns the institution in the path if the caller
+// may use its credits: platform admins, and the representative whose
+// registration of it was approved. Who represents an institution is read
+// from its registration record, not from the caller's token. Unapproved
+// institutions have no credits account and are answered 404.
+func creditsInstitution(c *gin.Context, client *rpc.Client) (string, bool) {
+	name := c.Param("name")
+	return name, mayUseCredits(c, client, name)
+}
+
+// mayUseCredits applies creditsInstitution's rule to name, answering the
+// request when the caller may not use its credits. The legacy /purchase
+// and /mycredits routes, which take the name from the body, use it too.
+func mayUseCredits(c *gin.Context, client *rpc.Client, name string) bool {
+	admin := middleware.HasRole(c, "platform_admin")
+	if !admin && !middleware.HasRole(c, "institution_representative") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access restricted: you do not represent " + name})
+		return false
+	}
+	var rec OnboardingRecord
+	if !callRegistration(c, client, "institution.get",
+		types.InstitutionGetRequest{Name: name, Status: "approved"}, "institution", &rec) {
+		return false
+	}
+	if !admin && (rec.RequestedBy == "" || rec.RequestedBy != middleware.GetUsername(c)) {
+		log.Printf("[Credits] ⚠ %s asked for the credits of %s, registered by %q", middleware.GetUsername(c), name, rec.RequestedBy)
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access restricted: you do not represent " + name})
+		return false
+	}
+	return true
+}
+
+// HandleCourseDistributions returns the grade histograms of one course
+// sheet: GET /api/v1/courses/:course/distributions?period=&class_title=
+func HandleCourseDistributions(c *gin.Context, client *rpc.Client, cache *statcache.Cache) {
+	req := types.DistributionsRequest{
+		Course:            c.Param("course"),
+		DeclarationPeriod: c.Query("period"),
+		ClassTitle:        c.Query("class_title"),
+	}
+	if req.DeclarationPeriod == "" || req.ClassTitle == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "period and class_title are required"})
+		return
+	}
+	distributions(c, client, cache, req)
+}
@@ -0,0 +1,39 @@
+package handlers
+
+// Claim-check downloads for the grade workers. Messages on postgrades.*
+// carry a types.GradeSheetRef; the worker fetches the bytes here with the
+// internal API token.
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"orchestrator/internal/blobstore"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HandleBlob streams one stored workbook: GET /internal/blobs/:sha256
+func HandleBlob(c *gin.Context, blobs *blobstore.Store) {
+	sum := c.Param("sha256")
+	body, size, err := blobs.Open(c.Request.Context(), sum)
+	switch {
+	case errors.Is(err, blobstore.ErrBadHash):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, blobstore.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "blob not found"})
+		return
+	case err != nil:
+		log.Printf("[HandleBlob] %s: %v", sum, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read blob"})
+		return
+	}
+	defer body.Close()
+
+	// Content-addressed, so the bytes behind a hash never change
+	c.Header("ETag", `"`+sum+`"`)
+	c.Header("Cache-Control", "private, max-age=31536000, immutable")
+	c.DataFromReader(http.StatusOK, size, "application/octet-stream", body, nil)
+}
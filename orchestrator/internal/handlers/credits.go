@@ -2,19 +2,22 @@ package handlers
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
-	"time"
+
+	"orchestrator/internal/idempotency"
+	"orchestrator/internal/pricing"
+	"orchestrator/internal/rpc"
+	"orchestrator/internal/types"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
-	amqp "github.com/rabbitmq/amqp091-go"
 )
 
 type PurchaseRequest struct {
 	Name   string `json:"name" binding:"required"`
-	Amount int    `json:"amount" binding:"required,gt=0"`
+	Amount int    `json:"amount" binding:"required,gt=0" minimum:"1"`
 }
 
 type PurchaseResponse struct {
@@ -47,7 +50,7 @@ type AvailableResp struct {
 	ErrorDetail string `json:"error,omitempty"`   // optional error text
 }
 
-func HandleCreditsAvail(c *gin.Context, ch *amqp.Channel) {
+func HandleCreditsAvail(c *gin.Context, client *rpc.Client) {
 	log.Printf("We made the API CALL")
 	var req AvailableReq
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -57,147 +60,92 @@ func HandleCreditsAvail(c *gin.Context, ch *amqp.Channel) {
 		})
 		return
 	}
-
-	replyQ, err := ch.QueueDeclare(
-		"",    // name: empty → broker generates one
-		false, // durable
-		true,  // auto-delete when unused
-		true,  // exclusive
-		false, // no-wait
-		nil,
-	)
-	log.Printf("Queue declared")
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, AvailableResp{
-			Status:      "error",
-			ErrorDetail: "queue declare failed: " + err.Error(),
-		})
-		log.Printf("JSON ERROR")
-		return
-	}
-
-	msgs, err := ch.Consume(
-		replyQ.Name,
-		"",    // consumer tag
-		true,  // auto-ack
-		true,  // exclusive
-		false, // no-local
-		false, // no-wait
-		nil,
-	)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, AvailableResp{
-			Status:      "error",
-			ErrorDetail: "consume start failed: " + err.Error(),
-		})
-		return
-	}
-
-	corrID := uuid.New().String()
-	reqBody, _ := json.Marshal(req)
-
-	if err := ch.Publish(
-		"clearSky.events", // exchange
-		"credits.avail",   // routing key
-		false, false,
-		amqp.Publishing{
-			ContentType:   "application/json",
-			CorrelationId: corrID,
-			ReplyTo:       replyQ.Name,
-			Body:          reqBody,
-		},
-	); err != nil {
-		c.JSON(http.StatusInternalServerError, AvailableResp{
-			Status:      "error",
-			ErrorDetail: "publish failed: " + err.Error(),
-		})
+	if !mayUseCredits(c, client, req.Name) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := rpcContext(c, rpcTimeout)
 	defer cancel()
 
-	for {
-		select {
-		case <-ctx.Done():
+	var resp AvailableResp
+	if err := client.CallJSON(ctx, eventsExchange, "credits.avail", types.CreditsAvailRequest{Name: req.Name}, &resp); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
 			c.JSON(http.StatusGatewayTimeout, AvailableResp{
 				Status:      "error",
 				ErrorDetail: "timeout waiting for service",
 			})
 			return
-
-		case d := <-msgs:
-			// ignore other correlation IDs
-			if d.CorrelationId != corrID {
-				continue
-			}
-
-			var resp AvailableResp
-			if err := json.Unmarshal(d.Body, &resp); err != nil {
-				c.JSON(http.StatusInternalServerError, AvailableResp{
-					Status:      "error",
-					ErrorDetail: "unmarshal reply failed: " + err.Error(),
-				})
-				return
-			}
-
-			statusCode := http.StatusOK
-			if resp.Status != "ok" {
-				statusCode = http.StatusBadRequest
-			}
-			c.JSON(statusCode, resp)
-			return
 		}
+		c.JSON(rpcStatus(c, err), AvailableResp{
+			Status:      "error",
+			ErrorDetail: err.Error(),
+		})
+		return
 	}
-}
 
-// this function will be used after uploaded final grades.
-func HandleCreditsSpent(ch *amqp.Channel) error {
-	type Payload struct {
-		Name   string  `json:"name"`
-		Amount float64 `json:"amount"`
+	statusCode := http.StatusOK
+	if resp.Status != "ok" {
+		statusCode = http.StatusBadRequest
 	}
-	body := Payload{
-		Name:   "NTUA",
-		Amount: 1,
+	c.JSON(statusCode, resp)
+}
+
+// InsufficientCredits is the 402 body for an upload the institution
+// cannot afford.
+type InsufficientCredits struct {
+	Error       string `json:"error"`
+	Institution string `json:"institution"`
+	Rows        int    `json:"rows"`
+	Required    int    `json:"required"`
+	Available   int    `json:"available"`
+}
+
+// creditBalance asks credits_service for institution's balance.
+func creditBalance(ctx context.Context, client *rpc.Client, institution string) (int, error) {
+	var resp AvailableResp
+	if err := client.CallJSON(ctx, eventsExchange, "credits.avail", types.CreditsAvailRequest{Name: institution}, &resp); err != nil {
+		return 0, err
 	}
-	jsonbody, err := json.Marshal(body)
-	if err != nil {
-		return err
+	if resp.Status != "ok" {
+		return 0, fmt.Errorf("credits.avail for %q: %s %s", institution, resp.Message, resp.ErrorDetail)
 	}
-	return ch.Publish(
-		"clearSky.events",
-		"credits.spent",
-		false,
-		false,
-		amqp.Publishing{
-			ContentType:  "application/json",
-			DeliveryMode: amqp.Persistent,
-			Body:         jsonbody,
-		},
-	)
+	return resp.Credits, nil
 }
 
-func HandleFinalGradesInc(req PurchaseRequest, ch *amqp.Channel) error {
-	jsonbody, err := json.Marshal(req)
+// checkBalance answers 402 when the quoted institution cannot pay for the
+// upload, or the RPC status when the balance is unknown.
+func checkBalance(c *gin.Context, client *rpc.Client, quote pricing.Quote) bool {
+	if quote.Credits == 0 {
+		return true
+	}
+	ctx, cancel := rpcContext(c, rpcTimeout)
+	defer cancel()
 
+	available, err := creditBalance(ctx, client, quote.Institution)
 	if err != nil {
-		return err
+		log.Printf("[Credits] ❌ balance check for %s failed: %v", quote.Institution, err)
+		c.JSON(rpcStatus(c, err), gin.H{"error": "could not check the institution's credits"})
+		return false
 	}
-	return ch.Publish(
-		"clearSky.events",
-		"incr.credits",
-		false,
-		false,
-		amqp.Publishing{
-			ContentType:  "application/json",
-			DeliveryMode: amqp.Persistent,
-			Body:         jsonbody,
-		},
-	)
+	if available < quote.Credits {
+		log.Printf("[Credits] 💸 %s has %d credits, upload needs %d", quote.Institution, available, quote.Credits)
+		c.JSON(http.StatusPaymentRequired, InsufficientCredits{
+			Error:       "insufficient credits",
+			Institution: quote.Institution,
+			Rows:        quote.Rows,
+			Required:    quote.Credits,
+			Available:   available,
+		})
+		return false
+	}
+	return true
 }
 
-func HandleCreditsPurchased(c *gin.Context, ch *amqp.Channel) {
+func HandleFinalGradesInc(ctx context.Context, req PurchaseRequest, client *rpc.Client) error {
+	return client.PublishJSON(ctx, eventsExchange, "incr.credits", types.CreditsPurchasedEvent{Name: req.Name, Amount: req.Amount})
+}
+
+func HandleCreditsPurchased(c *gin.Context, client *rpc.Client) {
 	log.Println("[HandleCreditsPurchased] → entered")
 
 	// 1. Bind JSON
@@ -208,118 +156,44 @@ func HandleCreditsPurchased(c *gin.Context, ch *amqp.Channel) {
 		return
 	}
 	log.Printf("[HandleCreditsPurchased] 📥 request: name=%s amount=%d", req.Name, req.Amount)
-
-	// 2. Declare a temporary reply queue
-	log.Println("[HandleCreditsPurchased] ⏳ declaring reply queue")
-	replyQ, err := ch.QueueDeclare(
-		"",    // empty name = broker-generated
-		false, // durable
-		true,  // auto-delete
-		true,  // exclusive
-		false, // no-wait
-		nil,   // args
-	)
-	if err != nil {
-		log.Printf("[HandleCreditsPurchased] ❌ QueueDeclare failed: %v", err)
-		c.JSON(http.StatusInternalServerError, PurchaseResponse{
-			Status:  "error",
-			Message: "failed to create reply queue",
-			Error:   err.Error(),
-		})
+	if !mayUseCredits(c, client, req.Name) {
 		return
 	}
-	log.Printf("[HandleCreditsPurchased] ✅ declared reply queue: %s", replyQ.Name)
 
-	// 3. Start consuming replies
-	log.Printf("[HandleCreditsPurchased] ⏳ start consuming on %s", replyQ.Name)
-	msgs, err := ch.Consume(
-		replyQ.Name,
-		"",    // consumer tag
-		true,  // auto-ack
-		true,  // exclusive
-		false, // no-local
-		false, // no-wait
-		nil,
-	)
-	if err != nil {
-		log.Printf("[HandleCreditsPurchased] ❌ Consume failed: %v", err)
-		c.JSON(http.StatusInternalServerError, PurchaseResponse{
-			Status:  "error",
-			Message: "failed to start consuming replies",
-			Error:   err.Error(),
-		})
-		return
-	}
-	log.Println("[HandleCreditsPurchased] ✅ consumer started")
-
-	// 4. Publish the event
-	corrID := uuid.New().String()
-	body, _ := json.Marshal(req)
-	log.Printf("[HandleCreditsPurchased] ⏳ publishing to exchange=clearSky.events routingKey=credits.purchased corrID=%s", corrID)
-	err = ch.Publish(
-		"clearSky.events",   // exchange
-		"credits.purchased", // routing key
-		false,               // mandatory
-		false,               // immediate
-		amqp.Publishing{
-			ContentType:   "application/json",
-			CorrelationId: corrID,
-			ReplyTo:       replyQ.Name,
-			Body:          body,
-		},
-	)
-	if err != nil {
-		log.Printf("[HandleCreditsPurchased] ❌ Publish failed: %v", err)
-		c.JSON(http.StatusInternalServerError, PurchaseResponse{
-			Status:  "error",
-			Message: "failed to publish request",
-			Error:   err.Error(),
-		})
-		return
-	}
-	log.Println("[HandleCreditsPurchased] ✅ published, waiting for reply...")
-
-	// 5. Wait for reply (with timeout)
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	// 2. Publish the event and wait for the reply (with timeout)
+	ctx, cancel := rpcContext(c, rpcTimeout)
 	defer cancel()
 
-	for {
-		select {
-		case <-ctx.Done():
+	log.Println("[HandleCreditsPurchased] ⏳ publishing to credits.purchased, waiting for reply...")
+	ev := types.CreditsPurchasedEvent{Name: req.Name, Amount: req.Amount, PurchaseID: idempotency.RequestID(c)}
+	var resp PurchaseResponse
+	if err := client.CallJSON(ctx, eventsExchange, "credits.purchased", ev, &resp); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
 			log.Println("[HandleCreditsPurchased] ⏰ timeout waiting for reply")
 			c.JSON(http.StatusGatewayTimeout, PurchaseResponse{
 				Status:  "error",
 				Message: "service timeout",
 			})
 			return
+		}
+		log.Printf("[HandleCreditsPurchased] ❌ RPC failed: %v", err)
+		c.JSON(rpcStatus(c, err), PurchaseResponse{
+			Status:  "error",
+			Message: "credits request failed",
+			Error:   err.Error(),
+		})
+		return
+	}
 
-		case d := <-msgs:
-			log.Printf("[HandleCreditsPurchased] 🔔 got delivery corrID=%s", d.CorrelationId)
-			if d.CorrelationId != corrID {
-				log.Printf("[HandleCreditsPurchased] 🔍 ignoring stray message (corrID=%s)", d.CorrelationId)
-				continue
-			}
-
-			log.Println("[HandleCreditsPurchased] ⏳ unmarshalling reply")
-			var resp PurchaseResponse
-			if err := json.Unmarshal(d.Body, &resp); err != nil {
-				log.Printf("[HandleCreditsPurchased] ❌ invalid reply format: %v", err)
-				c.JSON(http.StatusInternalServerError, PurchaseResponse{
-					Status:  "error",
-					Message: "invalid reply format",
-					Error:   err.Error(),
-				})
-				return
-			}
-
-			statusCode := http.StatusOK
-			if resp.Status != "ok" {
-				statusCode = http.StatusBadRequest
-			}
-			log.Printf("[HandleCreditsPurchased] ✅ replying to client with status=%d message=%q", statusCode, resp.Message)
-			HandleFinalGradesInc(req, ch)
-			c.JSON(statusCode, resp)
-			return
+	statusCode := http.StatusOK
+	if resp.Status != "ok" {
+		statusCode = http.StatusBadRequest
+	}
+	log.Printf("[HandleCreditsPurchased] ✅ replying to client with status=%d message=%q", statusCode, resp.Message)
+	if resp.Status == "ok" {
+		if err := publishEvent(ctx, client, "credits.purchased", ev); err != nil {
+			log.Printf("[HandleCreditsPurchased] ❌ credits.purchased event publish failed: %v", err)
 		}
 	}
+	c.JSON(statusCode, resp)
 }
@@ -0,0 +1,198 @@
+package handlers
+
+// Admin endpoints over the orchestrator's dead-letter queue. Every call,
+// including read-only ones, is appended to an NDJSON audit trail.
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"orchestrator/internal/idempotency"
+	"orchestrator/internal/middleware"
+	"orchestrator/internal/rabbitmq"
+
+	"github.com/gin-gonic/gin"
+)
+
+const auditPath = "dlq_audit.json"
+
+// AuditEntry records one admin action on the DLQ.
+type AuditEntry struct {
+	Time   time.Time `json:"time"`
+	Actor  string    `json:"actor"`
+	Action string    `json:"action"` // list, preview, replay, purge
+	IDs    []string  `json:"ids,omitempty"`
+	Count  int       `json:"count"`
+	Error  string    `json:"error,omitempty"`
+}
+
+var auditMu sync.Mutex
+
+func audit(c *gin.Context, action string, ids []string, count int, err error) {
+	entry := AuditEntry{
+		Time:   time.Now().UTC(),
+		Actor:  middleware.GetUsername(c),
+		Action: action,
+		IDs:    ids,
+		Count:  count,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	log.Printf("[DLQ] audit: %s by %q ids=%v count=%d err=%v", action, entry.Actor, ids, count, err)
+
+	data, mErr := json.Marshal(entry)
+	if mErr != nil {
+		log.Printf("[DLQ] ❌ marshal audit entry: %v", mErr)
+		return
+	}
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	f, oErr := os.OpenFile(auditPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if oErr != nil {
+		log.Printf("[DLQ] ❌ open %s: %v", auditPath, oErr)
+		return
+	}
+	defer f.Close()
+	if _, wErr := f.Write(append(data, '\n')); wErr != nil {
+		log.Printf("[DLQ] ❌ write %s: %v", auditPath, wErr)
+	}
+}
+
+// dlqStatus maps DLQ errors to HTTP statuses.
+func dlqStatus(err error) int {
+	switch {
+	case errors.Is(err, rabbitmq.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, rabbitmq.ErrNotConnected):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// HandleDLQList lists dead letters: GET /admin/dlq?limit=50
+func HandleDLQList(c *gin.Context, dlq *rabbitmq.DLQ) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	list, err := dlq.List(limit)
+	audit(c, "list", nil, len(list), err)
+	if err != nil {
+		c.JSON(dlqStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"count": len(list), "messages": list})
+}
+
+// HandleDLQPreview returns one dead letter with its full body: GET /admin/dlq/:id
+func HandleDLQPreview(c *gin.Context, dlq *rabbitmq.DLQ) {
+	id := c.Param("id")
+	msg, err := dlq.Get(id)
+	audit(c, "preview", []string{id}, boolCount(err == nil), err)
+	if err != nil {
+		c.JSON(dlqStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, msg)
+}
+
+// DLQSelection picks dead letters for replay or purge.
+type DLQSelection struct {
+	IDs []string `json:"ids,omitempty"`
+	All bool     `json:"all,omitempty"`
+}
+
+// HandleDLQReplay republishes the selected dead letters: POST /admin/dlq/replay {ids}
+func HandleDLQReplay(c *gin.Context, dlq *rabbitmq.DLQ) {
+	var req DLQSelection
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.IDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ids are required"})
+		return
+	}
+	replayed, err := dlq.Replay(req.IDs)
+	audit(c, "replay", req.IDs, len(replayed), err)
+	if err != nil {
+		if len(replayed) == 0 && errors.Is(err, rabbitmq.ErrNotConnected) {
+			idempotency.Release(c)
+		}
+		c.JSON(dlqStatus(err), gin.H{"error": err.Error(), "replayed": replayed})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"replayed": replayed, "missing": missing(req.IDs, replayed)})
+}
+
+// HandleDLQPurge deletes dead letters: POST /admin/dlq/purge {ids} or {all: true}
+func HandleDLQPurge(c *gin.Context, dlq *rabbitmq.DLQ) {
+	var req DLQSelection
+	if err := c.ShouldBindJSON(&req); err != nil || (len(req.IDs) == 0 && !req.All) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ids or all=true is required"})
+		return
+	}
+	n, err := dlq.Purge(req.IDs, req.All)
+	action := "purge"
+	if req.All {
+		action = "purge_all"
+	}
+	audit(c, action, req.IDs, n, err)
+	if err != nil {
+		if n == 0 && errors.Is(err, rabbitmq.ErrNotConnected) {
+			idempotency.Release(c)
+		}
+		c.JSON(dlqStatus(err), gin.H{"error": err.Error(), "purged": n})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"purged": n})
+}
+
+// HandleDLQAudit returns the audit trail: GET /admin/dlq/audit
+func HandleDLQAudit(c *gin.Context) {
+	f, err := os.Open(auditPath)
+	if os.IsNotExist(err) {
+		c.JSON(http.StatusOK, []AuditEntry{})
+		return
+	} else if err != nil {
+		log.Printf("[DLQ] ❌ open %s: %v", auditPath, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not read audit log"})
+		return
+	}
+	defer f.Close()
+
+	list := []AuditEntry{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			log.Printf("⚠ skipping malformed audit line: %v", err)
+			continue
+		}
+		list = append(list, e)
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func missing(want, got []string) []string {
+	seen := make(map[string]bool, len(got))
+	for _, id := range got {
+		seen[id] = true
+	}
+	out := []string{}
+	for _, id := range want {
+		if !seen[id] {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+func boolCount(ok bool) int {
+	if ok {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,108 @@
+package handlers
+
+// Domain event handlers run by the orchestrator consumer. HTTP handlers
+// publish a domain event on the orchestrator's own exchange once the
+// synchronous part of a request succeeds; the follow-up work (seeding
+// credits, debiting uploads, ...) happens here with retries instead of
+// inside the HTTP request. Handlers also fan events out as live
+// notifications (see notifications.go).
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"orchestrator/internal/config"
+	"orchestrator/internal/events"
+	"orchestrator/internal/rpc"
+	"orchestrator/internal/types"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// RegisterEventHandlers wires every domain event handler into reg.
+func RegisterEventHandlers(reg *events.Registry, client *rpc.Client) {
+	reg.Handle("user.created", HandleUserCreated,
+		policyFor("user.created", events.Policy{AckEarly: true}))
+	reg.Handle("institution.registered", onInstitutionRegistered,
+		policyFor("institution.registered", events.Policy{AckEarly: true}))
+	reg.Handle("institution.approved", onInstitutionApproved(client),
+		policyFor("institution.approved", events.DefaultPolicy))
+	reg.Handle("institution.rejected", onInstitutionRejected(client),
+		policyFor("institution.rejected", events.DefaultPolicy))
+	reg.Handle("credits.purchased", onCreditsPurchased(client),
+		policyFor("credits.purchased", events.DefaultPolicy))
+	reg.Handle("grades.final.uploaded", onFinalGradesUploaded(client),
+		policyFor("grades.final.uploaded", events.Policy{AckEarly: true}))
+	reg.Handle("review.requested", onReviewRequested(client),
+		policyFor("review.requested", events.DefaultPolicy))
+	reg.Handle("review.replied", onReviewReplied(client),
+		policyFor("review.replied", events.DefaultPolicy))
+}
+
+// publishEvent emits a domain event for the orchestrator's own handlers.
+func publishEvent(ctx context.Context, client *rpc.Client, key string, v interface{}) error {
+	return client.PublishJSON(ctx, config.Cfg.Exchange.Name, key, v)
+}
+
+// policyFor applies the config overrides for key on top of def.
+func policyFor(key string, def events.Policy) events.Policy {
+	o, ok := config.Cfg.Handlers[key]
+	if !ok {
+		return def
+	}
+	if o.Concurrency > 0 {
+		def.Concurrency = o.Concurrency
+	}
+	if o.MaxRetries != nil {
+		def.MaxRetries = *o.MaxRetries
+	}
+	if o.RetryDelay > 0 {
+		def.RetryDelay = o.RetryDelay
+	}
+	if o.Timeout > 0 {
+		def.Timeout = o.Timeout
+	}
+	if o.AckEarly != nil {
+		def.AckEarly = *o.AckEarly
+	}
+	return def
+}
+
+// decodeEvent unmarshals d's body; a malformed body is never retried.
+func decodeEvent(d amqp.Delivery, v interface{}) error {
+	if err := json.Unmarshal(d.Body, v); err != nil {
+		return events.Permanent(fmt.Errorf("decode %s: %w", events.EventKey(d), err))
+	}
+	return nil
+}
+
+// HandleUserCreated logs new accounts; nothing depends on it yet.
+func HandleUserCreated(ctx context.Context, d amqp.Delivery) error {
+	log.Printf("[Handler] user.created event received: %s", string(d.Body))
+	return nil
+}
+
+// onInstitutionRegistered logs new registrations; they wait for a
+// platform admin's decision (see onboarding.go).
+func onInstitutionRegistered(ctx context.Context, d amqp.Delivery) error {
+	var ev types.InstitutionRegisteredEvent
+	if err := decodeEvent(d, &ev); err != nil {
+		return err
+	}
+	log.Printf("[Handler] institution.registered: %q by %s awaits approval", ev.Name, ev.RequestedBy)
+	return nil
+}
+
+// onCreditsPurchased tells the grade services about the new allowance.
+func onCreditsPurchased(client *rpc.Client) events.Handler {
+	return func(ctx context.Context, d amqp.Delivery) error {
+		var ev types.CreditsPurchasedEvent
+		if err := decodeEvent(d, &ev); err != nil {
+			return err
+		}
+		log.Printf("[Handler] credits.purchased: %s +%d", ev.Name, ev.Amount)
+		return HandleFinalGradesInc(ctx, PurchaseRequest{Name: ev.Name, Amount: ev.Amount}, client)
+	}
+}
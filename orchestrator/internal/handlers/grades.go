@@ -3,20 +3,28 @@ package handlers
 import (
 	"bytes"
 	"context"
-	"encoding/base64"
-	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"path/filepath"
-	"time"
+	"strings"
+
+	"orchestrator/internal/blobstore"
+	"orchestrator/internal/gradesheet"
+	"orchestrator/internal/jobs"
+	"orchestrator/internal/middleware"
+	"orchestrator/internal/pricing"
+	"orchestrator/internal/rpc"
+	"orchestrator/internal/saga"
+	"orchestrator/internal/types"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
-	amqp "github.com/rabbitmq/amqp091-go"
-	"github.com/xuri/excelize/v2"
 )
 
+// Content type of the canonical workbook sent to the workers
+const xlsxType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
 // Reply coming back from the grades worker
 type ExcelUploadResponse struct {
 	Status  string `json:"status"`  // "ok" | "error"
@@ -26,241 +34,181 @@ type ExcelUploadResponse struct {
 
 // UploadExcelInit – Gin controller
 //
-// Expects a multipart field named "file" with a .xlsx inside.
-// Publishes the workbook to RabbitMQ (base-64 string) and waits up to 10 s
-// for a JSON reply from the worker.
-func UploadExcelInit(c *gin.Context, ch *amqp.Channel) {
-	//------------------------------------------------------------
-	// 1) Receive + quick template validation
-	//------------------------------------------------------------
-	file, err := c.FormFile("file")
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "no file received"})
-		return
-	}
-	if filepath.Ext(file.Filename) != ".xlsx" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "only .xlsx files allowed"})
+// Expects a multipart field named "file" with a .xlsx, .ods or .csv inside;
+// the latter two are converted to .xlsx so downstream sees one format. The
+// sheet is validated against the template here (422 with a per-cell report
+// when it does not match). A clean sheet is put in the blob store and the
+// grades worker, statistics and view services are sent a reference to it
+// from a background job; the reply is 202 with the job to poll
+// (GET /jobs/:id) or stream.
+func UploadExcelInit(c *gin.Context, client *rpc.Client, store *jobs.Store, blobs *blobstore.Store) {
+	filename, up, ok := readSheet(c, "[UploadExcelInit]")
+	if !ok {
 		return
 	}
 
-	src, _ := file.Open()
-	defer src.Close()
+	job := store.Submit(c.Request.Context(), "grades.initial", filename, middleware.GetUsername(c),
+		func(ctx context.Context) (interface{}, error) {
+			ref, err := blobs.Put(ctx, up.Name, xlsxType, up.Data)
+			if err != nil {
+				return nil, err
+			}
+			resp, err := uploadSheet(ctx, client, "postgrades.init", ref)
+			if err != nil {
+				return jobResult(resp), err
+			}
+			ForwardToStatistics(ctx, client, ref) //update statistics ms
+			ForwardToView(ctx, client, ref)
+			return resp, nil
+		})
+	log.Printf("[UploadExcelInit] %s queued as job %s", filename, job.ID)
+	acceptJob(c, job)
+}
 
-	var buf bytes.Buffer
-	if _, err = io.Copy(&buf, src); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read file"})
+// UploadExcelFinal is UploadExcelInit for final grades, billed to the
+// uploader's institution. The sheet is priced by its graded rows and
+// refused with 402 up front when the institution's balance does not cover
+// it (403 when the caller has no institution). The job then runs the
+// final-grades saga: the credits are held, the sheet is published, and the
+// hold is committed if the worker accepts it or released otherwise.
+func UploadExcelFinal(c *gin.Context, client *rpc.Client, store *jobs.Store, blobs *blobstore.Store, pricer *pricing.Pricer, sagas *saga.Runner) {
+	log.Println("[UploadExcelFinal] Receiving file...")
+	institution := middleware.GetInstitution(c)
+	if institution == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "your account is not linked to an institution"})
 		return
 	}
-
-	// Very light-weight check so we don’t send garbage downstream
-	if _, err := excelize.OpenReader(bytes.NewReader(buf.Bytes())); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid Excel file"})
+	filename, up, ok := readSheet(c, "[UploadExcelFinal]")
+	if !ok {
 		return
 	}
+	uploadedBy := middleware.GetUsername(c)
 
-	//------------------------------------------------------------
-	// 2) Build RPC envelope
-	//------------------------------------------------------------
-	replyQ, err := ch.QueueDeclare(
-		"",    // broker generates a random name
-		false, // durable
-		true,  // auto-delete
-		true,  // exclusive
-		false, // no-wait
-		nil,
-	)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot declare reply queue"})
+	quote := pricer.Quote(institution, len(up.Sheet.Rows))
+	if !checkBalance(c, client, quote) {
 		return
 	}
+	log.Printf("[UploadExcelFinal] %s: %d rows cost %s %d credits", filename, quote.Rows, institution, quote.Credits)
 
-	msgs, err := ch.Consume(
-		replyQ.Name, "", true, true, false, false, nil,
-	)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot consume reply"})
-		return
+	studentIDs := make([]string, 0, len(up.Sheet.Rows))
+	for _, row := range up.Sheet.Rows {
+		studentIDs = append(studentIDs, row.AM)
 	}
 
-	corrID := uuid.New().String()
-
-	// ----- publish base-64 string as text/plain -----
-	encoded := base64.StdEncoding.EncodeToString(buf.Bytes())
-
-	if err := ch.Publish(
-		"clearSky.events", // <<< same exchange your worker binds to
-		"postgrades.init",
-		false, false,
-		amqp.Publishing{
-			ContentType:   "text/plain", // makes the message readable in any CLI
-			CorrelationId: corrID,
-			ReplyTo:       replyQ.Name,
-			MessageId:     file.Filename,
-			Body:          []byte(encoded),
-		},
-	); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to publish file"})
-		return
-	}
-
-	//------------------------------------------------------------
-	// 3) Wait for the worker’s reply (10 s timeout)
-	//------------------------------------------------------------
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	for {
-		select {
-		case <-ctx.Done():
-			c.JSON(http.StatusGatewayTimeout, gin.H{"error": "service timeout"})
-			return
-
-		case d := <-msgs:
-			if d.CorrelationId != corrID {
-				continue // stray message
-			}
-
-			var resp ExcelUploadResponse
-			if err := json.Unmarshal(d.Body, &resp); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "invalid reply format"})
-				return
+	job := store.Submit(c.Request.Context(), "grades.final", filename, uploadedBy,
+		func(ctx context.Context) (interface{}, error) {
+			ref, err := blobs.Put(ctx, up.Name, xlsxType, up.Data)
+			if err != nil {
+				return nil, err
 			}
-
-			status := http.StatusOK
-			if resp.Status != "ok" {
-				status = http.StatusBadRequest
+			rec, err := sagas.Start(ctx, &saga.Record{
+				Institution: institution,
+				Rows:        quote.Rows,
+				Credits:     quote.Credits,
+				Sheet:       ref,
+				Course:      up.Sheet.Course,
+				ExamPeriod:  up.Sheet.Period,
+				UploadedBy:  uploadedBy,
+				StudentIDs:  studentIDs,
+			})
+			log.Printf("[UploadExcelFinal] saga %s for %s ended %s", rec.ID, filename, rec.Step)
+			if rec.Result == nil {
+				return nil, err
 			}
-			ForwardToStatistics(ch, buf.Bytes(), file.Filename) //update statistics ms
-			ForwardToView(ch, buf.Bytes(), file.Filename)
-			c.JSON(status, resp)
-			return
-		}
-	}
+			return rec.Result, err
+		})
+	log.Printf("[UploadExcelFinal] %s queued as job %s", filename, job.ID)
+	acceptJob(c, job)
 }
 
-func UploadExcelFinal(c *gin.Context, ch *amqp.Channel) {
-	log.Println("[UploadExcelFinal] Receiving file...")
+// SheetErrors is the 422 body for a grade sheet that does not match the
+// template.
+type SheetErrors struct {
+	Error     string                 `json:"error"`
+	Errors    []gradesheet.CellError `json:"errors"`
+	Truncated bool                   `json:"truncated,omitempty"`
+}
 
-	// 1) Receive + quick template validation
+// readSheet reads the "file" field, validates it against the grade sheet
+// template and converts it to .xlsx, answering 400/422/500 itself when
+// that fails. It returns the uploaded filename and the canonical sheet.
+func readSheet(c *gin.Context, tag string) (string, *gradesheet.Upload, bool) {
 	file, err := c.FormFile("file")
 	if err != nil {
-		log.Println("[UploadExcelFinal] No file received")
+		log.Printf("%s No file received", tag)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "no file received"})
-		return
+		return "", nil, false
 	}
-
-	if filepath.Ext(file.Filename) != ".xlsx" {
-		log.Printf("[UploadExcelFinal] Invalid file extension: %s\n", file.Filename)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "only .xlsx files allowed"})
-		return
+	if !gradesheet.Supported(file.Filename) {
+		log.Printf("%s Invalid file extension: %s\n", tag, file.Filename)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "only " + strings.Join(gradesheet.Extensions, ", ") + " files allowed"})
+		return "", nil, false
 	}
 
-	log.Printf("[UploadExcelFinal] Validating file: %s\n", file.Filename)
-	src, _ := file.Open()
+	src, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read file"})
+		return "", nil, false
+	}
 	defer src.Close()
 
 	var buf bytes.Buffer
 	if _, err = io.Copy(&buf, src); err != nil {
-		log.Printf("[UploadExcelFinal] Failed to read file: %v\n", err)
+		log.Printf("%s Failed to read file: %v\n", tag, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read file"})
-		return
-	}
-
-	if _, err := excelize.OpenReader(bytes.NewReader(buf.Bytes())); err != nil {
-		log.Printf("[UploadExcelFinal] Excel validation failed: %v\n", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid Excel file"})
-		return
-	}
+		return "", nil, false
+	}
+
+	// Nothing goes downstream until the whole sheet is clean
+	up, err := gradesheet.Load(file.Filename, buf.Bytes())
+	var invalid *gradesheet.ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		log.Printf("%s %s rejected: %v\n", tag, file.Filename, err)
+		c.JSON(http.StatusUnprocessableEntity, SheetErrors{
+			Error:     invalid.Error(),
+			Errors:    invalid.Errors,
+			Truncated: invalid.Truncated,
+		})
+		return "", nil, false
+	case err != nil:
+		log.Printf("%s Sheet validation failed: %v\n", tag, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid grade sheet file", "details": err.Error()})
+		return "", nil, false
+	}
+	log.Printf("%s %s validated: %d rows for %s (%s)\n", tag, file.Filename, len(up.Sheet.Rows), up.Sheet.Course, up.Sheet.Period)
+	return file.Filename, up, true
+}
 
-	// 2) Build RPC envelope
-	log.Println("[UploadExcelFinal] Declaring reply queue...")
-	replyQ, err := ch.QueueDeclare(
-		"", false, true, true, false, nil,
+// uploadSheet sends the workbook's reference to routingKey and waits for
+// the grades worker's reply. A reply other than "ok" is returned together
+// with an error.
+func uploadSheet(ctx context.Context, client *rpc.Client, routingKey string, ref types.GradeSheetRef) (*ExcelUploadResponse, error) {
+	var resp ExcelUploadResponse
+	err := client.CallEvent(ctx,
+		eventsExchange, // <<< same exchange your worker binds to
+		routingKey, routingKey, ref, &resp,
 	)
-	if err != nil {
-		log.Printf("[UploadExcelFinal] Failed to declare reply queue: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot declare reply queue"})
-		return
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil, errors.New("grades service did not answer in time")
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to publish sheet: %w", err)
 	}
 
-	log.Printf("[UploadExcelFinal] Consuming from reply queue: %s\n", replyQ.Name)
-	msgs, err := ch.Consume(
-		replyQ.Name, "", true, true, false, false, nil,
-	)
-	if err != nil {
-		log.Printf("[UploadExcelFinal] Failed to consume from reply queue: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot consume reply"})
-		return
-	}
-
-	corrID := uuid.New().String()
-	log.Printf("[UploadExcelFinal] Correlation ID: %s\n", corrID)
-
-	encoded := base64.StdEncoding.EncodeToString(buf.Bytes())
-	log.Println("[UploadExcelFinal] Publishing file to postgrades.final...")
-
-	if err := ch.Publish(
-		"clearSky.events",
-		"postgrades.final",
-		false, false,
-		amqp.Publishing{
-			ContentType:   "text/plain",
-			CorrelationId: corrID,
-			ReplyTo:       replyQ.Name,
-			MessageId:     file.Filename,
-			Body:          []byte(encoded),
-		},
-	); err != nil {
-		log.Printf("[UploadExcelFinal] Failed to publish message: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to publish file"})
-		return
+	if resp.Status != "ok" {
+		msg := resp.Error
+		if msg == "" {
+			msg = resp.Message
+		}
+		return &resp, fmt.Errorf("grades service rejected the sheet: %s", msg)
 	}
+	return &resp, nil
+}
 
-	log.Println("[UploadExcelFinal] Waiting for reply from worker...")
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	for {
-		select {
-		case <-ctx.Done():
-			log.Println("[UploadExcelFinal] Timeout waiting for reply")
-			c.JSON(http.StatusGatewayTimeout, gin.H{"error": "service timeout"})
-			return
-
-		case d := <-msgs:
-			if d.CorrelationId != corrID {
-				log.Println("[UploadExcelFinal] Ignoring unrelated message")
-				continue
-			}
-
-			log.Println("[UploadExcelFinal] Received reply from worker")
-			var resp ExcelUploadResponse
-			if err := json.Unmarshal(d.Body, &resp); err != nil {
-				log.Printf("[UploadExcelFinal] Failed to unmarshal reply: %v\n", err)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "invalid reply format"})
-				return
-			}
-
-			log.Println("[UploadExcelFinal] Calling HandleCreditsSpent...")
-			if err := HandleCreditsSpent(ch); err != nil { //update credits ms
-				log.Printf("[UploadExcelFinal] Failed to publish credits spent: %v\n", err)
-				c.JSON(http.StatusInternalServerError, gin.H{
-					"status":  "error",
-					"message": "failed to publish credits spent",
-					"error":   err.Error(),
-				})
-				return
-			}
-
-			log.Println("[UploadExcelFinal] Upload successful, credits deducted")
-			ForwardToStatistics(ch, buf.Bytes(), file.Filename) //update statistics ms
-			ForwardToView(ch, buf.Bytes(), file.Filename)
-			c.JSON(http.StatusOK, gin.H{
-				"status":  resp.Status,
-				"message": "final grades uploaded and credits deducted",
-				"details": resp,
-			})
-			return
-		}
+// jobResult keeps a missing worker reply out of the job's result.
+func jobResult(resp *ExcelUploadResponse) interface{} {
+	if resp == nil {
+		return nil
 	}
+	return resp
 }
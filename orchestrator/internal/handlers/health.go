@@ -0,0 +1,170 @@
+package handlers
+
+// Liveness and readiness probes for container orchestrators. /healthz only
+// says the process is serving; /readyz checks the broker and every
+// downstream dependency listed under readiness in the config, and reports
+// the RPC circuit breakers. An open circuit does not make the orchestrator
+// unready: taking it out of service would not bring the worker back.
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"orchestrator/internal/config"
+	"orchestrator/internal/rabbitmq"
+	"orchestrator/internal/rpc"
+	"orchestrator/internal/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pingEvent is the catalogued readiness probe every Go worker answers.
+const pingEvent = "system.ping"
+
+// defaultReadyTimeout bounds each probe when the config sets none.
+const defaultReadyTimeout = 2 * time.Second
+
+// ReadyReport is the body of GET /readyz.
+type ReadyReport struct {
+	Status       string                      `json:"status" enum:"ready|not_ready"`
+	Broker       CheckResult                 `json:"broker"`
+	Dependencies map[string]DependencyReport `json:"dependencies"`
+	Circuits     []rpc.CircuitState          `json:"circuits"`
+}
+
+// DependencyReport aggregates the checks of one downstream service.
+type DependencyReport struct {
+	Status string        `json:"status" enum:"ok|down"`
+	Checks []CheckResult `json:"checks"`
+}
+
+// CheckResult is the outcome of one probe.
+type CheckResult struct {
+	Target    string `json:"target"`
+	Kind      string `json:"kind" enum:"broker|ping|queue"`
+	Status    string `json:"status" enum:"ok|down"`
+	Error     string `json:"error,omitempty"`
+	Consumers int    `json:"consumers,omitempty"`
+	Service   string `json:"service,omitempty"`
+	LatencyMS int64  `json:"latency_ms"`
+}
+
+// HandleHealthz reports that the process is up: GET /healthz
+func HandleHealthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// HandleReadyz probes the broker and every configured dependency in
+// parallel and answers 200 only when all of them are up: GET /readyz
+func HandleReadyz(c *gin.Context, client *rpc.Client, mgr *rabbitmq.Manager) {
+	timeout := config.Cfg.Readiness.Timeout
+	if timeout <= 0 {
+		timeout = defaultReadyTimeout
+	}
+
+	report := ReadyReport{
+		Status:       "ready",
+		Broker:       CheckResult{Target: "rabbitmq", Kind: "broker", Status: "ok"},
+		Dependencies: map[string]DependencyReport{},
+	}
+	if !mgr.Connected() || !client.Available() {
+		report.Broker.Status = "down"
+		report.Broker.Error = rpc.ErrUnavailable.Error()
+	}
+
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	for _, dep := range config.Cfg.Readiness.Dependencies {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := checkDependency(c.Request.Context(), client, mgr, dep, timeout)
+			mu.Lock()
+			report.Dependencies[dep.Name] = r
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	report.Circuits = client.Circuits()
+
+	status := http.StatusOK
+	ready := report.Broker.Status == "ok"
+	for _, r := range report.Dependencies {
+		ready = ready && r.Status == "ok"
+	}
+	if !ready {
+		report.Status = "not_ready"
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
+
+func checkDependency(ctx context.Context, client *rpc.Client, mgr *rabbitmq.Manager, dep config.Dependency, timeout time.Duration) DependencyReport {
+	checks := make([]CheckResult, len(dep.Ping)+len(dep.Queues))
+	var wg sync.WaitGroup
+	for i, key := range dep.Ping {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			checks[i] = pingKey(ctx, client, key, timeout)
+		}()
+	}
+	for i, queue := range dep.Queues {
+		checks[len(dep.Ping)+i] = queueCheck(mgr, queue)
+	}
+	wg.Wait()
+
+	report := DependencyReport{Status: "ok", Checks: checks}
+	for _, ch := range checks {
+		if ch.Status != "ok" {
+			report.Status = "down"
+		}
+	}
+	return report
+}
+
+// pingKey sends system.ping over routingKey and waits for the worker's reply.
+func pingKey(ctx context.Context, client *rpc.Client, routingKey string, timeout time.Duration) CheckResult {
+	res := CheckResult{Target: routingKey, Kind: "ping", Status: "ok"}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	var reply types.PingReply
+	err := client.CallEvent(ctx, eventsExchange, routingKey, pingEvent, types.PingRequest{From: "orchestrator"}, &reply)
+	res.LatencyMS = time.Since(start).Milliseconds()
+	switch {
+	case err != nil:
+		res.Status = "down"
+		res.Error = err.Error()
+	case reply.Status != "ok":
+		res.Status = "down"
+		res.Error = fmt.Sprintf("unexpected ping status %q", reply.Status)
+	}
+	res.Service = reply.Service
+	return res
+}
+
+// queueCheck requires at least one consumer on queue.
+func queueCheck(mgr *rabbitmq.Manager, queue string) CheckResult {
+	res := CheckResult{Target: queue, Kind: "queue", Status: "ok"}
+	start := time.Now()
+	n, err := mgr.QueueConsumers(queue)
+	res.LatencyMS = time.Since(start).Milliseconds()
+	res.Consumers = n
+	switch {
+	case err != nil:
+		res.Status = "down"
+		res.Error = err.Error()
+	case n == 0:
+		res.Status = "down"
+		res.Error = "no consumers"
+	}
+	return res
+}
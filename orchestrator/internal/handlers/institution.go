@@ -2,17 +2,19 @@
 package handlers
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
-	"os"
+	"strconv"
 	"time"
 
+	"orchestrator/internal/middleware"
+	"orchestrator/internal/rpc"
+	"orchestrator/internal/types"
+
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
-	amqp "github.com/rabbitmq/amqp091-go"
 )
 
 // UserRequest is the payload we expect from the client.
@@ -22,8 +24,6 @@ type UserRequest struct {
 	Director string `json:"director"`
 }
 
-const storagePath = "requests.json"
-
 // Response is the structure sent back to the client.
 type Response struct {
 	Status      string `json:"status"`                // "ok", "conflict", "error"
@@ -31,9 +31,10 @@ type Response struct {
 	ErrorDetail string `json:"errorDetail,omitempty"` // optional detailed error
 }
 
-// HandleInstitutionRegistered receives a registration request, logs it to disk as NDJSON,
-// publishes an AMQP event, waits for the worker reply, and then returns the worker’s response.
-func HandleInstitutionRegistered(c *gin.Context, ch *amqp.Channel) {
+// HandleInstitutionRegistered receives a registration request, publishes an AMQP event,
+// waits for the worker reply, and then returns the worker’s response. The registration
+// stays pending until a platform admin decides on it (see onboarding.go).
+func HandleInstitutionRegistered(c *gin.Context, client *rpc.Client) {
 	log.Println("→ HandleInstitutionRegistered called")
 
 	var req UserRequest
@@ -42,162 +43,171 @@ func HandleInstitutionRegistered(c *gin.Context, ch *amqp.Channel) {
 		return
 	}
 	log.Printf("✅ Parsed UserRequest: %+v", req)
-
-	// append to ./requests.json
-	if data, err := json.Marshal(req); err != nil {
-		log.Printf("❌ marshal for storage: %v", err)
-	} else if f, err := os.OpenFile(storagePath,
-		os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644,
-	); err != nil {
-		log.Printf("❌ open %s: %v", storagePath, err)
-	} else {
-		defer f.Close()
-		if _, err := f.Write(append(data, '\n')); err != nil {
-			log.Printf("❌ write to %s: %v", storagePath, err)
-		} else {
-			log.Println("✅ Stored request in", storagePath)
-		}
+	ev := types.InstitutionRegisteredEvent{
+		Name:        req.Name,
+		Email:       req.Email,
+		Director:    req.Director,
+		RequestedBy: middleware.GetUsername(c),
 	}
 
-	// 3️⃣ Declare a temporary reply queue
-	log.Println("… Declaring temporary reply queue")
-	replyQ, err := ch.QueueDeclare(
-		"",    // name (empty → let the broker generate)
-		false, // durable
-		true,  // auto-delete
-		true,  // exclusive
-		false, // no-wait
-		nil,   // args
-	)
-	if err != nil {
-		log.Printf("❌ Queue declare failed: %v", err)
-		c.JSON(http.StatusInternalServerError, Response{
-			Status:      "error",
-			ErrorDetail: "queue declare failed: " + err.Error(),
-		})
-		return
-	}
-	log.Printf("✅ Reply queue declared: %s", replyQ.Name)
-
-	// 4️⃣ Start consuming on the reply queue
-	log.Println("… Starting consumer on reply queue")
-	msgs, err := ch.Consume(
-		replyQ.Name, // queue
-		"",          // consumer tag
-		true,        // auto-ack
-		true,        // exclusive
-		false,       // no-local
-		false,       // no-wait
-		nil,         // args
-	)
-	if err != nil {
-		log.Printf("❌ Consume start failed: %v", err)
-		c.JSON(http.StatusInternalServerError, Response{
-			Status:      "error",
-			ErrorDetail: "consume start failed: " + err.Error(),
-		})
-		return
-	}
-	log.Println("✅ Consumer started")
-
-	// 5️⃣ Publish the institution.registered event
-	corrID := uuid.New().String()
-	body, err := json.Marshal(req)
-	if err != nil {
-		log.Printf("❌ Marshal request failed: %v", err)
-		c.JSON(http.StatusInternalServerError, Response{
-			Status:      "error",
-			ErrorDetail: "marshal request failed: " + err.Error(),
-		})
-		return
-	}
-	log.Printf("… Publishing event with CorrelationId=%s", corrID)
-	if err := ch.Publish(
-		"clearSky.events",        // exchange
-		"institution.registered", // routing key
-		false, false,
-		amqp.Publishing{
-			ContentType:   "application/json",
-			CorrelationId: corrID,
-			ReplyTo:       replyQ.Name,
-			Body:          body,
-		},
-	); err != nil {
-		log.Printf("❌ Publish failed: %v", err)
-		c.JSON(http.StatusInternalServerError, Response{
-			Status:      "error",
-			ErrorDetail: "publish failed: " + err.Error(),
-		})
-		return
-	}
-	log.Println("✅ Message published, awaiting reply")
-
-	// 6️⃣ Wait for a reply or timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	// 3️⃣ Publish the institution.registered event and wait for a reply or timeout
+	ctx, cancel := rpcContext(c, rpcTimeout)
 	defer cancel()
 
-	for {
-		select {
-		case <-ctx.Done():
-			log.Printf("⏱ Timeout waiting for reply (CorrelationId=%s)", corrID)
+	log.Println("… Publishing institution.registered, awaiting reply")
+	var resp Response
+	if err := client.CallJSON(ctx, eventsExchange, "institution.registered", ev, &resp); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			log.Printf("⏱ Timeout waiting for reply: %v", err)
 			c.JSON(http.StatusGatewayTimeout, Response{
 				Status:      "error",
 				ErrorDetail: "timeout waiting for service",
 			})
 			return
-
-		case d := <-msgs:
-			log.Printf("… Received message: CorrelationId=%s", d.CorrelationId)
-			if d.CorrelationId != corrID {
-				log.Printf("🔄 Correlation ID mismatch (expected=%s, got=%s), skipping", corrID, d.CorrelationId)
-				continue
-			}
-			log.Println("✅ Correlation ID matches, processing reply")
-
-			var resp Response
-			if err := json.Unmarshal(d.Body, &resp); err != nil {
-				log.Printf("❌ Unmarshal reply failed: %v", err)
-				c.JSON(http.StatusInternalServerError, Response{
-					Status:      "error",
-					ErrorDetail: "unmarshal reply failed: " + err.Error(),
-				})
-				return
-			}
-			log.Printf("✅ Parsed response: %+v", resp)
-
-			// 7️⃣ Return the worker’s response
-			statusCode := http.StatusOK
-			if resp.Status != "ok" {
-				statusCode = http.StatusBadRequest
-				log.Printf("⚠ Service returned error status: %s", resp.Status)
-			}
-			c.JSON(statusCode, resp)
-			return
 		}
+		log.Printf("❌ RPC failed: %v", err)
+		c.JSON(rpcStatus(c, err), Response{
+			Status:      "error",
+			ErrorDetail: err.Error(),
+		})
+		return
+	}
+	log.Printf("✅ Parsed response: %+v", resp)
+
+	// 4️⃣ Return the worker’s response: accepted, pending approval
+	statusCode := http.StatusAccepted
+	if resp.Status != "ok" {
+		statusCode = http.StatusBadRequest
+		log.Printf("⚠ Service returned error status: %s", resp.Status)
+	} else if err := publishEvent(ctx, client, "institution.registered", ev); err != nil {
+		log.Printf("❌ institution.registered event publish failed: %v", err)
 	}
+	c.JSON(statusCode, resp)
 }
 
-func GetInstitutions(c *gin.Context) {
-	f, err := os.Open(storagePath)
-	if os.IsNotExist(err) {
-		c.JSON(http.StatusOK, []UserRequest{})
-		return
-	} else if err != nil {
-		log.Printf("❌ open %s: %v", storagePath, err)
-		c.JSON(http.StatusInternalServerError, Response{"error", "", "could not read stored institutions"})
-		return
+// Institution is one entry of the institution directory.
+type Institution struct {
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Director  string    `json:"director"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// InstitutionPage is one page of GET /institutions.
+type InstitutionPage struct {
+	Institutions []Institution `json:"institutions"`
+	Total        int           `json:"total"`
+	Page         int           `json:"page"`
+	PageSize     int           `json:"page_size"`
+}
+
+// GetInstitutions returns one page of the approved institutions:
+// GET /institutions?search=&sort=name|director|created_at&order=asc|desc&page=1&page_size=20
+func GetInstitutions(c *gin.Context, client *rpc.Client) {
+	var page InstitutionPage
+	if listInstitutions(c, client, "approved", &page) {
+		c.JSON(http.StatusOK, page)
+	}
+}
+
+// GetInstitution returns one approved institution: GET /institutions/:name
+func GetInstitution(c *gin.Context, client *rpc.Client) {
+	var inst Institution
+	if getInstitution(c, client, "approved", &inst) {
+		c.JSON(http.StatusOK, inst)
 	}
-	defer f.Close()
-
-	var list []UserRequest
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		var req UserRequest
-		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
-			log.Printf("⚠ skipping malformed line: %v", err)
+}
+
+// listInstitutions asks registration_service for one page of the
+// institutions in status (all when empty), with the search, sort, order,
+// page and page_size query parameters of c, and decodes it into page. On
+// failure it answers c and returns false.
+func listInstitutions(c *gin.Context, client *rpc.Client, status string, page interface{}) bool {
+	req := types.InstitutionListRequest{
+		Status: status,
+		Search: c.Query("search"),
+		Sort:   c.Query("sort"),
+		Order:  c.Query("order"),
+	}
+	for _, p := range []struct {
+		name string
+		dst  *int
+	}{{"page", &req.Page}, {"page_size", &req.PageSize}} {
+		v := c.Query(p.name)
+		if v == "" {
 			continue
 		}
-		list = append(list, req)
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": p.name + " must be a positive integer"})
+			return false
+		}
+		*p.dst = n
+	}
+	return callRegistration(c, client, "institution.list", req, "", page)
+}
+
+// getInstitution loads the institution named by the :name parameter of c,
+// which must be in status unless status is empty, into inst. On failure it
+// answers c and returns false.
+func getInstitution(c *gin.Context, client *rpc.Client, status string, inst interface{}) bool {
+	return callRegistration(c, client, "institution.get",
+		types.InstitutionGetRequest{Name: c.Param("name"), Status: status}, "institution", inst)
+}
+
+// callRegistration calls registration_service and decodes the field of
+// its reply named field (the whole reply when empty) into out. A reply
+// whose status is not "ok" is answered with the matching error status.
+func callRegistration(c *gin.Context, client *rpc.Client, key string, req interface{}, field string, out interface{}) bool {
+	ctx, cancel := rpcContext(c, rpcTimeout)
+	defer cancel()
+
+	var reply json.RawMessage
+	if err := client.CallJSON(ctx, eventsExchange, key, req, &reply); err != nil {
+		log.Printf("❌ %s failed: %v", key, err)
+		c.JSON(rpcStatus(c, err), gin.H{"error": err.Error()})
+		return false
+	}
+	var resp struct {
+		Status  string `json:"status"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(reply, &resp); err != nil {
+		log.Printf("❌ %s: malformed reply: %v", key, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "malformed reply from registration service"})
+		return false
+	}
+	switch resp.Status {
+	case "ok":
+	case "invalid":
+		c.JSON(http.StatusBadRequest, gin.H{"error": resp.Message})
+		return false
+	case "not_found":
+		c.JSON(http.StatusNotFound, gin.H{"error": "institution not found"})
+		return false
+	case "conflict":
+		c.JSON(http.StatusConflict, gin.H{"error": resp.Message})
+		return false
+	default:
+		log.Printf("⚠ %s returned %s: %s", key, resp.Status, resp.Message)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "registration service error: " + resp.Message})
+		return false
+	}
+
+	body := reply
+	if field != "" {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(reply, &fields); err != nil || len(fields[field]) == 0 {
+			log.Printf("❌ %s: reply has no %s", key, field)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "malformed reply from registration service"})
+			return false
+		}
+		body = fields[field]
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		log.Printf("❌ %s: malformed reply: %v", key, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "malformed reply from registration service"})
+		return false
 	}
-	c.JSON(http.StatusOK, list)
+	return true
 }
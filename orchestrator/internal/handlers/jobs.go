@@ -0,0 +1,97 @@
+package handlers
+
+// Status of background upload jobs, polled with GET /jobs/:id or
+// followed as server-sent events on GET /jobs/:id/events.
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"orchestrator/internal/jobs"
+	"orchestrator/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sseKeepAlive is how often an idle event stream sends a comment so
+// proxies keep the connection open.
+const sseKeepAlive = 15 * time.Second
+
+// JobAccepted is the 202 body returned when an upload is queued.
+type JobAccepted struct {
+	JobID     string     `json:"job_id"`
+	State     jobs.State `json:"state" enum:"queued|processing|succeeded|failed"`
+	StatusURL string     `json:"status_url"`
+	EventsURL string     `json:"events_url"`
+}
+
+func acceptJob(c *gin.Context, job jobs.Job) {
+	statusURL := "/jobs/" + job.ID
+	if isV1(c) {
+		statusURL = apiV1 + statusURL
+	}
+	c.Header("Location", statusURL)
+	c.JSON(http.StatusAccepted, JobAccepted{
+		JobID:     job.ID,
+		State:     job.State,
+		StatusURL: statusURL,
+		EventsURL: statusURL + "/events",
+	})
+}
+
+// HandleJobStatus returns one job: GET /jobs/:id
+func HandleJobStatus(c *gin.Context, store *jobs.Store) {
+	job, ok := store.Get(c.Param("id"))
+	if !ok || job.Owner != middleware.GetUsername(c) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// HandleJobEvents streams the job's state as server-sent "job" events
+// until it succeeds or fails: GET /jobs/:id/events
+func HandleJobEvents(c *gin.Context, store *jobs.Store) {
+	job, updates, cancel, ok := store.Subscribe(c.Param("id"))
+	if !ok || job.Owner != middleware.GetUsername(c) {
+		if ok {
+			cancel()
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+		return
+	}
+	defer cancel()
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.SSEvent("job", job)
+	c.Writer.Flush()
+	if job.State.Done() {
+		return
+	}
+
+	ticker := time.NewTicker(sseKeepAlive)
+	defer ticker.Stop()
+	last := job
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case j, open := <-updates:
+			if !open {
+				// Done; send the final state if that update was dropped
+				if final, ok := store.Get(job.ID); ok && !last.State.Done() {
+					c.SSEvent("job", final)
+				}
+				return false
+			}
+			c.SSEvent("job", j)
+			last = j
+			return true
+		case <-ticker.C:
+			io.WriteString(w, ": keep-alive\n\n")
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
@@ -0,0 +1,196 @@
+package handlers
+
+// Live notifications: the domain event handlers below work out who should
+// hear about an event and publish one notification per recipient;
+// GET /notifications/stream pushes the caller's to the browser as
+// server-sent "notification" events.
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"orchestrator/internal/config"
+	"orchestrator/internal/events"
+	"orchestrator/internal/middleware"
+	"orchestrator/internal/notify"
+	"orchestrator/internal/rpc"
+	"orchestrator/internal/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// sendNotification publishes n to the recipient key.
+func sendNotification(ctx context.Context, client *rpc.Client, key string, n types.Notification) error {
+	n.ID = uuid.NewString()
+	if n.At.IsZero() {
+		n.At = time.Now().UTC()
+	}
+	exchange := config.Cfg.Notifications.Exchange
+	if exchange == "" {
+		exchange = notify.DefaultExchange
+	}
+	return client.PublishJSON(ctx, exchange, key, n)
+}
+
+// onReviewRequested tells the course's instructors about a new review
+// request.
+func onReviewRequested(client *rpc.Client) events.Handler {
+	return func(ctx context.Context, d amqp.Delivery) error {
+		var ev types.ReviewRequestedEvent
+		if err := decodeEvent(d, &ev); err != nil {
+			return err
+		}
+		var resp struct {
+			Instructors []string `json:"instructors"`
+			Error       string   `json:"error"`
+		}
+		if err := client.CallJSON(ctx, eventsExchange, "instructor.getCourseInstructors",
+			types.CourseInstructorsRequest{Body: types.CourseInstructorsBody{CourseID: ev.CourseID}}, &resp); err != nil {
+			return err
+		}
+		if resp.Error != "" {
+			return fmt.Errorf("instructor.getCourseInstructors for %q: %s", ev.CourseID, resp.Error)
+		}
+		log.Printf("[Handler] review.requested: %s on %s, notifying %d instructor(s)", ev.StudentID, ev.CourseID, len(resp.Instructors))
+		for _, name := range resp.Instructors {
+			if err := sendNotification(ctx, client, notify.UserKey(name), types.Notification{
+				Type:       "review.requested",
+				Message:    fmt.Sprintf("New review request from %s for %s (%s)", ev.StudentID, ev.CourseID, ev.ExamPeriod),
+				Course:     ev.CourseID,
+				ExamPeriod: ev.ExamPeriod,
+				StudentID:  ev.StudentID,
+				At:         ev.RequestedAt,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// onReviewReplied tells the student that their review request was
+// answered.
+func onReviewReplied(client *rpc.Client) events.Handler {
+	return func(ctx context.Context, d amqp.Delivery) error {
+		var ev types.ReviewRepliedEvent
+		if err := decodeEvent(d, &ev); err != nil {
+			return err
+		}
+		log.Printf("[Handler] review.replied: %s answered %s (%s)", ev.Instructor, ev.StudentID, ev.Action)
+		return sendNotification(ctx, client, notify.StudentKey(ev.StudentID), types.Notification{
+			Type:       "review.replied",
+			Message:    fmt.Sprintf("Your review request for %s was answered: %s", ev.ExamPeriod, ev.Action),
+			ExamPeriod: ev.ExamPeriod,
+			StudentID:  ev.StudentID,
+			Action:     ev.Action,
+			At:         ev.RepliedAt,
+		})
+	}
+}
+
+// onFinalGradesUploaded tells the graded students that their grades are
+// out, and the institution when the upload left it low on credits. The
+// credits were already committed by the final-grades saga. Notifications
+// are best effort: failures are logged, not retried.
+func onFinalGradesUploaded(client *rpc.Client) events.Handler {
+	return func(ctx context.Context, d amqp.Delivery) error {
+		var ev types.GradesUploadedEvent
+		if err := decodeEvent(d, &ev); err != nil {
+			return err
+		}
+		log.Printf("[Handler] grades.final.uploaded: %s by %s, %d rows charged %d credits to %s",
+			ev.Filename, ev.UploadedBy, ev.Rows, ev.Credits, ev.Institution)
+
+		failed := 0
+		for _, id := range ev.StudentIDs {
+			if err := sendNotification(ctx, client, notify.StudentKey(id), types.Notification{
+				Type:       "grades.published",
+				Message:    fmt.Sprintf("Final grades for %s (%s) are published", ev.Course, ev.ExamPeriod),
+				Course:     ev.Course,
+				ExamPeriod: ev.ExamPeriod,
+				StudentID:  id,
+				At:         ev.UploadedAt,
+			}); err != nil {
+				failed++
+			}
+		}
+		if failed > 0 {
+			log.Printf("[Handler] ❌ grades.final.uploaded: %d of %d student notifications failed", failed, len(ev.StudentIDs))
+		}
+
+		if threshold := config.Cfg.Notifications.CreditsLow; threshold > 0 && ev.Institution != "" && ev.Credits > 0 {
+			notifyLowCredits(ctx, client, ev.Institution, threshold)
+		}
+		return nil
+	}
+}
+
+// notifyLowCredits warns the institution's representatives when its
+// balance is below threshold.
+func notifyLowCredits(ctx context.Context, client *rpc.Client, institution string, threshold int) {
+	ctx, cancel := context.WithTimeout(ctx, rpcTimeout)
+	defer cancel()
+
+	available, err := creditBalance(ctx, client, institution)
+	if err != nil {
+		log.Printf("[Handler] ❌ credits check for %s failed: %v", institution, err)
+		return
+	}
+	if available >= threshold {
+		return
+	}
+	if err := sendNotification(ctx, client, notify.InstitutionKey(institution), types.Notification{
+		Type:    "credits.low",
+		Message: fmt.Sprintf("%s has %d credits left", institution, available),
+		Credits: &available,
+	}); err != nil {
+		log.Printf("[Handler] ❌ credits.low for %s: %v", institution, err)
+	}
+}
+
+// notificationKeys are the recipient keys the caller listens on.
+func notificationKeys(c *gin.Context) []string {
+	keys := []string{notify.UserKey(middleware.GetUsername(c))}
+	if id := middleware.GetStudentID(c); id != "" && middleware.IsStudent(c) {
+		keys = append(keys, notify.StudentKey(id))
+	}
+	if inst := middleware.GetInstitution(c); inst != "" && middleware.HasRole(c, "institution_representative") {
+		keys = append(keys, notify.InstitutionKey(inst))
+	}
+	return keys
+}
+
+// HandleNotificationStream pushes the caller's notifications as
+// server-sent "notification" events until the client disconnects:
+// GET /notifications/stream
+func HandleNotificationStream(c *gin.Context, hub *notify.Hub) {
+	sub := hub.Subscribe(notificationKeys(c)...)
+	defer sub.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Writer.WriteHeaderNow()
+	c.Writer.Flush()
+
+	ticker := time.NewTicker(sseKeepAlive)
+	defer ticker.Stop()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case n := <-sub.C:
+			c.SSEvent("notification", n)
+			return true
+		case <-ticker.C:
+			// Comment line: keeps proxies from closing an idle stream
+			io.WriteString(w, ": keep-alive\n\n")
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
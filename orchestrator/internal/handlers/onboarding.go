@@ -0,0 +1,230 @@
+package handlers
+
+// Institution onboarding: registrations wait in registration_service until
+// a platform admin approves or rejects them. The decision is announced as
+// institution.approved or institution.rejected; the handlers below open the
+// approved institution's credits account and tell the representative who
+// registered it, and make that institution the one billed for the
+// representative's account.
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"orchestrator/internal/config"
+	"orchestrator/internal/events"
+	"orchestrator/internal/middleware"
+	"orchestrator/internal/notify"
+	"orchestrator/internal/rpc"
+	"orchestrator/internal/types"
+
+	"github.com/gin-gonic/gin"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// OnboardingRecord is an institution registration as admins see it.
+type OnboardingRecord struct {
+	Name        string     `json:"name"`
+	Email       string     `json:"email"`
+	Director    string     `json:"director"`
+	CreatedAt   time.Time  `json:"created_at"`
+	Status      string     `json:"status" enum:"pending|approved|rejected"`
+	RequestedBy string     `json:"requested_by,omitempty"`
+	Reason      string     `json:"reason,omitempty"`
+	DecidedBy   string     `json:"decided_by,omitempty"`
+	DecidedAt   *time.Time `json:"decided_at,omitempty"`
+}
+
+// OnboardingPage is one page of GET /admin/institutions.
+type OnboardingPage struct {
+	Institutions []OnboardingRecord `json:"institutions"`
+	Total        int                `json:"total"`
+	Page         int                `json:"page"`
+	PageSize     int                `json:"page_size"`
+}
+
+// DecisionRequest is the body of an approval ({} will do) or rejection;
+// a rejection needs a reason.
+type DecisionRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// HandleOnboardingQueue lists registrations, pending ones by default:
+// GET /admin/institutions?status=pending|approved|rejected|all&search=&sort=&order=&page=&page_size=
+func HandleOnboardingQueue(c *gin.Context, client *rpc.Client) {
+	status := c.DefaultQuery("status", "pending")
+	switch status {
+	case "all":
+		status = ""
+	case "pending", "approved", "rejected":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be pending, approved, rejected or all"})
+		return
+	}
+	var page OnboardingPage
+	if listInstitutions(c, client, status, &page) {
+		c.JSON(http.StatusOK, page)
+	}
+}
+
+// HandleOnboardingRecord returns one registration in any status:
+// GET /admin/institutions/:name
+func HandleOnboardingRecord(c *gin.Context, client *rpc.Client) {
+	var rec OnboardingRecord
+	if getInstitution(c, client, "", &rec) {
+		c.JSON(http.StatusOK, rec)
+	}
+}
+
+// HandleOnboardingDecision approves or rejects a pending registration and
+// announces the decision:
+// POST /admin/institutions/:name/approve, POST /admin/institutions/:name/reject
+//
+// Repeating a decision answers 200 again and re-announces it, so an admin
+// can retry one whose announcement failed; the other decision is 409.
+func HandleOnboardingDecision(c *gin.Context, client *rpc.Client, decision string) {
+	var body DecisionRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if decision == "reject" && body.Reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "a rejection needs a reason"})
+		return
+	}
+
+	var rec OnboardingRecord
+	if !callRegistration(c, client, "institution.decide", types.InstitutionDecideRequest{
+		Name:      c.Param("name"),
+		Decision:  decision,
+		Reason:    body.Reason,
+		DecidedBy: middleware.GetUsername(c),
+	}, "institution", &rec) {
+		return
+	}
+
+	ev := types.InstitutionDecisionEvent{
+		Name:        rec.Name,
+		RequestedBy: rec.RequestedBy,
+		DecidedBy:   rec.DecidedBy,
+		Reason:      rec.Reason,
+		DecidedAt:   time.Now().UTC(),
+	}
+	if rec.DecidedAt != nil {
+		ev.DecidedAt = *rec.DecidedAt
+	}
+	key := "institution.rejected"
+	if rec.Status == "approved" {
+		key = "institution.approved"
+		ev.StartingCredits = config.Cfg.Onboarding.StartingCredits
+	}
+	log.Printf("[Onboarding] %s %s by %s", rec.Name, rec.Status, rec.DecidedBy)
+
+	ctx, cancel := rpcContext(c, rpcTimeout)
+	defer cancel()
+	if err := publishEvent(ctx, client, key, ev); err != nil {
+		log.Printf("[Onboarding] ❌ publishing %s for %s: %v", key, rec.Name, err)
+		c.JSON(rpcStatus(c, err), gin.H{"error": "decision saved but not announced, retry it: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rec)
+}
+
+// onInstitutionApproved has credits_service open the institution's
+// account and waits for it to confirm, assigns the institution to the
+// representative who registered it, then tells them. A failed step is
+// retried under the handler's policy.
+func onInstitutionApproved(client *rpc.Client) events.Handler {
+	return func(ctx context.Context, d amqp.Delivery) error {
+		var ev types.InstitutionDecisionEvent
+		if err := decodeEvent(d, &ev); err != nil {
+			return err
+		}
+		log.Printf("[Handler] institution.approved: opening credits account for %q with %d credits", ev.Name, ev.StartingCredits)
+		if err := openCreditsAccount(ctx, client, ev); err != nil {
+			return err
+		}
+		if err := assignRepresentative(ctx, client, ev); err != nil {
+			return err
+		}
+		notifyDecision(ctx, client, "institution.approved", ev,
+			fmt.Sprintf("%s was approved; its credits account is open. Sign in again to act for it", ev.Name))
+		return nil
+	}
+}
+
+// openCreditsAccount asks credits_service to open the approved
+// institution's account and returns once it has (or already had) one.
+func openCreditsAccount(ctx context.Context, client *rpc.Client, ev types.InstitutionDecisionEvent) error {
+	ctx, cancel := context.WithTimeout(ctx, rpcTimeout)
+	defer cancel()
+
+	var reply struct {
+		Status  string `json:"status"`
+		Message string `json:"message"`
+	}
+	if err := client.CallJSON(ctx, eventsExchange, "institution.approved", ev, &reply); err != nil {
+		return fmt.Errorf("opening credits account for %q: %w", ev.Name, err)
+	}
+	if reply.Status != "ok" {
+		return fmt.Errorf("credits_service could not open the account of %q: %s", ev.Name, reply.Message)
+	}
+	return nil
+}
+
+// assignRepresentative makes the approved institution the one billed for
+// the account that registered it, on behalf of the admin who approved it.
+// A representative whose account is gone is skipped.
+func assignRepresentative(ctx context.Context, client *rpc.Client, ev types.InstitutionDecisionEvent) error {
+	if ev.RequestedBy == "" {
+		return nil
+	}
+	var reply userAdminReply
+	req := types.UserAdminRequest{Actor: ev.DecidedBy, Username: ev.RequestedBy, Institution: ev.Name}
+	if err := client.CallEvent(ctx, "", "auth.request", "users.set_institution", req, &reply); err != nil {
+		return err
+	}
+	switch reply.Status {
+	case "ok":
+		log.Printf("[Handler] institution.approved: %s now represents %q", ev.RequestedBy, ev.Name)
+	case "not_found":
+		log.Printf("[Handler] ⚠ institution.approved: representative %s of %q no longer exists", ev.RequestedBy, ev.Name)
+	default:
+		return fmt.Errorf("users.set_institution for %s: %s: %s", ev.RequestedBy, reply.Status, reply.Message)
+	}
+	return nil
+}
+
+// onInstitutionRejected tells the representative.
+func onInstitutionRejected(client *rpc.Client) events.Handler {
+	return func(ctx context.Context, d amqp.Delivery) error {
+		var ev types.InstitutionDecisionEvent
+		if err := decodeEvent(d, &ev); err != nil {
+			return err
+		}
+		log.Printf("[Handler] institution.rejected: %q (%s)", ev.Name, ev.Reason)
+		notifyDecision(ctx, client, "institution.rejected", ev,
+			fmt.Sprintf("%s was rejected: %s", ev.Name, ev.Reason))
+		return nil
+	}
+}
+
+// notifyDecision tells the representative who registered the institution;
+// best effort, like the other notifications.
+func notifyDecision(ctx context.Context, client *rpc.Client, kind string, ev types.InstitutionDecisionEvent, msg string) {
+	if ev.RequestedBy == "" {
+		return
+	}
+	if err := sendNotification(ctx, client, notify.UserKey(ev.RequestedBy), types.Notification{
+		Type:        kind,
+		Message:     msg,
+		Institution: ev.Name,
+		Reason:      ev.Reason,
+		At:          ev.DecidedAt,
+	}); err != nil {
+		log.Printf("[Handler] ❌ %s notification for %s: %v", kind, ev.RequestedBy, err)
+	}
+}
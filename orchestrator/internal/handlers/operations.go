@@ -0,0 +1,160 @@
+package handlers
+
+// Review requests and replies are written to both review services through
+// the workflow runner; GET /operations/:id reports how such a write ended.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"orchestrator/internal/middleware"
+	"orchestrator/internal/rpc"
+	"orchestrator/internal/types"
+	"orchestrator/internal/workflow"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OperationResponse is the single reply to a two-service review write.
+type OperationResponse struct {
+	OperationID string         `json:"operation_id"`
+	State       workflow.State `json:"state" enum:"completed|compensating|compensated|failed"`
+	StatusURL   string         `json:"status_url"`
+	// Data holds each service's reply, keyed by service.
+	Data  map[string]json.RawMessage `json:"data,omitempty"`
+	Error string                     `json:"error,omitempty"`
+}
+
+// reviewTransport sends workflow steps to the review services.
+type reviewTransport struct {
+	client *rpc.Client
+}
+
+// ReviewTransport returns the workflow transport for the review services.
+func ReviewTransport(client *rpc.Client) workflow.Transport {
+	return &reviewTransport{client: client}
+}
+
+// Apply sends one write; an {"error": ...} reply is a refusal.
+func (t *reviewTransport) Apply(ctx context.Context, key string, payload interface{}) (json.RawMessage, error) {
+	ctx, cancel := context.WithTimeout(ctx, rpcTimeout)
+	defer cancel()
+
+	var reply json.RawMessage
+	err := t.client.CallJSON(ctx, eventsExchange, key, payload, &reply)
+	if errors.Is(err, types.ErrInvalidPayload) {
+		// Never sent, and sending it again will not help
+		return nil, fmt.Errorf("%w: %w", workflow.ErrRefused, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if msg := replyError(reply); msg != "" {
+		return reply, fmt.Errorf("%w: %s", workflow.ErrRefused, msg)
+	}
+	return reply, nil
+}
+
+// Revert undoes the write made under id. The review services only answer
+// a revert with an error when their database failed, so it is retried.
+func (t *reviewTransport) Revert(ctx context.Context, key, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, rpcTimeout)
+	defer cancel()
+
+	var reply json.RawMessage
+	if err := t.client.CallJSON(ctx, eventsExchange, key,
+		types.ReviewRevertRequest{Body: types.ReviewRevertBody{OperationID: id}}, &reply); err != nil {
+		return err
+	}
+	if msg := replyError(reply); msg != "" {
+		return fmt.Errorf("%s: %s", key, msg)
+	}
+	return nil
+}
+
+// replyError returns the "error" field of a review service reply.
+func replyError(reply json.RawMessage) string {
+	var r struct {
+		Error   string `json:"error"`
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(reply, &r) != nil || r.Error == "" {
+		return ""
+	}
+	if r.Message != "" {
+		return r.Error + " (" + r.Message + ")"
+	}
+	return r.Error
+}
+
+// runReviewOperation writes payload to both review services and answers c
+// once with the outcome: 200, or 201 under /api/v1, with Location naming
+// the operation. It reports whether the operation completed.
+func runReviewOperation(c *gin.Context, ops *workflow.Runner, op *workflow.Operation, payload interface{}) bool {
+	op, err := ops.Start(c.Request.Context(), op, payload)
+
+	res := OperationResponse{
+		OperationID: op.ID,
+		State:       op.State,
+		StatusURL:   "/operations/" + op.ID,
+	}
+	created := http.StatusOK
+	if isV1(c) {
+		res.StatusURL, created = apiV1+res.StatusURL, http.StatusCreated
+	}
+	for _, s := range op.Steps {
+		if s.State == workflow.StepApplied && len(s.Reply) > 0 {
+			if res.Data == nil {
+				res.Data = make(map[string]json.RawMessage)
+			}
+			res.Data[s.Service] = s.Reply
+		}
+	}
+	c.Header("Location", res.StatusURL)
+	if err == nil {
+		c.JSON(created, res)
+		return true
+	}
+
+	log.Printf("[Workflow] %s %s ended %s: %v", op.Kind, op.ID, op.State, err)
+	res.Error = err.Error()
+	switch {
+	case errors.Is(err, types.ErrInvalidPayload):
+		c.JSON(http.StatusBadRequest, res)
+	case errors.Is(err, workflow.ErrRefused):
+		c.JSON(http.StatusUnprocessableEntity, res)
+	default:
+		c.JSON(rpcStatus(c, err), res)
+	}
+	return false
+}
+
+// announce publishes a domain event about a completed review operation;
+// the client already has its answer, so a failure is only logged.
+func announce(c *gin.Context, client *rpc.Client, key string, ev interface{}) {
+	ctx, cancel := rpcContext(c, rpcTimeout)
+	defer cancel()
+	if err := publishEvent(ctx, client, key, ev); err != nil {
+		log.Printf("[Workflow] ❌ publishing %s: %v", key, err)
+	}
+}
+
+// HandleOperationStatus returns one of the caller's operations:
+// GET /operations/:id
+func HandleOperationStatus(c *gin.Context, ops *workflow.Runner) {
+	op, err := ops.Get(c.Param("id"))
+	if errors.Is(err, workflow.ErrNotFound) || (err == nil && op.Owner != middleware.GetUsername(c)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "operation not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("[Workflow] loading %s: %v", c.Param("id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not load the operation"})
+		return
+	}
+	c.JSON(http.StatusOK, op)
+}
@@ -6,46 +6,27 @@ package handlers
 
 import (
 	"context"
-	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"orchestrator/internal/middleware"
-	"time"
+	"orchestrator/internal/rpc"
+	"orchestrator/internal/types"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
-	amqp "github.com/rabbitmq/amqp091-go"
 )
 
 // When upload grades, update view grades too.
 
-func ForwardToView(ch *amqp.Channel, fileData []byte, filename string) {
-	log.Println("[ForwardToView] Encoding data for VIEWING THEM")
-
-	// Base64 encode the file contents
-	encoded := base64.StdEncoding.EncodeToString(fileData)
-	// Log the encoded payload (optional)
-	log.Printf("[ForwardToView] Payload (base64): %s", encoded)
-
-	// Prepare the persistent message
-	msg := amqp.Publishing{
-		ContentType:  "text/plain",
-		DeliveryMode: amqp.Persistent, // ✅ Makes message durable
-		MessageId:    filename,        // Optional metadata
-		Timestamp:    time.Now(),      // Optional timestamp
-		Body:         []byte(encoded),
-	}
-
-	log.Println("[ForwardToView] Publishing to postgrades.VIEW")
+func ForwardToView(ctx context.Context, client *rpc.Client, ref types.GradeSheetRef) {
+	log.Printf("[ForwardToView] Publishing %s (%s) to postgrades.view", ref.Filename, ref.SHA256)
 
-	// Publish to exchange with the durable routing key
-	err := ch.Publish(
-		"clearSky.events", // 🔁 Exchange name (must exist and be durable)
+	// Persistent message carrying only the blob reference
+	err := client.PublishJSON(ctx,
+		eventsExchange,    // 🔁 Exchange name (must exist and be durable)
 		"postgrades.view", // 🎯 Routing key (must match queue binding)
-		false,              // mandatory
-		false,              // immediate
-		msg,
+		ref,
 	)
 
 	if err != nil {
@@ -55,7 +36,7 @@ func ForwardToView(ch *amqp.Channel, fileData []byte, filename string) {
 	}
 }
 
-func HandleGetPersonalGrades(c *gin.Context, ch *amqp.Channel) {
+func HandleGetPersonalGrades(c *gin.Context, client *rpc.Client) {
 	log.Println("[HandleGetPersonalGrades] → entered")
 
 	// Get student_id from JWT context using middleware helper
@@ -69,111 +50,48 @@ func HandleGetPersonalGrades(c *gin.Context, ch *amqp.Channel) {
 	log.Printf("[HandleGetPersonalGrades] 📥 Received request for student_id: %s", studentID)
 
 	// Build request with student_id from JWT
-	req := struct {
-		StudentID string `json:"AM"`
-	}{
-		StudentID: studentID,
-	}
-	log.Println("[HandleGetPersonalGrades] 🔧 Built request payload")
+	req := types.PersonalGradesRequest{AM: studentID}
+	log.Printf("[HandleGetPersonalGrades] 🔧 Built request payload: %+v", req)
 
-	// Marshal and log the JSON payload
-	body, err := json.Marshal(req)
-	if err != nil {
-		log.Printf("[HandleGetPersonalGrades] ❌ Failed to marshal request: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to prepare request payload"})
-		return
-	}
-	log.Printf("[HandleGetPersonalGrades] Payload: %s", string(body))
+	// Publish request and wait for the reply
+	ctx, cancel := rpcContext(c, rpcTimeout)
+	defer cancel()
 
-	// Declare reply queue
-	replyQ, err := ch.QueueDeclare(
-		"", false, true, true, false, nil,
-	)
-	if err != nil {
-		log.Printf("[HandleGetPersonalGrades] ❌ Failed to declare reply queue: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create reply queue"})
+	log.Println("[HandleGetPersonalGrades] 📦 Publishing request to view.avail")
+	var raw json.RawMessage
+	err := client.CallJSON(ctx, eventsExchange, "view.avail", req, &raw)
+	if errors.Is(err, context.DeadlineExceeded) {
+		log.Println("[HandleGetPersonalGrades] ⏰ Timeout while waiting for reply")
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": "Service timeout"})
+		return
+	} else if err != nil {
+		log.Printf("[HandleGetPersonalGrades] ❌ Publish failed: %v", err)
+		c.JSON(rpcStatus(c, err), gin.H{"error": "Failed to publish request: " + err.Error()})
 		return
 	}
-	log.Printf("[HandleGetPersonalGrades] ✅ Reply queue declared: %s", replyQ.Name)
 
-	// Start consuming
-	msgs, err := ch.Consume(
-		replyQ.Name, "", true, true, false, false, nil,
-	)
-	if err != nil {
-		log.Printf("[HandleGetPersonalGrades] ❌ Failed to start consuming: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to consume reply"})
-		return
+	// Log raw JSON response payload
+	log.Printf("[HandleGetPersonalGrades] Response payload: %s", string(raw))
+
+	var gradesResp struct {
+		Status string        `json:"status"`
+		Data   []interface{} `json:"data"`
 	}
-	log.Println("[HandleGetPersonalGrades] 🟢 Started consuming from reply queue")
-
-	// Publish request with correlation ID and reply-to
-	corrID := uuid.New().String()
-	log.Printf("[HandleGetPersonalGrades] 📦 Publishing message with Correlation ID: %s", corrID)
-	err = ch.Publish(
-		"clearSky.events",
-		"view.avail",
-		false, false,
-		amqp.Publishing{
-			ContentType:   "application/json",
-			CorrelationId: corrID,
-			ReplyTo:       replyQ.Name,
-			Body:          body,
-		},
-	)
-	if err != nil {
-		log.Printf("[HandleGetPersonalGrades] ❌ Publish failed: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to publish request"})
+
+	if err := json.Unmarshal(raw, &gradesResp); err != nil {
+		log.Printf("[HandleGetPersonalGrades] ❌ Failed to unmarshal response: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid response format"})
 		return
 	}
-	log.Println("[HandleGetPersonalGrades] 🚀 Request published successfully")
 
-	// Set timeout for reply
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	log.Printf("[HandleGetPersonalGrades] ✅ Successfully received response with status: %s", gradesResp.Status)
 
-	log.Println("[HandleGetPersonalGrades] ⏳ Waiting for response...")
-	for {
-		select {
-		case <-ctx.Done():
-			log.Println("[HandleGetPersonalGrades] ⏰ Timeout while waiting for reply")
-			c.JSON(http.StatusGatewayTimeout, gin.H{"error": "Service timeout"})
-			return
-
-		case d := <-msgs:
-			log.Printf("[HandleGetPersonalGrades] 📬 Received message with Correlation ID: %s", d.CorrelationId)
-
-			// Ignore messages with wrong correlation ID
-			if d.CorrelationId != corrID {
-				log.Printf("[HandleGetPersonalGrades] 🔄 Ignoring mismatched Correlation ID: %s", d.CorrelationId)
-				continue
-			}
-
-			// Log raw JSON response payload
-			log.Printf("[HandleGetPersonalGrades] Response payload: %s", string(d.Body))
-
-			var gradesResp struct {
-				Status string        `json:"status"`
-				Data   []interface{} `json:"data"`
-			}
-
-			if err := json.Unmarshal(d.Body, &gradesResp); err != nil {
-				log.Printf("[HandleGetPersonalGrades] ❌ Failed to unmarshal response: %v", err)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid response format"})
-				return
-			}
-
-			log.Printf("[HandleGetPersonalGrades] ✅ Successfully received response with status: %s", gradesResp.Status)
-
-			statusCode := http.StatusOK
-			if gradesResp.Status != "ok" {
-				log.Printf("[HandleGetPersonalGrades] ⚠️ Non-ok status received: %s", gradesResp.Status)
-				statusCode = http.StatusBadRequest
-			}
-
-			log.Printf("[HandleGetPersonalGrades] 📤 Sending JSON response with status code: %d", statusCode)
-			c.JSON(statusCode, gradesResp)
-			return
-		}
+	statusCode := http.StatusOK
+	if gradesResp.Status != "ok" {
+		log.Printf("[HandleGetPersonalGrades] ⚠️ Non-ok status received: %s", gradesResp.Status)
+		statusCode = http.StatusBadRequest
 	}
+
+	log.Printf("[HandleGetPersonalGrades] 📤 Sending JSON response with status code: %d", statusCode)
+	c.JSON(statusCode, gradesResp)
 }
@@ -1,76 +1,64 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
 	"log"
 	"net/http"
-	"time"
-	"github.com/google/uuid"
 
 	"orchestrator/internal/middleware"
+	"orchestrator/internal/rpc"
+	"orchestrator/internal/types"
+	"orchestrator/internal/workflow"
 
 	"github.com/gin-gonic/gin"
-	amqp "github.com/rabbitmq/amqp091-go"
 )
 
 // helperRequest sends the payload to the given routing key on ExchangeKey and waits for a JSON response
-func helperRequest(ch *amqp.Channel, routingKey string, payload []byte) (map[string]interface{}, error) {
-	log.Printf("[DEBUG] 🟡 helperRequest: routingKey=%s, payload=%s", routingKey, payload)
+func helperRequest(ctx context.Context, client *rpc.Client, routingKey string, payload interface{}) (map[string]interface{}, error) {
+	log.Printf("[DEBUG] 🟡 helperRequest: routingKey=%s, payload=%+v", routingKey, payload)
 
-	corrID := uuid.New().String()
-	replyQueue, err := ch.QueueDeclare("", false, true, true, false, nil)
-	if err != nil {
-		log.Printf("[DEBUG] 🟡 helperRequest: QueueDeclare error: %v", err)
+	var response map[string]interface{}
+	if err := client.CallJSON(ctx, eventsExchange, routingKey, payload, &response); err != nil {
+		log.Printf("[DEBUG] 🟡 helperRequest: %v", err)
 		return nil, err
 	}
+	log.Printf("[DEBUG] 🟡 helperRequest: received response: %+v", response)
+	return response, nil
+}
 
-	msgs, err := ch.Consume(replyQueue.Name, "", true, false, false, false, nil)
-	if err != nil {
-		log.Printf("[DEBUG] 🟡 helperRequest: Consume error: %v", err)
-		return nil, err
-	}
+// ReviewRequestInput is the body of PATCH /student/reviewRequest.
+type ReviewRequestInput struct {
+	CourseID       string `json:"course_id"`
+	StudentMessage string `json:"student_message"`
+	ExamPeriod     string `json:"exam_period"`
+}
 
-	err = ch.Publish(
-		"clearSky.events", // publish to the direct exchange
-		routingKey,
-		false,
-		false,
-		amqp.Publishing{
-			ContentType:   "application/json",
-			CorrelationId: corrID,
-			ReplyTo:       replyQueue.Name,
-			Body:          payload,
-		},
-	)
-	if err != nil {
-		log.Printf("[DEBUG] 🟡 helperRequest: Publish error: %v", err)
-		return nil, err
-	}
+// ReviewStatusInput is the body of PATCH /student/status.
+type ReviewStatusInput struct {
+	CourseID   string `json:"course_id"`
+	ExamPeriod string `json:"exam_period"`
+}
 
-	timeout := time.After(5 * time.Second)
-	for {
-		select {
-		case msg := <-msgs:
-			if msg.CorrelationId == corrID {
-				var response map[string]interface{}
-				err := json.Unmarshal(msg.Body, &response)
-				if err != nil {
-					log.Printf("[DEBUG] 🟡 helperRequest: Unmarshal error: %v", err)
-				}
-				log.Printf("[DEBUG] 🟡 helperRequest: received response: %+v", response)
-				return response, err
-			}
-		case <-timeout:
-			log.Printf("[DEBUG] 🟡 helperRequest: timeout waiting for response")
-			return nil, errors.New("timeout waiting for response")
-		}
-	}
+// InstructorReplyInput is the body of PATCH /instructor/reply.
+type InstructorReplyInput struct {
+	UserID                 string `json:"user_id"`
+	ExamPeriod             string `json:"exam_period"`
+	InstructorReplyMessage string `json:"instructor_reply_message"`
+	InstructorAction       string `json:"instructor_action" enum:"Total accept|Partial accept|Reject"`
+}
+
+// ReviewInfoInput is the body of the instructor request-details call.
+type ReviewInfoInput struct {
+	CourseID   string `json:"course_id"`
+	UserID     string `json:"user_id"`
+	ExamPeriod string `json:"exam_period"`
 }
 
 // HandlePostNewRequest processes new request events
-// -> sends 2 events: student.postNewRequest & instructor.insertStudentRequest
-func HandlePostNewRequest(c *gin.Context, ch *amqp.Channel) {
+// -> one operation: student.postNewRequest then instructor.insertStudentRequest,
+// the student insert is reverted if the instructor one fails
+func HandlePostNewRequest(c *gin.Context, client *rpc.Client, ops *workflow.Runner) {
 	log.Printf("HandlePostNewRequest invoked")
 
 	// Get student info from JWT using middleware helpers
@@ -89,11 +77,7 @@ func HandlePostNewRequest(c *gin.Context, ch *amqp.Channel) {
 		return
 	}
 
-	var req struct {
-		CourseID       string `json:"course_id"`
-		StudentMessage string `json:"student_message"`
-		ExamPeriod     string `json:"exam_period"`
-	}
+	var req ReviewRequestInput
 	if err := c.ShouldBindJSON(&req); err != nil {
 		log.Printf("HandlePostNewRequest: bind error: %v", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
@@ -101,38 +85,33 @@ func HandlePostNewRequest(c *gin.Context, ch *amqp.Channel) {
 	}
 	log.Printf("HandlePostNewRequest: payload struct %+v", req)
 
-	payload, _ := json.Marshal(map[string]interface{}{ // nolint: errcheck
-		"body": map[string]interface{}{
-			"exam_period":     req.ExamPeriod,
-			"course_id":       req.CourseID,
-			"user_id":         userID,
-			"student_id":      studentID,
-			"student_message": req.StudentMessage,
-		},
-	})
-
-	responseStudent, err := helperRequest(ch, "student.postNewRequest", payload)
-	if err != nil {
-		log.Printf("HandlePostNewRequest: student.postNewRequest error: %v", err)
-		c.JSON(http.StatusGatewayTimeout, gin.H{"error": err.Error()})
-		return
-	}
-	log.Printf("HandlePostNewRequest: responseStudent %+v", responseStudent)
-	c.JSON(http.StatusOK, gin.H{"data": responseStudent})
-
-	responseInstructor, err := helperRequest(ch, "instructor.insertStudentRequest", payload)
-	if err != nil {
-		log.Printf("HandlePostNewRequest: instructor.insertStudentRequest error: %v", err)
-		c.JSON(http.StatusGatewayTimeout, gin.H{"error": err.Error()})
-		return
+	op := workflow.New("review.request", middleware.GetUsername(c),
+		workflow.Step{Service: "student", Key: "student.postNewRequest", Revert: "student.revertOperation"},
+		workflow.Step{Service: "instructor", Key: "instructor.insertStudentRequest", Revert: "instructor.revertOperation"},
+	)
+	payload := types.NewReviewRequest{Body: types.NewReviewBody{
+		ExamPeriod:     req.ExamPeriod,
+		CourseID:       req.CourseID,
+		UserID:         userID,
+		StudentID:      studentID,
+		StudentMessage: req.StudentMessage,
+		OperationID:    op.ID,
+	}}
+
+	if runReviewOperation(c, ops, op, payload) {
+		announce(c, client, "review.requested", types.ReviewRequestedEvent{
+			OperationID: op.ID,
+			StudentID:   studentID,
+			CourseID:    req.CourseID,
+			ExamPeriod:  req.ExamPeriod,
+			RequestedAt: op.CreatedAt,
+		})
 	}
-	log.Printf("HandlePostNewRequest: responseInstructor %+v", responseInstructor)
-	c.JSON(http.StatusOK, gin.H{"data": responseInstructor})
 }
 
 // HandleGetRequestStatus processes student sees request status events
 // -> sends 1 event: student.getRequestStatus
-func HandleGetRequestStatus(c *gin.Context, ch *amqp.Channel) {
+func HandleGetRequestStatus(c *gin.Context, client *rpc.Client) {
 	log.Printf("HandleGetRequestStatus invoked")
 
 	studentID := middleware.GetStudentID(c)
@@ -144,10 +123,7 @@ func HandleGetRequestStatus(c *gin.Context, ch *amqp.Channel) {
 		return
 	}
 
-	var req struct {
-		CourseID   string `json:"course_id"`
-		ExamPeriod string `json:"exam_period"`
-	}
+	var req ReviewStatusInput
 	if err := c.ShouldBindJSON(&req); err != nil {
 		log.Printf("HandleGetRequestStatus: bind error: %v", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
@@ -155,19 +131,20 @@ func HandleGetRequestStatus(c *gin.Context, ch *amqp.Channel) {
 	}
 	log.Printf("HandleGetRequestStatus: payload struct %+v", req)
 
-	payload, _ := json.Marshal(map[string]interface{}{ // nolint: errcheck
-		"body": map[string]interface{}{
-			"exam_period": req.ExamPeriod,
-			"course_id":   req.CourseID,
-			"user_id":     userID,
-			"student_id":  studentID,
-		},
-	})
+	payload := types.ReviewStatusRequest{Body: types.ReviewStatusBody{
+		ExamPeriod: req.ExamPeriod,
+		CourseID:   req.CourseID,
+		UserID:     userID,
+		StudentID:  studentID,
+	}}
+
+	ctx, cancel := rpcContext(c, rpcTimeout)
+	defer cancel()
 
-	responseStudent, err := helperRequest(ch, "student.getRequestStatus", payload)
+	responseStudent, err := helperRequest(ctx, client, "student.getRequestStatus", payload)
 	if err != nil {
 		log.Printf("HandleGetRequestStatus: error: %v", err)
-		c.JSON(http.StatusGatewayTimeout, gin.H{"error": err.Error()})
+		c.JSON(rpcStatus(c, err), gin.H{"error": err.Error()})
 		return
 	}
 	log.Printf("HandleGetRequestStatus: responseStudent %+v", responseStudent)
@@ -175,8 +152,9 @@ func HandleGetRequestStatus(c *gin.Context, ch *amqp.Channel) {
 }
 
 // HandlePostResponse processes responses on review requests
-// -> sends 2 events: student.updateInstructorResponse & instructor.postResponse
-func HandlePostResponse(c *gin.Context, ch *amqp.Channel) {
+// -> one operation: student.updateInstructorResponse then instructor.postResponse,
+// the student's copy of the reply is reverted if the instructor update fails
+func HandlePostResponse(c *gin.Context, client *rpc.Client, ops *workflow.Runner) {
 	log.Printf("HandlePostResponse invoked")
 
 	// get user name from jwt
@@ -187,12 +165,7 @@ func HandlePostResponse(c *gin.Context, ch *amqp.Channel) {
 		return
 	}
 
-	var req struct {
-		UserID                 string `json:"user_id"`
-		ExamPeriod             string `json:"exam_period"`
-		InstructorReplyMessage string `json:"instructor_reply_message"`
-		InstructorAction       string `json:"instructor_action"`
-	}
+	var req InstructorReplyInput
 	if err := c.ShouldBindJSON(&req); err != nil {
 		log.Printf("HandlePostResponse: bind error: %v", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
@@ -200,38 +173,34 @@ func HandlePostResponse(c *gin.Context, ch *amqp.Channel) {
 	}
 	log.Printf("HandlePostResponse: payload struct %+v", req)
 
-	payload, _ := json.Marshal(map[string]interface{}{ // nolint: errcheck
-		"body": map[string]interface{}{
-			"exam_period":              req.ExamPeriod,
-			"username":                 username,
-			"user_id":                  req.UserID,
-			"instructor_reply_message": req.InstructorReplyMessage,
-			"instructor_action":        req.InstructorAction,
-		},
-	})
-
-	responseStudent, err := helperRequest(ch, "student.updateInstructorResponse", payload)
-	if err != nil {
-		log.Printf("HandlePostResponse: student.updateInstructorResponse error: %v", err)
-		c.JSON(http.StatusGatewayTimeout, gin.H{"error": err.Error()})
-		return
-	}
-	log.Printf("HandlePostResponse: responseStudent %+v", responseStudent)
-	c.JSON(http.StatusOK, gin.H{"data": responseStudent})
-
-	responseInstructor, err := helperRequest(ch, "instructor.postResponse", payload)
-	if err != nil {
-		log.Printf("HandlePostResponse: instructor.postResponse error: %v", err)
-		c.JSON(http.StatusGatewayTimeout, gin.H{"error": err.Error()})
-		return
+	op := workflow.New("review.reply", username,
+		workflow.Step{Service: "student", Key: "student.updateInstructorResponse", Revert: "student.revertOperation"},
+		workflow.Step{Service: "instructor", Key: "instructor.postResponse", Revert: "instructor.revertOperation"},
+	)
+	payload := types.InstructorReplyRequest{Body: types.InstructorReplyBody{
+		ExamPeriod:             req.ExamPeriod,
+		Username:               username,
+		UserID:                 req.UserID,
+		InstructorReplyMessage: req.InstructorReplyMessage,
+		InstructorAction:       req.InstructorAction,
+		OperationID:            op.ID,
+	}}
+
+	if runReviewOperation(c, ops, op, payload) {
+		announce(c, client, "review.replied", types.ReviewRepliedEvent{
+			OperationID: op.ID,
+			Instructor:  username,
+			StudentID:   req.UserID,
+			ExamPeriod:  req.ExamPeriod,
+			Action:      req.InstructorAction,
+			RepliedAt:   op.UpdatedAt,
+		})
 	}
-	log.Printf("HandlePostResponse: responseInstructor %+v", responseInstructor)
-	c.JSON(http.StatusOK, gin.H{"data": responseInstructor})
 }
 
 // HandleGetRequestList processes instructor get list of pending requests
 // -> sends 1 event: instructor.getRequestsList
-func HandleGetRequestList(c *gin.Context, ch *amqp.Channel) {
+func HandleGetRequestList(c *gin.Context, client *rpc.Client) {
 	log.Printf("[DEBUG] 🟡 HandleGetRequestList invoked")
 
 	// get user name from jwt
@@ -242,23 +211,17 @@ func HandleGetRequestList(c *gin.Context, ch *amqp.Channel) {
 		return
 	}
 
-	payload, err := json.Marshal(map[string]interface{}{
-		"body": map[string]interface{}{
-			"username": username,
-		},
-	})
-	if err != nil {
-		log.Printf("[DEBUG] 🟡 HandleGetRequestList: failed to marshal payload: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
-		return
-	}
+	payload := types.ReviewListRequest{Body: types.ReviewListBody{Username: username}}
 
-	log.Printf("[DEBUG] 🟡 HandleGetRequestList: sending payload to helperRequest: %s", string(payload))
+	log.Printf("[DEBUG] 🟡 HandleGetRequestList: sending payload to helperRequest: %+v", payload)
 
-	responseInstructor, err := helperRequest(ch, "instructor.getRequestsList", payload)
+	ctx, cancel := rpcContext(c, rpcTimeout)
+	defer cancel()
+
+	responseInstructor, err := helperRequest(ctx, client, "instructor.getRequestsList", payload)
 	if err != nil {
 		log.Printf("[DEBUG] 🟡 HandleGetRequestList: error from helperRequest: %v", err)
-		c.JSON(http.StatusGatewayTimeout, gin.H{"error": "Instructor service timeout or unavailable"})
+		c.JSON(rpcStatus(c, err), gin.H{"error": "Instructor service timeout or unavailable"})
 		return
 	}
 
@@ -271,14 +234,10 @@ func HandleGetRequestList(c *gin.Context, ch *amqp.Channel) {
 
 // HandleGetRequestInfo processes instructor sees request details
 // -> sends 1 event: instructor.getRequestInfo
-func HandleGetRequestInfo(c *gin.Context, ch *amqp.Channel) {
+func HandleGetRequestInfo(c *gin.Context, client *rpc.Client) {
 	log.Printf("HandleGetRequestInfo invoked")
 
-	var req struct {
-		CourseID   string `json:"course_id"`
-		UserID     string `json:"user_id"`
-		ExamPeriod string `json:"exam_period"`
-	}
+	var req ReviewInfoInput
 	if err := c.ShouldBindJSON(&req); err != nil {
 		log.Printf("HandleGetRequestInfo: bind error: %v", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
@@ -286,18 +245,19 @@ func HandleGetRequestInfo(c *gin.Context, ch *amqp.Channel) {
 	}
 	log.Printf("HandleGetRequestInfo: payload struct %+v", req)
 
-	payload, _ := json.Marshal(map[string]interface{}{ // nolint: errcheck
-		"body": map[string]interface{}{
-			"exam_period": req.ExamPeriod,
-			"course_id":   req.CourseID,
-			"user_id":     req.UserID,
-		},
-	})
+	payload := types.ReviewInfoRequest{Body: types.ReviewInfoBody{
+		ExamPeriod: req.ExamPeriod,
+		CourseID:   req.CourseID,
+		UserID:     req.UserID,
+	}}
 
-	responseInstructor, err := helperRequest(ch, "instructor.getRequestInfo", payload)
+	ctx, cancel := rpcContext(c, rpcTimeout)
+	defer cancel()
+
+	responseInstructor, err := helperRequest(ctx, client, "instructor.getRequestInfo", payload)
 	if err != nil {
 		log.Printf("HandleGetRequestInfo: error: %v", err)
-		c.JSON(http.StatusGatewayTimeout, gin.H{"error": err.Error()})
+		c.JSON(rpcStatus(c, err), gin.H{"error": err.Error()})
 		return
 	}
 	log.Printf("HandleGetRequestInfo: responseInstructor %+v", responseInstructor)
@@ -306,7 +266,7 @@ func HandleGetRequestInfo(c *gin.Context, ch *amqp.Channel) {
 
 // HandleAddCourse sends a message to the instructor services queue
 // with course_id and user_id when the instructor calls upload_init (or similar)
-/* func HandleAddCourse(c *gin.Context, ch *amqp.Channel) {
+/* func HandleAddCourse(c *gin.Context, client *rpc.Client) {
 	log.Printf("HandleAddCourse invoked")
 
 	// take instructor's id from JWT.
@@ -336,10 +296,13 @@ func HandleGetRequestInfo(c *gin.Context, ch *amqp.Channel) {
 		"body": map[string]interface{}{},
 	})
 
-	response, err := helperRequest(ch, "instructor.addCourse", payload)
+	ctx, cancel := rpcContext(c, rpcTimeout)
+	defer cancel()
+
+	response, err := helperRequest(ctx, client, "instructor.addCourse", payload)
 	if err != nil {
 		log.Printf("HandleAddCourse: error sending message: %v", err)
-		c.JSON(http.StatusGatewayTimeout, gin.H{"error": err.Error()})
+		c.JSON(rpcStatus(c, err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"orchestrator/internal/idempotency"
+	"orchestrator/internal/rpc"
+	"orchestrator/internal/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// eventsExchange is the exchange every backend worker binds its queue to.
+const eventsExchange = "clearSky.events"
+
+// rpcTimeout bounds a regular request/reply round trip. Grade-sheet
+// uploads run as background jobs with their own deadline.
+const rpcTimeout = 5 * time.Second
+
+// rpcContext derives the deadline for an RPC issued on behalf of c, so a
+// client that disconnects also cancels the wait for the reply.
+func rpcContext(c *gin.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(c.Request.Context(), timeout)
+}
+
+// rpcStatus maps an RPC error to the HTTP status reported to the caller:
+// 400 when the request does not satisfy the event schema, 503 while the
+// broker is unreachable or the routing key's breaker refuses calls (with
+// a Retry-After), 504 when the worker did not answer in time or the
+// connection was lost waiting for it, and 500 for anything else. A request
+// that was never published releases its Idempotency-Key.
+func rpcStatus(c *gin.Context, err error) int {
+	var rejected *rpc.RejectedError
+	if errors.As(err, &rejected) {
+		secs := int(math.Ceil(rejected.RetryAfter.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(max(secs, 1)))
+	}
+	if rpc.NotPublished(err) {
+		idempotency.Release(c)
+	}
+	switch {
+	case errors.Is(err, types.ErrInvalidPayload):
+		return http.StatusBadRequest
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, rpc.ErrReplyLost):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, rpc.ErrUnavailable):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
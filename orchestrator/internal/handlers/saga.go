@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"orchestrator/internal/rpc"
+	"orchestrator/internal/saga"
+	"orchestrator/internal/types"
+)
+
+// defaultHoldTTL is how long credits_service keeps a reservation when the
+// config does not say.
+const defaultHoldTTL = 30 * time.Minute
+
+// HoldResponse is credits_service's reply to credits.hold,
+// credits.hold.commit and credits.hold.release.
+type HoldResponse struct {
+	Status    string `json:"status"` // "ok", "insufficient", "conflict" or "error"
+	Message   string `json:"message"`
+	HoldID    string `json:"hold_id"`
+	State     string `json:"state,omitempty"`
+	Amount    int    `json:"amount,omitempty"`
+	Available *int   `json:"available,omitempty"`
+}
+
+// finalGradesSteps carries out the final-grades saga over RabbitMQ.
+type finalGradesSteps struct {
+	client  *rpc.Client
+	holdTTL time.Duration
+}
+
+// FinalGradesSteps returns the saga steps for publishing final grades:
+// hold the credits, send the sheet to postgrades.final, then commit or
+// release the hold.
+func FinalGradesSteps(client *rpc.Client, holdTTL time.Duration) saga.Steps {
+	if holdTTL <= 0 {
+		holdTTL = defaultHoldTTL
+	}
+	return &finalGradesSteps{client: client, holdTTL: holdTTL}
+}
+
+func (s *finalGradesSteps) Reserve(ctx context.Context, rec *saga.Record) error {
+	return s.hold(ctx, "credits.hold", types.CreditsHoldRequest{
+		HoldID:     rec.ID,
+		Name:       rec.Institution,
+		Amount:     rec.Credits,
+		TTLSeconds: int(s.holdTTL / time.Second),
+	})
+}
+
+func (s *finalGradesSteps) Publish(ctx context.Context, rec *saga.Record) (interface{}, error) {
+	ref := rec.Sheet
+	ref.SagaID = rec.ID
+	resp, err := uploadSheet(ctx, s.client, "postgrades.final", ref)
+	if err != nil && (resp != nil || rpc.NotPublished(err)) {
+		// refused by the worker, or never sent
+		err = saga.NotPublished(err)
+	}
+	return jobResult(resp), err
+}
+
+func (s *finalGradesSteps) Commit(ctx context.Context, rec *saga.Record) error {
+	return s.hold(ctx, "credits.hold.commit", types.CreditsHoldRef{HoldID: rec.ID})
+}
+
+func (s *finalGradesSteps) Release(ctx context.Context, rec *saga.Record) error {
+	return s.hold(ctx, "credits.hold.release", types.CreditsHoldRef{HoldID: rec.ID})
+}
+
+// Announce publishes grades.final.uploaded and hands the sheet to the
+// statistics and view services.
+func (s *finalGradesSteps) Announce(ctx context.Context, rec *saga.Record) error {
+	if err := publishEvent(ctx, s.client, "grades.final.uploaded", types.GradesUploadedEvent{
+		Filename:    rec.Sheet.Filename,
+		Course:      rec.Course,
+		ExamPeriod:  rec.ExamPeriod,
+		UploadedBy:  rec.UploadedBy,
+		UploadedAt:  rec.CreatedAt,
+		Institution: rec.Institution,
+		Rows:        rec.Rows,
+		Credits:     rec.Credits,
+		StudentIDs:  rec.StudentIDs,
+	}); err != nil {
+		return err
+	}
+	ForwardToStatistics(ctx, s.client, rec.Sheet) //update statistics ms
+	ForwardToView(ctx, s.client, rec.Sheet)
+	return nil
+}
+
+// hold sends one hold operation and maps the reply onto the saga's errors.
+func (s *finalGradesSteps) hold(ctx context.Context, key string, req interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, rpcTimeout)
+	defer cancel()
+
+	var resp HoldResponse
+	if err := s.client.CallJSON(ctx, eventsExchange, key, req, &resp); err != nil {
+		return err
+	}
+	log.Printf("[Saga] %s %s → %s (%s)", key, resp.HoldID, resp.Status, resp.Message)
+	switch resp.Status {
+	case "ok":
+		return nil
+	case "insufficient":
+		return fmt.Errorf("%w: %s", saga.ErrInsufficient, resp.Message)
+	case "conflict":
+		return fmt.Errorf("%w: %s", saga.ErrConflict, resp.Message)
+	default:
+		return fmt.Errorf("%s: %s", key, resp.Message)
+	}
+}
@@ -2,17 +2,16 @@ package handlers
 
 import (
 	"context"
-	"crypto/rand"
-	"encoding/base64"
-	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"orchestrator/internal/middleware"
-	"time"
+	"orchestrator/internal/rpc"
+	"orchestrator/internal/statcache"
+	"orchestrator/internal/types"
 
 	"github.com/gin-gonic/gin"
-	amqp "github.com/rabbitmq/amqp091-go"
 )
 
 // submissionLogResponse matches the shape your JS microservice replies with:
@@ -22,116 +21,49 @@ type submissionLogResponse struct {
 	Data    json.RawMessage `json:"data,omitempty"`    // actual rows
 }
 
-// randomCorrelationID generates a random hex string for correlation.
-func randomCorrelationID(n int) (string, error) {
-	b := make([]byte, n)
-	if _, err := rand.Read(b); err != nil {
-		return "", err
-	}
-	return hex.EncodeToString(b), nil
-}
-
 // HandleSubmissionLogs asks the JS microservice for all submission logs
-func HandleSubmissionLogs(c *gin.Context, ch *amqp.Channel) {
+func HandleSubmissionLogs(c *gin.Context, client *rpc.Client) {
 	// Get user context from JWT using middleware helpers
 	role := middleware.GetRole(c)
 	studentID := middleware.GetStudentID(c)
 	userID := middleware.GetUserID(c)
 
 	// Build request with user context
-	requestPayload := map[string]interface{}{
-		"role":    role,
-		"user_id": userID,
+	requestPayload := types.SubmissionLogsRequest{
+		Role:   role,
+		UserID: userID,
 	}
 
 	// Add student_id for student users
 	if role == "student" && studentID != "" {
-		requestPayload["student_id"] = studentID
+		requestPayload.StudentID = studentID
 	}
 
-	// 1) Declare a temporary reply queue
-	replyQ, err := ch.QueueDeclare(
-		"",    // let RabbitMQ generate a random name
-		false, // durable
-		true,  // delete when unused
-		true,  // exclusive
-		false, // no-wait
-		nil,   // arguments
-	)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "queue declare failed: " + err.Error()})
-		return
-	}
+	// 1) Publish the request to the same exchange/routing key your JS service
+	//    listens on and wait for the matching response (with timeout!)
+	ctx, cancel := rpcContext(c, rpcTimeout)
+	defer cancel()
 
-	msgs, err := ch.Consume(
-		replyQ.Name,
-		"",    // consumer
-		true,  // auto-ack
-		false, // exclusive
-		false, // no-local
-		false, // no-wait
-		nil,
-	)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "consume on reply queue failed: " + err.Error()})
+	var resp submissionLogResponse
+	if err := client.CallJSON(ctx,
+		eventsExchange, // RABBITMQ_EXCHANGE
+		"stats.avail",  // RABBITMQ_SEND_AVAIL_KEY
+		requestPayload, &resp,
+	); errors.Is(err, context.DeadlineExceeded) {
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": "timeout waiting for submission logs"})
 		return
-	}
-
-	// 2) Generate a correlation ID
-	corrID, err := randomCorrelationID(16)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not generate correlation ID"})
+	} else if err != nil {
+		c.JSON(rpcStatus(c, err), gin.H{"error": "submission logs request failed: " + err.Error()})
 		return
 	}
 
-	// 3) Publish the request to the same exchange/routing key your JS service listens on
-	body, _ := json.Marshal(requestPayload)
-	if err := ch.Publish(
-		"clearSky.events", // RABBITMQ_EXCHANGE
-		"stats.avail",     // RABBITMQ_SEND_AVAIL_KEY
-		false, false,
-		amqp.Publishing{
-			ContentType:   "application/json",
-			CorrelationId: corrID,
-			ReplyTo:       replyQ.Name,
-			Body:          body,
-		},
-	); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "publish failed: " + err.Error()})
+	if resp.Status != "ok" {
+		c.JSON(http.StatusBadGateway, gin.H{"error": resp.Message})
 		return
 	}
 
-	// 4) Wait for the matching response (with timeout!)
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	for {
-		select {
-		case <-ctx.Done():
-			c.JSON(http.StatusGatewayTimeout, gin.H{"error": "timeout waiting for submission logs"})
-			return
-
-		case d := <-msgs:
-			if d.CorrelationId != corrID {
-				continue // not ours, skip
-			}
-
-			var resp submissionLogResponse
-			if err := json.Unmarshal(d.Body, &resp); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "invalid response format"})
-				return
-			}
-
-			if resp.Status != "ok" {
-				c.JSON(http.StatusBadGateway, gin.H{"error": resp.Message})
-				return
-			}
-
-			// Success! return the raw data.
-			c.Data(http.StatusOK, "application/json", resp.Data)
-			return
-		}
-	}
+	// Success! return the raw data.
+	c.Data(http.StatusOK, "application/json", resp.Data)
 }
 
 // DistributionRequest represents the payload for fetching grade distributions.
@@ -140,30 +72,14 @@ type DistributionRequest struct {
 	ExamDate string `json:"exam_date"`
 }
 
-func ForwardToStatistics(ch *amqp.Channel, fileData []byte, filename string) {
-	log.Println("[ForwardToStatistics] Encoding data for statistics")
+func ForwardToStatistics(ctx context.Context, client *rpc.Client, ref types.GradeSheetRef) {
+	log.Printf("[ForwardToStatistics] Publishing %s (%s) to postgrades.statistics", ref.Filename, ref.SHA256)
 
-	// Base64 encode the file contents
-	encoded := base64.StdEncoding.EncodeToString(fileData)
-
-	// Prepare the persistent message
-	msg := amqp.Publishing{
-		ContentType:  "text/plain",
-		DeliveryMode: amqp.Persistent, // ✅ Makes message durable
-		MessageId:    filename,        // Optional metadata
-		Timestamp:    time.Now(),      // Optional timestamp
-		Body:         []byte(encoded),
-	}
-
-	log.Println("[ForwardToStatistics] Publishing to postgrades.statistics")
-
-	// Publish to exchange with the durable routing key
-	err := ch.Publish(
-		"clearSky.events",       // 🔁 Exchange name (must exist and be durable)
+	// Persistent message carrying only the blob reference
+	err := client.PublishJSON(ctx,
+		eventsExchange,          // 🔁 Exchange name (must exist and be durable)
 		"postgrades.statistics", // 🎯 Routing key (must match queue binding)
-		false,                   // mandatory
-		false,                   // immediate
-		msg,
+		ref,
 	)
 
 	if err != nil {
@@ -182,105 +98,62 @@ type rpcResponse struct {
 	} `json:"data,omitempty"`
 }
 
-type getGradesRequest struct {
-	Course            string `json:"course"            binding:"required"`
-	DeclarationPeriod string `json:"declarationPeriod" binding:"required"`
-	ClassTitle        string `json:"classTitle"        binding:"required"`
-}
-
 // HandleGetGrades is your Gin handler
-func HandleGetDistributions(ch *amqp.Channel) gin.HandlerFunc {
+func HandleGetDistributions(client *rpc.Client, cache *statcache.Cache) gin.HandlerFunc {
 
 	return func(c *gin.Context) {
 		// 1) bind JSON
-		var req getGradesRequest
+		var req types.DistributionsRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		// 2) declare a temporary reply queue
-		replyQ, err := ch.QueueDeclare(
-			"",    // let RabbitMQ name it
-			false, // durable
-			true,  // delete when unused
-			true,  // exclusive
-			false, // no-wait
-			nil,
-		)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "queue declare: " + err.Error()})
-			return
-		}
+		distributions(c, client, cache, req)
+	}
+}
 
-		msgs, err := ch.Consume(
-			replyQ.Name,
-			"",    // consumer
-			true,  // auto-ack
-			false, // exclusive
-			false, // no-local
-			false, // no-wait
-			nil,
-		)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "consume reply queue: " + err.Error()})
-			return
-		}
+// distributions answers c with the histograms of req, from the cache or
+// from the stats service. The reply carries an ETag; a GET whose
+// If-None-Match names it gets 304 without a body.
+func distributions(c *gin.Context, client *rpc.Client, cache *statcache.Cache, req types.DistributionsRequest) {
+	ctx, cancel := rpcContext(c, rpcTimeout)
+	defer cancel()
 
-		// 3) publish the RPC request
-		corrID, err := randomCorrelationID(16)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "generate corrID: " + err.Error()})
+	key := statcache.Key{Course: req.Course, Period: req.DeclarationPeriod, ClassTitle: req.ClassTitle, Scope: middleware.GetRole(c)}
+	body, slot, hit := cache.Lookup(ctx, key)
+	if !hit {
+		var resp rpcResponse
+		if err := client.CallJSON(ctx, eventsExchange, "stats.get", req, &resp); errors.Is(err, context.DeadlineExceeded) {
+			c.JSON(http.StatusGatewayTimeout, gin.H{"error": "timeout waiting for grades"})
+			return
+		} else if err != nil {
+			c.JSON(rpcStatus(c, err), gin.H{"error": "stats RPC: " + err.Error()})
 			return
 		}
 
-		body, _ := json.Marshal(req)
-		if err := ch.Publish(
-			"clearSky.events", // exchange
-			"stats.get",       // routing key
-			false, false,
-			amqp.Publishing{
-				ContentType:   "application/json",
-				CorrelationId: corrID,
-				ReplyTo:       replyQ.Name,
-				Body:          body,
-			},
-		); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "publish RPC: " + err.Error()})
+		if resp.Status != "ok" {
+			c.JSON(http.StatusBadGateway, gin.H{"error": resp.Message})
 			return
 		}
 
-		// 4) wait for the reply
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-
-		for {
-			select {
-			case <-ctx.Done():
-				c.JSON(http.StatusGatewayTimeout, gin.H{"error": "timeout waiting for grades"})
-				return
-
-			case d := <-msgs:
-				if d.CorrelationId != corrID {
-					continue
-				}
-
-				var resp rpcResponse
-				if err := json.Unmarshal(d.Body, &resp); err != nil {
-					c.JSON(http.StatusInternalServerError, gin.H{"error": "bad RPC response"})
-					return
-				}
-
-				if resp.Status != "ok" {
-					c.JSON(http.StatusBadGateway, gin.H{"error": resp.Message})
-					return
-				}
+		body, _ = json.Marshal(resp.Data)
+		cache.Store(ctx, slot, body)
+	}
 
-				c.JSON(http.StatusOK, resp.Data)
-				return
-			}
-		}
+	etag := statcache.ETag(body)
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "private, no-cache") // per-role reply: revalidate every time
+	if hit {
+		c.Header("X-Cache", "HIT")
+	} else {
+		c.Header("X-Cache", "MISS")
+	}
+	if c.Request.Method == http.MethodGet && statcache.Matches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
 	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", body)
 }
 
 // Add helper functions
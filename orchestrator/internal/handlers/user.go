@@ -2,95 +2,99 @@ package handlers
 
 import (
 	"context"
-	"encoding/json"
+	"fmt"
 	"net/http"
-	"time"
 
 	"log"
 
+	"orchestrator/internal/rpc"
+	"orchestrator/internal/sessions"
+	"orchestrator/internal/types"
+
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
-	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/gin-gonic/gin/binding"
 )
 
-// Helper for RPC via RabbitMQ
-func rpcRequest(ch *amqp.Channel, exchange, routingKey string, reqBody interface{}) (map[string]interface{}, error) {
-	body, _ := json.Marshal(reqBody)
-	corrID := uuid.New().String()
+// Helper for RPC via RabbitMQ; event names the catalog entry reqBody is
+// validated against (auth.request carries several).
+func rpcRequest(c *gin.Context, client *rpc.Client, exchange, routingKey, event string, reqBody interface{}) (map[string]interface{}, error) {
+	log.Printf("[RPC] Preparing request → Exchange: %q, RoutingKey: %q", exchange, routingKey)
 
-	log.Printf("[RPC] Preparing request → Exchange: %q, RoutingKey: %q, CorrID: %s, Payload: %s", exchange, routingKey, corrID, string(body))
+	ctx, cancel := rpcContext(c, rpcTimeout)
+	defer cancel()
 
-	replyQ, err := ch.QueueDeclare("", false, true, true, false, nil)
-	if err != nil {
-		log.Printf("[RPC] Failed to declare reply queue: %v", err)
+	var resp map[string]interface{}
+	if err := client.CallEvent(ctx, exchange, routingKey, event, reqBody, &resp); err != nil {
+		log.Printf("[RPC] %s failed: %v", routingKey, err)
 		return nil, err
 	}
+	log.Printf("[RPC] Received response for %s: %+v", routingKey, resp)
+	return resp, nil
+}
 
-	msgs, err := ch.Consume(replyQ.Name, "", true, true, false, false, nil)
-	if err != nil {
-		log.Printf("[RPC] Failed to consume from reply queue: %v", err)
-		return nil, err
-	}
+// RegisterRequest is the body of POST /user/register. It has no
+// institution: the one billed for a user's uploads is assigned by a
+// platform admin, by approving the institution the user registered, or by
+// the representative who creates the account (POST /institution/users).
+type RegisterRequest struct {
+	Username  string `json:"username" binding:"required"`
+	Password  string `json:"password" binding:"required"`
+	Role      string `json:"role,omitempty" enum:"student|instructor|institution_representative"`
+	StudentID string `json:"student_id,omitempty"` // Add student_id field
+}
 
-	err = ch.Publish(
-		exchange,
-		routingKey,
-		false, false,
-		amqp.Publishing{
-			ContentType:   "application/json",
-			CorrelationId: corrID,
-			ReplyTo:       replyQ.Name,
-			Body:          body,
-		},
-	)
-	if err != nil {
-		log.Printf("[RPC] Failed to publish message: %v", err)
-		return nil, err
-	}
+// signupRoles are the roles a user may pick at signup; platform_admin is
+// only granted by another platform admin.
+var signupRoles = map[string]bool{"student": true, "instructor": true, "institution_representative": true}
 
-	log.Printf("[RPC] Published message. Awaiting response...")
+// LoginRequest is the body of POST /user/login.
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+// DeleteUserRequest is the body of DELETE /user/delete.
+type DeleteUserRequest struct {
+	Username string `json:"username"`
+}
 
-	for {
-		select {
-		case <-ctx.Done():
-			log.Printf("[RPC] Timeout waiting for response for CorrID: %s", corrID)
-			return nil, context.DeadlineExceeded
-		case d := <-msgs:
-			if d.CorrelationId != corrID {
-				log.Printf("[RPC] Skipping unrelated CorrID: %s", d.CorrelationId)
-				continue
-			}
-			var resp map[string]interface{}
-			if err := json.Unmarshal(d.Body, &resp); err != nil {
-				log.Printf("[RPC] Failed to unmarshal response: %v", err)
-				return nil, err
-			}
-			log.Printf("[RPC] Received response for CorrID %s: %s", corrID, string(d.Body))
-			return resp, nil
-		}
-	}
+// GoogleLoginInput is the body of POST /user/google-login.
+type GoogleLoginInput struct {
+	Token string `json:"token"`
+	Role  string `json:"role,omitempty"` // Add role support
+}
+
+// ChangePasswordRequest is the body of PATCH /user/change-password.
+type ChangePasswordRequest struct {
+	Username    string `json:"username" binding:"required"`
+	OldPassword string `json:"old_password" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
 }
 
 // User Registration
-func HandleUserRegister(c *gin.Context, ch *amqp.Channel) {
-	var req struct {
-		Username  string `json:"username" binding:"required"`
-		Password  string `json:"password" binding:"required"`
-		Role      string `json:"role,omitempty"`
-		StudentID string `json:"student_id,omitempty"` // Add student_id field
-	}
-	if err := c.ShouldBindJSON(&req); err != nil {
+func HandleUserRegister(c *gin.Context, client *rpc.Client) {
+	var req RegisterRequest
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
 		log.Printf("[Register] Invalid request: %v", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "username and password are required"})
 		return
 	}
+	var claimed struct {
+		Institution *string `json:"institution"`
+	}
+	if c.ShouldBindBodyWith(&claimed, binding.JSON) == nil && claimed.Institution != nil {
+		log.Printf("[Register] ❌ %s declared institution %q", req.Username, *claimed.Institution)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "an institution cannot be chosen at signup; it is assigned by a platform admin or your institution's representative"})
+		return
+	}
 
 	if req.Role == "" {
 		req.Role = "student"
 	}
+	if !signupRoles[req.Role] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role must be student, instructor or institution_representative"})
+		return
+	}
 
 	// Validate student_id for student role
 	if req.Role == "student" && req.StudentID == "" {
@@ -101,17 +105,17 @@ func HandleUserRegister(c *gin.Context, ch *amqp.Channel) {
 
 	log.Printf("[Register] Registering user: %s with role: %s, student_id: %s", req.Username, req.Role, req.StudentID)
 
-	payload := map[string]interface{}{
-		"type":       "register",
-		"username":   req.Username,
-		"password":   req.Password,
-		"role":       req.Role,
-		"student_id": req.StudentID, // Include student_id in payload
+	payload := types.AuthRequest{
+		Type:      "register",
+		Username:  req.Username,
+		Password:  req.Password,
+		Role:      req.Role,
+		StudentID: req.StudentID, // Include student_id in payload
 	}
-	resp, err := rpcRequest(ch, "", "auth.request", payload)
+	resp, err := rpcRequest(c, client, "", "auth.request", "auth.register", payload)
 	if err != nil {
 		log.Printf("[Register] RPC error: %v", err)
-		c.JSON(http.StatusGatewayTimeout, gin.H{"error": err.Error()})
+		c.JSON(rpcStatus(c, err), gin.H{"error": err.Error()})
 		return
 	}
 	log.Printf("[Register] Registration response: %+v", resp)
@@ -119,11 +123,8 @@ func HandleUserRegister(c *gin.Context, ch *amqp.Channel) {
 }
 
 // User Login
-func HandleUserLogin(c *gin.Context, ch *amqp.Channel) {
-	var req struct {
-		Username string `json:"username"`
-		Password string `json:"password"`
-	}
+func HandleUserLogin(c *gin.Context, client *rpc.Client) {
+	var req LoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		log.Printf("[Login] Invalid request: %v", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
@@ -132,15 +133,15 @@ func HandleUserLogin(c *gin.Context, ch *amqp.Channel) {
 
 	log.Printf("[Login] Logging in user: %s", req.Username)
 
-	payload := map[string]interface{}{
-		"type":     "login",
-		"username": req.Username,
-		"password": req.Password,
+	payload := types.AuthRequest{
+		Type:     "login",
+		Username: req.Username,
+		Password: req.Password,
 	}
-	resp, err := rpcRequest(ch, "", "auth.request", payload)
+	resp, err := rpcRequest(c, client, "", "auth.request", "auth.login", payload)
 	if err != nil {
 		log.Printf("[Login] RPC error: %v", err)
-		c.JSON(http.StatusGatewayTimeout, gin.H{"error": err.Error()})
+		c.JSON(rpcStatus(c, err), gin.H{"error": err.Error()})
 		return
 	}
 	if role, ok := resp["role"]; !ok || role == "" {
@@ -151,10 +152,8 @@ func HandleUserLogin(c *gin.Context, ch *amqp.Channel) {
 }
 
 // User Delete
-func HandleUserDelete(c *gin.Context, ch *amqp.Channel) {
-	var req struct {
-		Username string `json:"username"`
-	}
+func HandleUserDelete(c *gin.Context, client *rpc.Client) {
+	var req DeleteUserRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		log.Printf("[Delete] Invalid request: %v", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
@@ -162,14 +161,14 @@ func HandleUserDelete(c *gin.Context, ch *amqp.Channel) {
 	}
 	log.Printf("[Delete] Deleting user: %s", req.Username)
 
-	payload := map[string]interface{}{
-		"type":     "delete",
-		"username": req.Username,
+	payload := types.AuthRequest{
+		Type:     "delete",
+		Username: req.Username,
 	}
-	resp, err := rpcRequest(ch, "", "auth.request", payload)
+	resp, err := rpcRequest(c, client, "", "auth.request", "auth.delete", payload)
 	if err != nil {
 		log.Printf("[Delete] RPC error: %v", err)
-		c.JSON(http.StatusGatewayTimeout, gin.H{"error": err.Error()})
+		c.JSON(rpcStatus(c, err), gin.H{"error": err.Error()})
 		return
 	}
 	log.Printf("[Delete] Deletion response: %+v", resp)
@@ -177,27 +176,28 @@ func HandleUserDelete(c *gin.Context, ch *amqp.Channel) {
 }
 
 // Google Login
-func HandleUserGoogleLogin(c *gin.Context, ch *amqp.Channel) {
-	var req struct {
-		Token string `json:"token"`
-		Role  string `json:"role,omitempty"` // Add role support
-	}
+func HandleUserGoogleLogin(c *gin.Context, client *rpc.Client) {
+	var req GoogleLoginInput
 	if err := c.ShouldBindJSON(&req); err != nil {
 		log.Printf("[GoogleLogin] Invalid request: %v", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 		return
 	}
+	if req.Role != "" && !signupRoles[req.Role] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role must be student, instructor or institution_representative"})
+		return
+	}
 	log.Printf("[GoogleLogin] Attempting Google login with token for role: %s", req.Role)
 
-	payload := map[string]interface{}{
-		"type":  "google_login",
-		"token": req.Token,
-		"role":  req.Role, // Include role in payload
+	payload := types.GoogleLoginRequest{
+		Type:  "google_login",
+		Token: req.Token,
+		Role:  req.Role, // Include role in payload
 	}
-	resp, err := rpcRequest(ch, "clearSky.events", "auth.login.google", payload)
+	resp, err := rpcRequest(c, client, eventsExchange, "auth.login.google", "auth.login.google", payload)
 	if err != nil {
 		log.Printf("[GoogleLogin] RPC error: %v", err)
-		c.JSON(http.StatusGatewayTimeout, gin.H{"error": err.Error()})
+		c.JSON(rpcStatus(c, err), gin.H{"error": err.Error()})
 		return
 	}
 	log.Printf("[GoogleLogin] Login response: %+v", resp)
@@ -205,12 +205,8 @@ func HandleUserGoogleLogin(c *gin.Context, ch *amqp.Channel) {
 }
 
 // Change Password
-func HandleUserChangePassword(c *gin.Context, ch *amqp.Channel) {
-	var req struct {
-		Username    string `json:"username" binding:"required"`
-		OldPassword string `json:"old_password" binding:"required"`
-		NewPassword string `json:"new_password" binding:"required"`
-	}
+func HandleUserChangePassword(c *gin.Context, client *rpc.Client) {
+	var req ChangePasswordRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		log.Printf("[ChangePassword] Invalid request: %v", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -218,27 +214,47 @@ func HandleUserChangePassword(c *gin.Context, ch *amqp.Channel) {
 	}
 	log.Printf("[ChangePassword] Changing password for user: %s", req.Username)
 
-	payload := map[string]interface{}{
-		"type":         "change_password",
-		"username":     req.Username,
-		"old_password": req.OldPassword,
-		"new_password": req.NewPassword,
+	payload := types.AuthRequest{
+		Type:        "change_password",
+		Username:    req.Username,
+		OldPassword: req.OldPassword,
+		NewPassword: req.NewPassword,
 	}
 	log.Printf("[ChangePassword] Publishing RPC payload: %+v", payload)
-	resp, err := rpcRequest(ch, "", "auth.request", payload)
+	resp, err := rpcRequest(c, client, "", "auth.request", "auth.change_password", payload)
 	if err != nil {
 		log.Printf("[ChangePassword] RPC error: %v", err)
-		c.JSON(http.StatusGatewayTimeout, gin.H{"error": err.Error()})
+		c.JSON(rpcStatus(c, err), gin.H{"error": err.Error()})
 		return
 	}
 	log.Printf("[ChangePassword] Response: %+v", resp)
 	c.JSON(http.StatusOK, resp)
 }
 
-// Dummy consumer handler
-func HandleUserCreated(d amqp.Delivery) {
-	log.Printf("[Handler] user.created event received: %s", string(d.Body))
-	if err := d.Ack(false); err != nil {
-		log.Printf("[Handler] Failed to ACK message: %v", err)
+// SessionLookup reads the account a token belongs to from
+// user_management_service (auth.session), for sessions.Checker.
+func SessionLookup(client *rpc.Client) sessions.Lookup {
+	return func(ctx context.Context, username string) (sessions.State, error) {
+		ctx, cancel := context.WithTimeout(ctx, rpcTimeout)
+		defer cancel()
+
+		var reply struct {
+			Status       string `json:"status"`
+			Message      string `json:"message"`
+			TokenVersion int    `json:"token_version"`
+			Locked       bool   `json:"locked"`
+		}
+		req := types.AuthRequest{Type: "session", Username: username}
+		if err := client.CallEvent(ctx, "", "auth.request", "auth.session", req, &reply); err != nil {
+			return sessions.State{}, err
+		}
+		switch reply.Status {
+		case "ok":
+			return sessions.State{Found: true, Locked: reply.Locked, TokenVersion: reply.TokenVersion}, nil
+		case "not_found":
+			return sessions.State{}, nil
+		default:
+			return sessions.State{}, fmt.Errorf("auth.session for %s: %s: %s", username, reply.Status, reply.Message)
+		}
 	}
 }
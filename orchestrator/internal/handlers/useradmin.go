@@ -0,0 +1,276 @@
+package handlers
+
+// User administration for platform admins. Every endpoint forwards a users.*
+// request to user_management_service on the auth.request queue, naming the
+// admin as actor; the service applies it and writes the audit trail.
+// Representatives use the same path to add accounts to their institution.
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"orchestrator/internal/middleware"
+	"orchestrator/internal/rpc"
+	"orchestrator/internal/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ManagedUser is a user account as admins see it.
+type ManagedUser struct {
+	ID          string   `json:"id"`
+	Username    string   `json:"username"`
+	Role        string   `json:"role" enum:"student|instructor|institution_representative|platform_admin"`
+	Roles       []string `json:"roles" enum:"student|instructor|institution_representative|platform_admin"`
+	StudentID   string   `json:"student_id,omitempty"`
+	Institution string   `json:"institution,omitempty"`
+	// InstitutionSource says who assigned Institution; an institution
+	// without one was declared at signup and is not billed.
+	InstitutionSource     string    `json:"institution_source,omitempty" enum:"admin|representative|email_domain"`
+	Locked                bool      `json:"locked"`
+	PasswordResetRequired bool      `json:"password_reset_required"`
+	CreatedAt             time.Time `json:"created_at"`
+	UpdatedAt             time.Time `json:"updated_at"`
+}
+
+// UserPage is one page of GET /admin/users.
+type UserPage struct {
+	Users    []ManagedUser `json:"users"`
+	Total    int           `json:"total"`
+	Page     int           `json:"page"`
+	PageSize int           `json:"page_size"`
+}
+
+// UserAuditEntry is one audited admin action.
+type UserAuditEntry struct {
+	ID     uint      `json:"id"`
+	Actor  string    `json:"actor"`
+	Action string    `json:"action"`
+	Target string    `json:"target,omitempty"`
+	Detail string    `json:"detail,omitempty"`
+	Status string    `json:"status"`
+	At     time.Time `json:"at"`
+}
+
+// UserAuditPage is one page of GET /admin/users/audit, newest first.
+type UserAuditPage struct {
+	Audit    []UserAuditEntry `json:"audit"`
+	Total    int              `json:"total"`
+	Page     int              `json:"page"`
+	PageSize int              `json:"page_size"`
+}
+
+// RoleChangeRequest is the body of PATCH /admin/users/:username/role: either
+// every role the user should hold, the primary one first, or just one.
+type RoleChangeRequest struct {
+	Role  string   `json:"role,omitempty" enum:"student|instructor|institution_representative|platform_admin"`
+	Roles []string `json:"roles,omitempty" enum:"student|instructor|institution_representative|platform_admin"`
+}
+
+// InstitutionAssignment is the body of PATCH /admin/users/:username/institution.
+type InstitutionAssignment struct {
+	Institution string `json:"institution" binding:"required"`
+}
+
+// MemberRequest is the body of POST /institution/users: an account a
+// representative adds to the institution they were assigned.
+type MemberRequest struct {
+	Username  string `json:"username" binding:"required"`
+	Password  string `json:"password" binding:"required"`
+	Role      string `json:"role" binding:"required" enum:"student|instructor"`
+	StudentID string `json:"student_id,omitempty"`
+}
+
+// PasswordResetResponse carries the one-time password the admin passes on;
+// the user must change it before logging in.
+type PasswordResetResponse struct {
+	User              ManagedUser `json:"user"`
+	TemporaryPassword string      `json:"temporary_password"`
+}
+
+// userAdminReply is user_management_service's answer to a users.* request.
+type userAdminReply struct {
+	Status            string           `json:"status"`
+	Message           string           `json:"message"`
+	User              *ManagedUser     `json:"user"`
+	Users             []ManagedUser    `json:"users"`
+	Audit             []UserAuditEntry `json:"audit"`
+	Total             int              `json:"total"`
+	Page              int              `json:"page"`
+	PageSize          int              `json:"page_size"`
+	TemporaryPassword string           `json:"temporary_password"`
+}
+
+// HandleListUsers pages through the accounts:
+// GET /admin/users?search=&role=&page=&page_size=
+func HandleListUsers(c *gin.Context, client *rpc.Client) {
+	req, ok := pagedUserAdminRequest(c)
+	if !ok {
+		return
+	}
+	req.Role = c.Query("role")
+	if reply, ok := callUserAdmin(c, client, "users.list", req); ok {
+		users := reply.Users
+		if users == nil {
+			users = []ManagedUser{}
+		}
+		c.JSON(http.StatusOK, UserPage{Users: users, Total: reply.Total, Page: reply.Page, PageSize: reply.PageSize})
+	}
+}
+
+// HandleUserAudit pages through the audit trail; search narrows it to one
+// actor or target: GET /admin/users/audit?search=&page=&page_size=
+func HandleUserAudit(c *gin.Context, client *rpc.Client) {
+	req, ok := pagedUserAdminRequest(c)
+	if !ok {
+		return
+	}
+	if reply, ok := callUserAdmin(c, client, "users.audit", req); ok {
+		audit := reply.Audit
+		if audit == nil {
+			audit = []UserAuditEntry{}
+		}
+		c.JSON(http.StatusOK, UserAuditPage{Audit: audit, Total: reply.Total, Page: reply.Page, PageSize: reply.PageSize})
+	}
+}
+
+// HandleUserAction runs one action on the account in the path and answers
+// the account as it now is: GET /admin/users/:username (get),
+// POST .../lock, POST .../unlock, DELETE /admin/users/:username (delete).
+func HandleUserAction(c *gin.Context, client *rpc.Client, action string) {
+	req := types.UserAdminRequest{Actor: middleware.GetUsername(c), Username: c.Param("username")}
+	if reply, ok := callUserAdmin(c, client, "users."+action, req); ok {
+		c.JSON(http.StatusOK, reply.User)
+	}
+}
+
+// HandleSetUserRole replaces the roles of an account:
+// PATCH /admin/users/:username/role {"roles": ["...", ...]} or {"role": "..."}
+func HandleSetUserRole(c *gin.Context, client *rpc.Client) {
+	var body RoleChangeRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if body.Role == "" && len(body.Roles) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role or roles is required"})
+		return
+	}
+	req := types.UserAdminRequest{Actor: middleware.GetUsername(c), Username: c.Param("username"), Role: body.Role, Roles: body.Roles}
+	if reply, ok := callUserAdmin(c, client, "users.set_role", req); ok {
+		c.JSON(http.StatusOK, reply.User)
+	}
+}
+
+// HandleResetUserPassword replaces the password with a temporary one:
+// POST /admin/users/:username/reset-password
+func HandleResetUserPassword(c *gin.Context, client *rpc.Client) {
+	req := types.UserAdminRequest{Actor: middleware.GetUsername(c), Username: c.Param("username")}
+	if reply, ok := callUserAdmin(c, client, "users.reset_password", req); ok {
+		c.JSON(http.StatusOK, PasswordResetResponse{User: *reply.User, TemporaryPassword: reply.TemporaryPassword})
+	}
+}
+
+// HandleSetUserInstitution assigns an approved institution to an account:
+// PATCH /admin/users/:username/institution {"institution": "..."}
+func HandleSetUserInstitution(c *gin.Context, client *rpc.Client) {
+	var body InstitutionAssignment
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var inst Institution
+	if !callRegistration(c, client, "institution.get",
+		types.InstitutionGetRequest{Name: body.Institution, Status: "approved"}, "institution", &inst) {
+		return
+	}
+	req := types.UserAdminRequest{Actor: middleware.GetUsername(c), Username: c.Param("username"), Institution: inst.Name}
+	if reply, ok := callUserAdmin(c, client, "users.set_institution", req); ok {
+		c.JSON(http.StatusOK, reply.User)
+	}
+}
+
+// HandleCreateMember adds a student or instructor account to the caller's
+// institution, which user_management_service reads from the caller's own
+// account: POST /institution/users
+func HandleCreateMember(c *gin.Context, client *rpc.Client) {
+	var body MemberRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req := types.UserAdminRequest{
+		Actor:     middleware.GetUsername(c),
+		Username:  body.Username,
+		Password:  body.Password,
+		Role:      body.Role,
+		StudentID: body.StudentID,
+	}
+	if reply, ok := callUserAdmin(c, client, "users.create", req); ok {
+		c.JSON(http.StatusCreated, reply.User)
+	}
+}
+
+// pagedUserAdminRequest reads search, page and page_size.
+func pagedUserAdminRequest(c *gin.Context) (types.UserAdminRequest, bool) {
+	req := types.UserAdminRequest{Actor: middleware.GetUsername(c), Search: c.Query("search")}
+	for name, dst := range map[string]*int{"page": &req.Page, "page_size": &req.PageSize} {
+		raw := c.Query(name)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": name + " must be a positive integer"})
+			return req, false
+		}
+		*dst = n
+	}
+	return req, true
+}
+
+// callUserAdmin sends a users.* request and answers the error itself unless
+// the reply is ok.
+func callUserAdmin(c *gin.Context, client *rpc.Client, event string, req types.UserAdminRequest) (userAdminReply, bool) {
+	ctx, cancel := rpcContext(c, rpcTimeout)
+	defer cancel()
+
+	var raw json.RawMessage
+	if err := client.CallEvent(ctx, "", "auth.request", event, req, &raw); err != nil {
+		log.Printf("[UserAdmin] ❌ %s failed: %v", event, err)
+		c.JSON(rpcStatus(c, err), gin.H{"error": err.Error()})
+		return userAdminReply{}, false
+	}
+	var reply userAdminReply
+	if err := json.Unmarshal(raw, &reply); err != nil {
+		log.Printf("[UserAdmin] ❌ %s: malformed reply: %v", event, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "malformed reply from user service"})
+		return reply, false
+	}
+	switch reply.Status {
+	case "ok":
+	case "invalid":
+		c.JSON(http.StatusBadRequest, gin.H{"error": reply.Message})
+		return reply, false
+	case "not_found":
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return reply, false
+	case "conflict":
+		c.JSON(http.StatusConflict, gin.H{"error": reply.Message})
+		return reply, false
+	default:
+		log.Printf("[UserAdmin] ⚠ %s returned %s: %s", event, reply.Status, reply.Message)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "user service error: " + reply.Message})
+		return reply, false
+	}
+	if reply.User == nil && event != "users.list" && event != "users.audit" {
+		log.Printf("[UserAdmin] ❌ %s: reply has no user", event)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "malformed reply from user service"})
+		return reply, false
+	}
+	log.Printf("[UserAdmin] %s on %q by %s", event, req.Username, req.Actor)
+	return reply, true
+}
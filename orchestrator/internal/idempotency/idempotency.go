@@ -0,0 +1,291 @@
+package idempotency
+
+// Idempotency-Key support for mutating endpoints. The first request with a
+// key runs normally and its response is kept for the store's TTL; a retry
+// with the same key and the same body gets that response replayed instead
+// of running the handler (and publishing) again. That includes a 504: the
+// message reached the broker and the worker may still act on it. Only a
+// handler that knows nothing was published (see Release) frees the key for
+// another attempt. Reusing a key for a different body, or while the first
+// request is still running, is a conflict. Keys are scoped to the caller
+// (the user, or the client address on public routes) and the route.
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"orchestrator/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// Header carries the client's key; ReplayedHeader marks a replay.
+	Header         = "Idempotency-Key"
+	ReplayedHeader = "Idempotent-Replayed"
+
+	maxKeyLen = 255
+	maxBody   = 32 << 20
+
+	// Context keys set by Middleware and Release.
+	scopedKey  = "idempotency.key"
+	releaseKey = "idempotency.release"
+)
+
+// replayedHeaders are the response headers kept alongside the body.
+var replayedHeaders = []string{"Content-Type", "Location"}
+
+type record struct {
+	fingerprint string
+	done        bool
+	status      int
+	header      http.Header
+	body        []byte
+	expires     time.Time
+}
+
+// Store keeps responses in memory for ttl.
+type Store struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	records map[string]*record
+}
+
+// NewStore returns a store remembering responses for ttl.
+func NewStore(ttl time.Duration) *Store {
+	return &Store{ttl: ttl, records: make(map[string]*record)}
+}
+
+type outcome int
+
+const (
+	started outcome = iota
+	replay
+	inProgress
+	mismatch
+)
+
+// begin claims key for a request with fingerprint, or reports why it
+// cannot run.
+func (s *Store) begin(key, fingerprint string) (outcome, *record) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.prune(now)
+
+	if r, ok := s.records[key]; ok {
+		switch {
+		case r.fingerprint != fingerprint:
+			return mismatch, nil
+		case !r.done:
+			return inProgress, nil
+		default:
+			return replay, r
+		}
+	}
+	s.records[key] = &record{fingerprint: fingerprint, expires: now.Add(s.ttl)}
+	return started, nil
+}
+
+func (s *Store) complete(key string, status int, header http.Header, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r, ok := s.records[key]; ok {
+		r.done, r.status, r.header, r.body = true, status, header, body
+		r.expires = time.Now().Add(s.ttl)
+	}
+}
+
+func (s *Store) forget(key string) {
+	s.mu.Lock()
+	delete(s.records, key)
+	s.mu.Unlock()
+}
+
+// prune drops expired records. The caller holds s.mu.
+func (s *Store) prune(now time.Time) {
+	for k, r := range s.records {
+		if now.After(r.expires) {
+			delete(s.records, k)
+		}
+	}
+}
+
+// Middleware applies the store to POST, PUT, PATCH and DELETE requests
+// that carry an Idempotency-Key. Install it after authentication and body
+// validation so keys are scoped to the user and bad requests do not use
+// them up.
+func Middleware(s *Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := strings.TrimSpace(c.GetHeader(Header))
+		if key == "" || !mutating(c.Request.Method) {
+			c.Next()
+			return
+		}
+		if len(key) > maxKeyLen {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": Header + " is longer than 255 characters"})
+			return
+		}
+
+		fp, err := fingerprint(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "could not read request body"})
+			return
+		}
+		scoped := caller(c) + " " + c.Request.Method + " " + c.FullPath() + " " + key
+
+		switch outcome, r := s.begin(scoped, fp); outcome {
+		case mismatch:
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": Header + " was already used for a different request"})
+			return
+		case inProgress:
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "a request with this " + Header + " is still being processed"})
+			return
+		case replay:
+			for k, v := range r.header {
+				c.Writer.Header()[k] = v
+			}
+			c.Header(ReplayedHeader, "true")
+			c.Writer.WriteHeader(r.status)
+			c.Writer.Write(r.body)
+			c.Abort()
+			return
+		}
+
+		c.Set(scopedKey, scoped)
+		rec := &recorder{ResponseWriter: c.Writer}
+		c.Writer = rec
+		completed := false
+		defer func() {
+			// A panicking handler must not hold the key until it expires
+			if !completed {
+				s.forget(scoped)
+			}
+		}()
+
+		c.Next()
+
+		if c.GetBool(releaseKey) {
+			s.forget(scoped)
+		} else {
+			header := http.Header{}
+			for _, h := range replayedHeaders {
+				if v := rec.Header().Values(h); len(v) > 0 {
+					header[h] = v
+				}
+			}
+			s.complete(scoped, rec.Status(), header, rec.body.Bytes())
+		}
+		completed = true
+	}
+}
+
+// Release frees the request's key once its response is written, so a
+// retry with the same key runs again. Handlers call it only when nothing
+// was published: the broker was unreachable, the breaker refused the call
+// or the publish failed.
+func Release(c *gin.Context) {
+	c.Set(releaseKey, true)
+}
+
+// RequestID identifies the request's Idempotency-Key for workers that drop
+// duplicates (e.g. a credit purchase): the same for every retry under the
+// key, different for other callers and routes. It is "" without a key.
+func RequestID(c *gin.Context) string {
+	scoped := c.GetString(scopedKey)
+	if scoped == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(scoped))
+	return hex.EncodeToString(sum[:16])
+}
+
+// caller identifies who a key belongs to: the authenticated user, or the
+// client address on routes without a JWT.
+func caller(c *gin.Context) string {
+	if id := middleware.GetUserID(c); id != "" {
+		return "user:" + id
+	}
+	return "ip:" + c.ClientIP()
+}
+
+func mutating(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// fingerprint hashes the request body. Multipart forms are hashed field
+// by field so a retry with a new boundary still matches.
+func fingerprint(c *gin.Context) (string, error) {
+	h := sha256.New()
+	if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		form, err := c.MultipartForm()
+		if err != nil {
+			return "", err
+		}
+		for _, name := range sortedKeys(form.Value) {
+			for _, v := range form.Value[name] {
+				io.WriteString(h, "v\x00"+name+"\x00"+v+"\x00")
+			}
+		}
+		for _, name := range sortedKeys(form.File) {
+			for _, fh := range form.File[name] {
+				io.WriteString(h, "f\x00"+name+"\x00"+fh.Filename+"\x00")
+				f, err := fh.Open()
+				if err != nil {
+					return "", err
+				}
+				_, err = io.Copy(h, f)
+				f.Close()
+				if err != nil {
+					return "", err
+				}
+			}
+		}
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(c.Request.Body, maxBody))
+	if err != nil {
+		return "", err
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(raw))
+	h.Write(raw)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// recorder copies the response body while writing it through.
+type recorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
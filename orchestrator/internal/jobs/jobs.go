@@ -0,0 +1,187 @@
+package jobs
+
+// Background jobs for slow uploads. A job is queued when submitted, moves
+// to processing once one of the store's workers picks it up and ends as
+// succeeded or failed when its function returns. Jobs live in memory for
+// the retention period; subscribers get every state change, which is what
+// the SSE endpoint streams.
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type State string
+
+const (
+	Queued     State = "queued"
+	Processing State = "processing"
+	Succeeded  State = "succeeded"
+	Failed     State = "failed"
+)
+
+// Done reports whether s is terminal.
+func (s State) Done() bool { return s == Succeeded || s == Failed }
+
+// Job is the externally visible state of one background job.
+type Job struct {
+	ID        string      `json:"id"`
+	Kind      string      `json:"kind"`
+	Filename  string      `json:"filename,omitempty"`
+	State     State       `json:"state" enum:"queued|processing|succeeded|failed"`
+	Result    interface{} `json:"result,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+	// Owner is the username that submitted the job; only they may see it.
+	Owner string `json:"-"`
+}
+
+// Func does the work of a job. The result is stored whether or not an
+// error is returned, so a worker's error reply stays visible.
+type Func func(ctx context.Context) (result interface{}, err error)
+
+type entry struct {
+	job  Job
+	subs map[chan Job]struct{}
+}
+
+// Store runs jobs on a bounded number of workers and keeps their state.
+type Store struct {
+	timeout   time.Duration
+	retention time.Duration
+	slots     chan struct{}
+
+	mu   sync.Mutex
+	jobs map[string]*entry
+}
+
+// NewStore returns a store running at most workers jobs at once, each
+// bounded by timeout, and forgetting finished jobs after retention.
+func NewStore(workers int, timeout, retention time.Duration) *Store {
+	return &Store{
+		timeout:   timeout,
+		retention: retention,
+		slots:     make(chan struct{}, workers),
+		jobs:      make(map[string]*entry),
+	}
+}
+
+// Submit queues fn and returns the new job. The job keeps the values of
+// parent (such as the trace) but not its cancellation, so it outlives
+// the HTTP request that created it.
+func (s *Store) Submit(parent context.Context, kind, filename, owner string, fn Func) Job {
+	now := time.Now().UTC()
+	job := Job{
+		ID:        uuid.NewString(),
+		Kind:      kind,
+		Filename:  filename,
+		Owner:     owner,
+		State:     Queued,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	s.mu.Lock()
+	s.prune(now)
+	s.jobs[job.ID] = &entry{job: job, subs: map[chan Job]struct{}{}}
+	s.mu.Unlock()
+
+	go s.run(context.WithoutCancel(parent), job.ID, fn)
+	return job
+}
+
+func (s *Store) run(parent context.Context, id string, fn Func) {
+	s.slots <- struct{}{}
+	defer func() { <-s.slots }()
+
+	s.update(id, func(j *Job) { j.State = Processing })
+
+	ctx, cancel := context.WithTimeout(parent, s.timeout)
+	defer cancel()
+	result, err := fn(ctx)
+
+	s.update(id, func(j *Job) {
+		j.Result = result
+		if err != nil {
+			j.State = Failed
+			j.Error = err.Error()
+			return
+		}
+		j.State = Succeeded
+	})
+}
+
+// update applies fn to job id and notifies its subscribers. Subscribers
+// are closed once the job is done.
+func (s *Store) update(id string, fn func(*Job)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.jobs[id]
+	if !ok {
+		return
+	}
+	fn(&e.job)
+	e.job.UpdatedAt = time.Now().UTC()
+	for ch := range e.subs {
+		select {
+		case ch <- e.job:
+		default: // slow reader; it re-reads the job when the channel closes
+		}
+		if e.job.State.Done() {
+			close(ch)
+			delete(e.subs, ch)
+		}
+	}
+}
+
+// Get returns job id.
+func (s *Store) Get(id string) (Job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return e.job, true
+}
+
+// Subscribe returns the current state of job id and a channel receiving
+// its later changes. The channel is closed when the job is done (right
+// away if it already is); call cancel to stop listening earlier.
+func (s *Store) Subscribe(id string) (Job, <-chan Job, func(), bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.jobs[id]
+	if !ok {
+		return Job{}, nil, nil, false
+	}
+	ch := make(chan Job, 8)
+	if e.job.State.Done() {
+		close(ch)
+		return e.job, ch, func() {}, true
+	}
+	e.subs[ch] = struct{}{}
+	cancel := func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := e.subs[ch]; ok {
+			delete(e.subs, ch)
+			close(ch)
+		}
+	}
+	return e.job, ch, cancel, true
+}
+
+// prune forgets finished jobs older than the retention period. The caller
+// holds s.mu.
+func (s *Store) prune(now time.Time) {
+	for id, e := range s.jobs {
+		if e.job.State.Done() && now.Sub(e.job.UpdatedAt) > s.retention {
+			delete(s.jobs, id)
+		}
+	}
+}
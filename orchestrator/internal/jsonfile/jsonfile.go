@@ -0,0 +1,70 @@
+// Package jsonfile keeps records as one JSON file each under a directory.
+// Every write replaces the file atomically and is synced before it
+// returns, so a crash leaves either the old record or the new one.
+package jsonfile
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func path(dir, id string) string {
+	return filepath.Join(dir, id+".json")
+}
+
+// Write stores v as dir/id.json.
+func Write(dir, id string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, id+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	// Callers persist a step before the remote call it announces
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path(dir, id))
+}
+
+// Read loads dir/id.json into v; a missing record is fs.ErrNotExist.
+func Read(dir, id string, v interface{}) error {
+	data, err := os.ReadFile(path(dir, id))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Remove deletes dir/id.json.
+func Remove(dir, id string) error {
+	return os.Remove(path(dir, id))
+}
+
+// IDs lists the records in dir.
+func IDs(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, e := range entries {
+		if id, ok := strings.CutSuffix(e.Name(), ".json"); ok && !e.IsDir() {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,185 @@
+package metrics
+
+// Prometheus metrics for the orchestrator: HTTP traffic per route and role,
+// RPC round trips per routing key and the state of their circuit breakers,
+// fire-and-forget publish failures, the outcome of events handled by the
+// orchestrator's own consumer, and the hit rate of the response caches.
+// Everything is exposed on GET /metrics.
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "clearsky"
+
+var (
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by route, method, status and caller role.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status", "role"})
+
+	rpcDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "rpc",
+		Name:      "duration_seconds",
+		Help:      "RPC round-trip latency by routing key and outcome (ok, timeout, error).",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"routing_key", "outcome"})
+
+	rpcTimeouts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "rpc",
+		Name:      "timeouts_total",
+		Help:      "RPCs whose reply did not arrive before the deadline.",
+	}, []string{"routing_key"})
+
+	rpcErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "rpc",
+		Name:      "errors_total",
+		Help:      "RPCs that failed for a reason other than a timeout.",
+	}, []string{"routing_key"})
+
+	rpcInFlight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "rpc",
+		Name:      "in_flight",
+		Help:      "RPCs currently waiting for a reply.",
+	}, []string{"routing_key"})
+
+	rpcCircuitState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "rpc",
+		Name:      "circuit_state",
+		Help:      "Circuit breaker state by routing key: 0 closed, 1 half-open, 2 open.",
+	}, []string{"routing_key"})
+
+	rpcRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "rpc",
+		Name:      "rejected_total",
+		Help:      "RPCs refused without publishing, by routing key and reason (circuit_open, bulkhead_full).",
+	}, []string{"routing_key", "reason"})
+
+	publishFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "amqp",
+		Name:      "publish_failures_total",
+		Help:      "Messages that could not be published.",
+	}, []string{"exchange", "routing_key"})
+
+	cacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "cache",
+		Name:      "lookups_total",
+		Help:      "Response cache lookups by cache and result (hit, miss, error).",
+	}, []string{"cache", "result"})
+
+	cacheInvalidations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "cache",
+		Name:      "invalidations_total",
+		Help:      "Response cache invalidations by cache.",
+	}, []string{"cache"})
+
+	eventDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "consumer",
+		Name:      "handle_duration_seconds",
+		Help:      "Time spent in orchestrator event handlers by event key and result.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"event", "result"})
+)
+
+// Handler serves the Prometheus exposition format.
+func Handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.Handler())
+}
+
+// Middleware records the latency and status of every request. The route
+// label is gin's path template, so /admin/dlq/:id stays one series; the
+// role is read after the handler chain ran, once the JWT was parsed.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		role := c.GetString("role")
+		if role == "" {
+			role = "anonymous"
+		}
+		httpDuration.WithLabelValues(route, c.Request.Method, strconv.Itoa(c.Writer.Status()), role).
+			Observe(time.Since(start).Seconds())
+	}
+}
+
+// StartRPC marks an RPC on routingKey as in flight and returns the function
+// that records its outcome once the reply (or error) is in.
+func StartRPC(routingKey string) func(err error) {
+	start := time.Now()
+	rpcInFlight.WithLabelValues(routingKey).Inc()
+	return func(err error) {
+		rpcInFlight.WithLabelValues(routingKey).Dec()
+		outcome := "ok"
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			outcome = "timeout"
+			rpcTimeouts.WithLabelValues(routingKey).Inc()
+		case err != nil:
+			outcome = "error"
+			rpcErrors.WithLabelValues(routingKey).Inc()
+		}
+		rpcDuration.WithLabelValues(routingKey, outcome).Observe(time.Since(start).Seconds())
+	}
+}
+
+// circuitStates are the values of the circuit_state gauge.
+var circuitStates = map[string]float64{"closed": 0, "half_open": 1, "open": 2}
+
+// SetCircuitState records the breaker state (closed, half_open or open) of
+// routingKey.
+func SetCircuitState(routingKey, state string) {
+	rpcCircuitState.WithLabelValues(routingKey).Set(circuitStates[state])
+}
+
+// RPCRejected counts an RPC on routingKey refused by its breaker; reason is
+// circuit_open or bulkhead_full.
+func RPCRejected(routingKey, reason string) {
+	rpcRejected.WithLabelValues(routingKey, reason).Inc()
+}
+
+// PublishFailed counts a message that never reached the broker.
+func PublishFailed(exchange, routingKey string) {
+	publishFailures.WithLabelValues(exchange, routingKey).Inc()
+}
+
+// ObserveEvent records how long handling event took; result is one of
+// ack, retry, dead_letter or dropped (failed after an early ack).
+func ObserveEvent(event, result string, d time.Duration) {
+	eventDuration.WithLabelValues(event, result).Observe(d.Seconds())
+}
+
+// CacheLookup counts one lookup in cache; result is hit, miss or error.
+func CacheLookup(cache, result string) {
+	cacheLookups.WithLabelValues(cache, result).Inc()
+}
+
+// CacheInvalidated counts one invalidation of cache.
+func CacheInvalidated(cache string) {
+	cacheInvalidations.WithLabelValues(cache).Inc()
+}
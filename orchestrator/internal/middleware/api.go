@@ -0,0 +1,169 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIError is the body of every non-2xx reply under /api/v1.
+type APIError struct {
+	Error APIErrorBody `json:"error"`
+}
+
+// APIErrorBody describes one failure. Code is a stable, machine-readable
+// name for the HTTP status; Details carries whatever else the handler
+// reported (e.g. the balance behind a 402).
+type APIErrorBody struct {
+	Status  int                    `json:"status"`
+	Code    string                 `json:"code" enum:"invalid_request|unauthenticated|payment_required|forbidden|not_found|conflict|unprocessable|too_many_requests|internal|bad_gateway|unavailable|timeout|error"`
+	Message string                 `json:"message"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+var errorCodes = map[int]string{
+	http.StatusBadRequest:          "invalid_request",
+	http.StatusUnauthorized:        "unauthenticated",
+	http.StatusPaymentRequired:     "payment_required",
+	http.StatusForbidden:           "forbidden",
+	http.StatusNotFound:            "not_found",
+	http.StatusConflict:            "conflict",
+	http.StatusUnprocessableEntity: "unprocessable",
+	http.StatusTooManyRequests:     "too_many_requests",
+	http.StatusInternalServerError: "internal",
+	http.StatusBadGateway:          "bad_gateway",
+	http.StatusServiceUnavailable:  "unavailable",
+	http.StatusGatewayTimeout:      "timeout",
+}
+
+// ErrorEnvelope rewrites every error reply of the handlers after it into an
+// APIError, whatever shape the handler wrote: the message is taken from its
+// "error" (or "message") field and the other fields become details.
+// Successful replies, including event streams, pass through untouched.
+func ErrorEnvelope() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		w := &envelopeWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+		if w.failed {
+			w.flushEnvelope()
+		}
+	}
+}
+
+// APINotFound is the engine's NoRoute handler: requests under prefix that
+// match no route get a 404 APIError, the others gin's plain 404.
+func APINotFound(prefix string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if strings.HasPrefix(c.Request.URL.Path, prefix) {
+			c.JSON(http.StatusNotFound, APIError{Error: APIErrorBody{
+				Status:  http.StatusNotFound,
+				Code:    errorCodes[http.StatusNotFound],
+				Message: "no route for " + c.Request.Method + " " + c.Request.URL.Path,
+			}})
+		}
+	}
+}
+
+// envelopeWriter holds back the body of an error reply so it can be
+// rewritten once the handler is done.
+type envelopeWriter struct {
+	gin.ResponseWriter
+	failed bool
+	status int
+	body   bytes.Buffer
+}
+
+func (w *envelopeWriter) WriteHeader(code int) {
+	if code >= http.StatusBadRequest {
+		w.failed, w.status = true, code
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *envelopeWriter) Write(b []byte) (int, error) {
+	if w.failed {
+		return w.body.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *envelopeWriter) WriteString(s string) (int, error) {
+	if w.failed {
+		return w.body.WriteString(s)
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+// WriteHeaderNow is called by gin for replies without a body (c.Status,
+// c.AbortWithStatus), before any Write.
+func (w *envelopeWriter) WriteHeaderNow() {
+	if !w.failed && w.ResponseWriter.Status() >= http.StatusBadRequest {
+		w.failed, w.status = true, w.ResponseWriter.Status()
+	}
+	if !w.failed {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+// Flush is held back with the body of an error reply.
+func (w *envelopeWriter) Flush() {
+	if !w.failed {
+		w.ResponseWriter.Flush()
+	}
+}
+
+func (w *envelopeWriter) Status() int {
+	if w.failed {
+		return w.status
+	}
+	return w.ResponseWriter.Status()
+}
+
+func (w *envelopeWriter) Size() int {
+	if w.failed {
+		return w.body.Len()
+	}
+	return w.ResponseWriter.Size()
+}
+
+func (w *envelopeWriter) Written() bool {
+	return w.failed || w.ResponseWriter.Written()
+}
+
+func (w *envelopeWriter) flushEnvelope() {
+	env := APIError{Error: APIErrorBody{Status: w.status, Code: errorCodes[w.status]}}
+	if env.Error.Code == "" {
+		env.Error.Code = "error"
+	}
+
+	var fields map[string]interface{}
+	if json.Unmarshal(w.body.Bytes(), &fields) == nil {
+		for _, key := range []string{"error", "message"} {
+			if s, ok := fields[key].(string); ok && s != "" && env.Error.Message == "" {
+				env.Error.Message = s
+				delete(fields, key)
+			}
+		}
+		delete(fields, "status") // the legacy "ok"/"error" marker
+		if len(fields) > 0 {
+			env.Error.Details = fields
+		}
+	} else if w.body.Len() > 0 {
+		env.Error.Message = w.body.String()
+	}
+	if env.Error.Message == "" {
+		env.Error.Message = http.StatusText(w.status)
+	}
+
+	out, _ := json.Marshal(env)
+	h := w.ResponseWriter.Header()
+	h.Set("Content-Type", "application/json; charset=utf-8")
+	h.Del("Content-Length")
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.Write(out) //nolint:errcheck
+}
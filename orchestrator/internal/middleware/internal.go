@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Shared secret of the service-to-service endpoints under /internal
+var internalToken = []byte(os.Getenv("INTERNAL_API_TOKEN"))
+
+// InternalTokenMiddleware admits requests carrying
+// "Authorization: Bearer <INTERNAL_API_TOKEN>". Without a configured
+// token every request is refused.
+func InternalTokenMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if len(internalToken) == 0 || !ok || subtle.ConstantTimeCompare([]byte(token), internalToken) != 1 {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid internal token"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -1,10 +1,14 @@
 package middleware
 
 import (
+	"errors"
+	"log"
 	"net/http"
 	"os"
 	"strings"
 
+	"orchestrator/internal/sessions"
+
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 )
@@ -13,14 +17,22 @@ import (
 var jwtKey = []byte(os.Getenv("JWT_SECRET"))
 
 type Claims struct {
-	UserID    string `json:"user_id"`
-	Username  string `json:"username,omitempty"`
-	Role      string `json:"role"`
-	StudentID string `json:"student_id,omitempty"` // Add student_id field
+	UserID      string   `json:"user_id"`
+	Username    string   `json:"username,omitempty"`
+	Role        string   `json:"role"`
+	Roles       []string `json:"roles,omitempty"`       // every role held, Role first
+	StudentID   string   `json:"student_id,omitempty"`  // Add student_id field
+	Institution string   `json:"institution,omitempty"` // billed for the user's uploads
+	// TokenVersion is the account's version when the token was issued;
+	// Email is only set by google_auth_service
+	TokenVersion int    `json:"token_version,omitempty"`
+	Email        string `json:"email,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func JWTAuthMiddleware() gin.HandlerFunc {
+// JWTAuthMiddleware accepts a signed, unexpired bearer token that checker
+// does not find revoked.
+func JWTAuthMiddleware(checker *sessions.Checker) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -46,11 +58,35 @@ func JWTAuthMiddleware() gin.HandlerFunc {
 			c.Abort()
 			return
 		}
+		err = checker.Check(c.Request.Context(), sessions.Token{
+			Username:     claims.Username,
+			TokenVersion: claims.TokenVersion,
+			Google:       claims.Email != "",
+		})
+		if errors.Is(err, sessions.ErrRevoked) {
+			log.Printf("[Auth] refused token of %s: %v", claims.Username, err)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token revoked, log in again"})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			log.Printf("[Auth] ❌ session check for %s: %v", claims.Username, err)
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Could not check the session, retry later"})
+			c.Abort()
+			return
+		}
 
 		c.Set("user_id", claims.UserID)
 		c.Set("username", claims.Username) // Add username to context
 		c.Set("role", claims.Role)
+		// Tokens issued before multi-role accounts carry only role
+		roles := claims.Roles
+		if len(roles) == 0 && claims.Role != "" {
+			roles = []string{claims.Role}
+		}
+		c.Set("roles", roles)
 		c.Set("student_id", claims.StudentID) // Set student_id in context
+		c.Set("institution", claims.Institution)
 
 		c.Next()
 	}
@@ -78,6 +114,24 @@ func GetRole(c *gin.Context) string {
 	return ""
 }
 
+// GetRoles returns every role the caller holds, the primary role first.
+func GetRoles(c *gin.Context) []string {
+	if roles, exists := c.Get("roles"); exists {
+		return roles.([]string)
+	}
+	return nil
+}
+
+// HasRole reports whether role is any of the caller's roles.
+func HasRole(c *gin.Context, role string) bool {
+	for _, r := range GetRoles(c) {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
 func GetStudentID(c *gin.Context) string {
 	if studentID, exists := c.Get("student_id"); exists && studentID != nil {
 		return studentID.(string)
@@ -85,8 +139,30 @@ func GetStudentID(c *gin.Context) string {
 	return ""
 }
 
+// GetInstitution returns the institution the caller belongs to, or "" for
+// accounts not linked to one.
+func GetInstitution(c *gin.Context) string {
+	if institution, exists := c.Get("institution"); exists && institution != nil {
+		return institution.(string)
+	}
+	return ""
+}
+
+// RequireRole refuses with 403 a caller who does not hold role. It runs
+// after JWTAuthMiddleware.
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !HasRole(c, role) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access restricted to " + role})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
 func IsStudent(c *gin.Context) bool {
-	return GetRole(c) == "student"
+	return HasRole(c, "student")
 }
 
 func RequireStudentID() gin.HandlerFunc {
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"orchestrator/internal/sessions"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func signed(t *testing.T, claims Claims) string {
+	t.Helper()
+	claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(time.Hour))
+	tok, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &claims).SignedString(jwtKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tok
+}
+
+func TestJWTAuthRefusesRevokedTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	jwtKey = []byte("test-secret")
+
+	// alice was locked after her token was issued (version 0); user
+	// management bumped her version to 1
+	accounts := map[string]sessions.State{
+		"alice": {Found: true, Locked: true, TokenVersion: 1},
+		"bob":   {Found: true, TokenVersion: 1},
+	}
+	lookup := func(_ context.Context, username string) (sessions.State, error) {
+		if username == "down" {
+			return sessions.State{}, errors.New("user service down")
+		}
+		return accounts[username], nil
+	}
+
+	r := gin.New()
+	r.Use(JWTAuthMiddleware(sessions.New(lookup, 0)))
+	r.GET("/", func(c *gin.Context) { c.String(http.StatusOK, GetUsername(c)) })
+
+	tests := []struct {
+		name   string
+		claims Claims
+		want   int
+	}{
+		{"locked user's old token", Claims{Username: "alice", Role: "student"}, http.StatusUnauthorized},
+		{"token issued before a password reset", Claims{Username: "bob", Role: "student"}, http.StatusUnauthorized},
+		{"token issued after it", Claims{Username: "bob", Role: "student", TokenVersion: 1}, http.StatusOK},
+		{"deleted user", Claims{Username: "carol", Role: "student"}, http.StatusUnauthorized},
+		{"account lookup fails", Claims{Username: "down", Role: "student"}, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+signed(t, tt.claims))
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d (%s), want %d", w.Code, w.Body, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package notify
+
+// Per-user notifications pushed to browsers. Domain event handlers publish
+// a types.Notification on the notifications exchange with its recipient as
+// routing key (user.<username>, student.<student id> or
+// institution.<name>, with ".", "*", "#" and "%" escaped so no name can
+// bind a wildcard or span several words). Every orchestrator replica consumes from its own
+// exclusive queue, bound only to the recipients with an open stream on
+// that replica, and fans each message out to their streams; a browser
+// gets its notifications whichever replica it is connected to.
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"orchestrator/internal/types"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// DefaultExchange is used when the config names no exchange.
+const DefaultExchange = "clearsky.notifications"
+
+// buffer is how many notifications a slow stream may fall behind before
+// further ones are dropped for it.
+const buffer = 16
+
+// Recipient routing keys.
+func UserKey(username string) string     { return "user." + escapeKey(username) }
+func StudentKey(studentID string) string { return "student." + escapeKey(studentID) }
+func InstitutionKey(name string) string  { return "institution." + escapeKey(name) }
+
+// keyEscaper percent-encodes what a topic exchange gives a meaning to.
+var keyEscaper = strings.NewReplacer("%", "%25", ".", "%2E", "*", "%2A", "#", "%23")
+
+func escapeKey(s string) string { return keyEscaper.Replace(s) }
+
+// Hub fans notifications from this replica's queue out to subscriptions.
+type Hub struct {
+	exchange string
+
+	mu    sync.Mutex
+	subs  map[string]map[*Subscription]struct{}
+	ch    *amqp.Channel // nil while disconnected
+	queue string
+}
+
+// Subscription receives the notifications sent to any of its keys.
+type Subscription struct {
+	C    <-chan types.Notification
+	c    chan types.Notification
+	keys []string
+	hub  *Hub
+}
+
+// NewHub returns a hub for exchange. Register Setup with the connection
+// manager to start receiving.
+func NewHub(exchange string) *Hub {
+	if exchange == "" {
+		exchange = DefaultExchange
+	}
+	return &Hub{exchange: exchange, subs: make(map[string]map[*Subscription]struct{})}
+}
+
+// Setup declares the exchange and this replica's queue, binds the keys of
+// the open subscriptions and starts consuming. It runs again after every
+// reconnect.
+func (h *Hub) Setup(conn *amqp.Connection) error {
+	ch, err := conn.Channel()
+	if err != nil {
+		return fmt.Errorf("notifications channel: %w", err)
+	}
+	if err := ch.ExchangeDeclare(h.exchange, "topic", true, false, false, false, nil); err != nil {
+		ch.Close()
+		return fmt.Errorf("notifications ExchangeDeclare failed: %w", err)
+	}
+	// Server-named, exclusive and auto-deleted: it lives as long as this
+	// replica's connection
+	q, err := ch.QueueDeclare("", false, true, true, false, nil)
+	if err != nil {
+		ch.Close()
+		return fmt.Errorf("notifications QueueDeclare failed: %w", err)
+	}
+	msgs, err := ch.Consume(q.Name, "", true, true, false, false, nil)
+	if err != nil {
+		ch.Close()
+		return fmt.Errorf("notifications Consume failed: %w", err)
+	}
+
+	h.mu.Lock()
+	for key := range h.subs {
+		if err := ch.QueueBind(q.Name, key, h.exchange, false, nil); err != nil {
+			h.mu.Unlock()
+			ch.Close()
+			return fmt.Errorf("notifications QueueBind %q failed: %w", key, err)
+		}
+	}
+	h.ch, h.queue = ch, q.Name
+	bound := len(h.subs)
+	h.mu.Unlock()
+
+	closed := ch.NotifyClose(make(chan *amqp.Error, 1))
+	go func() {
+		for d := range msgs {
+			h.deliver(d.RoutingKey, d.Body)
+		}
+		<-closed
+		h.mu.Lock()
+		if h.ch == ch {
+			h.ch = nil
+		}
+		h.mu.Unlock()
+	}()
+	log.Printf("[Notify] ✅ queue %s bound to %d recipient(s)", q.Name, bound)
+	return nil
+}
+
+// Subscribe opens a subscription for keys. Close it when the stream ends.
+func (h *Hub) Subscribe(keys ...string) *Subscription {
+	c := make(chan types.Notification, buffer)
+	s := &Subscription{C: c, c: c, keys: keys, hub: h}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, key := range keys {
+		if h.subs[key] == nil {
+			h.subs[key] = make(map[*Subscription]struct{})
+			h.bind(key, true)
+		}
+		h.subs[key][s] = struct{}{}
+	}
+	return s
+}
+
+// Close ends the subscription and closes C.
+func (s *Subscription) Close() {
+	h := s.hub
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, key := range s.keys {
+		delete(h.subs[key], s)
+		if len(h.subs[key]) == 0 {
+			delete(h.subs, key)
+			h.bind(key, false)
+		}
+	}
+	close(s.c)
+}
+
+// bind adds or removes key on this replica's queue; while disconnected it
+// is left to the next Setup. Callers hold h.mu.
+func (h *Hub) bind(key string, on bool) {
+	if h.ch == nil {
+		return
+	}
+	var err error
+	if on {
+		err = h.ch.QueueBind(h.queue, key, h.exchange, false, nil)
+	} else {
+		err = h.ch.QueueUnbind(h.queue, key, h.exchange, nil)
+	}
+	if err != nil {
+		log.Printf("[Notify] ❌ binding %q (%v): %v", key, on, err)
+	}
+}
+
+// deliver hands a notification to every subscription for key.
+func (h *Hub) deliver(key string, body []byte) {
+	var n types.Notification
+	if err := json.Unmarshal(body, &n); err != nil {
+		log.Printf("[Notify] dropping malformed notification for %s: %v", key, err)
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.subs[key] {
+		select {
+		case s.c <- n:
+		default:
+			log.Printf("[Notify] stream for %s is behind, dropping %s", key, n.ID)
+		}
+	}
+}
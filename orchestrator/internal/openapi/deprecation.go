@@ -0,0 +1,67 @@
+package openapi
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Deprecations returns middleware that marks the replies of every route
+// with a Successor as deprecated (RFC 9745): "Deprecation: true", a
+// Sunset header (RFC 8594) with the date the route goes away, if sunset
+// ("2006-01-02") is set, and a Link to the successor. It is installed on
+// the engine, so even refused calls of a legacy route carry the headers.
+func Deprecations(routes []Route, sunset string) gin.HandlerFunc {
+	successors := make(map[string]string)
+	for _, rt := range routes {
+		if rt.Successor != "" {
+			successors[rt.Method+" "+rt.Path] = rt.Successor
+		}
+	}
+	var sunsetHeader string
+	if sunset != "" {
+		t, err := time.Parse(time.DateOnly, sunset)
+		if err != nil {
+			log.Printf("[OpenAPI] ⚠ legacy sunset %q is not a date (YYYY-MM-DD); no Sunset header is sent", sunset)
+		} else {
+			sunsetHeader = t.UTC().Format(http.TimeFormat)
+		}
+	}
+
+	return func(c *gin.Context) {
+		successor, ok := successors[c.Request.Method+" "+c.FullPath()]
+		if !ok {
+			c.Next()
+			return
+		}
+		h := c.Writer.Header()
+		h.Set("Deprecation", "true")
+		if sunsetHeader != "" {
+			h.Set("Sunset", sunsetHeader)
+		}
+		if link, ok := successorLink(c, successor); ok {
+			h.Set("Link", "<"+link+`>; rel="successor-version"`)
+		}
+		c.Next()
+	}
+}
+
+// successorLink fills the :params of successor ("GET /api/v1/x/:name")
+// from the request; false if one of them is not in the legacy path.
+func successorLink(c *gin.Context, successor string) (string, bool) {
+	_, path, _ := strings.Cut(successor, " ")
+	parts := strings.Split(path, "/")
+	for i, p := range parts {
+		if name, ok := strings.CutPrefix(p, ":"); ok {
+			v := c.Param(name)
+			if v == "" {
+				return "", false
+			}
+			parts[i] = v
+		}
+	}
+	return strings.Join(parts, "/"), true
+}
@@ -0,0 +1,206 @@
+package openapi
+
+import (
+	"orchestrator/internal/handlers"
+	"orchestrator/internal/jobs"
+	"orchestrator/internal/rabbitmq"
+	"orchestrator/internal/types"
+	"orchestrator/internal/workflow"
+)
+
+// Route documents one HTTP endpoint. Paths use gin syntax (:param).
+type Route struct {
+	Method  string
+	Path    string
+	ID      string
+	Summary string
+	Tag     string
+	// Auth requires a bearer token; who may call is up to the RBAC
+	// policy (configs/rbac.yaml).
+	Auth bool
+	// Request is a value of the JSON body type; Files names required
+	// multipart file fields. At most one of the two is set.
+	Request interface{}
+	Files   []string
+	// Response is a value of the success body type (nil: any JSON).
+	Response interface{}
+	Status   int
+	// Errors lists further error statuses the handler can return.
+	Errors []int
+	// Successor ("METHOD /path") marks a legacy route as deprecated in
+	// favour of an /api/v1 route; see Deprecations.
+	Successor string
+}
+
+var rpcErrors = []int{500, 503, 504}
+
+// Routes is the contract of every endpoint registered by routes.SetupRouter.
+var Routes = []Route{
+	// Users
+	{Method: "POST", Path: "/user/register", ID: "registerUser", Summary: "Register a user account", Tag: "users",
+		Request: handlers.RegisterRequest{}, Errors: rpcErrors},
+	{Method: "POST", Path: "/user/login", ID: "loginUser", Summary: "Log in with username and password", Tag: "users",
+		Request: handlers.LoginRequest{}, Errors: rpcErrors},
+	{Method: "DELETE", Path: "/user/delete", ID: "deleteUser", Summary: "Delete a user account", Tag: "users",
+		Request: handlers.DeleteUserRequest{}, Errors: rpcErrors},
+	{Method: "POST", Path: "/user/google-login", ID: "googleLogin", Summary: "Log in with a Google ID token", Tag: "users",
+		Request: handlers.GoogleLoginInput{}, Errors: rpcErrors},
+	{Method: "PATCH", Path: "/user/change-password", ID: "changePassword", Summary: "Change a user's password", Tag: "users",
+		Request: handlers.ChangePasswordRequest{}, Errors: rpcErrors},
+
+	// Institutions & credits
+	{Method: "GET", Path: "/institutions", ID: "listInstitutions", Summary: "Search the registered institutions", Tag: "institutions",
+		Response: handlers.InstitutionPage{}, Errors: []int{400, 500, 503, 504}, Successor: "GET /api/v1/institutions"},
+	{Method: "GET", Path: "/institutions/:name", ID: "getInstitution", Summary: "Show one registered institution", Tag: "institutions",
+		Response: handlers.Institution{}, Errors: []int{404, 500, 503, 504}, Successor: "GET /api/v1/institutions/:name"},
+	{Method: "POST", Path: "/registration", ID: "registerInstitution", Summary: "Register an institution", Tag: "institutions",
+		Auth: true, Request: handlers.UserRequest{}, Response: handlers.Response{}, Status: 202, Errors: rpcErrors, Successor: "POST /api/v1/institutions"},
+	{Method: "PATCH", Path: "/purchase", ID: "purchaseCredits", Summary: "Buy credits for an institution", Tag: "credits",
+		Auth: true, Request: handlers.PurchaseRequest{}, Response: handlers.PurchaseResponse{}, Errors: append([]int{404}, rpcErrors...), Successor: "POST /api/v1/institutions/:name/credits/purchases"},
+	{Method: "GET", Path: "/mycredits", ID: "availableCredits", Summary: "Show an institution's credit balance", Tag: "credits",
+		Auth: true, Request: handlers.AvailableReq{}, Response: handlers.AvailableResp{}, Errors: append([]int{404}, rpcErrors...), Successor: "GET /api/v1/institutions/:name/credits"},
+	{Method: "POST", Path: "/institution/users", ID: "createMember", Summary: "Add a student or instructor to the caller's institution", Tag: "institutions",
+		Auth: true, Request: handlers.MemberRequest{}, Response: handlers.ManagedUser{}, Status: 201, Errors: []int{400, 404, 409, 500, 503, 504}},
+
+	// Grades
+	{Method: "POST", Path: "/upload_init", ID: "uploadInitialGrades", Summary: "Queue an initial grade sheet (.xlsx, .ods or .csv) for import", Tag: "grades",
+		Auth: true, Files: []string{"file"}, Response: handlers.JobAccepted{}, Status: 202, Errors: []int{422, 500}, Successor: "POST /api/v1/grades/initial"},
+	{Method: "PATCH", Path: "/postFinalGrades", ID: "uploadFinalGrades", Summary: "Queue a final grade sheet (.xlsx, .ods or .csv) for import", Tag: "grades",
+		Auth: true, Files: []string{"file"}, Response: handlers.JobAccepted{}, Status: 202, Errors: []int{402, 422, 500, 503, 504}, Successor: "POST /api/v1/grades/final"},
+	{Method: "GET", Path: "/jobs/:id", ID: "uploadJobStatus", Summary: "Show the state of an upload job", Tag: "grades",
+		Auth: true, Response: jobs.Job{}, Errors: []int{404}, Successor: "GET /api/v1/jobs/:id"},
+	{Method: "GET", Path: "/jobs/:id/events", ID: "uploadJobEvents", Summary: "Stream an upload job's state changes (text/event-stream)", Tag: "grades",
+		Auth: true, Errors: []int{404}, Successor: "GET /api/v1/jobs/:id/events"},
+	{Method: "GET", Path: "/personal/grades", ID: "personalGrades", Summary: "Show the caller's grades", Tag: "grades",
+		Auth: true, Errors: rpcErrors, Successor: "GET /api/v1/grades"},
+
+	// Review requests
+	{Method: "PATCH", Path: "/student/reviewRequest", ID: "postReviewRequest", Summary: "Ask for a grade review", Tag: "reviews",
+		Auth: true, Request: handlers.ReviewRequestInput{}, Response: handlers.OperationResponse{}, Errors: []int{422, 500, 503, 504}, Successor: "POST /api/v1/reviews"},
+	{Method: "PATCH", Path: "/student/status", ID: "reviewRequestStatus", Summary: "Show the status of a review request", Tag: "reviews",
+		Auth: true, Request: handlers.ReviewStatusInput{}, Errors: rpcErrors, Successor: "GET /api/v1/reviews"},
+	{Method: "PATCH", Path: "/instructor/review-list", ID: "reviewRequestList", Summary: "List pending review requests", Tag: "reviews",
+		Auth: true, Errors: rpcErrors, Successor: "GET /api/v1/reviews"},
+	{Method: "PATCH", Path: "/instructor/reply", ID: "replyReviewRequest", Summary: "Answer a review request", Tag: "reviews",
+		Auth: true, Request: handlers.InstructorReplyInput{}, Response: handlers.OperationResponse{}, Errors: []int{422, 500, 503, 504}, Successor: "POST /api/v1/reviews/replies"},
+	{Method: "GET", Path: "/operations/:id", ID: "reviewOperationStatus", Summary: "Show how a review request or reply write ended", Tag: "reviews",
+		Auth: true, Response: workflow.Operation{}, Errors: []int{404, 500}, Successor: "GET /api/v1/operations/:id"},
+
+	// Notifications
+	{Method: "GET", Path: "/notifications/stream", ID: "notificationStream", Summary: "Stream the caller's notifications as server-sent \"notification\" events (text/event-stream)", Tag: "notifications",
+		Auth: true, Successor: "GET /api/v1/notifications/stream"},
+
+	// Statistics
+	{Method: "GET", Path: "/stats/available", ID: "availableStatistics", Summary: "List courses with statistics", Tag: "statistics",
+		Auth: true, Errors: append([]int{502}, rpcErrors...), Successor: "GET /api/v1/courses"},
+	{Method: "GET", Path: "/stats/courses", ID: "statisticsCourses", Summary: "List courses with statistics", Tag: "statistics",
+		Auth: true, Errors: append([]int{502}, rpcErrors...), Successor: "GET /api/v1/courses"},
+	{Method: "POST", Path: "/stats/distributions", ID: "gradeDistributions", Summary: "Grade histograms for a course", Tag: "statistics",
+		Auth: true, Request: types.DistributionsRequest{}, Errors: append([]int{502}, rpcErrors...), Successor: "GET /api/v1/courses/:course/distributions"},
+
+	// Versioned API. Same handlers as the legacy routes above where the
+	// semantics match; errors are middleware.APIError envelopes.
+	{Method: "GET", Path: "/api/v1/institutions", ID: "v1ListInstitutions", Summary: "Search the registered institutions", Tag: "v1 institutions",
+		Response: handlers.InstitutionPage{}, Errors: []int{400, 500, 503, 504}},
+	{Method: "GET", Path: "/api/v1/institutions/:name", ID: "v1GetInstitution", Summary: "Show one registered institution", Tag: "v1 institutions",
+		Response: handlers.Institution{}, Errors: []int{404, 500, 503, 504}},
+	{Method: "POST", Path: "/api/v1/institutions", ID: "v1RegisterInstitution", Summary: "Register an institution for approval", Tag: "v1 institutions",
+		Auth: true, Request: handlers.UserRequest{}, Response: handlers.Response{}, Status: 202, Errors: rpcErrors},
+	{Method: "GET", Path: "/api/v1/institutions/:name/credits", ID: "v1InstitutionCredits", Summary: "Show an institution's credit balance", Tag: "v1 institutions",
+		Auth: true, Response: handlers.InstitutionCredits{}, Errors: []int{404, 500, 503, 504}},
+	{Method: "POST", Path: "/api/v1/institutions/:name/credits/purchases", ID: "v1PurchaseCredits", Summary: "Buy credits for an institution", Tag: "v1 institutions",
+		Auth: true, Request: handlers.CreditPurchase{}, Response: handlers.CreditPurchaseReceipt{}, Status: 201, Errors: []int{404, 500, 502, 503, 504}},
+
+	{Method: "GET", Path: "/api/v1/grades", ID: "v1PersonalGrades", Summary: "Show the caller's grades", Tag: "v1 grades",
+		Auth: true, Errors: append([]int{400}, rpcErrors...)},
+	{Method: "POST", Path: "/api/v1/grades/initial", ID: "v1UploadInitialGrades", Summary: "Queue an initial grade sheet (.xlsx, .ods or .csv) for import", Tag: "v1 grades",
+		Auth: true, Files: []string{"file"}, Response: handlers.JobAccepted{}, Status: 202, Errors: []int{422, 500}},
+	{Method: "POST", Path: "/api/v1/grades/final", ID: "v1UploadFinalGrades", Summary: "Queue a final grade sheet (.xlsx, .ods or .csv) for import", Tag: "v1 grades",
+		Auth: true, Files: []string{"file"}, Response: handlers.JobAccepted{}, Status: 202, Errors: []int{402, 422, 500, 503, 504}},
+	{Method: "GET", Path: "/api/v1/jobs/:id", ID: "v1UploadJobStatus", Summary: "Show the state of an upload job", Tag: "v1 grades",
+		Auth: true, Response: jobs.Job{}, Errors: []int{404}},
+	{Method: "GET", Path: "/api/v1/jobs/:id/events", ID: "v1UploadJobEvents", Summary: "Stream an upload job's state changes (text/event-stream)", Tag: "v1 grades",
+		Auth: true, Errors: []int{404}},
+
+	{Method: "GET", Path: "/api/v1/reviews", ID: "v1ListReviews", Summary: "List review requests: a student's own (course and period required) or those pending on an instructor's courses; callers with both roles pass as=student|instructor", Tag: "v1 reviews",
+		Auth: true, Response: handlers.ReviewList{}, Errors: append([]int{400, 502}, rpcErrors...)},
+	{Method: "POST", Path: "/api/v1/reviews", ID: "v1CreateReview", Summary: "Ask for a grade review", Tag: "v1 reviews",
+		Auth: true, Request: handlers.ReviewRequestInput{}, Response: handlers.OperationResponse{}, Status: 201, Errors: []int{422, 500, 503, 504}},
+	{Method: "POST", Path: "/api/v1/reviews/replies", ID: "v1ReplyReview", Summary: "Answer a review request", Tag: "v1 reviews",
+		Auth: true, Request: handlers.InstructorReplyInput{}, Response: handlers.OperationResponse{}, Status: 201, Errors: []int{422, 500, 503, 504}},
+	{Method: "GET", Path: "/api/v1/operations/:id", ID: "v1ReviewOperationStatus", Summary: "Show how a review request or reply write ended", Tag: "v1 reviews",
+		Auth: true, Response: workflow.Operation{}, Errors: []int{404, 500}},
+
+	{Method: "GET", Path: "/api/v1/courses", ID: "v1ListCourses", Summary: "List courses with statistics", Tag: "v1 statistics",
+		Auth: true, Errors: append([]int{502}, rpcErrors...)},
+	{Method: "GET", Path: "/api/v1/courses/:course/distributions", ID: "v1GradeDistributions", Summary: "Grade histograms for a course sheet (period and class_title query parameters required); the reply carries an ETag, and If-None-Match answers 304 while it is current", Tag: "v1 statistics",
+		Auth: true, Errors: append([]int{400, 502}, rpcErrors...)},
+
+	{Method: "GET", Path: "/api/v1/notifications/stream", ID: "v1NotificationStream", Summary: "Stream the caller's notifications as server-sent \"notification\" events (text/event-stream)", Tag: "v1 notifications",
+		Auth: true},
+
+	// Admin
+	{Method: "GET", Path: "/admin/dlq", ID: "listDeadLetters", Summary: "List dead-lettered messages", Tag: "admin",
+		Auth: true, Errors: []int{500, 503}},
+	{Method: "GET", Path: "/admin/dlq/audit", ID: "deadLetterAudit", Summary: "Audit trail of DLQ actions", Tag: "admin",
+		Auth: true, Response: []handlers.AuditEntry{}, Errors: []int{500}},
+	{Method: "GET", Path: "/admin/dlq/:id", ID: "previewDeadLetter", Summary: "Show one dead letter with its body", Tag: "admin",
+		Auth: true, Response: rabbitmq.DeadLetter{}, Errors: []int{404, 500, 503}},
+	{Method: "POST", Path: "/admin/dlq/replay", ID: "replayDeadLetters", Summary: "Republish dead letters to their origin", Tag: "admin",
+		Auth: true, Request: handlers.DLQSelection{}, Errors: []int{500, 503}},
+	{Method: "POST", Path: "/admin/dlq/purge", ID: "purgeDeadLetters", Summary: "Delete dead letters", Tag: "admin",
+		Auth: true, Request: handlers.DLQSelection{}, Errors: []int{500, 503}},
+	{Method: "GET", Path: "/admin/institutions", ID: "listRegistrations", Summary: "List institution registrations, pending ones by default", Tag: "admin",
+		Auth: true, Response: handlers.OnboardingPage{}, Errors: []int{400, 500, 503, 504}},
+	{Method: "GET", Path: "/admin/institutions/:name", ID: "getRegistration", Summary: "Show one institution registration", Tag: "admin",
+		Auth: true, Response: handlers.OnboardingRecord{}, Errors: []int{404, 500, 503, 504}},
+	{Method: "POST", Path: "/admin/institutions/:name/approve", ID: "approveRegistration", Summary: "Approve a registration and open its credits account", Tag: "admin",
+		Auth: true, Request: handlers.DecisionRequest{}, Response: handlers.OnboardingRecord{}, Errors: []int{404, 409, 500, 503, 504}},
+	{Method: "POST", Path: "/admin/institutions/:name/reject", ID: "rejectRegistration", Summary: "Reject a registration with a reason", Tag: "admin",
+		Auth: true, Request: handlers.DecisionRequest{}, Response: handlers.OnboardingRecord{}, Errors: []int{404, 409, 500, 503, 504}},
+	{Method: "GET", Path: "/admin/users", ID: "listUsers", Summary: "List and search user accounts", Tag: "admin",
+		Auth: true, Response: handlers.UserPage{}, Errors: []int{400, 500, 503, 504}},
+	{Method: "GET", Path: "/admin/users/audit", ID: "userAdminAudit", Summary: "Audit trail of user administration, newest first", Tag: "admin",
+		Auth: true, Response: handlers.UserAuditPage{}, Errors: []int{400, 500, 503, 504}},
+	{Method: "GET", Path: "/admin/users/:username", ID: "getManagedUser", Summary: "Show one user account", Tag: "admin",
+		Auth: true, Response: handlers.ManagedUser{}, Errors: []int{404, 500, 503, 504}},
+	{Method: "PATCH", Path: "/admin/users/:username/role", ID: "setUserRole", Summary: "Change the role of a user", Tag: "admin",
+		Auth: true, Request: handlers.RoleChangeRequest{}, Response: handlers.ManagedUser{}, Errors: []int{400, 404, 409, 500, 503, 504}},
+	{Method: "PATCH", Path: "/admin/users/:username/institution", ID: "setUserInstitution", Summary: "Assign an approved institution to a user", Tag: "admin",
+		Auth: true, Request: handlers.InstitutionAssignment{}, Response: handlers.ManagedUser{}, Errors: []int{400, 404, 500, 503, 504}},
+	{Method: "POST", Path: "/admin/users/:username/lock", ID: "lockUser", Summary: "Lock an account so it cannot log in", Tag: "admin",
+		Auth: true, Response: handlers.ManagedUser{}, Errors: []int{404, 409, 500, 503, 504}},
+	{Method: "POST", Path: "/admin/users/:username/unlock", ID: "unlockUser", Summary: "Unlock an account", Tag: "admin",
+		Auth: true, Response: handlers.ManagedUser{}, Errors: []int{404, 409, 500, 503, 504}},
+	{Method: "POST", Path: "/admin/users/:username/reset-password", ID: "resetUserPassword", Summary: "Replace a password with a temporary one the user must change", Tag: "admin",
+		Auth: true, Response: handlers.PasswordResetResponse{}, Errors: []int{404, 500, 503, 504}},
+	{Method: "DELETE", Path: "/admin/users/:username", ID: "deleteManagedUser", Summary: "Delete a user account", Tag: "admin",
+		Auth: true, Response: handlers.ManagedUser{}, Errors: []int{404, 409, 500, 503, 504}},
+
+	// Operations
+	{Method: "GET", Path: "/metrics", ID: "metrics", Summary: "Prometheus metrics", Tag: "operations"},
+	{Method: "GET", Path: "/healthz", ID: "healthz", Summary: "Liveness probe", Tag: "operations"},
+	{Method: "GET", Path: "/readyz", ID: "readyz", Summary: "Readiness of the broker and downstream services", Tag: "operations",
+		Response: handlers.ReadyReport{}, Errors: []int{503}},
+
+	// Service-to-service; the bearer token is INTERNAL_API_TOKEN, not a JWT
+	{Method: "GET", Path: "/internal/blobs/:sha256", ID: "getBlob", Summary: "Download a stored workbook by its SHA-256 (application/octet-stream)", Tag: "internal",
+		Auth: true, Errors: []int{400, 404, 500}},
+
+	// Documentation
+	{Method: "GET", Path: "/openapi.json", ID: "openapiSpec", Summary: "This OpenAPI document", Tag: "docs"},
+	{Method: "GET", Path: "/docs", ID: "apiDocs", Summary: "Interactive API documentation", Tag: "docs"},
+}
+
+// PolicyRoutes lists the routes ("METHOD /path") the RBAC policy must
+// cover: every authenticated route except the service-to-service ones,
+// which take INTERNAL_API_TOKEN instead of a JWT.
+func PolicyRoutes(routes []Route) []string {
+	var keys []string
+	for _, rt := range routes {
+		if rt.Auth && rt.Tag != "internal" {
+			keys = append(keys, rt.Method+" "+rt.Path)
+		}
+	}
+	return keys
+}
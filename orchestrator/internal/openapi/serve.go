@@ -0,0 +1,34 @@
+package openapi
+
+import (
+	_ "embed"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed docs.html
+var docsPage []byte
+
+// Register serves the spec at /openapi.json and the docs page at /docs. The
+// spec is built on every request, so it follows reloads of the access
+// policy.
+func Register(r *gin.Engine, build func() *Document) {
+	r.GET("/openapi.json", func(c *gin.Context) { c.JSON(http.StatusOK, build()) })
+	r.GET("/docs", func(c *gin.Context) { c.Data(http.StatusOK, "text/html; charset=utf-8", docsPage) })
+}
+
+// CheckRoutes logs every registered endpoint that the spec does not
+// describe, so a new route without a contract is noticed at startup.
+func CheckRoutes(r *gin.Engine, routes []Route) {
+	known := make(map[string]bool, len(routes))
+	for _, rt := range routes {
+		known[rt.Method+" "+rt.Path] = true
+	}
+	for _, info := range r.Routes() {
+		if !known[info.Method+" "+info.Path] {
+			log.Printf("[OpenAPI] ⚠ %s %s is not documented", info.Method, info.Path)
+		}
+	}
+}
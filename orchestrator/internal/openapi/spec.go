@@ -0,0 +1,296 @@
+package openapi
+
+// OpenAPI 3.1 description of the orchestrator's HTTP API. The document is
+// built from the route table in routes.go; schemas come from the Go request
+// and response types through types.SchemaFor, so the spec cannot drift
+// from what the handlers bind.
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"orchestrator/internal/middleware"
+	"orchestrator/internal/rbac"
+	"orchestrator/internal/types"
+)
+
+// Document is the root OpenAPI object.
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Servers    []Server            `json:"servers,omitempty"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+	Tags       []Tag               `json:"tags,omitempty"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type Server struct {
+	URL string `json:"url"`
+}
+
+type Tag struct {
+	Name string `json:"name"`
+}
+
+// PathItem maps lower-case HTTP methods to operations.
+type PathItem map[string]*Operation
+
+type Operation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+	Deprecated  bool                  `json:"deprecated,omitempty"`
+	// XRoles lists the roles the RBAC policy lets call the operation.
+	XRoles []string `json:"x-roles,omitempty"`
+}
+
+type Parameter struct {
+	Name        string        `json:"name"`
+	In          string        `json:"in"`
+	Description string        `json:"description,omitempty"`
+	Required    bool          `json:"required,omitempty"`
+	Schema      *types.Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *types.Schema `json:"schema"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type Components struct {
+	Schemas         map[string]*types.Schema  `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+// ErrorResponse is the body of every non-2xx reply outside /api/v1.
+type ErrorResponse struct {
+	Error   string `json:"error"`
+	Details string `json:"details,omitempty"`
+}
+
+const (
+	jsonType      = "application/json"
+	multipartType = "multipart/form-data"
+	errorRef      = "#/components/schemas/Error"
+	apiErrorRef   = "#/components/schemas/APIError"
+)
+
+// Build assembles the document from routes. roles, if not nil, names the
+// roles the access policy lets call an authenticated route.
+func Build(routes []Route, roles func(method, path string) []string) *Document {
+	doc := &Document{
+		OpenAPI: "3.1.0",
+		Info: Info{
+			Title:       "ClearSky Orchestrator API",
+			Version:     "1.0.0",
+			Description: "HTTP gateway in front of the ClearSky microservices.",
+		},
+		Servers: []Server{{URL: "/"}},
+		Paths:   map[string]PathItem{},
+		Components: Components{
+			Schemas: map[string]*types.Schema{
+				"Error":    types.SchemaFor(ErrorResponse{}),
+				"APIError": types.SchemaFor(middleware.APIError{}),
+			},
+			SecuritySchemes: map[string]SecurityScheme{
+				"bearerAuth": {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+			},
+		},
+	}
+
+	tags := map[string]bool{}
+	for _, rt := range routes {
+		path, params := oasPath(rt.Path)
+		item, ok := doc.Paths[path]
+		if !ok {
+			item = PathItem{}
+			doc.Paths[path] = item
+		}
+		var allowed []string
+		if rt.Auth && roles != nil {
+			allowed = roles(rt.Method, rt.Path)
+			if contains(allowed, rbac.Authenticated) {
+				allowed = nil
+			}
+		}
+		op := &Operation{
+			OperationID: rt.ID,
+			Summary:     rt.Summary,
+			Tags:        []string{rt.Tag},
+			Parameters:  params,
+			Responses:   responses(rt, allowed),
+			XRoles:      allowed,
+		}
+		if rt.Auth {
+			op.Security = []map[string][]string{{"bearerAuth": {}}}
+			if len(allowed) > 0 {
+				op.Description = "Requires role: " + strings.Join(allowed, ", ")
+			} else {
+				op.Description = "Requires any authenticated user"
+			}
+		}
+		if rt.Successor != "" {
+			op.Deprecated = true
+			if op.Description != "" {
+				op.Description += ". "
+			}
+			op.Description += "Deprecated: use " + rt.Successor
+		}
+		if body := requestBody(rt); body != nil {
+			op.RequestBody = body
+		}
+		if mutating(rt.Method) {
+			op.Parameters = append(op.Parameters, Parameter{
+				Name: "Idempotency-Key", In: "header",
+				Description: "Retries with the same key and body replay the first response, unless it never reached a worker",
+				Schema:      &types.Schema{Type: "string"},
+			})
+		}
+		item[strings.ToLower(rt.Method)] = op
+		tags[rt.Tag] = true
+	}
+
+	for name := range tags {
+		doc.Tags = append(doc.Tags, Tag{Name: name})
+	}
+	sort.Slice(doc.Tags, func(i, j int) bool { return doc.Tags[i].Name < doc.Tags[j].Name })
+	return doc
+}
+
+// oasPath converts a gin path (/admin/dlq/:id) into an OpenAPI template
+// (/admin/dlq/{id}) and its path parameters.
+func oasPath(ginPath string) (string, []Parameter) {
+	var params []Parameter
+	parts := strings.Split(ginPath, "/")
+	for i, p := range parts {
+		if strings.HasPrefix(p, ":") || strings.HasPrefix(p, "*") {
+			name := p[1:]
+			parts[i] = "{" + name + "}"
+			params = append(params, Parameter{
+				Name: name, In: "path", Required: true,
+				Schema: &types.Schema{Type: "string"},
+			})
+		}
+	}
+	return strings.Join(parts, "/"), params
+}
+
+func requestBody(rt Route) *RequestBody {
+	switch {
+	case rt.Request != nil:
+		return &RequestBody{
+			Required: true,
+			Content:  map[string]MediaType{jsonType: {Schema: types.SchemaFor(rt.Request)}},
+		}
+	case len(rt.Files) > 0:
+		s := &types.Schema{Type: "object", Properties: map[string]*types.Schema{}}
+		for _, f := range rt.Files {
+			s.Properties[f] = &types.Schema{Type: "string", Format: "binary"}
+			s.Required = append(s.Required, f)
+		}
+		return &RequestBody{
+			Required: true,
+			Content:  map[string]MediaType{multipartType: {Schema: s}},
+		}
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func responses(rt Route, roles []string) map[string]Response {
+	ok := Response{Description: "Success"}
+	if rt.Response != nil {
+		ok.Content = map[string]MediaType{jsonType: {Schema: types.SchemaFor(rt.Response)}}
+	} else {
+		ok.Content = map[string]MediaType{jsonType: {Schema: &types.Schema{}}}
+	}
+	status := rt.Status
+	if status == 0 {
+		status = 200
+	}
+	out := map[string]Response{fmt.Sprint(status): ok}
+
+	ref := errorRef
+	if strings.HasPrefix(rt.Path, "/api/v1/") {
+		ref = apiErrorRef
+	}
+	errResp := func(desc string) Response {
+		return Response{
+			Description: desc,
+			Content:     map[string]MediaType{jsonType: {Schema: &types.Schema{Ref: ref}}},
+		}
+	}
+	if rt.Request != nil || len(rt.Files) > 0 {
+		out["400"] = errResp("Request does not match the schema")
+	}
+	if rt.Auth {
+		out["401"] = errResp("Missing or invalid bearer token")
+		if len(roles) > 0 {
+			out["403"] = errResp("Role not allowed")
+		}
+	}
+	if mutating(rt.Method) {
+		out["409"] = errResp("Idempotency-Key reused for a different request or still in progress")
+	}
+	for _, code := range rt.Errors {
+		out[fmt.Sprint(code)] = errResp(errorText[code])
+	}
+	return out
+}
+
+// mutating reports whether method honours the Idempotency-Key header.
+func mutating(method string) bool {
+	switch method {
+	case "POST", "PUT", "PATCH", "DELETE":
+		return true
+	}
+	return false
+}
+
+var errorText = map[int]string{
+	400: "Bad request",
+	402: "Payment required",
+	404: "Not found",
+	409: "Conflict",
+	422: "Unprocessable entity",
+	429: "Too many requests",
+	500: "Internal error",
+	502: "Downstream service returned an error",
+	503: "Message broker or downstream service unavailable (see Retry-After)",
+	504: "Downstream service timed out",
+}
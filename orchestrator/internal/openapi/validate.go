@@ -0,0 +1,90 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"orchestrator/internal/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxBody bounds the JSON bodies read for validation.
+const maxBody = 1 << 20
+
+type bodyRule struct {
+	schema *types.Schema // JSON body schema
+	files  []string      // required multipart files
+}
+
+// Validator returns middleware that checks the request body against the
+// route's contract before the handler runs. It relies on gin's FullPath,
+// so it must be installed on the groups that register the routes.
+func Validator(routes []Route) gin.HandlerFunc {
+	rules := make(map[string]bodyRule, len(routes))
+	for _, rt := range routes {
+		rule := bodyRule{files: rt.Files}
+		if rt.Request != nil {
+			rule.schema = types.SchemaFor(rt.Request)
+		}
+		rules[rt.Method+" "+rt.Path] = rule
+	}
+
+	return func(c *gin.Context) {
+		rule, ok := rules[c.Request.Method+" "+c.FullPath()]
+		if !ok {
+			c.Next()
+			return
+		}
+		if rule.schema != nil {
+			if err := validateJSON(c, rule.schema); err != nil {
+				reject(c, err)
+				return
+			}
+		}
+		for _, field := range rule.files {
+			if _, err := c.FormFile(field); err != nil {
+				reject(c, &validationError{"missing multipart file field \"" + field + "\""})
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+type validationError struct{ msg string }
+
+func (e *validationError) Error() string { return e.msg }
+
+func validateJSON(c *gin.Context, schema *types.Schema) error {
+	if ct := c.ContentType(); ct != "" && !strings.HasSuffix(ct, "json") {
+		return &validationError{"content type must be application/json"}
+	}
+	raw, err := io.ReadAll(io.LimitReader(c.Request.Body, maxBody))
+	if err != nil {
+		return &validationError{"could not read request body"}
+	}
+	// Restore the body so the handler can bind it.
+	c.Request.Body = io.NopCloser(bytes.NewReader(raw))
+
+	var decoded interface{}
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		return &validationError{"request body is not valid JSON"}
+	}
+	if err := schema.Validate(decoded); err != nil {
+		return &validationError{err.Error()}
+	}
+	return nil
+}
+
+func reject(c *gin.Context, err error) {
+	log.Printf("[OpenAPI] %s %s rejected: %v", c.Request.Method, c.FullPath(), err)
+	c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{
+		Error:   "request does not match the API schema",
+		Details: err.Error(),
+	})
+}
@@ -0,0 +1,53 @@
+package pricing
+
+// Usage-based pricing of final grade uploads. An upload costs the
+// uploader's institution a number of credits proportional to the rows it
+// grades, at the institution's own rate when the config sets one.
+
+import (
+	"math"
+
+	"orchestrator/internal/config"
+)
+
+// Quote is the price of one upload.
+type Quote struct {
+	Institution string  `json:"institution"`
+	Rows        int     `json:"rows"`
+	PerRow      float64 `json:"per_row"`
+	Credits     int     `json:"credits"`
+}
+
+// Pricer prices uploads from the pricing section of the config.
+type Pricer struct {
+	cfg config.Pricing
+}
+
+// New returns a pricer for cfg. An empty config charges one credit per
+// upload whatever its size.
+func New(cfg config.Pricing) *Pricer {
+	if cfg.PerRow <= 0 && cfg.Minimum <= 0 {
+		cfg.Minimum = 1
+	}
+	return &Pricer{cfg: cfg}
+}
+
+// Quote prices an upload of rows graded rows billed to institution.
+func (p *Pricer) Quote(institution string, rows int) Quote {
+	perRow, minimum := p.cfg.PerRow, p.cfg.Minimum
+	if r, ok := p.cfg.Institutions[institution]; ok {
+		if r.PerRow != nil {
+			perRow = *r.PerRow
+		}
+		if r.Minimum != nil {
+			minimum = *r.Minimum
+		}
+	}
+
+	// Round the product first so 0.1 × 30 is 3 credits, not 4
+	credits := int(math.Ceil(math.Round(float64(rows)*perRow*1e6) / 1e6))
+	if credits < minimum {
+		credits = minimum
+	}
+	return Quote{Institution: institution, Rows: rows, PerRow: perRow, Credits: credits}
+}
@@ -3,22 +3,30 @@ package rabbitmq
 import (
 	"fmt"
 	"orchestrator/internal/config"
+	"orchestrator/internal/events"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
-// Connect establishes a connection and channel to RabbitMQ.
-func Connect() (*amqp.Connection, *amqp.Channel) {
-	conn, err := amqp.Dial(config.Cfg.RabbitMQ.URL)
-	if err != nil {
-		panic(fmt.Errorf("Dial RabbitMQ failed: %w", err))
-	}
-	ch, err := conn.Channel()
-	if err != nil {
-		conn.Close()
-		panic(fmt.Errorf("Open channel failed: %w", err))
+// Setup returns the Manager hook that prepares the orchestrator's own
+// topology and consumer on a fresh connection. It runs again after every
+// reconnect.
+func Setup(reg *events.Registry) func(*amqp.Connection) error {
+	return func(conn *amqp.Connection) error {
+		ch, err := conn.Channel()
+		if err != nil {
+			return fmt.Errorf("Open channel failed: %w", err)
+		}
+		if err := SetupMessaging(ch); err != nil {
+			ch.Close()
+			return err
+		}
+		if err := StartOrchestratorConsumer(ch, reg); err != nil {
+			ch.Close()
+			return err
+		}
+		return nil
 	}
-	return conn, ch
 }
 
 // SetupMessaging declares the exchange, queue with DLX, and bindings.
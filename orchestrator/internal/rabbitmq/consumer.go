@@ -1,16 +1,22 @@
 package rabbitmq
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"orchestrator/internal/config"
-	"orchestrator/internal/handlers"
+	"orchestrator/internal/events"
+	"orchestrator/internal/types"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
-// StartOrchestratorConsumer opens the consumer and dispatches deliveries.
-func StartOrchestratorConsumer(ch *amqp.Channel) error {
+// StartOrchestratorConsumer opens the consumer and dispatches deliveries
+// to the handlers registered in reg.
+func StartOrchestratorConsumer(ch *amqp.Channel, reg *events.Registry) error {
+	if err := ch.Qos(reg.Prefetch(), 0, false); err != nil {
+		return fmt.Errorf("Qos failed: %w", err)
+	}
 	msgs, err := ch.Consume(
 		config.Cfg.Queue.Name,
 		"orchestrator-consumer",
@@ -21,14 +27,15 @@ func StartOrchestratorConsumer(ch *amqp.Channel) error {
 	}
 	go func() {
 		for d := range msgs {
-			switch d.RoutingKey {
-			case "user.created":
-				handlers.HandleUserCreated(d)
-			// other cases omitted for brevity
-			default:
-				log.Printf("[Orchestrator] Unknown key: %s", d.RoutingKey)
+			key := events.EventKey(d)
+			// Reject payloads that break their catalogued contract before
+			// any handler sees them; they are dead-lettered for inspection.
+			if err := types.Validate(key, d.Headers, d.Body); err != nil && !errors.Is(err, types.ErrUnknownEvent) {
+				log.Printf("[Orchestrator] Invalid %s payload: %v", key, err)
 				d.Nack(false, false)
+				continue
 			}
+			reg.Dispatch(d)
 		}
 	}()
 	return nil
@@ -0,0 +1,276 @@
+package rabbitmq
+
+// Dead-letter queue inspection and replay. The DLQ is browsed with
+// basic.get on a dedicated channel: messages stay unacked while they are
+// examined and return to the queue, in order, when the channel closes.
+// Only messages that are replayed or purged are acked.
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"orchestrator/internal/events"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	// maxScan bounds how many messages one operation walks through.
+	maxScan = 1000
+	// previewSize is the number of body bytes included in listings.
+	previewSize = 256
+)
+
+// ErrNotFound is returned when no dead letter matches the requested ID.
+var ErrNotFound = errors.New("dead letter not found")
+
+// DeadLetter describes one message sitting in the DLQ.
+type DeadLetter struct {
+	ID          string                 `json:"id"`
+	Exchange    string                 `json:"exchange"`
+	RoutingKey  string                 `json:"routing_key"`
+	Queue       string                 `json:"queue"`
+	Reason      string                 `json:"reason"`
+	DeathCount  int64                  `json:"death_count"`
+	DiedAt      *time.Time             `json:"died_at,omitempty"`
+	ContentType string                 `json:"content_type,omitempty"`
+	MessageID   string                 `json:"message_id,omitempty"`
+	Headers     map[string]interface{} `json:"headers,omitempty"`
+	BodySize    int                    `json:"body_size"`
+	Body        string                 `json:"body,omitempty"`
+	Base64      bool                   `json:"body_base64,omitempty"`
+}
+
+// DLQ inspects and replays the orchestrator's dead-letter queue.
+type DLQ struct {
+	mgr   *Manager
+	queue string
+}
+
+// NewDLQ returns an inspector for queue.
+func NewDLQ(mgr *Manager, queue string) *DLQ {
+	return &DLQ{mgr: mgr, queue: queue}
+}
+
+// List returns up to limit dead letters with a short body preview.
+func (q *DLQ) List(limit int) ([]DeadLetter, error) {
+	if limit <= 0 || limit > maxScan {
+		limit = maxScan
+	}
+	list := []DeadLetter{}
+	err := q.scan(func(ch *amqp.Channel, d amqp.Delivery) (bool, error) {
+		list = append(list, describe(d, previewSize))
+		return len(list) < limit, nil
+	})
+	return list, err
+}
+
+// Get returns the dead letter with id including its full body.
+func (q *DLQ) Get(id string) (DeadLetter, error) {
+	var found *DeadLetter
+	err := q.scan(func(ch *amqp.Channel, d amqp.Delivery) (bool, error) {
+		if letterID(d) != id {
+			return true, nil
+		}
+		dl := describe(d, len(d.Body))
+		found = &dl
+		return false, nil
+	})
+	if err != nil {
+		return DeadLetter{}, err
+	}
+	if found == nil {
+		return DeadLetter{}, ErrNotFound
+	}
+	return *found, nil
+}
+
+// Replay republishes the selected dead letters to the exchange and routing
+// key they originally died from and removes them from the DLQ. It returns
+// the IDs that were replayed.
+func (q *DLQ) Replay(ids []string) ([]string, error) {
+	want := toSet(ids)
+	var done []string
+	err := q.scan(func(ch *amqp.Channel, d amqp.Delivery) (bool, error) {
+		id := letterID(d)
+		if !want[id] {
+			return true, nil
+		}
+		dl := describe(d, -1)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		confirm, err := ch.PublishWithDeferredConfirmWithContext(ctx, dl.Exchange, dl.RoutingKey, false, false, amqp.Publishing{
+			Headers:       replayHeaders(d.Headers),
+			ContentType:   d.ContentType,
+			DeliveryMode:  amqp.Persistent,
+			CorrelationId: d.CorrelationId,
+			MessageId:     d.MessageId,
+			Timestamp:     d.Timestamp,
+			Body:          d.Body,
+		})
+		if err == nil && !confirm.Wait() {
+			err = fmt.Errorf("broker rejected replay of %s", id)
+		}
+		cancel()
+		if err != nil {
+			return false, err
+		}
+		if err := d.Ack(false); err != nil {
+			return false, err
+		}
+		done = append(done, id)
+		return true, nil
+	}, withConfirms)
+	return done, err
+}
+
+// Purge deletes the selected dead letters, or every dead letter when all
+// is set, and returns how many were removed.
+func (q *DLQ) Purge(ids []string, all bool) (int, error) {
+	if all {
+		ch, err := q.mgr.Channel()
+		if err != nil {
+			return 0, err
+		}
+		defer ch.Close()
+		return ch.QueuePurge(q.queue, false)
+	}
+	want := toSet(ids)
+	n := 0
+	err := q.scan(func(ch *amqp.Channel, d amqp.Delivery) (bool, error) {
+		if !want[letterID(d)] {
+			return true, nil
+		}
+		if err := d.Ack(false); err != nil {
+			return false, err
+		}
+		n++
+		return true, nil
+	})
+	return n, err
+}
+
+// withConfirms puts the scan channel into publisher-confirm mode.
+func withConfirms(ch *amqp.Channel) error { return ch.Confirm(false) }
+
+// scan walks the DLQ on a fresh channel, calling visit for each message
+// until it returns false or the queue is exhausted. Unacked messages are
+// requeued when the channel closes.
+func (q *DLQ) scan(visit func(*amqp.Channel, amqp.Delivery) (bool, error), setup ...func(*amqp.Channel) error) error {
+	ch, err := q.mgr.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+	for _, fn := range setup {
+		if err := fn(ch); err != nil {
+			return err
+		}
+	}
+
+	for i := 0; i < maxScan; i++ {
+		d, ok, err := ch.Get(q.queue, false)
+		if err != nil {
+			return fmt.Errorf("get from %s: %w", q.queue, err)
+		}
+		if !ok {
+			return nil
+		}
+		more, err := visit(ch, d)
+		if err != nil || !more {
+			return err
+		}
+	}
+	return nil
+}
+
+// letterID returns the ID describe assigns to d.
+func letterID(d amqp.Delivery) string {
+	return describe(d, -1).ID
+}
+
+// describe extracts the death metadata RabbitMQ records in x-death and
+// includes up to bodyLimit bytes of the body; a negative bodyLimit skips
+// body and headers.
+func describe(d amqp.Delivery, bodyLimit int) DeadLetter {
+	dl := DeadLetter{
+		Exchange:    d.Exchange,
+		RoutingKey:  d.RoutingKey,
+		ContentType: d.ContentType,
+		MessageID:   d.MessageId,
+		Headers:     map[string]interface{}(d.Headers),
+		BodySize:    len(d.Body),
+	}
+	if deaths, ok := d.Headers["x-death"].([]interface{}); ok && len(deaths) > 0 {
+		if death, ok := deaths[0].(amqp.Table); ok {
+			dl.Exchange, _ = death["exchange"].(string)
+			dl.Queue, _ = death["queue"].(string)
+			dl.Reason, _ = death["reason"].(string)
+			dl.DeathCount, _ = death["count"].(int64)
+			if keys, ok := death["routing-keys"].([]interface{}); ok && len(keys) > 0 {
+				dl.RoutingKey, _ = keys[0].(string)
+			}
+			if t, ok := death["time"].(time.Time); ok {
+				dl.DiedAt = &t
+			}
+		}
+	}
+	dl.ID = deadLetterID(dl, d)
+	if bodyLimit < 0 {
+		dl.Headers = nil
+		return dl
+	}
+	if bodyLimit > 0 {
+		body := d.Body
+		if len(body) > bodyLimit {
+			body = body[:bodyLimit]
+		}
+		if utf8.Valid(body) {
+			dl.Body = string(body)
+		} else {
+			dl.Body = base64.StdEncoding.EncodeToString(body)
+			dl.Base64 = true
+		}
+	}
+	return dl
+}
+
+// deadLetterID is a stable identifier derived from where and when the
+// message died and what it carried, since publishers rarely set MessageId.
+func deadLetterID(dl DeadLetter, d amqp.Delivery) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00", dl.Exchange, dl.RoutingKey, d.MessageId)
+	if dl.DiedAt != nil {
+		fmt.Fprint(h, dl.DiedAt.UnixNano())
+	}
+	h.Write(d.Body)
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// replayHeaders drops the broker's death bookkeeping and the registry's
+// retry counter so the replayed message starts afresh.
+func replayHeaders(in amqp.Table) amqp.Table {
+	out := amqp.Table{}
+	for k, v := range in {
+		if k == "x-death" || k == events.HeaderRetryCount || strings.HasPrefix(k, "x-first-death-") || strings.HasPrefix(k, "x-last-death-") {
+			continue
+		}
+		out[k] = v
+	}
+	out["x-replayed-at"] = time.Now().UTC()
+	return out
+}
+
+func toSet(ids []string) map[string]bool {
+	set := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
@@ -0,0 +1,177 @@
+package rabbitmq
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ErrNotConnected is returned while the broker connection is down.
+var ErrNotConnected = errors.New("rabbitmq: not connected")
+
+const (
+	minBackoff = 1 * time.Second
+	maxBackoff = 30 * time.Second
+	// poolSize is how many idle publisher channels are kept open.
+	poolSize = 8
+)
+
+// Manager owns the broker connection. It dials with exponential backoff,
+// runs the registered setup hooks after every (re)connect, watches
+// NotifyClose and hands out pooled channels to publishers.
+type Manager struct {
+	url string
+
+	mu    sync.RWMutex
+	conn  *amqp.Connection
+	hooks []func(*amqp.Connection) error
+
+	pool chan *amqp.Channel
+}
+
+// NewManager creates a manager for url. Call Run to start connecting.
+func NewManager(url string) *Manager {
+	return &Manager{
+		url:  url,
+		pool: make(chan *amqp.Channel, poolSize),
+	}
+}
+
+// OnConnect registers fn to run, in registration order, each time a new
+// connection is established. A failing hook drops the connection and
+// triggers a reconnect. Register hooks before calling Run.
+func (m *Manager) OnConnect(fn func(*amqp.Connection) error) {
+	m.mu.Lock()
+	m.hooks = append(m.hooks, fn)
+	m.mu.Unlock()
+}
+
+// Run keeps the connection alive until the process exits. It never panics
+// when the broker is unreachable; it just retries.
+func (m *Manager) Run() {
+	backoff := minBackoff
+	for {
+		conn, err := m.connect()
+		if err != nil {
+			log.Printf("[RabbitMQ] connect failed: %v (retrying in %s)", err, backoff)
+			time.Sleep(backoff)
+			backoff *= 2
+			if backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+			continue
+		}
+		backoff = minBackoff
+		log.Println("[RabbitMQ] connected")
+
+		closed := conn.NotifyClose(make(chan *amqp.Error, 1))
+		if err := <-closed; err != nil {
+			log.Printf("[RabbitMQ] connection lost: %v", err)
+		} else {
+			log.Println("[RabbitMQ] connection closed")
+		}
+		m.setConn(nil)
+	}
+}
+
+// connect dials the broker and runs every hook on the new connection.
+func (m *Manager) connect() (*amqp.Connection, error) {
+	conn, err := amqp.Dial(m.url)
+	if err != nil {
+		return nil, fmt.Errorf("dial: %w", err)
+	}
+
+	m.mu.RLock()
+	hooks := append([]func(*amqp.Connection) error(nil), m.hooks...)
+	m.mu.RUnlock()
+
+	for _, hook := range hooks {
+		if err := hook(conn); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	m.setConn(conn)
+	return conn, nil
+}
+
+func (m *Manager) setConn(conn *amqp.Connection) {
+	m.mu.Lock()
+	m.conn = conn
+	m.mu.Unlock()
+}
+
+// Connected reports whether a live broker connection exists.
+func (m *Manager) Connected() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.conn != nil && !m.conn.IsClosed()
+}
+
+// Acquire returns an open channel from the pool, or opens a new one on the
+// current connection. Return it with Release when done.
+func (m *Manager) Acquire() (*amqp.Channel, error) {
+	for {
+		select {
+		case ch := <-m.pool:
+			if !ch.IsClosed() {
+				return ch, nil
+			}
+		default:
+			m.mu.RLock()
+			conn := m.conn
+			m.mu.RUnlock()
+			if conn == nil || conn.IsClosed() {
+				return nil, ErrNotConnected
+			}
+			return conn.Channel()
+		}
+	}
+}
+
+// Channel opens a dedicated, unpooled channel on the current connection
+// for work that holds deliveries unacked or changes channel modes. The
+// caller must close it.
+func (m *Manager) Channel() (*amqp.Channel, error) {
+	m.mu.RLock()
+	conn := m.conn
+	m.mu.RUnlock()
+	if conn == nil || conn.IsClosed() {
+		return nil, ErrNotConnected
+	}
+	return conn.Channel()
+}
+
+// Release puts ch back into the pool, closing it if the pool is full.
+// Channels that were closed by a channel-level error are discarded.
+func (m *Manager) Release(ch *amqp.Channel) {
+	if ch == nil || ch.IsClosed() {
+		return
+	}
+	select {
+	case m.pool <- ch:
+	default:
+		ch.Close()
+	}
+}
+
+// QueueConsumers returns how many consumers are attached to queue. A
+// missing queue is an error. The passive declare runs on a throwaway
+// channel because the broker closes the channel when the queue is absent.
+func (m *Manager) QueueConsumers(queue string) (int, error) {
+	ch, err := m.Channel()
+	if err != nil {
+		return 0, err
+	}
+	defer ch.Close()
+
+	q, err := ch.QueueDeclarePassive(queue, false, false, false, false, nil)
+	if err != nil {
+		return 0, fmt.Errorf("inspect queue %s: %w", queue, err)
+	}
+	return q.Consumers, nil
+}
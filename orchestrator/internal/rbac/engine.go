@@ -0,0 +1,131 @@
+package rbac
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"orchestrator/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Engine serves the current policy and reloads it when the file changes.
+// A file that does not compile, or that leaves a required route out, is
+// refused and the previous policy stays in force.
+type Engine struct {
+	path     string
+	required []string
+
+	mu      sync.RWMutex
+	policy  *Policy
+	modTime time.Time
+}
+
+// Load reads the policy at path. required lists the routes ("METHOD
+// /path") the policy must cover, now and after every reload.
+func Load(path string, required []string) (*Engine, error) {
+	e := &Engine{path: path, required: required}
+	if err := e.Reload(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Policy returns the policy in force.
+func (e *Engine) Policy() *Policy {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.policy
+}
+
+// Reload reads the file again and puts it in force if it is valid.
+func (e *Engine) Reload() error {
+	info, err := os.Stat(e.path)
+	if err != nil {
+		return err
+	}
+	p, err := ReadFile(e.path)
+	if err != nil {
+		return err
+	}
+	if missing := p.Missing(e.required); len(missing) > 0 {
+		return fmt.Errorf("%s: no permission for %s", e.path, strings.Join(missing, ", "))
+	}
+	for _, key := range p.Unreachable() {
+		log.Printf("[RBAC] ⚠ no role may call %s", key)
+	}
+
+	e.mu.Lock()
+	e.policy, e.modTime = p, info.ModTime()
+	e.mu.Unlock()
+	log.Printf("[RBAC] ✅ policy loaded from %s (%d routes)", e.path, len(p.routes))
+	return nil
+}
+
+// Watch reloads the policy whenever the file's modification time changes,
+// checking every interval (10 seconds if 0) until ctx is done.
+func (e *Engine) Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		info, err := os.Stat(e.path)
+		if err != nil {
+			log.Printf("[RBAC] ❌ %v; keeping the current policy", err)
+			continue
+		}
+		e.mu.RLock()
+		changed := !info.ModTime().Equal(e.modTime)
+		e.mu.RUnlock()
+		if !changed {
+			continue
+		}
+		if err := e.Reload(); err != nil {
+			log.Printf("[RBAC] ❌ reload refused, keeping the current policy: %v", err)
+			// Do not retry the same broken file every tick
+			e.mu.Lock()
+			e.modTime = info.ModTime()
+			e.mu.Unlock()
+		}
+	}
+}
+
+// Middleware refuses with 403 a caller none of whose roles grants the
+// permission of the matched route, or any caller if the policy does not
+// list the route. It runs after JWTAuthMiddleware.
+func (e *Engine) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if route == "" {
+			c.Next() // no route: 404
+			return
+		}
+		p := e.Policy()
+		perm, ok := p.Permission(c.Request.Method, route)
+		if !ok {
+			log.Printf("[RBAC] ⚠ %s %s is not in the policy", c.Request.Method, route)
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+			c.Abort()
+			return
+		}
+		if !p.Allowed(middleware.GetRoles(c), perm) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access restricted: your roles do not grant " + perm})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,190 @@
+package rbac
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	goodPolicy = `
+roles:
+  student: [grades.view_own]
+routes:
+  GET /personal/grades: grades.view_own
+`
+	// widerPolicy also lets instructors read grades.
+	widerPolicy = `
+roles:
+  student: [grades.view_own]
+  instructor: [grades.view_own]
+routes:
+  GET /personal/grades: grades.view_own
+`
+)
+
+var required = []string{"GET /personal/grades"}
+
+// writePolicy writes body to path and dates it age before now, so every
+// write is seen as a change.
+func writePolicy(t *testing.T, path, body string, age time.Duration) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Now().Add(-age)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func load(t *testing.T) (*Engine, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "rbac.yaml")
+	writePolicy(t, path, goodPolicy, 3*time.Hour)
+	e, err := Load(path, required)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	return e, path
+}
+
+func TestLoadShippedPolicy(t *testing.T) {
+	if _, err := Load(policyFile, required); err != nil {
+		t.Fatalf("Load(%s): %v", policyFile, err)
+	}
+}
+
+func TestLoadRefusesBadPolicy(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"malformed yaml", "roles: [student"},
+		{"bad route key", "routes:\n  /personal/grades: grades.view_own\n"},
+		{"required route missing", "roles:\n  student: [grades.view_own]\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "rbac.yaml")
+			writePolicy(t, path, tt.body, 0)
+			if _, err := Load(path, required); err == nil {
+				t.Fatal("Load accepted the policy")
+			}
+		})
+	}
+	if _, err := Load(filepath.Join(t.TempDir(), "none.yaml"), required); err == nil {
+		t.Fatal("Load accepted a missing file")
+	}
+}
+
+func TestReloadKeepsLastGoodPolicy(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"malformed yaml", "roles: [student"},
+		{"empty permission", "roles:\n  student: ['']\nroutes:\n  GET /personal/grades: grades.view_own\n"},
+		{"required route missing", "roles:\n  student: [grades.view_own]\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, path := load(t)
+			good := e.Policy()
+			writePolicy(t, path, tt.body, 2*time.Hour)
+			if err := e.Reload(); err == nil {
+				t.Fatal("Reload accepted the policy")
+			}
+			if e.Policy() != good {
+				t.Fatal("a refused policy replaced the one in force")
+			}
+		})
+	}
+}
+
+// waitFor polls cond until it holds or a second has passed.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWatchReloadsOnModTime(t *testing.T) {
+	e, path := load(t)
+	good := e.Policy()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go e.Watch(ctx, 5*time.Millisecond)
+
+	// A broken file is refused once its new mtime has been seen.
+	writePolicy(t, path, "roles: [student", 2*time.Hour)
+	want, _ := os.Stat(path)
+	waitFor(t, "the broken file to be seen", func() bool {
+		e.mu.RLock()
+		defer e.mu.RUnlock()
+		return e.modTime.Equal(want.ModTime())
+	})
+	if e.Policy() != good {
+		t.Fatal("a broken file replaced the policy in force")
+	}
+	if e.Policy().Allowed([]string{"instructor"}, "grades.view_own") {
+		t.Fatal("instructors read grades under the old policy")
+	}
+
+	// A fixed file is put in force.
+	writePolicy(t, path, widerPolicy, time.Hour)
+	waitFor(t, "the fixed file to be loaded", func() bool { return e.Policy() != good })
+	if !e.Policy().Allowed([]string{"instructor"}, "grades.view_own") {
+		t.Fatal("the reloaded policy is not the one written")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	e, _ := load(t)
+
+	tests := []struct {
+		name  string
+		roles []string
+		path  string
+		want  int
+	}{
+		{"role granted", []string{"student"}, "/personal/grades", http.StatusOK},
+		{"one of several roles granted", []string{"instructor", "student"}, "/personal/grades", http.StatusOK},
+		{"role not granted", []string{"instructor"}, "/personal/grades", http.StatusForbidden},
+		{"unknown role", []string{"superuser"}, "/personal/grades", http.StatusForbidden},
+		{"no roles", nil, "/personal/grades", http.StatusForbidden},
+		{"route not in the policy", []string{"student"}, "/admin/users", http.StatusForbidden},
+		{"no such route", []string{"student"}, "/nowhere", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(func(c *gin.Context) { c.Set("roles", tt.roles) }, e.Middleware())
+			ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+			r.GET("/personal/grades", ok)
+			r.GET("/admin/users", ok)
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			if w.Code == http.StatusForbidden && !strings.Contains(w.Body.String(), `"error"`) {
+				t.Fatalf("403 without an error body: %s", w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package rbac
+
+// Role-based access control for the authenticated routes. The policy file
+// maps every route to the permission it needs and every role to the
+// permissions it grants; a caller may use a route if any of their roles
+// grants its permission. Every authenticated caller also holds the
+// Authenticated role, for routes open to all users.
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Authenticated is the role every caller with a valid token holds.
+const Authenticated = "authenticated"
+
+// File is the policy file as written.
+type File struct {
+	// Roles maps a role to the permissions it grants.
+	Roles map[string][]string `yaml:"roles"`
+	// Routes maps "METHOD /path" (gin's pattern, e.g. /jobs/:id) to the
+	// permission it needs.
+	Routes map[string]string `yaml:"routes"`
+}
+
+// Policy is a checked policy file, ready to evaluate.
+type Policy struct {
+	grants map[string]map[string]bool // role → permissions
+	routes map[string]string          // "METHOD /path" → permission
+}
+
+var methods = map[string]bool{"GET": true, "POST": true, "PUT": true, "PATCH": true, "DELETE": true}
+
+// ReadFile reads and compiles the policy at path.
+func ReadFile(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f File
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	p, err := Compile(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+// Compile checks f: route keys must be "METHOD /path" and every route and
+// role must name its permissions.
+func Compile(f File) (*Policy, error) {
+	p := &Policy{grants: make(map[string]map[string]bool), routes: make(map[string]string)}
+	for role, perms := range f.Roles {
+		if role == "" {
+			return nil, fmt.Errorf("role with no name")
+		}
+		p.grants[role] = make(map[string]bool, len(perms))
+		for _, perm := range perms {
+			if perm == "" {
+				return nil, fmt.Errorf("role %s: empty permission", role)
+			}
+			p.grants[role][perm] = true
+		}
+	}
+	for key, perm := range f.Routes {
+		method, path, ok := strings.Cut(key, " ")
+		if !ok || !methods[method] || !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("route %q: want \"METHOD /path\"", key)
+		}
+		if perm == "" {
+			return nil, fmt.Errorf("route %s: no permission", key)
+		}
+		p.routes[key] = perm
+	}
+	return p, nil
+}
+
+// Permission returns the permission the route needs, if the policy lists
+// it.
+func (p *Policy) Permission(method, path string) (string, bool) {
+	perm, ok := p.routes[method+" "+path]
+	return perm, ok
+}
+
+// Allowed reports whether any of roles, or Authenticated, grants perm.
+func (p *Policy) Allowed(roles []string, perm string) bool {
+	if p.grants[Authenticated][perm] {
+		return true
+	}
+	for _, role := range roles {
+		if p.grants[role][perm] {
+			return true
+		}
+	}
+	return false
+}
+
+// RolesFor lists the roles that may use the route, sorted; nil if the
+// policy does not list it.
+func (p *Policy) RolesFor(method, path string) []string {
+	perm, ok := p.Permission(method, path)
+	if !ok {
+		return nil
+	}
+	var roles []string
+	for role, perms := range p.grants {
+		if perms[perm] {
+			roles = append(roles, role)
+		}
+	}
+	sort.Strings(roles)
+	return roles
+}
+
+// Missing returns the routes of required ("METHOD /path") the policy does
+// not list. Those routes would be refused to everybody.
+func (p *Policy) Missing(required []string) []string {
+	var missing []string
+	for _, key := range required {
+		if _, ok := p.routes[key]; !ok {
+			missing = append(missing, key)
+		}
+	}
+	return missing
+}
+
+// Unreachable returns the routes whose permission no role grants, sorted.
+func (p *Policy) Unreachable() []string {
+	granted := make(map[string]bool)
+	for _, perms := range p.grants {
+		for perm := range perms {
+			granted[perm] = true
+		}
+	}
+	var keys []string
+	for key, perm := range p.routes {
+		if !granted[perm] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
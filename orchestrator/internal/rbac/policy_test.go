@@ -0,0 +1,205 @@
+package rbac
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// policyFile is the policy the orchestrator ships with.
+const policyFile = "../../configs/rbac.yaml"
+
+func shipped(t *testing.T) *Policy {
+	t.Helper()
+	p, err := ReadFile(policyFile)
+	if err != nil {
+		t.Fatalf("ReadFile(%s): %v", policyFile, err)
+	}
+	return p
+}
+
+// allowed applies the policy to one route the way Middleware does.
+func allowed(p *Policy, roles []string, route string) bool {
+	method, path, _ := strings.Cut(route, " ")
+	perm, ok := p.Permission(method, path)
+	return ok && p.Allowed(roles, perm)
+}
+
+func TestShippedPolicy(t *testing.T) {
+	p := shipped(t)
+	tests := []struct {
+		roles []string
+		route string
+		want  bool
+	}{
+		// students
+		{[]string{"student"}, "GET /personal/grades", true},
+		{[]string{"student"}, "PATCH /student/reviewRequest", true},
+		{[]string{"student"}, "GET /api/v1/operations/:id", true},
+		{[]string{"student"}, "POST /upload_init", false},
+		{[]string{"student"}, "PATCH /instructor/reply", false},
+		{[]string{"student"}, "PATCH /purchase", false},
+		{[]string{"student"}, "GET /admin/users", false},
+
+		// instructors
+		{[]string{"instructor"}, "POST /upload_init", true},
+		{[]string{"instructor"}, "PATCH /postFinalGrades", true},
+		{[]string{"instructor"}, "GET /jobs/:id", true},
+		{[]string{"instructor"}, "POST /api/v1/reviews/replies", true},
+		{[]string{"instructor"}, "PATCH /student/reviewRequest", false},
+		{[]string{"instructor"}, "GET /personal/grades", false},
+		{[]string{"instructor"}, "GET /mycredits", false},
+
+		// institution representatives
+		{[]string{"institution_representative"}, "POST /registration", true},
+		{[]string{"institution_representative"}, "PATCH /purchase", true},
+		{[]string{"institution_representative"}, "GET /api/v1/institutions/:name/credits", true},
+		{[]string{"institution_representative"}, "POST /institution/users", true},
+		{[]string{"institution_representative"}, "POST /upload_init", false},
+		{[]string{"institution_representative"}, "POST /admin/institutions/:name/approve", false},
+
+		// platform admins
+		{[]string{"platform_admin"}, "GET /admin/users", true},
+		{[]string{"platform_admin"}, "PATCH /admin/users/:username/role", true},
+		{[]string{"platform_admin"}, "POST /admin/dlq/replay", true},
+		{[]string{"platform_admin"}, "POST /admin/institutions/:name/approve", true},
+		{[]string{"platform_admin"}, "GET /mycredits", true},
+		{[]string{"platform_admin"}, "PATCH /purchase", false},
+		{[]string{"platform_admin"}, "POST /upload_init", false},
+
+		// every caller holds "authenticated"
+		{[]string{"student"}, "GET /stats/available", true},
+		{[]string{"platform_admin"}, "GET /notifications/stream", true},
+
+		// a role the policy does not know grants nothing of its own
+		{[]string{"superuser"}, "GET /stats/courses", true},
+		{[]string{"superuser"}, "GET /personal/grades", false},
+		{[]string{"superuser"}, "GET /admin/users", false},
+		{nil, "GET /api/v1/courses", true},
+		{nil, "POST /upload_init", false},
+
+		// several roles grant the union of their permissions
+		{[]string{"student", "instructor"}, "PATCH /student/reviewRequest", true},
+		{[]string{"student", "instructor"}, "POST /upload_init", true},
+		{[]string{"student", "instructor"}, "PATCH /purchase", false},
+		{[]string{"institution_representative", "platform_admin"}, "PATCH /purchase", true},
+		{[]string{"institution_representative", "platform_admin"}, "DELETE /admin/users/:username", true},
+		{[]string{"superuser", "instructor"}, "GET /jobs/:id/events", true},
+
+		// a route the policy does not list is refused to everybody
+		{[]string{"platform_admin"}, "GET /admin/secrets", false},
+	}
+	for _, tt := range tests {
+		if got := allowed(p, tt.roles, tt.route); got != tt.want {
+			t.Errorf("roles %v on %s: allowed = %v, want %v", tt.roles, tt.route, got, tt.want)
+		}
+	}
+}
+
+func TestShippedPolicyReachesEveryRoute(t *testing.T) {
+	if unreachable := shipped(t).Unreachable(); len(unreachable) > 0 {
+		t.Errorf("no role may call %v", unreachable)
+	}
+}
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    File
+		wantErr string
+	}{
+		{"valid", File{
+			Roles:  map[string][]string{"student": {"grades.view_own"}},
+			Routes: map[string]string{"GET /personal/grades": "grades.view_own"},
+		}, ""},
+		{"empty", File{}, ""},
+		{"role with no name", File{Roles: map[string][]string{"": {"x"}}}, "role with no name"},
+		{"empty permission in a role", File{Roles: map[string][]string{"student": {""}}}, "empty permission"},
+		{"route without method", File{Routes: map[string]string{"/personal/grades": "x"}}, "want \"METHOD /path\""},
+		{"unknown method", File{Routes: map[string]string{"FETCH /personal/grades": "x"}}, "want \"METHOD /path\""},
+		{"lower-case method", File{Routes: map[string]string{"get /personal/grades": "x"}}, "want \"METHOD /path\""},
+		{"relative path", File{Routes: map[string]string{"GET personal/grades": "x"}}, "want \"METHOD /path\""},
+		{"route without permission", File{Routes: map[string]string{"GET /personal/grades": ""}}, "no permission"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Compile(tt.file)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("Compile: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("Compile: %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	p, err := Compile(File{Roles: map[string][]string{
+		Authenticated: {"stats.view"},
+		"student":     {"grades.view_own"},
+		"instructor":  {"grades.upload"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		roles []string
+		perm  string
+		want  bool
+	}{
+		{[]string{"student"}, "grades.view_own", true},
+		{[]string{"student"}, "grades.upload", false},
+		{[]string{"student", "instructor"}, "grades.upload", true},
+		{[]string{"instructor", "student"}, "grades.view_own", true},
+		{[]string{"ghost"}, "grades.view_own", false},
+		{[]string{"ghost"}, "stats.view", true},
+		{nil, "stats.view", true},
+		{nil, "grades.view_own", false},
+		{[]string{"student"}, "unknown.permission", false},
+	}
+	for _, tt := range tests {
+		if got := p.Allowed(tt.roles, tt.perm); got != tt.want {
+			t.Errorf("Allowed(%v, %s) = %v, want %v", tt.roles, tt.perm, got, tt.want)
+		}
+	}
+}
+
+func TestRolesFor(t *testing.T) {
+	p := shipped(t)
+	tests := []struct {
+		route string
+		want  []string
+	}{
+		{"GET /mycredits", []string{"institution_representative", "platform_admin"}},
+		{"POST /upload_init", []string{"instructor"}},
+		{"GET /stats/available", []string{Authenticated}},
+		{"GET /admin/users", []string{"platform_admin"}},
+		{"GET /admin/secrets", nil},
+	}
+	for _, tt := range tests {
+		method, path, _ := strings.Cut(tt.route, " ")
+		if got := p.RolesFor(method, path); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("RolesFor(%s) = %v, want %v", tt.route, got, tt.want)
+		}
+	}
+}
+
+func TestMissingAndUnreachable(t *testing.T) {
+	p, err := Compile(File{
+		Roles: map[string][]string{"student": {"grades.view_own"}},
+		Routes: map[string]string{
+			"GET /personal/grades": "grades.view_own",
+			"POST /upload_init":    "grades.upload",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := p.Missing([]string{"GET /personal/grades", "GET /jobs/:id"}); !reflect.DeepEqual(got, []string{"GET /jobs/:id"}) {
+		t.Errorf("Missing = %v", got)
+	}
+	if got := p.Unreachable(); !reflect.DeepEqual(got, []string{"POST /upload_init"}) {
+		t.Errorf("Unreachable = %v", got)
+	}
+}
@@ -2,116 +2,214 @@
 package routes
 
 import (
+	"orchestrator/internal/blobstore"
+	"orchestrator/internal/config"
 	"orchestrator/internal/handlers"
+	"orchestrator/internal/idempotency"
+	"orchestrator/internal/jobs"
+	"orchestrator/internal/metrics"
 	mw "orchestrator/internal/middleware"
+	"orchestrator/internal/notify"
+	"orchestrator/internal/openapi"
+	"orchestrator/internal/pricing"
+	"orchestrator/internal/rabbitmq"
+	"orchestrator/internal/rbac"
+	"orchestrator/internal/rpc"
+	"orchestrator/internal/saga"
+	"orchestrator/internal/sessions"
+	"orchestrator/internal/statcache"
+	"orchestrator/internal/workflow"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
-	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
 // SetupRouter configures all HTTP endpoints and returns the Gin engine.
-func SetupRouter(ch *amqp.Channel) *gin.Engine {
+func SetupRouter(client *rpc.Client, mgr *rabbitmq.Manager, dlq *rabbitmq.DLQ, uploads *jobs.Store, blobs *blobstore.Store, keys *idempotency.Store, pricer *pricing.Pricer, sagas *saga.Runner, ops *workflow.Runner, hub *notify.Hub, authz *rbac.Engine, stats *statcache.Cache, checker *sessions.Checker) *gin.Engine {
 	r := gin.Default()
 
 	// Allow CORS in development
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
 		AllowMethods:     []string{"GET", "POST", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", idempotency.Header, "If-None-Match"},
+		ExposeHeaders:    []string{"Content-Length", "Location", idempotency.ReplayedHeader, "Deprecation", "Sunset", "Link", "ETag", "X-Cache", "Retry-After"},
 		AllowCredentials: true,
 	}))
 
 	r.MaxMultipartMemory = 16 << 20 // 16 MiB
 
+	// One server span per request; RPCs issued by handlers become children
+	r.Use(otelgin.Middleware("orchestrator"))
+
+	// Prometheus: latency/status per route and role, scraped from /metrics
+	r.Use(metrics.Middleware())
+	r.GET("/metrics", metrics.Handler())
+
+	// Probes for container orchestrators
+	r.GET("/healthz", handlers.HandleHealthz)
+	r.GET("/readyz", func(c *gin.Context) { handlers.HandleReadyz(c, client, mgr) })
+
+	// API contract: served for clients and enforced on every request body
+	openapi.Register(r, func() *openapi.Document { return openapi.Build(openapi.Routes, authz.Policy().RolesFor) })
+	validate := openapi.Validator(openapi.Routes)
+
+	// Legacy routes with an /api/v1 successor announce their retirement
+	r.Use(openapi.Deprecations(openapi.Routes, config.Cfg.API.LegacySunset))
+
+	// Retried POST/PATCH/DELETE with the same Idempotency-Key replay the
+	// first response; runs after auth and validation in every group
+	idem := idempotency.Middleware(keys)
+
 	// ────────────────────────────────────────────────────────────────────────
 	//  Public endpoints (no JWT)
 	// ────────────────────────────────────────────────────────────────────────
+	pub := r.Group("/")
+	pub.Use(validate, idem)
 	{
-		r.POST("/user/register", func(c *gin.Context) { handlers.HandleUserRegister(c, ch) })
-		r.POST("/user/login", func(c *gin.Context) { handlers.HandleUserLogin(c, ch) })
-		r.DELETE("/user/delete", func(c *gin.Context) { handlers.HandleUserDelete(c, ch) })
-		r.POST("/user/google-login", func(c *gin.Context) { handlers.HandleUserGoogleLogin(c, ch) })
-		r.PATCH("/user/change-password", func(c *gin.Context) { handlers.HandleUserChangePassword(c, ch) })
-		r.GET("/institutions", func(c *gin.Context) {
-			handlers.GetInstitutions(c)
+		pub.POST("/user/register", func(c *gin.Context) { handlers.HandleUserRegister(c, client) })
+		pub.POST("/user/login", func(c *gin.Context) { handlers.HandleUserLogin(c, client) })
+		pub.DELETE("/user/delete", func(c *gin.Context) { handlers.HandleUserDelete(c, client) })
+		pub.POST("/user/google-login", func(c *gin.Context) { handlers.HandleUserGoogleLogin(c, client) })
+		pub.PATCH("/user/change-password", func(c *gin.Context) { handlers.HandleUserChangePassword(c, client) })
+		pub.GET("/institutions", func(c *gin.Context) {
+			handlers.GetInstitutions(c, client)
+		})
+		pub.GET("/institutions/:name", func(c *gin.Context) {
+			handlers.GetInstitution(c, client)
 		})
 		// NEW: purchase credits endpoint
 		// front-end does: PATCH /purchase { name, amount }
 
 	}
 
-	repr := r.Group("/")
-	repr.Use(mw.JWTAuthMiddleware())
-	repr.Use(func(c *gin.Context) {
-		if c.GetString("role") != "institution_representative" {
-			c.JSON(403, gin.H{"error": "Access restricted to tuinstitution_representative only"})
-			c.Abort()
-			return
-		}
-		c.Next()
-	})
+	// ────────────────────────────────────────────────────────────────────────
+	//  Authenticated endpoints: who may call which route is decided by the
+	//  RBAC policy (configs/rbac.yaml), not by the group
+	// ────────────────────────────────────────────────────────────────────────
+	authed := r.Group("/")
+	authed.Use(mw.JWTAuthMiddleware(checker), authz.Middleware())
+
+	api := authed.Group("/")
+	api.Use(validate, idem)
 	{
-		repr.PATCH("/purchase", func(c *gin.Context) {
-			handlers.HandleCreditsPurchased(c, ch)
+		// Institution representatives
+		api.PATCH("/purchase", func(c *gin.Context) {
+			handlers.HandleCreditsPurchased(c, client)
 		})
-		repr.GET("/mycredits", func(c *gin.Context) {
-			handlers.HandleCreditsAvail(c, ch)
+		api.GET("/mycredits", func(c *gin.Context) {
+			handlers.HandleCreditsAvail(c, client)
 		})
-		repr.POST("/registration", func(c *gin.Context) {
-			handlers.HandleInstitutionRegistered(c, ch)
+		api.POST("/registration", func(c *gin.Context) {
+			handlers.HandleInstitutionRegistered(c, client)
 		})
+		api.POST("/institution/users", func(c *gin.Context) { handlers.HandleCreateMember(c, client) })
+
+		// Students
+		api.GET("/personal/grades", func(c *gin.Context) { handlers.HandleGetPersonalGrades(c, client) })
+		api.PATCH("/student/reviewRequest", func(c *gin.Context) { handlers.HandlePostNewRequest(c, client, ops) })
+		api.PATCH("/student/status", func(c *gin.Context) { handlers.HandleGetRequestStatus(c, client) })
+
+		// Instructors
+		api.POST("/upload_init", func(c *gin.Context) { handlers.UploadExcelInit(c, client, uploads, blobs) })
+		api.PATCH("/postFinalGrades", func(c *gin.Context) { handlers.UploadExcelFinal(c, client, uploads, blobs, pricer, sagas) })
+		api.GET("/jobs/:id", func(c *gin.Context) { handlers.HandleJobStatus(c, uploads) })
+		api.GET("/jobs/:id/events", func(c *gin.Context) { handlers.HandleJobEvents(c, uploads) })
+		api.PATCH("/instructor/review-list", func(c *gin.Context) { handlers.HandleGetRequestList(c, client) })
+		api.PATCH("/instructor/reply", func(c *gin.Context) { handlers.HandlePostResponse(c, client, ops) })
+
+		// Statistics (all roles)
+		api.GET("/stats/available", func(c *gin.Context) { handlers.HandleSubmissionLogs(c, client) })
+		api.GET("/stats/courses", func(c *gin.Context) { handlers.HandleSubmissionLogs(c, client) })
+		api.POST("/stats/distributions", handlers.HandleGetDistributions(client, stats))
+
+		// Review workflow outcomes (own operations)
+		api.GET("/operations/:id", func(c *gin.Context) { handlers.HandleOperationStatus(c, ops) })
 	}
-	// ────────────────────────────────────────────────────────────────────────
-	//  Student‐only endpoints
-	// ────────────────────────────────────────────────────────────────────────
-	std := r.Group("/")
-	std.Use(mw.JWTAuthMiddleware())
-	std.Use(func(c *gin.Context) {
-		if c.GetString("role") != "student" {
-			c.JSON(403, gin.H{"error": "Access restricted to students only"})
-			c.Abort()
-			return
-		}
-		c.Next()
-	})
+
+	// Live notifications (all roles, own notifications)
+	authed.GET("/notifications/stream", func(c *gin.Context) { handlers.HandleNotificationStream(c, hub) })
+
+	// Platform administration: platform_admin is never granted at signup,
+	// so it is required here whatever the RBAC policy grants
+	admin := api.Group("/admin")
+	admin.Use(mw.RequireRole("platform_admin"))
 	{
-		std.GET("/personal/grades", func(c *gin.Context) { handlers.HandleGetPersonalGrades(c, ch) })
-		std.PATCH("/student/reviewRequest", func(c *gin.Context) { handlers.HandlePostNewRequest(c, ch) })
-		std.PATCH("/student/status", func(c *gin.Context) { handlers.HandleGetRequestStatus(c, ch) })
+		admin.GET("/dlq", func(c *gin.Context) { handlers.HandleDLQList(c, dlq) })
+		admin.GET("/dlq/audit", handlers.HandleDLQAudit)
+		admin.GET("/dlq/:id", func(c *gin.Context) { handlers.HandleDLQPreview(c, dlq) })
+		admin.POST("/dlq/replay", func(c *gin.Context) { handlers.HandleDLQReplay(c, dlq) })
+		admin.POST("/dlq/purge", func(c *gin.Context) { handlers.HandleDLQPurge(c, dlq) })
+		admin.GET("/institutions", func(c *gin.Context) { handlers.HandleOnboardingQueue(c, client) })
+		admin.GET("/institutions/:name", func(c *gin.Context) { handlers.HandleOnboardingRecord(c, client) })
+		admin.POST("/institutions/:name/approve", func(c *gin.Context) { handlers.HandleOnboardingDecision(c, client, "approve") })
+		admin.POST("/institutions/:name/reject", func(c *gin.Context) { handlers.HandleOnboardingDecision(c, client, "reject") })
+		admin.GET("/users", func(c *gin.Context) { handlers.HandleListUsers(c, client) })
+		admin.GET("/users/audit", func(c *gin.Context) { handlers.HandleUserAudit(c, client) })
+		admin.GET("/users/:username", func(c *gin.Context) { handlers.HandleUserAction(c, client, "get") })
+		admin.PATCH("/users/:username/role", func(c *gin.Context) { handlers.HandleSetUserRole(c, client) })
+		admin.PATCH("/users/:username/institution", func(c *gin.Context) { handlers.HandleSetUserInstitution(c, client) })
+		admin.POST("/users/:username/lock", func(c *gin.Context) { handlers.HandleUserAction(c, client, "lock") })
+		admin.POST("/users/:username/unlock", func(c *gin.Context) { handlers.HandleUserAction(c, client, "unlock") })
+		admin.POST("/users/:username/reset-password", func(c *gin.Context) { handlers.HandleResetUserPassword(c, client) })
+		admin.DELETE("/users/:username", func(c *gin.Context) { handlers.HandleUserAction(c, client, "delete") })
 	}
 
 	// ────────────────────────────────────────────────────────────────────────
-	//  Instructor‐only endpoints
+	//  Versioned API: resource-oriented routes, every error an APIError
+	//  envelope. Account (/user) and /admin routes stay unversioned.
 	// ────────────────────────────────────────────────────────────────────────
-	instr := r.Group("/")
-	instr.Use(mw.JWTAuthMiddleware())
-	instr.Use(func(c *gin.Context) {
-		if c.GetString("role") != "instructor" {
-			c.JSON(403, gin.H{"error": "Access restricted to instructors only"})
-			c.Abort()
-			return
-		}
-		c.Next()
-	})
+	v1 := r.Group("/api/v1")
+	v1.Use(mw.ErrorEnvelope())
+
+	v1pub := v1.Group("/")
+	v1pub.Use(validate, idem)
 	{
-		instr.POST("/upload_init", func(c *gin.Context) { handlers.UploadExcelInit(c, ch) })
-		instr.PATCH("/postFinalGrades", func(c *gin.Context) { handlers.UploadExcelFinal(c, ch) })
-		instr.PATCH("/instructor/review-list", func(c *gin.Context) { handlers.HandleGetRequestList(c, ch) })
-		instr.PATCH("/instructor/reply", func(c *gin.Context) { handlers.HandlePostResponse(c, ch) })
+		v1pub.GET("/institutions", func(c *gin.Context) { handlers.GetInstitutions(c, client) })
+		v1pub.GET("/institutions/:name", func(c *gin.Context) { handlers.GetInstitution(c, client) })
+	}
+
+	v1authed := v1.Group("/")
+	v1authed.Use(mw.JWTAuthMiddleware(checker), authz.Middleware())
+
+	v1api := v1authed.Group("/")
+	v1api.Use(validate, idem)
+	{
+		// Institutions & credits
+		v1api.POST("/institutions", func(c *gin.Context) { handlers.HandleInstitutionRegistered(c, client) })
+		v1api.GET("/institutions/:name/credits", func(c *gin.Context) { handlers.HandleInstitutionCredits(c, client) })
+		v1api.POST("/institutions/:name/credits/purchases", func(c *gin.Context) { handlers.HandleInstitutionPurchase(c, client) })
+
+		// Grades
+		v1api.GET("/grades", func(c *gin.Context) { handlers.HandleGetPersonalGrades(c, client) })
+		v1api.POST("/grades/initial", func(c *gin.Context) { handlers.UploadExcelInit(c, client, uploads, blobs) })
+		v1api.POST("/grades/final", func(c *gin.Context) { handlers.UploadExcelFinal(c, client, uploads, blobs, pricer, sagas) })
+		v1api.GET("/jobs/:id", func(c *gin.Context) { handlers.HandleJobStatus(c, uploads) })
+		v1api.GET("/jobs/:id/events", func(c *gin.Context) { handlers.HandleJobEvents(c, uploads) })
+
+		// Reviews
+		v1api.GET("/reviews", func(c *gin.Context) { handlers.HandleListReviews(c, client) })
+		v1api.POST("/reviews", func(c *gin.Context) { handlers.HandlePostNewRequest(c, client, ops) })
+		v1api.POST("/reviews/replies", func(c *gin.Context) { handlers.HandlePostResponse(c, client, ops) })
+		v1api.GET("/operations/:id", func(c *gin.Context) { handlers.HandleOperationStatus(c, ops) })
+
+		// Statistics
+		v1api.GET("/courses", func(c *gin.Context) { handlers.HandleSubmissionLogs(c, client) })
+		v1api.GET("/courses/:course/distributions", func(c *gin.Context) { handlers.HandleCourseDistributions(c, client, stats) })
 	}
+	v1authed.GET("/notifications/stream", func(c *gin.Context) { handlers.HandleNotificationStream(c, hub) })
+	r.NoRoute(mw.APINotFound("/api/v1/"))
 
 	// ────────────────────────────────────────────────────────────────────────
-	//  Shared stats endpoints (all roles)
+	//  Service-to-service endpoints (INTERNAL_API_TOKEN)
 	// ────────────────────────────────────────────────────────────────────────
-	stats := r.Group("/stats")
-	stats.Use(mw.JWTAuthMiddleware())
+	internal := r.Group("/internal")
+	internal.Use(mw.InternalTokenMiddleware())
 	{
-		stats.GET("/available", func(c *gin.Context) { handlers.HandleSubmissionLogs(c, ch) })
-		stats.GET("/courses", func(c *gin.Context) { handlers.HandleSubmissionLogs(c, ch) })
-		stats.POST("/distributions", handlers.HandleGetDistributions(ch))
+		internal.GET("/blobs/:sha256", func(c *gin.Context) { handlers.HandleBlob(c, blobs) })
 	}
 
+	openapi.CheckRoutes(r, openapi.Routes)
 	return r
 }
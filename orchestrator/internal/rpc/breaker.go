@@ -0,0 +1,254 @@
+package rpc
+
+// Circuit breakers and bulkheads, one of each per routing key. A worker
+// that stopped answering would otherwise hold every caller (and its
+// goroutine) for the full RPC timeout, and the pile-up would slow every
+// other route: after FailureThreshold timeouts in a row the circuit opens
+// and calls fail at once with ErrCircuitOpen until OpenFor has passed;
+// then HalfOpenProbes calls are let through, and the first that gets a
+// reply closes the circuit again. Independently, at most MaxConcurrent
+// calls per routing key wait for a reply; more fail with ErrBulkheadFull.
+//
+// Only reply timeouts count as failures: an unreachable broker is not the
+// worker's fault, and an error reply still proves the worker is alive.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"orchestrator/internal/config"
+	"orchestrator/internal/metrics"
+)
+
+var (
+	// ErrCircuitOpen is returned, without publishing, while the circuit
+	// of a routing key is open.
+	ErrCircuitOpen = errors.New("circuit open")
+	// ErrBulkheadFull is returned, without publishing, when too many
+	// calls on a routing key are already waiting for a reply.
+	ErrBulkheadFull = errors.New("too many calls in flight")
+)
+
+// RejectedError is returned by a call the breakers refused. It matches
+// both its Reason and ErrUnavailable.
+type RejectedError struct {
+	RoutingKey string
+	Reason     error // ErrCircuitOpen or ErrBulkheadFull
+	// RetryAfter is when the call may succeed again.
+	RetryAfter time.Duration
+}
+
+func (e *RejectedError) Error() string {
+	return fmt.Sprintf("%s: %v", e.RoutingKey, e.Reason)
+}
+
+func (e *RejectedError) Unwrap() []error {
+	return []error{e.Reason, ErrUnavailable}
+}
+
+// Circuit states.
+const (
+	Closed   = "closed"
+	Open     = "open"
+	HalfOpen = "half_open"
+)
+
+// bulkheadRetryAfter is the Retry-After of a call refused by a full bulkhead.
+const bulkheadRetryAfter = time.Second
+
+// DefaultBreakerPolicy supplies the fields a config leaves unset.
+var DefaultBreakerPolicy = config.BreakerPolicy{
+	FailureThreshold: 5,
+	OpenFor:          30 * time.Second,
+	HalfOpenProbes:   1,
+	MaxConcurrent:    32,
+}
+
+// CircuitState is the state of one routing key's breaker and bulkhead.
+type CircuitState struct {
+	RoutingKey    string     `json:"routing_key"`
+	State         string     `json:"state" enum:"closed|open|half_open"`
+	Failures      int        `json:"consecutive_failures"`
+	InFlight      int        `json:"in_flight"`
+	MaxConcurrent int        `json:"max_concurrent"`
+	OpenUntil     *time.Time `json:"open_until,omitempty"`
+}
+
+// Breakers holds the breaker and bulkhead of every routing key called so
+// far. A nil *Breakers lets every call through.
+type Breakers struct {
+	def  config.BreakerPolicy
+	keys map[string]config.BreakerPolicy
+
+	mu    sync.Mutex
+	byKey map[string]*breaker
+}
+
+type breaker struct {
+	policy config.BreakerPolicy
+
+	mu        sync.Mutex
+	state     string
+	failures  int
+	openUntil time.Time
+	probes    int // half-open calls in flight
+	inFlight  int
+}
+
+// NewBreakers builds the breakers described by cfg. Keys overrides the
+// policy of single routing keys; unset fields keep the top-level values,
+// and those not set there keep DefaultBreakerPolicy.
+func NewBreakers(cfg config.Breakers) *Breakers {
+	def := mergePolicy(DefaultBreakerPolicy, cfg.BreakerPolicy)
+	keys := make(map[string]config.BreakerPolicy, len(cfg.Keys))
+	for key, p := range cfg.Keys {
+		keys[key] = mergePolicy(def, p)
+	}
+	return &Breakers{def: def, keys: keys, byKey: make(map[string]*breaker)}
+}
+
+func mergePolicy(base, o config.BreakerPolicy) config.BreakerPolicy {
+	if o.FailureThreshold > 0 {
+		base.FailureThreshold = o.FailureThreshold
+	}
+	if o.OpenFor > 0 {
+		base.OpenFor = o.OpenFor
+	}
+	if o.HalfOpenProbes > 0 {
+		base.HalfOpenProbes = o.HalfOpenProbes
+	}
+	if o.MaxConcurrent > 0 {
+		base.MaxConcurrent = o.MaxConcurrent
+	}
+	return base
+}
+
+func (b *Breakers) get(routingKey string) *breaker {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	br, ok := b.byKey[routingKey]
+	if !ok {
+		policy, ok := b.keys[routingKey]
+		if !ok {
+			policy = b.def
+		}
+		br = &breaker{policy: policy, state: Closed}
+		b.byKey[routingKey] = br
+		metrics.SetCircuitState(routingKey, Closed)
+	}
+	return br
+}
+
+// acquire admits one call on routingKey, or returns the *RejectedError
+// refusing it. An admitted call must be finished with the returned
+// function and the call's error.
+func (b *Breakers) acquire(routingKey string) (func(err error), error) {
+	if b == nil {
+		return func(error) {}, nil
+	}
+	br := b.get(routingKey)
+	br.mu.Lock()
+	defer br.mu.Unlock()
+
+	now := time.Now()
+	if br.state == Open && !now.Before(br.openUntil) {
+		br.setState(routingKey, HalfOpen)
+	}
+	switch {
+	case br.state == Open:
+		return nil, b.reject(routingKey, ErrCircuitOpen, br.openUntil.Sub(now))
+	case br.state == HalfOpen && br.probes >= br.policy.HalfOpenProbes:
+		return nil, b.reject(routingKey, ErrCircuitOpen, bulkheadRetryAfter)
+	case br.inFlight >= br.policy.MaxConcurrent:
+		return nil, b.reject(routingKey, ErrBulkheadFull, bulkheadRetryAfter)
+	}
+
+	probe := br.state == HalfOpen
+	if probe {
+		br.probes++
+	}
+	br.inFlight++
+	return func(err error) { br.finish(routingKey, probe, err) }, nil
+}
+
+func (b *Breakers) reject(routingKey string, reason error, retryAfter time.Duration) error {
+	if reason == ErrCircuitOpen {
+		metrics.RPCRejected(routingKey, "circuit_open")
+	} else {
+		metrics.RPCRejected(routingKey, "bulkhead_full")
+	}
+	return &RejectedError{RoutingKey: routingKey, Reason: reason, RetryAfter: retryAfter}
+}
+
+// finish records the outcome of an admitted call.
+func (br *breaker) finish(routingKey string, probe bool, err error) {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	br.inFlight--
+	if probe {
+		br.probes--
+	}
+
+	switch {
+	case err == nil:
+		br.failures = 0
+		if br.state != Closed {
+			log.Printf("[RPC] ✅ %s answered; circuit closed", routingKey)
+			br.setState(routingKey, Closed)
+		}
+	case errors.Is(err, context.DeadlineExceeded):
+		br.failures++
+		if br.state == HalfOpen || (br.state == Closed && br.failures >= br.policy.FailureThreshold) {
+			br.openUntil = time.Now().Add(br.policy.OpenFor)
+			log.Printf("[RPC] ⚠ %s timed out %d time(s) in a row; circuit open for %s", routingKey, br.failures, br.policy.OpenFor)
+			br.setState(routingKey, Open)
+		}
+	}
+}
+
+func (br *breaker) setState(routingKey, state string) {
+	br.state = state
+	metrics.SetCircuitState(routingKey, state)
+}
+
+// States reports every breaker, sorted by routing key.
+func (b *Breakers) States() []CircuitState {
+	if b == nil {
+		return []CircuitState{}
+	}
+	b.mu.Lock()
+	keys := make([]string, 0, len(b.byKey))
+	for key := range b.byKey {
+		keys = append(keys, key)
+	}
+	b.mu.Unlock()
+	sort.Strings(keys)
+
+	states := make([]CircuitState, 0, len(keys))
+	for _, key := range keys {
+		br := b.get(key)
+		br.mu.Lock()
+		if br.state == Open && !time.Now().Before(br.openUntil) {
+			br.setState(key, HalfOpen)
+		}
+		s := CircuitState{
+			RoutingKey:    key,
+			State:         br.state,
+			Failures:      br.failures,
+			InFlight:      br.inFlight,
+			MaxConcurrent: br.policy.MaxConcurrent,
+		}
+		if br.state == Open {
+			until := br.openUntil
+			s.OpenUntil = &until
+		}
+		br.mu.Unlock()
+		states = append(states, s)
+	}
+	return states
+}
@@ -0,0 +1,286 @@
+package rpc
+
+// Request/reply messaging over RabbitMQ. A single Client is shared by all
+// HTTP handlers: it owns one channel, consumes the broker's direct reply-to
+// pseudo queue once, and routes each reply to the goroutine waiting on its
+// correlation ID. No per-request queues or consumers are declared.
+//
+// The client survives reconnects: the connection manager calls Attach with
+// every new connection, and while detached all calls fail fast with
+// ErrUnavailable. Calls also fail fast, with a *RejectedError, while the
+// breaker of their routing key refuses them (see breaker.go).
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"orchestrator/internal/metrics"
+	"orchestrator/internal/telemetry"
+	"orchestrator/internal/types"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// directReplyTo is RabbitMQ's built-in pseudo queue for RPC replies.
+const directReplyTo = "amq.rabbitmq.reply-to"
+
+// ErrUnavailable is returned when the broker cannot be reached.
+var ErrUnavailable = errors.New("message broker unavailable")
+
+var (
+	// ErrPublishFailed is returned when the broker refused a message.
+	ErrPublishFailed = errors.New("publish failed")
+	// ErrReplyLost is returned when the connection went away after the
+	// request was published: the worker may still act on it.
+	ErrReplyLost = fmt.Errorf("%w: connection lost before the reply", ErrUnavailable)
+)
+
+// NotPublished reports whether err proves the message never reached the
+// broker, so the call can be repeated without running twice.
+func NotPublished(err error) bool {
+	if errors.Is(err, ErrReplyLost) {
+		return false
+	}
+	return errors.Is(err, ErrUnavailable) || errors.Is(err, ErrPublishFailed)
+}
+
+// ChannelPool hands out channels for fire-and-forget publishing.
+type ChannelPool interface {
+	Acquire() (*amqp.Channel, error)
+	Release(*amqp.Channel)
+}
+
+// Client performs concurrent RPC calls on a dedicated channel.
+type Client struct {
+	pool     ChannelPool
+	breakers *Breakers
+
+	mu      sync.Mutex
+	ch      *amqp.Channel
+	pending map[string]chan amqp.Delivery
+	// lost is closed when the current channel goes away, waking waiters.
+	lost chan struct{}
+}
+
+// NewClient returns a detached Client that publishes through pool and
+// guards its calls with breakers (nil: unguarded).
+func NewClient(pool ChannelPool, breakers *Breakers) *Client {
+	return &Client{
+		pool:     pool,
+		breakers: breakers,
+		pending:  make(map[string]chan amqp.Delivery),
+	}
+}
+
+// Attach opens the RPC channel on conn and starts the reply consumer. It is
+// meant to be registered as a connection manager hook.
+func (c *Client) Attach(conn *amqp.Connection) error {
+	ch, err := conn.Channel()
+	if err != nil {
+		return fmt.Errorf("open rpc channel: %w", err)
+	}
+	replies, err := ch.Consume(
+		directReplyTo,
+		"",    // consumer tag
+		true,  // auto-ack (mandatory for direct reply-to)
+		false, // exclusive
+		false, // no-local
+		false, // no-wait
+		nil,
+	)
+	if err != nil {
+		ch.Close()
+		return fmt.Errorf("consume %s: %w", directReplyTo, err)
+	}
+
+	lost := make(chan struct{})
+	c.mu.Lock()
+	c.ch = ch
+	c.lost = lost
+	c.mu.Unlock()
+
+	go c.dispatch(replies, lost)
+	return nil
+}
+
+// dispatch hands every reply to its waiter until the delivery stream ends.
+func (c *Client) dispatch(replies <-chan amqp.Delivery, lost chan struct{}) {
+	for d := range replies {
+		c.mu.Lock()
+		waiter, ok := c.pending[d.CorrelationId]
+		if ok {
+			delete(c.pending, d.CorrelationId)
+		}
+		c.mu.Unlock()
+
+		if !ok {
+			log.Printf("[RPC] Dropping reply with unknown CorrID: %s", d.CorrelationId)
+			continue
+		}
+		waiter <- d // buffered, never blocks
+	}
+
+	log.Println("[RPC] Reply consumer stopped; detaching")
+	c.mu.Lock()
+	if c.lost == lost {
+		c.ch = nil
+		c.lost = nil
+	}
+	c.mu.Unlock()
+	close(lost)
+}
+
+// Circuits reports the breaker state of every routing key called so far.
+func (c *Client) Circuits() []CircuitState {
+	return c.breakers.States()
+}
+
+// Available reports whether the client is attached to a live channel.
+func (c *Client) Available() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ch != nil && !c.ch.IsClosed()
+}
+
+// Call publishes msg to exchange/routingKey and waits for the correlated
+// reply until ctx is done. CorrelationId and ReplyTo are set by the client,
+// and the call is traced as a client span whose context rides in the
+// message headers. Calls the breaker of routingKey refuses are not
+// published.
+func (c *Client) Call(ctx context.Context, exchange, routingKey string, msg amqp.Publishing) (d amqp.Delivery, err error) {
+	finish, err := c.breakers.acquire(routingKey)
+	if err != nil {
+		return amqp.Delivery{}, err
+	}
+	defer func() { finish(err) }()
+
+	ctx, span := telemetry.StartPublish(ctx, trace.SpanKindClient, exchange, routingKey, &msg)
+	done := metrics.StartRPC(routingKey)
+	defer func() {
+		telemetry.End(span, err)
+		done(err)
+	}()
+
+	corrID := uuid.New().String()
+	waiter := make(chan amqp.Delivery, 1)
+
+	c.mu.Lock()
+	ch, lost := c.ch, c.lost
+	if ch == nil {
+		c.mu.Unlock()
+		return amqp.Delivery{}, ErrUnavailable
+	}
+	c.pending[corrID] = waiter
+	c.mu.Unlock()
+	defer c.forget(corrID)
+
+	msg.CorrelationId = corrID
+	msg.ReplyTo = directReplyTo
+	if err := ch.PublishWithContext(ctx, exchange, routingKey, false, false, msg); err != nil {
+		metrics.PublishFailed(exchange, routingKey)
+		if errors.Is(err, amqp.ErrClosed) {
+			return amqp.Delivery{}, ErrUnavailable
+		}
+		return amqp.Delivery{}, fmt.Errorf("%w: %s: %v", ErrPublishFailed, routingKey, err)
+	}
+
+	select {
+	case d := <-waiter:
+		return d, nil
+	case <-ctx.Done():
+		return amqp.Delivery{}, fmt.Errorf("waiting for %s reply: %w", routingKey, ctx.Err())
+	case <-lost:
+		return amqp.Delivery{}, ErrReplyLost
+	}
+}
+
+// CallJSON marshals req as the message body, performs Call and decodes the
+// reply body into resp (which may be nil to discard it). Requests on
+// catalogued routing keys are validated and stamped with their schema
+// version before they leave the process.
+func (c *Client) CallJSON(ctx context.Context, exchange, routingKey string, req, resp interface{}) error {
+	return c.CallEvent(ctx, exchange, routingKey, routingKey, req, resp)
+}
+
+// CallEvent is CallJSON for queues that multiplex several catalogued
+// events behind one routing key (e.g. auth.request): req is validated
+// against event instead of routingKey.
+func (c *Client) CallEvent(ctx context.Context, exchange, routingKey, event string, req, resp interface{}) error {
+	msg, err := encode(event, req)
+	if err != nil {
+		return err
+	}
+	d, err := c.Call(ctx, exchange, routingKey, msg)
+	if err != nil {
+		return err
+	}
+	if resp == nil {
+		return nil
+	}
+	if err := json.Unmarshal(d.Body, resp); err != nil {
+		return fmt.Errorf("unmarshal %s reply: %w", routingKey, err)
+	}
+	return nil
+}
+
+// PublishJSON marshals v and publishes it as a persistent fire-and-forget
+// message, validating it first when routingKey is catalogued.
+func (c *Client) PublishJSON(ctx context.Context, exchange, routingKey string, v interface{}) error {
+	msg, err := encode(routingKey, v)
+	if err != nil {
+		return err
+	}
+	msg.DeliveryMode = amqp.Persistent
+	return c.Publish(ctx, exchange, routingKey, msg)
+}
+
+// encode builds a JSON publishing for event, enforcing the catalog schema
+// when one exists.
+func encode(event string, v interface{}) (amqp.Publishing, error) {
+	body, headers, err := types.Marshal(event, v)
+	if errors.Is(err, types.ErrUnknownEvent) {
+		body, err = json.Marshal(v)
+	}
+	if err != nil {
+		return amqp.Publishing{}, fmt.Errorf("encode %s: %w", event, err)
+	}
+	return amqp.Publishing{
+		ContentType: "application/json",
+		Headers:     headers,
+		Body:        body,
+	}, nil
+}
+
+// Publish sends a fire-and-forget message on a pooled channel.
+func (c *Client) Publish(ctx context.Context, exchange, routingKey string, msg amqp.Publishing) (err error) {
+	ctx, span := telemetry.StartPublish(ctx, trace.SpanKindProducer, exchange, routingKey, &msg)
+	defer func() { telemetry.End(span, err) }()
+
+	ch, err := c.pool.Acquire()
+	if err != nil {
+		metrics.PublishFailed(exchange, routingKey)
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	defer c.pool.Release(ch)
+
+	if err := ch.PublishWithContext(ctx, exchange, routingKey, false, false, msg); err != nil {
+		metrics.PublishFailed(exchange, routingKey)
+		if errors.Is(err, amqp.ErrClosed) {
+			return ErrUnavailable
+		}
+		return fmt.Errorf("%w: %s: %v", ErrPublishFailed, routingKey, err)
+	}
+	return nil
+}
+
+func (c *Client) forget(corrID string) {
+	c.mu.Lock()
+	delete(c.pending, corrID)
+	c.mu.Unlock()
+}
@@ -0,0 +1,340 @@
+package saga
+
+// Final-grades publication saga. Credits are reserved with credits.hold
+// before the sheet is sent to postgrades.final; the hold is committed when
+// the grades worker accepts the sheet, and released when it refuses it,
+// the sheet never reached the broker or the reservation itself went
+// unanswered. Each step is written to disk before it runs, so a saga
+// interrupted by a crash or a broker outage is carried on by Resume with
+// the same ID, which credits_service (as the hold ID) and the grades
+// worker (which stores one sheet per saga) treat idempotently.
+//
+// A sheet the worker did not answer for may still be stored, so it is not
+// released at once: Resume publishes it again under the same ID, up to
+// maxPublishAttempts times, and only then gives the credits back.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"orchestrator/internal/types"
+
+	"github.com/google/uuid"
+)
+
+// Step is where a saga stands.
+type Step string
+
+const (
+	Reserving  Step = "reserving"
+	Publishing Step = "publishing"
+	Committing Step = "committing"
+	Announcing Step = "announcing"
+	Releasing  Step = "releasing"
+
+	// Final steps
+	Completed Step = "completed" // grades published and paid for
+	Released  Step = "released"  // grades not published, hold given back
+	Rejected  Step = "rejected"  // nothing reserved, nothing published
+	Failed    Step = "failed"    // the hold could not be settled; see Error
+)
+
+// Final reports whether s ends the saga.
+func (s Step) Final() bool {
+	switch s {
+	case Completed, Released, Rejected, Failed:
+		return true
+	}
+	return false
+}
+
+var (
+	// ErrNotFound is returned by Store.Load for unknown sagas.
+	ErrNotFound = errors.New("saga not found")
+	// ErrInsufficient is returned by Steps.Reserve when the institution
+	// cannot cover the hold.
+	ErrInsufficient = errors.New("insufficient credits")
+	// ErrConflict is returned by a step that can never succeed, such as
+	// committing a hold that expired.
+	ErrConflict = errors.New("hold conflict")
+	// ErrNotPublished matches the errors of NotPublished.
+	ErrNotPublished = errors.New("grades not published")
+)
+
+// NotPublished marks a Publish error as proof that the grades were not
+// stored: the worker refused the sheet or it never reached the broker.
+// Any other Publish error leaves the outcome in doubt.
+func NotPublished(err error) error {
+	return &notPublishedError{err}
+}
+
+type notPublishedError struct{ err error }
+
+func (e *notPublishedError) Error() string   { return e.err.Error() }
+func (e *notPublishedError) Unwrap() []error { return []error{e.err, ErrNotPublished} }
+
+// Record is the persisted state of one saga. Its ID doubles as the hold ID.
+type Record struct {
+	ID          string              `json:"id"`
+	Step        Step                `json:"step"`
+	Institution string              `json:"institution"`
+	Rows        int                 `json:"rows"`
+	Credits     int                 `json:"credits"`
+	Sheet       types.GradeSheetRef `json:"sheet"`
+	Course      string              `json:"course,omitempty"`
+	ExamPeriod  string              `json:"exam_period,omitempty"`
+	UploadedBy  string              `json:"uploaded_by"`
+	StudentIDs  []string            `json:"student_ids,omitempty"`
+	// PublishAttempts counts the sheets sent to the grades worker.
+	PublishAttempts int `json:"publish_attempts,omitempty"`
+	// Result is the grades worker's reply, once there is one.
+	Result    json.RawMessage `json:"result,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// Steps performs the saga's remote calls. Commit, Release and Announce are
+// retried on any error except ErrConflict, and Publish on any error not
+// marked with NotPublished, so they must all be idempotent.
+type Steps interface {
+	Reserve(ctx context.Context, rec *Record) error
+	Publish(ctx context.Context, rec *Record) (result interface{}, err error)
+	Commit(ctx context.Context, rec *Record) error
+	Release(ctx context.Context, rec *Record) error
+	// Announce tells the rest of the system about published grades.
+	Announce(ctx context.Context, rec *Record) error
+}
+
+const (
+	// publishTimeout bounds the wait for the grades worker on resume,
+	// where there is no job deadline
+	publishTimeout = 5 * time.Minute
+	// maxPublishAttempts is how often a sheet left in doubt is sent
+	// before its credits are released
+	maxPublishAttempts = 5
+	// settleTimeout bounds the retries of one commit, release or
+	// announce; a saga still unsettled is left for the next Resume
+	settleTimeout = 2 * time.Minute
+	retryDelay    = time.Second
+	maxRetryDelay = 30 * time.Second
+	// retention is how long finished sagas are kept on disk
+	retention = 7 * 24 * time.Hour
+)
+
+// Runner drives sagas through Steps.
+type Runner struct {
+	store *Store
+	steps Steps
+
+	mu     sync.Mutex
+	active map[string]bool
+}
+
+// NewRunner returns a runner persisting to store.
+func NewRunner(store *Store, steps Steps) *Runner {
+	return &Runner{store: store, steps: steps, active: make(map[string]bool)}
+}
+
+// Start persists rec as a new saga and runs it to a final step (or as far
+// as ctx allows). The error describes why the grades were not published
+// and paid for; rec is returned either way.
+func (r *Runner) Start(ctx context.Context, rec *Record) (*Record, error) {
+	rec.ID = uuid.NewString()
+	rec.Step = Reserving
+	rec.CreatedAt = time.Now().UTC()
+	if err := r.store.Save(rec); err != nil {
+		return rec, fmt.Errorf("persist saga: %w", err)
+	}
+	r.claim(rec.ID)
+	defer r.unclaim(rec.ID)
+	return rec, r.drive(ctx, rec)
+}
+
+// Run resumes unfinished sagas now and then every interval until ctx ends.
+func (r *Runner) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		r.Resume(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Resume carries on every persisted saga that is not final and not
+// already running in this process.
+func (r *Runner) Resume(ctx context.Context) {
+	pending, err := r.store.Pending(retention)
+	if err != nil {
+		log.Printf("[Saga] ❌ listing pending sagas: %v", err)
+		return
+	}
+	for _, rec := range pending {
+		if !r.claim(rec.ID) {
+			continue
+		}
+		log.Printf("[Saga] 🔁 resuming %s at %s", rec.ID, rec.Step)
+		// A saga stopped while publishing sends the sheet again under the
+		// same ID; the grades worker stores it only once
+		pctx, cancel := context.WithTimeout(ctx, publishTimeout)
+		if err := r.drive(pctx, rec); err != nil {
+			log.Printf("[Saga] %s ended %s: %v", rec.ID, rec.Step, err)
+		}
+		cancel()
+		r.unclaim(rec.ID)
+	}
+}
+
+// claim marks id as running here; false if it already is.
+func (r *Runner) claim(id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.active[id] {
+		return false
+	}
+	r.active[id] = true
+	return true
+}
+
+func (r *Runner) unclaim(id string) {
+	r.mu.Lock()
+	delete(r.active, id)
+	r.mu.Unlock()
+}
+
+// drive runs rec from its current step until it is final or a settle step
+// runs out of retries.
+func (r *Runner) drive(ctx context.Context, rec *Record) error {
+	// Compensation must run even when the caller's deadline has passed
+	settleCtx := context.WithoutCancel(ctx)
+
+	for !rec.Step.Final() {
+		var (
+			next Step
+			err  error
+		)
+		switch rec.Step {
+		case Reserving:
+			err = r.steps.Reserve(ctx, rec)
+			switch {
+			case err == nil:
+				next = Publishing
+			case errors.Is(err, ErrInsufficient), errors.Is(err, ErrConflict):
+				rec.Error = err.Error()
+				next = Rejected
+			default:
+				// The hold may have been placed even though the reply was lost
+				rec.Error = "reserve credits: " + err.Error()
+				next = Releasing
+			}
+
+		case Publishing:
+			rec.PublishAttempts++
+			result, err := r.steps.Publish(ctx, rec)
+			if result != nil {
+				if raw, merr := json.Marshal(result); merr == nil {
+					rec.Result = raw
+				}
+			}
+			switch {
+			case err == nil:
+				next = Committing
+			case errors.Is(err, ErrNotPublished):
+				rec.Error = err.Error()
+				next = Releasing
+			case rec.PublishAttempts >= maxPublishAttempts:
+				rec.Error = fmt.Sprintf("%v (no answer after %d attempts)", err, rec.PublishAttempts)
+				next = Releasing
+			default:
+				// The worker may be storing the grades: releasing now would
+				// publish them unpaid, so the next Resume sends them again
+				if serr := r.store.Save(rec); serr != nil {
+					return fmt.Errorf("persist saga %s: %w", rec.ID, serr)
+				}
+				return fmt.Errorf("saga %s still publishing, will retry: %w", rec.ID, err)
+			}
+
+		case Committing:
+			if next, err = r.settleStep(settleCtx, rec, r.steps.Commit, Announcing); err != nil {
+				return err
+			}
+		case Announcing:
+			if next, err = r.settleStep(settleCtx, rec, r.steps.Announce, Completed); err != nil {
+				return err
+			}
+		case Releasing:
+			if next, err = r.settleStep(settleCtx, rec, r.steps.Release, Released); err != nil {
+				return err
+			}
+
+		default:
+			return fmt.Errorf("saga %s: unknown step %q", rec.ID, rec.Step)
+		}
+
+		log.Printf("[Saga] %s: %s → %s", rec.ID, rec.Step, next)
+		rec.Step = next
+		if err := r.store.Save(rec); err != nil {
+			return fmt.Errorf("persist saga %s: %w", rec.ID, err)
+		}
+	}
+	return outcome(rec)
+}
+
+// settleStep runs a settle step and picks the step after it: done on
+// success, Failed on a conflict. An error means the saga stays where it is
+// on disk for the next Resume.
+func (r *Runner) settleStep(ctx context.Context, rec *Record, fn func(context.Context, *Record) error, done Step) (Step, error) {
+	err := settle(ctx, rec, fn)
+	switch {
+	case err == nil:
+		return done, nil
+	case errors.Is(err, ErrConflict):
+		rec.Error = fmt.Sprintf("%s: %v", rec.Step, err)
+		return Failed, nil
+	default:
+		return rec.Step, fmt.Errorf("saga %s still %s: %w", rec.ID, rec.Step, err)
+	}
+}
+
+// settle retries fn with backoff until it succeeds, reports a conflict or
+// settleTimeout passes.
+func settle(ctx context.Context, rec *Record, fn func(context.Context, *Record) error) error {
+	ctx, cancel := context.WithTimeout(ctx, settleTimeout)
+	defer cancel()
+
+	delay := retryDelay
+	for {
+		err := fn(ctx, rec)
+		if err == nil || errors.Is(err, ErrConflict) {
+			return err
+		}
+		log.Printf("[Saga] %s: %s failed, retrying in %s: %v", rec.ID, rec.Step, delay, err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxRetryDelay)
+	}
+}
+
+// outcome is the error Start reports for a final record.
+func outcome(rec *Record) error {
+	switch rec.Step {
+	case Completed:
+		return nil
+	case Released:
+		return fmt.Errorf("%s; the credits were not charged", rec.Error)
+	default:
+		return errors.New(rec.Error)
+	}
+}
@@ -0,0 +1,75 @@
+package saga
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"time"
+
+	"orchestrator/internal/jsonfile"
+)
+
+// defaultDir is used when the config names no directory.
+const defaultDir = "data/sagas"
+
+// Store keeps one JSON file per saga. Every write replaces the file
+// atomically, so a crash leaves either the old step or the new one.
+type Store struct {
+	dir string
+}
+
+// NewStore returns a store under dir, creating it if needed.
+func NewStore(dir string) (*Store, error) {
+	if dir == "" {
+		dir = defaultDir
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Save writes rec, stamping UpdatedAt.
+func (s *Store) Save(rec *Record) error {
+	rec.UpdatedAt = time.Now().UTC()
+	return jsonfile.Write(s.dir, rec.ID, rec)
+}
+
+// Load reads one saga.
+func (s *Store) Load(id string) (*Record, error) {
+	var rec Record
+	err := jsonfile.Read(s.dir, id, &rec)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("saga %s: %w", id, err)
+	}
+	return &rec, nil
+}
+
+// Pending returns the sagas that have not reached a final step, and
+// deletes finished ones older than retention.
+func (s *Store) Pending(retention time.Duration) ([]*Record, error) {
+	ids, err := jsonfile.IDs(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var out []*Record
+	for _, id := range ids {
+		rec, err := s.Load(id)
+		if err != nil {
+			log.Printf("[Saga] skipping %s: %v", id, err)
+			continue
+		}
+		switch {
+		case !rec.Step.Final():
+			out = append(out, rec)
+		case time.Since(rec.UpdatedAt) > retention:
+			jsonfile.Remove(s.dir, id)
+		}
+	}
+	return out, nil
+}
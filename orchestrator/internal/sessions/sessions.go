@@ -0,0 +1,118 @@
+package sessions
+
+// Revocation of issued tokens. user_management_service bumps an account's
+// token version when it is locked, its password reset or its roles
+// changed, and puts the version in every token it issues; a token carrying
+// an older version, or the token of a locked or deleted account, is
+// refused here although its signature is still good.
+//
+// Google sign-ins get their tokens from google_auth_service, which knows
+// nothing of versions: those are only refused while the account is locked,
+// and not at all when user_management_service has no such account.
+//
+// Lookups are cached per username for a short TTL, so a revocation takes
+// effect within that TTL on every replica.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrRevoked is returned by Check for a token that must not be used any
+// more.
+var ErrRevoked = errors.New("token revoked")
+
+// DefaultCacheTTL is how long a lookup is reused when the config sets none.
+const DefaultCacheTTL = 5 * time.Second
+
+// State is an account as far as its tokens are concerned.
+type State struct {
+	Found        bool
+	Locked       bool
+	TokenVersion int
+}
+
+// Lookup reads the current State of the account named username.
+type Lookup func(ctx context.Context, username string) (State, error)
+
+// Token is what Check needs to know of a token.
+type Token struct {
+	Username     string
+	TokenVersion int
+	// Google is set for tokens issued by google_auth_service.
+	Google bool
+}
+
+// Checker refuses revoked tokens. A nil *Checker lets every token through.
+type Checker struct {
+	lookup Lookup
+	ttl    time.Duration
+	now    func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cached
+}
+
+type cached struct {
+	state State
+	until time.Time
+}
+
+// New returns a Checker reading accounts with lookup and reusing each
+// answer for ttl (DefaultCacheTTL when not positive).
+func New(lookup Lookup, ttl time.Duration) *Checker {
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+	return &Checker{lookup: lookup, ttl: ttl, now: time.Now, cache: make(map[string]cached)}
+}
+
+// Check returns ErrRevoked if tok may not be used any more, or the error
+// of a failed lookup.
+func (c *Checker) Check(ctx context.Context, tok Token) error {
+	if c == nil || tok.Username == "" {
+		return nil
+	}
+	state, err := c.state(ctx, tok.Username)
+	if err != nil {
+		return err
+	}
+	switch {
+	case !state.Found && tok.Google:
+		return nil
+	case !state.Found:
+		return fmt.Errorf("%w: account deleted", ErrRevoked)
+	case state.Locked:
+		return fmt.Errorf("%w: account locked", ErrRevoked)
+	case !tok.Google && tok.TokenVersion < state.TokenVersion:
+		return fmt.Errorf("%w: issued before the account last changed", ErrRevoked)
+	}
+	return nil
+}
+
+func (c *Checker) state(ctx context.Context, username string) (State, error) {
+	now := c.now()
+	c.mu.Lock()
+	e, ok := c.cache[username]
+	c.mu.Unlock()
+	if ok && now.Before(e.until) {
+		return e.state, nil
+	}
+
+	state, err := c.lookup(ctx, username)
+	if err != nil {
+		return State{}, err
+	}
+	c.mu.Lock()
+	c.cache[username] = cached{state: state, until: now.Add(c.ttl)}
+	for name, e := range c.cache {
+		if !now.Before(e.until) {
+			delete(c.cache, name)
+		}
+	}
+	c.mu.Unlock()
+	return state, nil
+}
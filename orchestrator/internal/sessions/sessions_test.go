@@ -0,0 +1,100 @@
+package sessions
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCheck(t *testing.T) {
+	accounts := map[string]State{
+		"alice":          {Found: true, TokenVersion: 0},
+		"bob":            {Found: true, TokenVersion: 2},
+		"carol":          {Found: true, Locked: true, TokenVersion: 1},
+		"dave@gmail.com": {Found: true, TokenVersion: 3},
+		"erin@gmail.com": {Found: true, Locked: true},
+	}
+	lookup := func(_ context.Context, username string) (State, error) {
+		return accounts[username], nil
+	}
+
+	tests := []struct {
+		name    string
+		tok     Token
+		revoked bool
+	}{
+		{"current token", Token{Username: "alice"}, false},
+		{"token of the current version", Token{Username: "bob", TokenVersion: 2}, false},
+		{"token issued before a bump", Token{Username: "bob", TokenVersion: 1}, true},
+		{"locked account, old token", Token{Username: "carol", TokenVersion: 0}, true},
+		{"locked account, current token", Token{Username: "carol", TokenVersion: 1}, true},
+		{"deleted account", Token{Username: "mallory"}, true},
+		{"no username", Token{}, false},
+		{"google token, versions ignored", Token{Username: "dave@gmail.com", Google: true}, false},
+		{"google token, locked account", Token{Username: "erin@gmail.com", Google: true}, true},
+		{"google token, unknown account", Token{Username: "frank@gmail.com", Google: true}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := New(lookup, 0).Check(context.Background(), tt.tok)
+			if got := errors.Is(err, ErrRevoked); got != tt.revoked {
+				t.Fatalf("Check(%+v) = %v, want revoked=%v", tt.tok, err, tt.revoked)
+			}
+		})
+	}
+}
+
+func TestCheckNil(t *testing.T) {
+	var c *Checker
+	if err := c.Check(context.Background(), Token{Username: "carol"}); err != nil {
+		t.Fatalf("nil Checker: %v", err)
+	}
+}
+
+func TestLockTakesEffectAfterCacheTTL(t *testing.T) {
+	state := State{Found: true}
+	calls := 0
+	lookup := func(context.Context, string) (State, error) {
+		calls++
+		return state, nil
+	}
+	c := New(lookup, time.Minute)
+	now := time.Unix(1000, 0)
+	c.now = func() time.Time { return now }
+	tok := Token{Username: "alice"}
+
+	if err := c.Check(context.Background(), tok); err != nil {
+		t.Fatalf("before the lock: %v", err)
+	}
+	state = State{Found: true, Locked: true, TokenVersion: 1}
+	if err := c.Check(context.Background(), tok); err != nil {
+		t.Fatalf("within the TTL the cached answer is used: %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("lookups = %d, want 1", calls)
+	}
+	now = now.Add(time.Minute)
+	if err := c.Check(context.Background(), tok); !errors.Is(err, ErrRevoked) {
+		t.Fatalf("after the TTL: %v, want ErrRevoked", err)
+	}
+}
+
+func TestLookupErrorIsNotCached(t *testing.T) {
+	fail := errors.New("user service down")
+	calls := 0
+	lookup := func(context.Context, string) (State, error) {
+		calls++
+		if calls == 1 {
+			return State{}, fail
+		}
+		return State{Found: true}, nil
+	}
+	c := New(lookup, 0)
+	if err := c.Check(context.Background(), Token{Username: "alice"}); !errors.Is(err, fail) {
+		t.Fatalf("first check: %v, want the lookup error", err)
+	}
+	if err := c.Check(context.Background(), Token{Username: "alice"}); err != nil {
+		t.Fatalf("second check: %v", err)
+	}
+}
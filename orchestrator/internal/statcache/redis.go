@@ -0,0 +1,197 @@
+package statcache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// RedisConfig locates a Redis-compatible server (Redis, Valkey, KeyDB,
+// ...). Entries are written with an expiry, so a volatile-* eviction
+// policy never evicts the generation counters.
+type RedisConfig struct {
+	Addr     string // host:port
+	DB       int
+	Prefix   string // prepended to every key
+	Password string
+}
+
+const (
+	redisPoolSize = 8
+	redisTimeout  = 500 * time.Millisecond
+)
+
+// Redis is a Backend shared by every replica, spoken to over RESP.
+type Redis struct {
+	cfg  RedisConfig
+	pool chan *redisConn
+}
+
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// errNil is the reply to GET of a missing key.
+var errNil = errors.New("redis: nil")
+
+// NewRedis returns a Redis backend for cfg. Connections are opened on
+// first use, so the server need not be up yet.
+func NewRedis(cfg RedisConfig) (*Redis, error) {
+	if cfg.Addr == "" {
+		return nil, errors.New("redis stats cache needs an addr")
+	}
+	if cfg.Prefix == "" {
+		cfg.Prefix = "clearsky:stats:"
+	}
+	return &Redis{cfg: cfg, pool: make(chan *redisConn, redisPoolSize)}, nil
+}
+
+func (b *Redis) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	v, err := b.do(ctx, "GET", b.cfg.Prefix+key)
+	if errors.Is(err, errNil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return v, true, nil
+}
+
+func (b *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	_, err := b.do(ctx, "SET", b.cfg.Prefix+key, string(value), "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	return err
+}
+
+func (b *Redis) Counter(ctx context.Context, key string) (int64, error) {
+	v, err := b.do(ctx, "GET", b.cfg.Prefix+key)
+	if errors.Is(err, errNil) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(string(v), 10, 64)
+}
+
+func (b *Redis) Incr(ctx context.Context, key string) error {
+	_, err := b.do(ctx, "INCR", b.cfg.Prefix+key)
+	return err
+}
+
+// do sends one command on a pooled connection and reads its reply. A
+// connection that failed mid-command is closed rather than pooled.
+func (b *Redis) do(ctx context.Context, args ...string) ([]byte, error) {
+	conn, err := b.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(redisTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline) //nolint:errcheck
+
+	v, err := conn.command(args...)
+	if err != nil && !errors.Is(err, errNil) && !isServerError(err) {
+		conn.Close()
+		return nil, err
+	}
+	b.put(conn)
+	return v, err
+}
+
+func (b *Redis) get(ctx context.Context) (*redisConn, error) {
+	select {
+	case c := <-b.pool:
+		return c, nil
+	default:
+	}
+	d := net.Dialer{Timeout: redisTimeout}
+	nc, err := d.DialContext(ctx, "tcp", b.cfg.Addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{Conn: nc, r: bufio.NewReader(nc)}
+	c.SetDeadline(time.Now().Add(redisTimeout)) //nolint:errcheck
+	if b.cfg.Password != "" {
+		if _, err := c.command("AUTH", b.cfg.Password); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("redis AUTH: %w", err)
+		}
+	}
+	if b.cfg.DB != 0 {
+		if _, err := c.command("SELECT", strconv.Itoa(b.cfg.DB)); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("redis SELECT: %w", err)
+		}
+	}
+	return c, nil
+}
+
+func (b *Redis) put(c *redisConn) {
+	select {
+	case b.pool <- c:
+	default:
+		c.Close()
+	}
+}
+
+// serverError is an "-ERR ..." reply; the connection is still usable.
+type serverError string
+
+func (e serverError) Error() string { return "redis: " + string(e) }
+
+func isServerError(err error) bool {
+	var se serverError
+	return errors.As(err, &se)
+}
+
+// command writes args as a RESP array of bulk strings and reads one reply:
+// the value of a simple string, integer or bulk string reply.
+func (c *redisConn) command(args ...string) ([]byte, error) {
+	buf := []byte("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, a := range args {
+		buf = append(buf, "$"+strconv.Itoa(len(a))+"\r\n"...)
+		buf = append(buf, a...)
+		buf = append(buf, "\r\n"...)
+	}
+	if _, err := c.Write(buf); err != nil {
+		return nil, err
+	}
+
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 {
+		return nil, fmt.Errorf("redis: malformed reply %q", line)
+	}
+	kind, rest := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+', ':':
+		return []byte(rest), nil
+	case '-':
+		return nil, serverError(rest)
+	case '$':
+		n, err := strconv.Atoi(rest)
+		if err != nil {
+			return nil, fmt.Errorf("redis: malformed bulk length %q", rest)
+		}
+		if n < 0 {
+			return nil, errNil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply %q", line)
+	}
+}
@@ -0,0 +1,257 @@
+package statcache
+
+// Cache of the grade distributions computed by the stats service
+// (stats.get). Distributions only change when a grade sheet is imported,
+// so replies are kept per course, period, class and caller role until
+// then: every replica binds its own queue to the sheets handed to the
+// stats service (postgrades.statistics), to its report that a sheet is
+// imported (stats.imported) and to grades.*.uploaded, and drops what they
+// make stale. The second invalidation, once the import is done, drops the
+// old distributions a request may have fetched and cached while it was
+// running. Entries also expire after a TTL, in case that report is lost.
+//
+// Invalidation bumps a generation counter, global or per course, that is
+// part of every entry's key: stale entries are never read again and age
+// out, and with a shared backend (Redis) one bump invalidates the entries
+// of every replica.
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"orchestrator/internal/config"
+	"orchestrator/internal/metrics"
+	"orchestrator/internal/types"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Backend keeps cache entries and the generation counters.
+type Backend interface {
+	// Get returns the entry under key; false if there is none.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set stores an entry under key for ttl.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Counter returns the counter under key, 0 if it was never bumped.
+	Counter(ctx context.Context, key string) (int64, error)
+	// Incr adds one to the counter under key. Counters never expire.
+	Incr(ctx context.Context, key string) error
+}
+
+const (
+	defaultTTL = 10 * time.Minute
+	// statsExchange and sheetsKey are where handlers.ForwardToStatistics
+	// hands new sheets to the stats service.
+	statsExchange = "clearSky.events"
+	sheetsKey     = "postgrades.statistics"
+	// importedKey is published there by the stats service once a sheet
+	// is in its database.
+	importedKey = "stats.imported"
+	// uploadedKey matches grades.initial.uploaded and grades.final.uploaded
+	// on the orchestrator's own exchange.
+	uploadedKey = "grades.*.uploaded"
+)
+
+// Key scopes a cached reply: one class sheet of a course in a period, as
+// seen by callers of one role.
+type Key struct {
+	Course     string
+	Period     string
+	ClassTitle string
+	Scope      string
+}
+
+// Cache is the distributions cache. A nil *Cache, or one whose backend is
+// off, caches nothing.
+type Cache struct {
+	backend Backend
+	ttl     time.Duration
+}
+
+// New builds the cache described by cfg: backend "memory" (the default),
+// "redis" or "off".
+func New(cfg config.StatsCache) (*Cache, error) {
+	ttl := cfg.TTL
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+	var b Backend
+	switch cfg.Backend {
+	case "", "memory":
+		b = NewMemory(cfg.MaxEntries)
+	case "redis":
+		r, err := NewRedis(RedisConfig{
+			Addr:     cfg.Redis.Addr,
+			DB:       cfg.Redis.DB,
+			Prefix:   cfg.Redis.Prefix,
+			Password: os.Getenv("REDIS_PASSWORD"),
+		})
+		if err != nil {
+			return nil, err
+		}
+		b = r
+	case "off":
+		log.Println("[StatsCache] caching is off")
+	default:
+		return nil, fmt.Errorf("unknown stats cache backend %q", cfg.Backend)
+	}
+	return &Cache{backend: b, ttl: ttl}, nil
+}
+
+// Lookup returns the cached reply for k. On a miss it returns the slot to
+// Store the fresh reply in: the slot belongs to the generation current
+// before the reply was fetched, so a reply racing an invalidation is
+// stored where nobody will read it.
+func (c *Cache) Lookup(ctx context.Context, k Key) (body []byte, slot string, ok bool) {
+	if c == nil || c.backend == nil {
+		return nil, "", false
+	}
+	global, err := c.backend.Counter(ctx, "gen")
+	var course int64
+	if err == nil {
+		course, err = c.backend.Counter(ctx, "gen:"+url.QueryEscape(k.Course))
+	}
+	if err != nil {
+		log.Printf("[StatsCache] ❌ reading generations: %v", err)
+		metrics.CacheLookup("stats", "error")
+		return nil, "", false
+	}
+	parts := []string{"dist", strconv.FormatInt(global, 10), strconv.FormatInt(course, 10)}
+	for _, p := range []string{k.Course, k.Period, k.ClassTitle, k.Scope} {
+		parts = append(parts, url.QueryEscape(p))
+	}
+	slot = strings.Join(parts, ":")
+
+	body, ok, err = c.backend.Get(ctx, slot)
+	switch {
+	case err != nil:
+		log.Printf("[StatsCache] ❌ get %s: %v", slot, err)
+		metrics.CacheLookup("stats", "error")
+	case ok:
+		metrics.CacheLookup("stats", "hit")
+	default:
+		metrics.CacheLookup("stats", "miss")
+	}
+	return body, slot, ok
+}
+
+// Store keeps body in the slot returned by Lookup.
+func (c *Cache) Store(ctx context.Context, slot string, body []byte) {
+	if c == nil || c.backend == nil || slot == "" {
+		return
+	}
+	if err := c.backend.Set(ctx, slot, body, c.ttl); err != nil {
+		log.Printf("[StatsCache] ❌ set %s: %v", slot, err)
+	}
+}
+
+// Invalidate drops the entries of course, or every entry if course is
+// empty.
+func (c *Cache) Invalidate(ctx context.Context, course string) {
+	if c == nil || c.backend == nil {
+		return
+	}
+	key := "gen"
+	if course != "" {
+		key += ":" + url.QueryEscape(course)
+	}
+	if err := c.backend.Incr(ctx, key); err != nil {
+		log.Printf("[StatsCache] ❌ invalidating %q: %v", course, err)
+		return
+	}
+	metrics.CacheInvalidated("stats")
+	if course == "" {
+		log.Println("[StatsCache] 🧹 all distributions invalidated")
+	} else {
+		log.Printf("[StatsCache] 🧹 distributions of %s invalidated", course)
+	}
+}
+
+// Setup binds this replica's invalidation queue: server-named, exclusive
+// and auto-deleted like the notifications queue, so every replica hears
+// every import. Register it with Manager.OnConnect after the orchestrator's
+// own exchange is declared.
+func (c *Cache) Setup(conn *amqp.Connection) error {
+	if c == nil || c.backend == nil {
+		return nil
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		return fmt.Errorf("stats cache channel: %w", err)
+	}
+	// Same arguments as the services that share the exchange
+	if err := ch.ExchangeDeclare(statsExchange, "direct", true, false, false, false, nil); err != nil {
+		ch.Close()
+		return fmt.Errorf("stats cache ExchangeDeclare failed: %w", err)
+	}
+	q, err := ch.QueueDeclare("", false, true, true, false, nil)
+	if err != nil {
+		ch.Close()
+		return fmt.Errorf("stats cache QueueDeclare failed: %w", err)
+	}
+	for _, b := range []struct{ key, exchange string }{
+		{sheetsKey, statsExchange},
+		{importedKey, statsExchange},
+		{uploadedKey, config.Cfg.Exchange.Name},
+	} {
+		if err := ch.QueueBind(q.Name, b.key, b.exchange, false, nil); err != nil {
+			ch.Close()
+			return fmt.Errorf("stats cache QueueBind %q failed: %w", b.key, err)
+		}
+	}
+	msgs, err := ch.Consume(q.Name, "", true, true, false, false, nil)
+	if err != nil {
+		ch.Close()
+		return fmt.Errorf("stats cache Consume failed: %w", err)
+	}
+	go func() {
+		for d := range msgs {
+			c.invalidateFor(d)
+		}
+	}()
+	log.Printf("[StatsCache] ✅ queue %s invalidates on %s, %s and %s", q.Name, sheetsKey, importedKey, uploadedKey)
+	return nil
+}
+
+// invalidateFor drops what the message makes stale: a sheet reference
+// and an import report do not name the course, an upload event does.
+func (c *Cache) invalidateFor(d amqp.Delivery) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if d.RoutingKey == sheetsKey || d.RoutingKey == importedKey {
+		c.Invalidate(ctx, "")
+		return
+	}
+	var ev types.GradesUploadedEvent
+	if err := json.Unmarshal(d.Body, &ev); err != nil {
+		log.Printf("[StatsCache] ⚠ %s: %v; invalidating everything", d.RoutingKey, err)
+	}
+	c.Invalidate(ctx, ev.Course)
+}
+
+// ETag is the strong entity tag of a reply body.
+func ETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// Matches reports whether an If-None-Match header value names etag
+// (weak comparison, as RFC 9110 asks for If-None-Match).
+func Matches(ifNoneMatch, etag string) bool {
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,173 @@
+package types
+
+//go:generate go run ../../cmd/schemagen -out ../../schemas
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Message headers identifying the contract a body was written against.
+const (
+	HeaderEventType     = "x-event-type"
+	HeaderSchemaVersion = "x-schema-version"
+)
+
+var (
+	// ErrUnknownEvent is returned for routing keys that are not catalogued.
+	ErrUnknownEvent = errors.New("event not in catalog")
+	// ErrInvalidPayload is returned when a body violates its schema.
+	ErrInvalidPayload = errors.New("invalid event payload")
+)
+
+// Entry describes one routing key's payload contract.
+type Entry struct {
+	Key     string
+	Version int
+	Schema  *Schema
+}
+
+// catalog maps every routing key to its payload type and schema version.
+// Bump Version whenever a payload changes incompatibly.
+var catalog = map[string]Entry{}
+
+func register(key string, version int, payload interface{}) {
+	s := SchemaFor(payload)
+	s.SchemaURI = schemaDialect
+	s.ID = fmt.Sprintf("https://clearsky/schemas/%s.v%d.json", key, version)
+	s.Title = key
+	catalog[key] = Entry{Key: key, Version: version, Schema: s}
+}
+
+func init() {
+	register("institution.registered", 1, InstitutionRegisteredEvent{})
+	register("institution.list", 1, InstitutionListRequest{})
+	register("institution.get", 1, InstitutionGetRequest{})
+	register("institution.decide", 1, InstitutionDecideRequest{})
+	register("institution.approved", 1, InstitutionDecisionEvent{})
+	register("institution.rejected", 1, InstitutionDecisionEvent{})
+	register("user.created", 1, UserCreatedEvent{})
+	register("statistics.viewed", 1, ViewedEvent{})
+	register("grades.viewed", 1, ViewedEvent{})
+	register("grades.initial.uploaded", 1, GradesUploadedEvent{})
+	register("grades.final.uploaded", 1, GradesUploadedEvent{})
+	register("postgrades.init", 1, GradeSheetRef{})
+	register("postgrades.final", 1, GradeSheetRef{})
+	register("postgrades.statistics", 1, GradeSheetRef{})
+	register("postgrades.view", 1, GradeSheetRef{})
+	register("stats.imported", 1, StatsImportedEvent{})
+	register("add.new", 1, AddInstitutionRequest{})
+	register("credits.avail", 1, CreditsAvailRequest{})
+	register("credits.spent", 1, CreditsSpentEvent{})
+	register("credits.hold", 1, CreditsHoldRequest{})
+	register("credits.hold.commit", 1, CreditsHoldRef{})
+	register("credits.hold.release", 1, CreditsHoldRef{})
+	register("credits.purchased", 1, CreditsPurchasedEvent{})
+	register("incr.credits", 1, CreditsPurchasedEvent{})
+	register("user.login.google", 1, UserLoggedInEvent{})
+	register("student.postNewRequest", 1, NewReviewRequest{})
+	register("student.getRequestStatus", 1, ReviewStatusRequest{})
+	register("student.updateInstructorResponse", 1, InstructorReplyRequest{})
+	register("instructor.postResponse", 1, InstructorReplyRequest{})
+	register("instructor.getRequestsList", 1, ReviewListRequest{})
+	register("instructor.getRequestInfo", 1, ReviewInfoRequest{})
+	register("instructor.insertStudentRequest", 1, NewReviewRequest{})
+	register("student.revertOperation", 1, ReviewRevertRequest{})
+	register("instructor.revertOperation", 1, ReviewRevertRequest{})
+	register("instructor.getCourseInstructors", 1, CourseInstructorsRequest{})
+	register("review.requested", 1, ReviewRequestedEvent{})
+	register("review.replied", 1, ReviewRepliedEvent{})
+	register("auth.register", 1, AuthRequest{})
+	register("auth.login", 1, AuthRequest{})
+	register("auth.delete", 1, AuthRequest{})
+	register("auth.change_password", 1, AuthRequest{})
+	register("auth.session", 1, AuthRequest{})
+	register("auth.login.google", 1, GoogleLoginRequest{})
+	for _, key := range []string{"users.list", "users.get", "users.set_role", "users.lock",
+		"users.unlock", "users.reset_password", "users.delete", "users.audit", "users.set_institution",
+		"users.create"} {
+		register(key, 1, UserAdminRequest{})
+	}
+	register("view.avail", 1, PersonalGradesRequest{})
+	register("stats.avail", 1, SubmissionLogsRequest{})
+	register("stats.get", 1, DistributionsRequest{})
+	register("system.ping", 1, PingRequest{})
+}
+
+// Lookup returns the catalog entry for key.
+func Lookup(key string) (Entry, bool) {
+	e, ok := catalog[key]
+	return e, ok
+}
+
+// Entries returns every catalog entry ordered by key.
+func Entries() []Entry {
+	list := make([]Entry, 0, len(catalog))
+	for _, e := range catalog {
+		list = append(list, e)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	return list
+}
+
+// Marshal encodes v as the payload of event key, validates it against the
+// key's schema and returns the body with the headers naming the contract.
+func Marshal(key string, v interface{}) ([]byte, amqp.Table, error) {
+	e, ok := Lookup(key)
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %s", ErrUnknownEvent, key)
+	}
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, nil, fmt.Errorf("marshal %s: %w", key, err)
+	}
+	if err := e.validateBody(body); err != nil {
+		return nil, nil, err
+	}
+	return body, amqp.Table{
+		HeaderEventType:     key,
+		HeaderSchemaVersion: int32(e.Version),
+	}, nil
+}
+
+// Validate checks an incoming body against the schema of event key.
+// Messages without a version header are treated as version 1, so services
+// that do not stamp headers yet keep working.
+func Validate(key string, headers amqp.Table, body []byte) error {
+	e, ok := Lookup(key)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownEvent, key)
+	}
+	version := 1
+	if raw, ok := headers[HeaderSchemaVersion]; ok {
+		switch n := raw.(type) {
+		case int32:
+			version = int(n)
+		case int64:
+			version = int(n)
+		case int:
+			version = n
+		default:
+			return fmt.Errorf("%w: %s: invalid %s header %v", ErrInvalidPayload, key, HeaderSchemaVersion, raw)
+		}
+	}
+	if version != e.Version {
+		return fmt.Errorf("%w: %s: schema version %d not supported (want %d)", ErrInvalidPayload, key, version, e.Version)
+	}
+	return e.validateBody(body)
+}
+
+func (e Entry) validateBody(body []byte) error {
+	var decoded interface{}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		return fmt.Errorf("%w: %s: invalid JSON: %v", ErrInvalidPayload, e.Key, err)
+	}
+	if err := e.Schema.Validate(decoded); err != nil {
+		return fmt.Errorf("%w: %s v%d: %v", ErrInvalidPayload, e.Key, e.Version, err)
+	}
+	return nil
+}
@@ -1,12 +1,377 @@
 package types
 
-// Define event payload structs
+// Event payload structs, one per routing key. Field names and JSON tags
+// mirror exactly what travels over the wire today; fields without
+// `omitempty` are required by the generated schema.
 
+import "time"
+
+// ────────────────────────────────────────────────────────────────────────
+//  Institutions & credits
+// ────────────────────────────────────────────────────────────────────────
+
+// InstitutionRegisteredEvent is sent to registration_service (institution.registered).
+// The registration waits for a platform admin's decision.
 type InstitutionRegisteredEvent struct {
-	InstitutionID string `json:"institutionId"`
-	Name          string `json:"name"`
-	Domain        string `json:"domain"`
-	RegisteredAt  string `json:"registeredAt"`
+	Name        string `json:"name"`
+	Email       string `json:"email"`
+	Director    string `json:"director"`
+	RequestedBy string `json:"requested_by,omitempty"`
+}
+
+// InstitutionListRequest asks registration_service for one page of the
+// institution directory (institution.list).
+type InstitutionListRequest struct {
+	Status   string `json:"status,omitempty" enum:"pending|approved|rejected"`
+	Search   string `json:"search,omitempty"`
+	Sort     string `json:"sort,omitempty" enum:"name|director|created_at"`
+	Order    string `json:"order,omitempty" enum:"asc|desc"`
+	Page     int    `json:"page,omitempty" minimum:"1"`
+	PageSize int    `json:"page_size,omitempty" minimum:"1"`
+}
+
+// InstitutionGetRequest asks registration_service for one institution
+// (institution.get).
+type InstitutionGetRequest struct {
+	Name   string `json:"name"`
+	Status string `json:"status,omitempty" enum:"pending|approved|rejected"`
+}
+
+// InstitutionDecideRequest approves or rejects a pending registration
+// (institution.decide). A rejection needs a Reason.
+type InstitutionDecideRequest struct {
+	Name      string `json:"name"`
+	Decision  string `json:"decision" enum:"approve|reject"`
+	Reason    string `json:"reason,omitempty"`
+	DecidedBy string `json:"decided_by"`
+}
+
+// InstitutionDecisionEvent announces a decided registration
+// (institution.approved, institution.rejected). credits_service opens the
+// account of an approved institution with StartingCredits.
+type InstitutionDecisionEvent struct {
+	Name            string    `json:"name"`
+	RequestedBy     string    `json:"requested_by,omitempty"`
+	DecidedBy       string    `json:"decided_by"`
+	Reason          string    `json:"reason,omitempty"`
+	StartingCredits int       `json:"starting_credits" minimum:"0"`
+	DecidedAt       time.Time `json:"decided_at"`
+}
+
+// AddInstitutionRequest opens a credits wallet for a new institution (add.new).
+type AddInstitutionRequest struct {
+	Name string `json:"name"`
+}
+
+// CreditsAvailRequest asks credits_service for a balance (credits.avail).
+type CreditsAvailRequest struct {
+	Name string `json:"name"`
+}
+
+// CreditsSpentEvent debits an institution (credits.spent).
+type CreditsSpentEvent struct {
+	Name   string `json:"name"`
+	Amount int    `json:"amount" minimum:"1"`
+}
+
+// CreditsHoldRequest reserves credits for the final-grades saga
+// (credits.hold). HoldID makes repeats idempotent.
+type CreditsHoldRequest struct {
+	HoldID     string `json:"hold_id"`
+	Name       string `json:"name"`
+	Amount     int    `json:"amount" minimum:"1"`
+	TTLSeconds int    `json:"ttl_seconds,omitempty" minimum:"1"`
+}
+
+// CreditsHoldRef names a hold to settle (credits.hold.commit,
+// credits.hold.release).
+type CreditsHoldRef struct {
+	HoldID string `json:"hold_id"`
+}
+
+// CreditsPurchasedEvent credits an institution (credits.purchased, incr.credits).
+type CreditsPurchasedEvent struct {
+	Name   string `json:"name"`
+	Amount int    `json:"amount"`
+	// PurchaseID is derived from the request's Idempotency-Key;
+	// credits_service applies a purchase ID only once.
+	PurchaseID string `json:"purchase_id,omitempty"`
+}
+
+// ────────────────────────────────────────────────────────────────────────
+//  Users & auth
+// ────────────────────────────────────────────────────────────────────────
+
+// UserCreatedEvent announces a new account (user.created).
+type UserCreatedEvent struct {
+	UserID    string `json:"user_id"`
+	Username  string `json:"username"`
+	Role      string `json:"role" enum:"student|instructor|institution_representative"`
+	StudentID string `json:"student_id,omitempty"`
+}
+
+// AuthRequest is the command understood by user_management_service on the
+// auth.request queue (auth.register, auth.login, auth.delete,
+// auth.change_password, auth.session). Type selects the operation; a
+// session request reads the account's token version and lock.
+type AuthRequest struct {
+	Type        string `json:"type" enum:"register|login|delete|change_password|session"`
+	Username    string `json:"username,omitempty"`
+	Password    string `json:"password,omitempty"`
+	Role        string `json:"role,omitempty"`
+	StudentID   string `json:"student_id,omitempty"`
+	OldPassword string `json:"old_password,omitempty"`
+	NewPassword string `json:"new_password,omitempty"`
+}
+
+// UserAdminRequest is a user administration request to user_management_service
+// on the auth.request queue (users.list, users.get, users.set_role,
+// users.lock, users.unlock, users.reset_password, users.delete,
+// users.audit, users.set_institution). Actor is the admin; the service
+// audits every request. users.set_role replaces the account's roles with
+// Roles (the first is the primary one), or with just Role.
+// users.set_institution assigns Institution, which must be approved.
+// users.create is sent by a representative (Actor) and adds a student or
+// instructor account, with Password and StudentID, to the institution the
+// representative was assigned.
+type UserAdminRequest struct {
+	Actor       string   `json:"actor"`
+	Username    string   `json:"username,omitempty"`
+	Role        string   `json:"role,omitempty" enum:"student|instructor|institution_representative|platform_admin"`
+	Roles       []string `json:"roles,omitempty" enum:"student|instructor|institution_representative|platform_admin"`
+	Search      string   `json:"search,omitempty"`
+	Page        int      `json:"page,omitempty" minimum:"1"`
+	PageSize    int      `json:"page_size,omitempty" minimum:"1"`
+	Institution string   `json:"institution,omitempty"`
+	Password    string   `json:"password,omitempty"`
+	StudentID   string   `json:"student_id,omitempty"`
+}
+
+// GoogleLoginRequest is sent to google_auth_service (auth.login.google).
+type GoogleLoginRequest struct {
+	Type  string `json:"type" enum:"google_login"`
+	Token string `json:"token"`
+	Role  string `json:"role,omitempty"`
+}
+
+// UserLoggedInEvent is emitted by google_auth_service after a login (user.login.google).
+type UserLoggedInEvent struct {
+	Event string `json:"event"`
+	Email string `json:"email"`
+}
+
+// ────────────────────────────────────────────────────────────────────────
+//  Grades & statistics
+// ────────────────────────────────────────────────────────────────────────
+
+// GradesUploadedEvent announces a processed grade sheet
+// (grades.initial.uploaded, grades.final.uploaded).
+type GradesUploadedEvent struct {
+	Filename   string    `json:"filename"`
+	Course     string    `json:"course,omitempty"`
+	ExamPeriod string    `json:"exam_period,omitempty"`
+	UploadedBy string    `json:"uploaded_by"`
+	UploadedAt time.Time `json:"uploaded_at"`
+	// Institution is charged Credits for the Rows graded (final uploads).
+	Institution string `json:"institution,omitempty"`
+	Rows        int    `json:"rows,omitempty"`
+	Credits     int    `json:"credits,omitempty"`
+	// StudentIDs lists the graded students (final uploads), who are
+	// notified that their grades are out.
+	StudentIDs []string `json:"student_ids,omitempty"`
+}
+
+// GradeSheetRef is a claim check for an uploaded workbook
+// (postgrades.init, postgrades.final, postgrades.statistics,
+// postgrades.view). Workers download the .xlsx from URL with the internal
+// API token and check it against SHA256.
+type GradeSheetRef struct {
+	SHA256      string `json:"sha256"`
+	Size        int64  `json:"size" minimum:"1"`
+	URL         string `json:"url"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	// SagaID is set on postgrades.final: the grades worker stores the
+	// sheet of a saga once, however often it is sent.
+	SagaID string `json:"saga_id,omitempty"`
+}
+
+// StatsImportedEvent is published by the stats service once a sheet it got
+// on postgrades.statistics is in its database (stats.imported).
+type StatsImportedEvent struct {
+	SHA256            string `json:"sha256,omitempty"`
+	Filename          string `json:"filename,omitempty"`
+	DeclarationPeriod string `json:"declaration_period,omitempty"`
+	ClassTitle        string `json:"class_title,omitempty"`
+	Rows              int    `json:"rows"`
+}
+
+// ViewedEvent records that a user opened grades or statistics
+// (grades.viewed, statistics.viewed).
+type ViewedEvent struct {
+	UserID   string    `json:"user_id"`
+	Role     string    `json:"role"`
+	Course   string    `json:"course,omitempty"`
+	ViewedAt time.Time `json:"viewed_at"`
+}
+
+// PersonalGradesRequest asks the view service for a student's grades (view.avail).
+type PersonalGradesRequest struct {
+	AM string `json:"AM"`
 }
 
-// ... others omitted for brevity
+// SubmissionLogsRequest asks the stats service for available courses (stats.avail).
+type SubmissionLogsRequest struct {
+	Role      string `json:"role"`
+	UserID    string `json:"user_id"`
+	StudentID string `json:"student_id,omitempty"`
+}
+
+// DistributionsRequest asks the stats service for grade histograms (stats.get).
+type DistributionsRequest struct {
+	Course            string `json:"course"            binding:"required"`
+	DeclarationPeriod string `json:"declarationPeriod" binding:"required"`
+	ClassTitle        string `json:"classTitle"        binding:"required"`
+}
+
+// ────────────────────────────────────────────────────────────────────────
+//  Review requests (student & instructor review services)
+// ────────────────────────────────────────────────────────────────────────
+
+// The review services expect every payload wrapped in {"body": {...}}.
+
+// NewReviewRequest is sent to student.postNewRequest and
+// instructor.insertStudentRequest.
+type NewReviewRequest struct {
+	Body NewReviewBody `json:"body"`
+}
+
+type NewReviewBody struct {
+	ExamPeriod     string `json:"exam_period"`
+	CourseID       string `json:"course_id"`
+	UserID         string `json:"user_id"`
+	StudentID      string `json:"student_id"`
+	StudentMessage string `json:"student_message"`
+	// OperationID makes the write idempotent and revertible; see
+	// ReviewRevertRequest.
+	OperationID string `json:"operation_id,omitempty"`
+}
+
+// ReviewStatusRequest is sent to student.getRequestStatus.
+type ReviewStatusRequest struct {
+	Body ReviewStatusBody `json:"body"`
+}
+
+type ReviewStatusBody struct {
+	ExamPeriod string `json:"exam_period"`
+	CourseID   string `json:"course_id"`
+	UserID     string `json:"user_id"`
+	StudentID  string `json:"student_id"`
+}
+
+// InstructorReplyRequest is sent to student.updateInstructorResponse and
+// instructor.postResponse.
+type InstructorReplyRequest struct {
+	Body InstructorReplyBody `json:"body"`
+}
+
+type InstructorReplyBody struct {
+	ExamPeriod             string `json:"exam_period"`
+	Username               string `json:"username"`
+	UserID                 string `json:"user_id"`
+	InstructorReplyMessage string `json:"instructor_reply_message"`
+	InstructorAction       string `json:"instructor_action" enum:"Total accept|Partial accept|Reject"`
+	OperationID            string `json:"operation_id,omitempty"`
+}
+
+// ReviewRevertRequest is sent to student.revertOperation and
+// instructor.revertOperation to undo the write made under OperationID.
+type ReviewRevertRequest struct {
+	Body ReviewRevertBody `json:"body"`
+}
+
+type ReviewRevertBody struct {
+	OperationID string `json:"operation_id" minLength:"1"`
+}
+
+// ReviewRequestedEvent announces a review request written to both review
+// services (review.requested).
+type ReviewRequestedEvent struct {
+	OperationID string    `json:"operation_id"`
+	StudentID   string    `json:"student_id"`
+	CourseID    string    `json:"course_id"`
+	ExamPeriod  string    `json:"exam_period"`
+	RequestedAt time.Time `json:"requested_at"`
+}
+
+// ReviewRepliedEvent announces an instructor's reply written to both
+// review services (review.replied).
+type ReviewRepliedEvent struct {
+	OperationID string    `json:"operation_id"`
+	Instructor  string    `json:"instructor"`
+	StudentID   string    `json:"student_id"`
+	ExamPeriod  string    `json:"exam_period"`
+	Action      string    `json:"action" enum:"Total accept|Partial accept|Reject"`
+	RepliedAt   time.Time `json:"replied_at"`
+}
+
+// CourseInstructorsRequest is sent to instructor.getCourseInstructors.
+type CourseInstructorsRequest struct {
+	Body CourseInstructorsBody `json:"body"`
+}
+
+type CourseInstructorsBody struct {
+	CourseID string `json:"course_id" minLength:"1"`
+}
+
+// ReviewListRequest is sent to instructor.getRequestsList.
+type ReviewListRequest struct {
+	Body ReviewListBody `json:"body"`
+}
+
+type ReviewListBody struct {
+	Username string `json:"username"`
+}
+
+// ReviewInfoRequest is sent to instructor.getRequestInfo.
+type ReviewInfoRequest struct {
+	Body ReviewInfoBody `json:"body"`
+}
+
+type ReviewInfoBody struct {
+	ExamPeriod string `json:"exam_period"`
+	CourseID   string `json:"course_id"`
+	UserID     string `json:"user_id"`
+}
+
+// Notification is pushed to the browsers of its recipients. It is
+// published on the notifications exchange with the recipient as routing
+// key (see internal/notify), so it is not catalogued.
+type Notification struct {
+	ID      string `json:"id"`
+	Type    string `json:"type" enum:"review.requested|review.replied|grades.published|credits.low|institution.approved|institution.rejected"`
+	Message string `json:"message"`
+	// Set when they apply to Type
+	Course      string    `json:"course,omitempty"`
+	ExamPeriod  string    `json:"exam_period,omitempty"`
+	StudentID   string    `json:"student_id,omitempty"`
+	Action      string    `json:"action,omitempty"`
+	Credits     *int      `json:"credits,omitempty"`
+	Institution string    `json:"institution,omitempty"`
+	Reason      string    `json:"reason,omitempty"`
+	At          time.Time `json:"at"`
+}
+
+// PingRequest is the system.ping readiness probe. It travels over a
+// service's regular routing key with x-event-type set to system.ping, so
+// a reply proves the key is bound to a live consumer.
+type PingRequest struct {
+	From string `json:"from"`
+}
+
+// PingReply is what a worker answers to system.ping.
+type PingReply struct {
+	Status        string `json:"status" enum:"ok"`
+	Service       string `json:"service"`
+	UptimeSeconds int    `json:"uptime_seconds"`
+}
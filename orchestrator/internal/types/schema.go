@@ -0,0 +1,227 @@
+package types
+
+// A deliberately small JSON Schema (draft 2020-12 subset) implementation:
+// enough to describe the catalog's Go structs and to validate decoded
+// message bodies against them, without pulling in a schema library.
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const schemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema is a JSON Schema node.
+type Schema struct {
+	SchemaURI   string             `json:"$schema,omitempty"`
+	ID          string             `json:"$id,omitempty"`
+	Title       string             `json:"title,omitempty"`
+	Ref         string             `json:"$ref,omitempty"`
+	Type        interface{}        `json:"type,omitempty"` // string or []string
+	Format      string             `json:"format,omitempty"`
+	Enum        []string           `json:"enum,omitempty"`
+	Minimum     *float64           `json:"minimum,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`
+	Additional  *Schema            `json:"additionalProperties,omitempty"`
+	Description string             `json:"description,omitempty"`
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	rawType  = reflect.TypeOf(json.RawMessage{})
+)
+
+// SchemaFor builds the schema of v's Go type.
+func SchemaFor(v interface{}) *Schema {
+	return schemaOf(reflect.TypeOf(v))
+}
+
+func schemaOf(t reflect.Type) *Schema {
+	if t == timeType {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+	if t == rawType {
+		return &Schema{}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		s := schemaOf(t.Elem())
+		if name, ok := s.Type.(string); ok {
+			s.Type = []string{name, "null"}
+		}
+		return s
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", Additional: schemaOf(t.Elem())}
+	case reflect.Struct:
+		return structSchema(t)
+	default: // interface{} and friends accept anything
+		return &Schema{}
+	}
+}
+
+func structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, omitempty, skip := jsonName(f)
+		if skip {
+			continue
+		}
+		prop := schemaOf(f.Type)
+		if enum := f.Tag.Get("enum"); enum != "" {
+			// On a list, the enum constrains its items
+			if prop.Type == "array" {
+				prop.Items.Enum = strings.Split(enum, "|")
+			} else {
+				prop.Enum = strings.Split(enum, "|")
+			}
+		}
+		if min, err := strconv.ParseFloat(f.Tag.Get("minimum"), 64); err == nil {
+			prop.Minimum = &min
+		}
+		s.Properties[name] = prop
+		if !omitempty && f.Type.Kind() != reflect.Ptr {
+			s.Required = append(s.Required, name)
+		}
+	}
+	sort.Strings(s.Required)
+	return s
+}
+
+func jsonName(f reflect.StructField) (name string, omitempty, skip bool) {
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", false, true
+	}
+	parts := strings.Split(tag, ",")
+	name = parts[0]
+	if name == "" {
+		name = f.Name
+	}
+	for _, opt := range parts[1:] {
+		if opt == "omitempty" {
+			omitempty = true
+		}
+	}
+	return name, omitempty, false
+}
+
+// Validate checks a decoded JSON value (as produced by encoding/json into
+// interface{}) against s and returns the first violation found.
+func (s *Schema) Validate(v interface{}) error {
+	return s.validate("$", v)
+}
+
+func (s *Schema) validate(path string, v interface{}) error {
+	if s.Type != nil && !s.allows(v) {
+		return fmt.Errorf("%s: expected %v, got %s", path, s.Type, jsonKind(v))
+	}
+	if len(s.Enum) > 0 {
+		str, _ := v.(string)
+		if !contains(s.Enum, str) {
+			return fmt.Errorf("%s: %q is not one of %v", path, str, s.Enum)
+		}
+	}
+	if s.Minimum != nil {
+		if n, ok := v.(float64); ok && n < *s.Minimum {
+			return fmt.Errorf("%s: %v is less than minimum %v", path, n, *s.Minimum)
+		}
+	}
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := val[name]; !ok {
+				return fmt.Errorf("%s: missing required property %q", path, name)
+			}
+		}
+		for name, child := range val {
+			if prop, ok := s.Properties[name]; ok {
+				if err := prop.validate(path+"."+name, child); err != nil {
+					return err
+				}
+			} else if s.Additional != nil {
+				if err := s.Additional.validate(path+"."+name, child); err != nil {
+					return err
+				}
+			}
+		}
+	case []interface{}:
+		if s.Items != nil {
+			for i, child := range val {
+				if err := s.Items.validate(fmt.Sprintf("%s[%d]", path, i), child); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Schema) allows(v interface{}) bool {
+	var names []string
+	switch t := s.Type.(type) {
+	case string:
+		names = []string{t}
+	case []string:
+		names = t
+	}
+	kind := jsonKind(v)
+	for _, name := range names {
+		if name == kind || (name == "number" && kind == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonKind(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if val == float64(int64(val)) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
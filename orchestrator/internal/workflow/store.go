@@ -0,0 +1,74 @@
+package workflow
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"time"
+
+	"orchestrator/internal/jsonfile"
+)
+
+// defaultDir is used when the config names no directory.
+const defaultDir = "data/workflows"
+
+// Store keeps one JSON file per operation.
+type Store struct {
+	dir string
+}
+
+// NewStore returns a store under dir, creating it if needed.
+func NewStore(dir string) (*Store, error) {
+	if dir == "" {
+		dir = defaultDir
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Save writes op, stamping UpdatedAt.
+func (s *Store) Save(op *Operation) error {
+	op.UpdatedAt = time.Now().UTC()
+	return jsonfile.Write(s.dir, op.ID, op)
+}
+
+// Load reads one operation.
+func (s *Store) Load(id string) (*Operation, error) {
+	var op Operation
+	err := jsonfile.Read(s.dir, id, &op)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("operation %s: %w", id, err)
+	}
+	return &op, nil
+}
+
+// Pending returns the operations that are not final, and deletes final
+// ones older than retention.
+func (s *Store) Pending(retention time.Duration) ([]*Operation, error) {
+	ids, err := jsonfile.IDs(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var out []*Operation
+	for _, id := range ids {
+		op, err := s.Load(id)
+		if err != nil {
+			log.Printf("[Workflow] skipping %s: %v", id, err)
+			continue
+		}
+		switch {
+		case !op.State.Final():
+			out = append(out, op)
+		case time.Since(op.UpdatedAt) > retention:
+			jsonfile.Remove(s.dir, id)
+		}
+	}
+	return out, nil
+}
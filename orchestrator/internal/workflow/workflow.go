@@ -0,0 +1,335 @@
+package workflow
+
+// Writes that must land in several services or in none. An operation sends
+// its steps in order, each carrying the operation ID so the service applies
+// it once however often it is retried. When a step is refused, or still
+// unanswered after retries, the steps already sent are reverted newest
+// first; a service that never saw the step records the revert so the late
+// write is refused. Every state change is on disk before the call it
+// announces, so an operation cut short by a crash is compensated by Resume.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// State is where an operation stands.
+type State string
+
+const (
+	Running      State = "running"
+	Compensating State = "compensating"
+
+	// Final states
+	Completed   State = "completed"   // every step applied
+	Compensated State = "compensated" // every step sent was reverted; see Error
+	Failed      State = "failed"      // a service refused a revert; see Error
+)
+
+// Final reports whether s ends the operation.
+func (s State) Final() bool {
+	switch s {
+	case Completed, Compensated, Failed:
+		return true
+	}
+	return false
+}
+
+// StepState is where one step stands.
+type StepState string
+
+const (
+	StepPending   StepState = "pending"
+	StepApplied   StepState = "applied"
+	StepRefused   StepState = "refused"   // the service answered that it cannot apply it
+	StepUncertain StepState = "uncertain" // sent, but never answered
+	StepReverted  StepState = "reverted"
+)
+
+var (
+	// ErrNotFound is returned by Runner.Get for unknown operations.
+	ErrNotFound = errors.New("operation not found")
+	// ErrRefused is returned by a Transport when the service answered
+	// that it cannot make the write; refused steps are not retried.
+	ErrRefused = errors.New("refused")
+)
+
+// Step is one service's part of an operation.
+type Step struct {
+	Service string `json:"service"`
+	// Key applies the step; Revert undoes it.
+	Key    string          `json:"key"`
+	Revert string          `json:"revert"`
+	State  StepState       `json:"state" enum:"pending|applied|refused|uncertain|reverted"`
+	Reply  json.RawMessage `json:"reply,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// Operation is the persisted state of one multi-service write.
+type Operation struct {
+	ID    string `json:"id"`
+	Kind  string `json:"kind"`
+	Owner string `json:"owner"`
+	State State  `json:"state" enum:"running|compensating|completed|compensated|failed"`
+	Steps []Step `json:"steps"`
+	// Error says why the operation was compensated or failed.
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// New returns an operation of kind for owner with a fresh ID. Steps run in
+// the order given.
+func New(kind, owner string, steps ...Step) *Operation {
+	for i := range steps {
+		steps[i].State = StepPending
+	}
+	return &Operation{ID: uuid.NewString(), Kind: kind, Owner: owner, Steps: steps}
+}
+
+// Transport sends steps and reverts. Revert must be idempotent and must
+// work for an operation the service never saw.
+type Transport interface {
+	Apply(ctx context.Context, key string, payload interface{}) (json.RawMessage, error)
+	Revert(ctx context.Context, key, id string) error
+}
+
+const (
+	// applyAttempts is how often a step is sent before it is given up
+	applyAttempts = 3
+	// compensateTimeout bounds the reverts made while the client waits;
+	// an operation still compensating is finished by Resume
+	compensateTimeout = 15 * time.Second
+	// settleTimeout bounds the reverts of one Resume pass
+	settleTimeout = 2 * time.Minute
+	retryDelay    = 500 * time.Millisecond
+	maxRetryDelay = 30 * time.Second
+	// retention is how long final operations are kept on disk
+	retention = 7 * 24 * time.Hour
+)
+
+// Runner drives operations through a Transport.
+type Runner struct {
+	store     *Store
+	transport Transport
+
+	mu     sync.Mutex
+	active map[string]bool
+}
+
+// NewRunner returns a runner persisting to store.
+func NewRunner(store *Store, transport Transport) *Runner {
+	return &Runner{store: store, transport: transport, active: make(map[string]bool)}
+}
+
+// Get returns a persisted operation.
+func (r *Runner) Get(id string) (*Operation, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrNotFound
+	}
+	return r.store.Load(id)
+}
+
+// Start persists op and sends payload to each step in turn, compensating
+// if one fails. The error, wrapping the failed step's, says why the
+// operation did not complete; op is returned either way, and may still be
+// Compensating if the reverts did not go through in time.
+func (r *Runner) Start(ctx context.Context, op *Operation, payload interface{}) (*Operation, error) {
+	op.State = Running
+	op.CreatedAt = time.Now().UTC()
+	if err := r.store.Save(op); err != nil {
+		return op, fmt.Errorf("persist operation: %w", err)
+	}
+	r.claim(op.ID)
+	defer r.unclaim(op.ID)
+
+	cause := r.apply(ctx, op, payload)
+	if op.State == Completed {
+		return op, nil
+	}
+	settleCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), compensateTimeout)
+	defer cancel()
+	if err := r.compensate(settleCtx, op); err != nil {
+		log.Printf("[Workflow] %s: %v", op.ID, err)
+	}
+	return op, cause
+}
+
+// Run resumes unfinished operations now and then every interval until ctx
+// ends.
+func (r *Runner) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		r.Resume(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Resume compensates every persisted operation that is not final and not
+// already running in this process. An operation found Running lost its
+// request with the crash, so it is never carried forward.
+func (r *Runner) Resume(ctx context.Context) {
+	pending, err := r.store.Pending(retention)
+	if err != nil {
+		log.Printf("[Workflow] ❌ listing pending operations: %v", err)
+		return
+	}
+	for _, op := range pending {
+		if !r.claim(op.ID) {
+			continue
+		}
+		log.Printf("[Workflow] 🔁 resuming %s (%s) while %s", op.ID, op.Kind, op.State)
+		if op.State == Running {
+			for i := range op.Steps {
+				if op.Steps[i].State == StepPending {
+					op.Steps[i].State = StepUncertain
+					op.Error = fmt.Sprintf("%s: interrupted", op.Steps[i].Service)
+					break
+				}
+			}
+			op.State = Compensating
+		}
+		sctx, cancel := context.WithTimeout(ctx, settleTimeout)
+		if err := r.compensate(sctx, op); err != nil {
+			log.Printf("[Workflow] %s: %v", op.ID, err)
+		}
+		cancel()
+		r.unclaim(op.ID)
+	}
+}
+
+// claim marks id as running here; false if it already is.
+func (r *Runner) claim(id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.active[id] {
+		return false
+	}
+	r.active[id] = true
+	return true
+}
+
+func (r *Runner) unclaim(id string) {
+	r.mu.Lock()
+	delete(r.active, id)
+	r.mu.Unlock()
+}
+
+// apply sends the steps in order and leaves op Completed, or Compensating
+// with the error of the step that failed.
+func (r *Runner) apply(ctx context.Context, op *Operation, payload interface{}) error {
+	for i := range op.Steps {
+		s := &op.Steps[i]
+		reply, err := r.send(ctx, op, s, payload)
+		if err == nil {
+			s.State, s.Reply = StepApplied, reply
+			log.Printf("[Workflow] %s: %s applied", op.ID, s.Service)
+			if err := r.store.Save(op); err != nil {
+				// Nothing on disk says the step landed; undo it now
+				op.State, op.Error = Compensating, "persist operation: "+err.Error()
+				return fmt.Errorf("persist operation %s: %w", op.ID, err)
+			}
+			continue
+		}
+
+		if errors.Is(err, ErrRefused) {
+			s.State = StepRefused
+		} else {
+			// The write may have landed even though the reply was lost
+			s.State = StepUncertain
+		}
+		s.Error = err.Error()
+		op.State, op.Error = Compensating, fmt.Sprintf("%s: %v", s.Service, err)
+		log.Printf("[Workflow] %s: %s %s: %v", op.ID, s.Service, s.State, err)
+		if serr := r.store.Save(op); serr != nil {
+			log.Printf("[Workflow] ❌ persist operation %s: %v", op.ID, serr)
+		}
+		return fmt.Errorf("%s: %w", s.Service, err)
+	}
+	op.State = Completed
+	if err := r.store.Save(op); err != nil {
+		log.Printf("[Workflow] ❌ persist operation %s: %v", op.ID, err)
+	}
+	return nil
+}
+
+// send applies one step, retrying with backoff unless it is refused.
+func (r *Runner) send(ctx context.Context, op *Operation, s *Step, payload interface{}) (json.RawMessage, error) {
+	delay := retryDelay
+	for attempt := 1; ; attempt++ {
+		reply, err := r.transport.Apply(ctx, s.Key, payload)
+		if err == nil || errors.Is(err, ErrRefused) || attempt == applyAttempts {
+			return reply, err
+		}
+		log.Printf("[Workflow] %s: %s attempt %d failed, retrying in %s: %v", op.ID, s.Key, attempt, delay, err)
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxRetryDelay)
+	}
+}
+
+// compensate reverts every step that was applied or may have been, newest
+// first. An error means the operation stays Compensating on disk for the
+// next Resume.
+func (r *Runner) compensate(ctx context.Context, op *Operation) error {
+	for i := len(op.Steps) - 1; i >= 0; i-- {
+		s := &op.Steps[i]
+		if s.State != StepApplied && s.State != StepUncertain {
+			continue
+		}
+		err := r.revert(ctx, op, s)
+		if errors.Is(err, ErrRefused) {
+			s.Error = "revert: " + err.Error()
+			op.State, op.Error = Failed, fmt.Sprintf("%s; reverting %s: %v", op.Error, s.Service, err)
+			log.Printf("[Workflow] ❌ %s failed: %s", op.ID, op.Error)
+			return r.store.Save(op)
+		}
+		if err != nil {
+			if serr := r.store.Save(op); serr != nil {
+				log.Printf("[Workflow] ❌ persist operation %s: %v", op.ID, serr)
+			}
+			return fmt.Errorf("operation %s still compensating: %w", op.ID, err)
+		}
+		s.State = StepReverted
+		log.Printf("[Workflow] %s: %s reverted", op.ID, s.Service)
+		if err := r.store.Save(op); err != nil {
+			return fmt.Errorf("persist operation %s: %w", op.ID, err)
+		}
+	}
+	op.State = Compensated
+	return r.store.Save(op)
+}
+
+// revert retries one revert with backoff until it succeeds, is refused or
+// ctx ends.
+func (r *Runner) revert(ctx context.Context, op *Operation, s *Step) error {
+	delay := retryDelay
+	for {
+		err := r.transport.Revert(ctx, s.Revert, op.ID)
+		if err == nil || errors.Is(err, ErrRefused) {
+			return err
+		}
+		log.Printf("[Workflow] %s: %s failed, retrying in %s: %v", op.ID, s.Revert, delay, err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxRetryDelay)
+	}
+}
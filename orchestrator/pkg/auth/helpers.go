@@ -6,19 +6,21 @@ import (
 
 // AuthInfo contains all user authentication information
 type AuthInfo struct {
-	UserID    string
-	Username  string
-	Role      string
-	StudentID string
+	UserID      string
+	Username    string
+	Role        string
+	StudentID   string
+	Institution string
 }
 
 // GetAuthInfo extracts all authentication info from gin context
 func GetAuthInfo(c *gin.Context) AuthInfo {
 	return AuthInfo{
-		UserID:    getStringFromContext(c, "user_id"),
-		Username:  getStringFromContext(c, "username"),
-		Role:      getStringFromContext(c, "role"),
-		StudentID: getStringFromContext(c, "student_id"),
+		UserID:      getStringFromContext(c, "user_id"),
+		Username:    getStringFromContext(c, "username"),
+		Role:        getStringFromContext(c, "role"),
+		StudentID:   getStringFromContext(c, "student_id"),
+		Institution: getStringFromContext(c, "institution"),
 	}
 }
 
@@ -8,6 +8,8 @@ import (
 	"log"
 	"os"
 
+	"registration_service/metrics"
+
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -36,36 +38,67 @@ func InitDB() {
 	log.Println("Connected to PostgreSQL via pgxpool.")
 }
 
-func AddInstitution(inst_name, email, director string) (int, error) {
-	log.Printf("→ AddInstitution called with name=%q, email=%q, director=%q", inst_name, email, director)
+// EnsureSchema adds the onboarding columns to the institution table.
+// Institutions registered before onboarding approval existed count as
+// approved.
+func EnsureSchema() error {
+	_, err := Pool.Exec(context.Background(), `
+		ALTER TABLE institution
+			ADD COLUMN IF NOT EXISTS status varchar(16) NOT NULL DEFAULT 'approved',
+			ADD COLUMN IF NOT EXISTS requested_by varchar(100),
+			ADD COLUMN IF NOT EXISTS decision_reason text,
+			ADD COLUMN IF NOT EXISTS decided_by varchar(100),
+			ADD COLUMN IF NOT EXISTS decided_at timestamp`)
+	if err != nil {
+		metrics.DBError("ensure_schema")
+	}
+	return err
+}
+
+// AddInstitution records a registration as pending approval. A name that
+// was rejected before may be registered again.
+func AddInstitution(inst_name, email, director, requestedBy string) (int, error) {
+	log.Printf("→ AddInstitution called with name=%q, email=%q, director=%q, requested_by=%q", inst_name, email, director, requestedBy)
 	ctx := context.Background()
 
 	// 1. Check for existing institution
 	log.Println("… Checking if institution already exists")
-	checkQuery := `SELECT name FROM institution WHERE name = $1;`
-	var existing string
-	err := Pool.QueryRow(ctx, checkQuery, inst_name).Scan(&existing)
+	checkQuery := `SELECT status FROM institution WHERE name = $1;`
+	var status string
+	err := Pool.QueryRow(ctx, checkQuery, inst_name).Scan(&status)
 	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		// anything except “no rows” is fatal
 		log.Printf("❌ Error during existence check: %v", err)
+		metrics.DBError("add_institution")
 		return 0, err
 	}
-	if err == nil {
+	if err == nil && status != StatusRejected {
 		// found a match, don’t insert
-		log.Printf("⚠ Institution %q already exists", inst_name)
+		log.Printf("⚠ Institution %q already exists (%s)", inst_name, status)
 		return 2, fmt.Errorf("institution already exists")
 	}
-	log.Println("✅ No existing institution found, proceeding to insert")
 
-	// 2. Insert new institution
-	insertQuery := `INSERT INTO institution (name, email, director) VALUES ($1, $2, $3);`
-	log.Printf("… Inserting institution %q into database", inst_name)
-	_, err = Pool.Exec(ctx, insertQuery, inst_name, email, director)
+	if err == nil {
+		// 2a. Re-open a rejected registration
+		log.Printf("… Institution %q was rejected before, re-opening it", inst_name)
+		_, err = Pool.Exec(ctx, `UPDATE institution
+			SET email = $2, director = $3, requested_by = NULLIF($4, ''), status = 'pending',
+			    decision_reason = NULL, decided_by = NULL, decided_at = NULL, created_at = CURRENT_TIMESTAMP
+			WHERE name = $1 AND status = 'rejected';`,
+			inst_name, email, director, requestedBy)
+	} else {
+		// 2b. Insert new institution
+		log.Printf("… Inserting institution %q into database", inst_name)
+		_, err = Pool.Exec(ctx, `INSERT INTO institution (name, email, director, requested_by, status)
+			VALUES ($1, $2, $3, NULLIF($4, ''), 'pending');`,
+			inst_name, email, director, requestedBy)
+	}
 	if err != nil {
-		log.Printf("❌ Failed to insert institution %q: %v", inst_name, err)
+		log.Printf("❌ Failed to store institution %q: %v", inst_name, err)
+		metrics.DBError("add_institution")
 		return 0, err
 	}
-	log.Printf("✅ Institution %q inserted successfully", inst_name)
+	log.Printf("✅ Institution %q is pending approval", inst_name)
 
 	return 1, nil
 }
@@ -0,0 +1,190 @@
+package dbService
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"registration_service/metrics"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Onboarding states of a registration.
+const (
+	StatusPending  = "pending"
+	StatusApproved = "approved"
+	StatusRejected = "rejected"
+)
+
+// Institution is one row of the institution table.
+type Institution struct {
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Director  string    `json:"director"`
+	CreatedAt time.Time `json:"created_at"`
+	// Onboarding
+	Status      string     `json:"status"`
+	RequestedBy string     `json:"requested_by,omitempty"`
+	Reason      string     `json:"reason,omitempty"`
+	DecidedBy   string     `json:"decided_by,omitempty"`
+	DecidedAt   *time.Time `json:"decided_at,omitempty"`
+}
+
+var (
+	// ErrInstitutionNotFound is returned for an unknown name.
+	ErrInstitutionNotFound = errors.New("institution not found")
+	// ErrAlreadyDecided is returned by DecideInstitution when the
+	// registration was already decided the other way.
+	ErrAlreadyDecided = errors.New("institution already decided")
+)
+
+// institutionColumns are scanned by scanInstitution, in order.
+const institutionColumns = `name, email, COALESCE(director, ''), COALESCE(created_at, 'epoch'),
+	status, COALESCE(requested_by, ''), COALESCE(decision_reason, ''), COALESCE(decided_by, ''), decided_at`
+
+func scanInstitution(row pgx.Row) (Institution, error) {
+	var inst Institution
+	err := row.Scan(&inst.Name, &inst.Email, &inst.Director, &inst.CreatedAt,
+		&inst.Status, &inst.RequestedBy, &inst.Reason, &inst.DecidedBy, &inst.DecidedAt)
+	return inst, err
+}
+
+// sortColumns maps the sort keys callers may ask for to their columns.
+var sortColumns = map[string]string{
+	"name":       "name",
+	"director":   "director",
+	"created_at": "created_at",
+}
+
+// ListInstitutions returns one page of institutions in status (any status
+// if empty) whose name or director contains search (case-insensitive),
+// ordered by sort, and the number of matches over all pages. sort must be
+// a key of sortColumns.
+func ListInstitutions(status, search, sort string, desc bool, limit, offset int) ([]Institution, int, error) {
+	log.Printf("→ ListInstitutions status=%q search=%q sort=%s desc=%v limit=%d offset=%d", status, search, sort, desc, limit, offset)
+	ctx := context.Background()
+
+	column, ok := sortColumns[sort]
+	if !ok {
+		return nil, 0, fmt.Errorf("unknown sort key %q", sort)
+	}
+	direction := "ASC"
+	if desc {
+		direction = "DESC"
+	}
+
+	// % and _ in the search text are literal
+	pattern := "%" + strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(search) + "%"
+	where := `WHERE (name ILIKE $1 OR COALESCE(director, '') ILIKE $1) AND ($2 = '' OR status = $2)`
+
+	var total int
+	if err := Pool.QueryRow(ctx, `SELECT COUNT(*) FROM institution `+where, pattern, status).Scan(&total); err != nil {
+		log.Printf("❌ Counting institutions failed: %v", err)
+		metrics.DBError("list_institutions")
+		return nil, 0, err
+	}
+
+	// name breaks ties so pages never overlap
+	query := fmt.Sprintf(`SELECT %s FROM institution %s ORDER BY %s %s, name ASC LIMIT $3 OFFSET $4`,
+		institutionColumns, where, column, direction)
+	rows, err := Pool.Query(ctx, query, pattern, status, limit, offset)
+	if err != nil {
+		log.Printf("❌ Listing institutions failed: %v", err)
+		metrics.DBError("list_institutions")
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	list := []Institution{}
+	for rows.Next() {
+		inst, err := scanInstitution(rows)
+		if err != nil {
+			log.Printf("❌ Scanning institution failed: %v", err)
+			metrics.DBError("list_institutions")
+			return nil, 0, err
+		}
+		list = append(list, inst)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("❌ Listing institutions failed: %v", err)
+		metrics.DBError("list_institutions")
+		return nil, 0, err
+	}
+	log.Printf("✅ %d of %d institution(s) returned", len(list), total)
+	return list, total, nil
+}
+
+// GetInstitution returns the institution registered under name, in any
+// status.
+func GetInstitution(name string) (Institution, error) {
+	log.Printf("→ GetInstitution called with name=%q", name)
+
+	inst, err := scanInstitution(Pool.QueryRow(context.Background(),
+		`SELECT `+institutionColumns+` FROM institution WHERE name = $1`, name))
+	if errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("⚠ Institution %q not found", name)
+		return inst, ErrInstitutionNotFound
+	}
+	if err != nil {
+		log.Printf("❌ Loading institution %q failed: %v", name, err)
+		metrics.DBError("get_institution")
+		return inst, err
+	}
+	return inst, nil
+}
+
+// DecideInstitution approves or rejects a pending registration. Deciding
+// again the way it was already decided changes nothing, so a retried
+// decision succeeds; deciding the other way is ErrAlreadyDecided.
+func DecideInstitution(name string, approve bool, reason, decidedBy string) (Institution, error) {
+	log.Printf("→ DecideInstitution name=%q approve=%v by=%q", name, approve, decidedBy)
+	ctx := context.Background()
+	target := StatusRejected
+	if approve {
+		target = StatusApproved
+	}
+
+	tx, err := Pool.Begin(ctx)
+	if err != nil {
+		metrics.DBError("decide_institution")
+		return Institution{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	inst, err := scanInstitution(tx.QueryRow(ctx,
+		`SELECT `+institutionColumns+` FROM institution WHERE name = $1 FOR UPDATE`, name))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return inst, ErrInstitutionNotFound
+	}
+	if err != nil {
+		log.Printf("❌ Loading institution %q failed: %v", name, err)
+		metrics.DBError("decide_institution")
+		return inst, err
+	}
+	if inst.Status == target {
+		log.Printf("⚠ Institution %q is already %s", name, target)
+		return inst, nil
+	}
+	if inst.Status != StatusPending {
+		return inst, ErrAlreadyDecided
+	}
+
+	inst, err = scanInstitution(tx.QueryRow(ctx, `UPDATE institution
+		SET status = $2, decision_reason = NULLIF($3, ''), decided_by = $4, decided_at = CURRENT_TIMESTAMP
+		WHERE name = $1 RETURNING `+institutionColumns, name, target, reason, decidedBy))
+	if err != nil {
+		log.Printf("❌ Deciding institution %q failed: %v", name, err)
+		metrics.DBError("decide_institution")
+		return inst, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		metrics.DBError("decide_institution")
+		return inst, err
+	}
+	log.Printf("✅ Institution %q %s by %s", name, target, decidedBy)
+	return inst, nil
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"registration_service/dbService"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// ListRequest asks for one page of the institution directory.
+type ListRequest struct {
+	Status   string `json:"status"` // "pending", "approved", "rejected"; empty for all
+	Search   string `json:"search"`
+	Sort     string `json:"sort"`  // "name" (default), "director", "created_at"
+	Order    string `json:"order"` // "asc" (default) or "desc"
+	Page     int    `json:"page"`  // 1-based
+	PageSize int    `json:"page_size"`
+}
+
+// ListResponse is one page of the directory.
+type ListResponse struct {
+	Status       string                  `json:"status"` // "ok", "invalid", "error"
+	Message      string                  `json:"message,omitempty"`
+	Institutions []dbService.Institution `json:"institutions"`
+	Total        int                     `json:"total"`
+	Page         int                     `json:"page"`
+	PageSize     int                     `json:"page_size"`
+}
+
+// GetRequest names one institution; with Status set, an institution in
+// another status is not found.
+type GetRequest struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+// DecideRequest approves or rejects a pending registration.
+type DecideRequest struct {
+	Name      string `json:"name"`
+	Decision  string `json:"decision"` // "approve" or "reject"
+	Reason    string `json:"reason"`
+	DecidedBy string `json:"decided_by"`
+}
+
+// DecideResponse carries the institution as decided.
+type DecideResponse struct {
+	Status      string                 `json:"status"` // "ok", "invalid", "not_found", "conflict", "error"
+	Message     string                 `json:"message,omitempty"`
+	Institution *dbService.Institution `json:"institution,omitempty"`
+}
+
+func validStatus(s string) bool {
+	return s == "" || s == dbService.StatusPending || s == dbService.StatusApproved || s == dbService.StatusRejected
+}
+
+// GetResponse carries the institution, if found.
+type GetResponse struct {
+	Status      string                 `json:"status"` // "ok", "invalid", "not_found", "error"
+	Message     string                 `json:"message,omitempty"`
+	Institution *dbService.Institution `json:"institution,omitempty"`
+}
+
+func HandleList(d amqp.Delivery, ch *amqp.Channel) {
+	log.Println("→ HandleList called")
+	defer d.Ack(false)
+
+	var req ListRequest
+	if err := json.Unmarshal(d.Body, &req); err != nil {
+		log.Printf("❌ JSON unmarshal error: %v", err)
+		publishJSON(ch, d, ListResponse{Status: "invalid", Message: "Invalid JSON", Institutions: []dbService.Institution{}})
+		return
+	}
+
+	// Defaults and bounds -------------------------------------------------
+	if req.Sort == "" {
+		req.Sort = "name"
+	}
+	if req.Page < 1 {
+		req.Page = 1
+	}
+	if req.PageSize < 1 {
+		req.PageSize = defaultPageSize
+	}
+	if req.PageSize > maxPageSize {
+		req.PageSize = maxPageSize
+	}
+	res := ListResponse{Page: req.Page, PageSize: req.PageSize, Institutions: []dbService.Institution{}}
+	if req.Order != "" && req.Order != "asc" && req.Order != "desc" {
+		res.Status, res.Message = "invalid", "order must be asc or desc"
+		publishJSON(ch, d, res)
+		return
+	}
+	if !validStatus(req.Status) {
+		res.Status, res.Message = "invalid", "status must be pending, approved or rejected"
+		publishJSON(ch, d, res)
+		return
+	}
+	if req.Sort != "name" && req.Sort != "director" && req.Sort != "created_at" {
+		res.Status, res.Message = "invalid", "sort must be name, director or created_at"
+		publishJSON(ch, d, res)
+		return
+	}
+
+	list, total, err := dbService.ListInstitutions(req.Status, req.Search, req.Sort, req.Order == "desc",
+		req.PageSize, (req.Page-1)*req.PageSize)
+	if err != nil {
+		log.Printf("❌ Database error listing institutions: %v", err)
+		res.Status, res.Message = "error", "Database error"
+		publishJSON(ch, d, res)
+		return
+	}
+	res.Status, res.Institutions, res.Total = "ok", list, total
+	publishJSON(ch, d, res)
+}
+
+func HandleGet(d amqp.Delivery, ch *amqp.Channel) {
+	log.Println("→ HandleGet called")
+	defer d.Ack(false)
+
+	var req GetRequest
+	if err := json.Unmarshal(d.Body, &req); err != nil || req.Name == "" || !validStatus(req.Status) {
+		log.Printf("❌ Invalid institution.get payload: %v", err)
+		publishJSON(ch, d, GetResponse{Status: "invalid", Message: "name is required; status must be pending, approved or rejected"})
+		return
+	}
+
+	inst, err := dbService.GetInstitution(req.Name)
+	switch {
+	case errors.Is(err, dbService.ErrInstitutionNotFound) || (err == nil && req.Status != "" && inst.Status != req.Status):
+		publishJSON(ch, d, GetResponse{Status: "not_found", Message: "Institution not found"})
+	case err != nil:
+		publishJSON(ch, d, GetResponse{Status: "error", Message: "Database error"})
+	default:
+		publishJSON(ch, d, GetResponse{Status: "ok", Institution: &inst})
+	}
+}
+
+func HandleDecide(d amqp.Delivery, ch *amqp.Channel) {
+	log.Println("→ HandleDecide called")
+	defer d.Ack(false)
+
+	var req DecideRequest
+	if err := json.Unmarshal(d.Body, &req); err != nil {
+		log.Printf("❌ JSON unmarshal error: %v", err)
+		publishJSON(ch, d, DecideResponse{Status: "invalid", Message: "Invalid JSON"})
+		return
+	}
+	if req.Name == "" || req.DecidedBy == "" || (req.Decision != "approve" && req.Decision != "reject") {
+		publishJSON(ch, d, DecideResponse{Status: "invalid", Message: "name, decided_by and a decision of approve or reject are required"})
+		return
+	}
+	if req.Decision == "reject" && req.Reason == "" {
+		publishJSON(ch, d, DecideResponse{Status: "invalid", Message: "a rejection needs a reason"})
+		return
+	}
+
+	inst, err := dbService.DecideInstitution(req.Name, req.Decision == "approve", req.Reason, req.DecidedBy)
+	switch {
+	case errors.Is(err, dbService.ErrInstitutionNotFound):
+		publishJSON(ch, d, DecideResponse{Status: "not_found", Message: "Institution not found"})
+	case errors.Is(err, dbService.ErrAlreadyDecided):
+		log.Printf("⚠ Conflict: institution %q is already %s", req.Name, inst.Status)
+		publishJSON(ch, d, DecideResponse{Status: "conflict", Message: "Institution is already " + inst.Status, Institution: &inst})
+	case err != nil:
+		publishJSON(ch, d, DecideResponse{Status: "error", Message: "Database error"})
+	default:
+		publishJSON(ch, d, DecideResponse{Status: "ok", Institution: &inst})
+	}
+}
+
+// publishJSON answers d with any reply value, like publishReply.
+func publishJSON(ch *amqp.Channel, d amqp.Delivery, res interface{}) {
+	if d.ReplyTo == "" {
+		log.Println("… No ReplyTo set; skipping reply publish")
+		return
+	}
+	body, _ := json.Marshal(res)
+	err := ch.Publish("", d.ReplyTo, false, false, amqp.Publishing{
+		ContentType:   "application/json",
+		CorrelationId: d.CorrelationId,
+		Body:          body,
+	})
+	if err != nil {
+		log.Printf("❌ Failed to publish reply: %v", err)
+	} else {
+		log.Println("✅ Reply published")
+	}
+}
@@ -14,6 +14,9 @@ type UserRequest struct {
 	Name     string `json:"name"`
 	Email    string `json:"email"`
 	Director string `json:"director"`
+	// RequestedBy is the representative who registered the institution;
+	// they are told when it is approved or rejected.
+	RequestedBy string `json:"requested_by,omitempty"`
 }
 
 // Response is sent back to the orchestrator
@@ -46,7 +49,7 @@ func HandleRegister(d amqp.Delivery, ch *amqp.Channel) {
 
 	// 2. Business logic -----------------------------------------------------
 	log.Println("… Calling dbService.AddInstitution")
-	code, err := dbService.AddInstitution(req.Name, req.Email, req.Director)
+	code, err := dbService.AddInstitution(req.Name, req.Email, req.Director, req.RequestedBy)
 	if err != nil {
 		if code == 2 {
 			log.Printf("⚠ Conflict: institution %q already registered", req.Name)
@@ -62,9 +65,9 @@ func HandleRegister(d amqp.Delivery, ch *amqp.Channel) {
 	}
 
 	// 3. Success ------------------------------------------------------------
-	log.Printf("✅ Institution %q registered (code %d)", req.Name, code)
+	log.Printf("✅ Institution %q registered, pending approval (code %d)", req.Name, code)
 	res.Status = "ok"
-	res.Message = "Institution registered successfully"
+	res.Message = "Registration submitted for approval"
 	publishReply(ch, d, res)
 }
 
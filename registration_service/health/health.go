@@ -0,0 +1,47 @@
+package health
+
+// Answers the orchestrator's system.ping readiness probe, sent over the
+// routing keys registration_service consumes.
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const pingEvent = "system.ping"
+
+var started = time.Now()
+
+// Publisher is the part of *amqp.Channel used to reply.
+type Publisher interface {
+	Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+}
+
+// IsPing reports whether d is a readiness probe rather than real work.
+func IsPing(d amqp.Delivery) bool {
+	event, _ := d.Headers["x-event-type"].(string)
+	return d.RoutingKey == pingEvent || event == pingEvent
+}
+
+// Pong answers the probe d on ch and acks it.
+func Pong(ch Publisher, d amqp.Delivery) {
+	body, _ := json.Marshal(map[string]interface{}{
+		"status":         "ok",
+		"service":        "registration_service",
+		"uptime_seconds": int(time.Since(started).Seconds()),
+	})
+	if d.ReplyTo != "" {
+		err := ch.Publish("", d.ReplyTo, false, false, amqp.Publishing{
+			ContentType:   "application/json",
+			CorrelationId: d.CorrelationId,
+			Body:          body,
+		})
+		if err != nil {
+			log.Printf("[Health] ping reply failed: %v", err)
+		}
+	}
+	d.Ack(false)
+}
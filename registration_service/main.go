@@ -8,6 +8,9 @@ import (
 
 	"registration_service/dbService"
 	"registration_service/handlers"
+	"registration_service/health"
+	"registration_service/metrics"
+	"registration_service/tracing"
 
 	"github.com/joho/godotenv"
 	amqp "github.com/rabbitmq/amqp091-go"
@@ -31,8 +34,14 @@ func main() {
 		log.Println("✅ .env file loaded")
 	}
 
+	defer tracing.Init()()
+	metrics.Serve()
+
 	log.Println("… Initializing database connection")
 	dbService.InitDB()
+	if err := dbService.EnsureSchema(); err != nil {
+		log.Fatalf("❌ Failed to migrate the institution table: %v", err)
+	}
 	log.Println("✅ Database initialized")
 
 	// ----------------------------------------------------------------------
@@ -60,7 +69,13 @@ func main() {
 	// 3. Declare exchange & queue (idempotent; safe if already exist)
 	// ----------------------------------------------------------------------
 	exchange := "clearSky.events"
-	routingKey := "institution.registered"
+	queue := "registration_queue"
+	keys := []string{
+		"institution.registered",
+		"institution.list",
+		"institution.get",
+		"institution.decide",
+	}
 
 	log.Printf("… Declaring exchange %q", exchange)
 	err = ch.ExchangeDeclare(
@@ -75,28 +90,30 @@ func main() {
 	failOnErr(err, "Failed to declare exchange")
 	log.Printf("✅ Exchange %q declared", exchange)
 
-	log.Printf("… Declaring queue %q", routingKey)
+	log.Printf("… Declaring queue %q", queue)
 	q, err := ch.QueueDeclare(
-		routingKey, // queue name == routing key
-		true,       // durable
-		false,      // delete when unused
-		false,      // exclusive
-		false,      // no-wait
-		nil,        // args
+		queue, // queue name
+		true,  // durable
+		false, // delete when unused
+		false, // exclusive
+		false, // no-wait
+		nil,   // args
 	)
 	failOnErr(err, "Failed to declare queue")
 	log.Printf("✅ Queue %q declared", q.Name)
 
-	log.Printf("… Binding queue %q to exchange %q with routing key %q", q.Name, exchange, routingKey)
-	err = ch.QueueBind(
-		q.Name,     // queue
-		routingKey, // routing key
-		exchange,   // exchange
-		false,
-		nil,
-	)
-	failOnErr(err, "Failed to bind queue")
-	log.Printf("✅ Queue %q bound to exchange %q with routing key %q", q.Name, exchange, routingKey)
+	for _, key := range keys {
+		log.Printf("… Binding queue %q to exchange %q with routing key %q", q.Name, exchange, key)
+		err = ch.QueueBind(
+			q.Name,   // queue
+			key,      // routing key
+			exchange, // exchange
+			false,
+			nil,
+		)
+		failOnErr(err, "Failed to bind queue to key "+key)
+	}
+	log.Printf("✅ Queue %q bound to exchange %q with %d routing keys", q.Name, exchange, len(keys))
 
 	// ----------------------------------------------------------------------
 	// 4. QoS & consumer
@@ -136,7 +153,27 @@ func main() {
 			log.Printf("👷 Worker %d is ready", id)
 			for d := range msgs {
 				log.Printf("👷 Worker %d received a message", id)
-				handlers.HandleRegister(d, ch)
+				if health.IsPing(d) {
+					health.Pong(ch, d)
+					continue
+				}
+				_, span := tracing.StartConsume(d)
+				done := metrics.Track(&d)
+				switch d.RoutingKey {
+				case "institution.registered":
+					handlers.HandleRegister(d, ch)
+				case "institution.list":
+					handlers.HandleList(d, ch)
+				case "institution.get":
+					handlers.HandleGet(d, ch)
+				case "institution.decide":
+					handlers.HandleDecide(d, ch)
+				default:
+					log.Printf("⚠ Worker %d: unknown key %q", id, d.RoutingKey)
+					d.Nack(false, false)
+				}
+				done()
+				span.End()
 			}
 			log.Printf("👷 Worker %d exiting", id)
 		}(i)
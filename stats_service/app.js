@@ -2,6 +2,7 @@ require('dotenv').config();
 const amqp = require('amqplib');
 const mysql = require('mysql2/promise');
 const XLSX = require('xlsx');
+const { loadWorkbook } = require('./blob');
 
 /* const {
   MYSQL_URI,
@@ -61,6 +62,25 @@ if (missingVars.length > 0) {
     process.exit(1);
   }
 
+  // Tells the orchestrators a sheet is imported, so they drop the
+  // distributions they cached while it was (stats.imported).
+  const announceImport = (msg, sheet) => {
+    let ref = {};
+    if ((msg.properties.contentType || '').toLowerCase().trim() === 'application/json') {
+      ref = JSON.parse(msg.content.toString());
+    }
+    channel.publish(RABBITMQ_EXCHANGE, 'stats.imported', Buffer.from(JSON.stringify({
+      sha256: ref.sha256,
+      filename: ref.filename,
+      declaration_period: sheet.declarationPeriod,
+      class_title: sheet.classTitle,
+      rows: sheet.rows
+    })), {
+      contentType: 'application/json',
+      headers: { 'x-event-type': 'stats.imported', 'x-schema-version': 1 }
+    });
+  };
+
   const makeReply = msg => payload => {
     const { replyTo, correlationId } = msg.properties;
     if (!replyTo) return;
@@ -86,12 +106,8 @@ if (missingVars.length > 0) {
     console.log('📩  Received grade message');
     const reply = makeReply(msg);
 
-    const ct = (msg.properties.contentType || '').toLowerCase().trim();
-    const buffer = (ct.includes('spreadsheet') || ct === 'application/octet-stream')
-      ? msg.content
-      : Buffer.from(msg.content.toString(), 'base64');
-
     try {
+      const buffer = await loadWorkbook(msg);   // claim check → .xlsx bytes
       const wb = XLSX.read(buffer, { type: 'buffer' });
       const rows = XLSX.utils.sheet_to_json(wb.Sheets[wb.SheetNames[0]], {
         header: 1,
@@ -114,6 +130,7 @@ if (missingVars.length > 0) {
       };
 
       let totalInserted = 0;
+      const sheet = {};
 
       for (const row of dataRows) {
         const d = {};
@@ -155,6 +172,8 @@ if (missingVars.length > 0) {
         ]);
 
           if (totalInserted==0) {
+          sheet.declarationPeriod = d.declarationPeriod;
+          sheet.classTitle = d.classTitle;
           // Submission log handling (without AM)
           const [existingLog] = await connection.execute(
             `SELECT initialSubmissionDate, finalSubmissionDate 
@@ -182,6 +201,7 @@ if (missingVars.length > 0) {
       
 
       console.log(`✅  Processed ${totalInserted} grades`);
+      announceImport(msg, { ...sheet, rows: totalInserted });
       reply({ status: 'ok', message: `Processed ${totalInserted} grades` });
       channel.ack(msg);
 
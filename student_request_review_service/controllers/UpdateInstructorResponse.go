@@ -2,9 +2,11 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"student_request_review_service/db"
+	"student_request_review_service/metrics"
 )
 
 func UpdateInstructorResponse(body map[string]interface{}) (string, error) {
@@ -27,8 +29,11 @@ func UpdateInstructorResponse(body map[string]interface{}) (string, error) {
 	    OR
 
 	   {
+	     "error": "Review not found",
 	     "message": "Failed to update instructor response in database on student end."
 	   }
+
+	   With an "operation_id" the update is journalled (see operations.go).
 	*/
 	log.Println("UpdateInstructorResponse: invoked with body:", body)
 
@@ -81,6 +86,29 @@ func UpdateInstructorResponse(body map[string]interface{}) (string, error) {
 	}
 	log.Printf("UpdateInstructorResponse: updating review for student_id=%s, course_id=%s, exam_period=%s", userID, courseID, examPeriod)
 
+	// journalled update for the orchestrator's review workflow
+	if opID := operationID(body); opID != "" {
+		err := replyOnce(opID, instructorReply, instructorAction, userID, courseID, examPeriod)
+		switch {
+		case errors.Is(err, errReviewNotFound), errors.Is(err, errOperationReverted):
+			failResponse := map[string]interface{}{
+				"error":   err.Error(),
+				"message": "Failed to update instructor response in database on student end.",
+			}
+			failRespBytes, _ := json.Marshal(failResponse)
+			return string(failRespBytes), nil
+		case err != nil:
+			metrics.DBError("update_instructor_response")
+			return "", fmt.Errorf("UpdateInstructorResponse failed to update review: %v", err)
+		}
+		response := map[string]interface{}{
+			"message":      "Instructor response updated successfully on student end.",
+			"operation_id": opID,
+		}
+		respBytes, _ := json.Marshal(response)
+		return string(respBytes), nil
+	}
+
 	query := `
 		UPDATE reviews 
 		SET instructor_reply_message = $1,
@@ -92,12 +120,14 @@ func UpdateInstructorResponse(body map[string]interface{}) (string, error) {
 
 	result, err := db.DB.Exec(query, instructorReply, instructorAction, userID, courseID, examPeriod)
 	if err != nil {
+		metrics.DBError("update_instructor_response")
 		return "", fmt.Errorf("UpdateInstructorResponse failed to update review: %v", err)
 	}
 
 	rowsAffected, _ := result.RowsAffected()
 	if rowsAffected == 0 {
 		failResponse := map[string]interface{}{
+			"error":   "Review not found",
 			"message": "Failed to update instructor response in database on student end.",
 		}
 		failRespBytes, _ := json.Marshal(failResponse)
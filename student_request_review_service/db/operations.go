@@ -0,0 +1,24 @@
+package db
+
+// review_operations journals the writes the orchestrator sends with an
+// operation_id, so a repeated write is applied once and a failed
+// two-service workflow can revert it (see controllers/operations.go, which
+// also says why the other review service keeps an identical copy).
+
+// EnsureOperationsTable creates review_operations on databases initialised
+// before it existed.
+func EnsureOperationsTable() error {
+	_, err := DB.Exec(`
+		CREATE TABLE IF NOT EXISTS review_operations (
+			operation_id VARCHAR(64) PRIMARY KEY,
+			kind VARCHAR(16) NOT NULL CHECK (kind IN ('insert', 'reply', 'tombstone')),
+			review_id INTEGER,
+			prev_status VARCHAR(50),
+			prev_reply_message TEXT,
+			prev_action VARCHAR(50),
+			prev_reviewed_at TIMESTAMP,
+			reverted BOOLEAN NOT NULL DEFAULT FALSE,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`)
+	return err
+}
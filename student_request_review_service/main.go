@@ -4,13 +4,17 @@ package main
 import (
 	"fmt"
 	"student_request_review_service/db"
+	"student_request_review_service/metrics"
 	"student_request_review_service/mq"
+	"student_request_review_service/tracing"
 	"time"
 
 	_ "github.com/lib/pq"
 )
 
 func main() {
+	defer tracing.Init()()
+	metrics.Serve()
 
 	for i := 0; i < 15; i++ {
 		err := mq.InitRabbitMQ()
@@ -39,6 +43,10 @@ func main() {
 	}
 	defer db.CloseDB()
 
+	if err := db.EnsureOperationsTable(); err != nil {
+		panic(fmt.Sprintf("Could not create review_operations: %v", err))
+	}
+
 	mq.StartConsumer()
 
 	fmt.Println("Student Service started and waiting for RabbitMQ messages...")
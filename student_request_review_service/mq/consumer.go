@@ -3,7 +3,10 @@ package mq
 import (
 	"fmt"
 
+	"student_request_review_service/health"
+	"student_request_review_service/metrics"
 	"student_request_review_service/routes"
+	"student_request_review_service/tracing"
 
 	"github.com/streadway/amqp"
 )
@@ -23,6 +26,7 @@ func StartConsumer() {
 		"student.postNewRequest",
 		"student.getRequestStatus",
 		"student.updateInstructorResponse",
+		"student.revertOperation",
 	}
 
 	// declare direct exchange for event routing
@@ -77,6 +81,12 @@ func StartConsumer() {
 
 	go func() {
 		for d := range msgs {
+			if health.IsPing(d) {
+				health.Pong(Mqch, d)
+				continue
+			}
+			ctx, span := tracing.StartConsume(d)
+			done := metrics.Track(&d)
 			fmt.Printf("Received message: %s", d.Body)
 
 			response, err := routes.Routing(d.RoutingKey, d.Body)
@@ -95,6 +105,7 @@ func StartConsumer() {
 				amqp.Publishing{
 					ContentType:   "application/json",
 					CorrelationId: d.CorrelationId,
+					Headers:       tracing.Inject(ctx, nil),
 					Body:          []byte(response),
 				},
 			)
@@ -107,6 +118,8 @@ func StartConsumer() {
 				fmt.Printf("Sent reply to %s\n", d.ReplyTo)
 				d.Ack(false)
 			}
+			done()
+			tracing.End(span, err)
 		}
 	}()
 }
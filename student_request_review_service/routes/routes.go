@@ -45,6 +45,9 @@ func Routing(routingKey string, messageBody []byte) (string, error) {
 	case "student.updateInstructorResponse":
 		return controllers.UpdateInstructorResponse(msg.Body)
 
+	case "student.revertOperation":
+		return controllers.RevertOperation(msg.Body)
+
 	default:
 		return "", fmt.Errorf("unknown routing key: %s", routingKey)
 	}
@@ -6,12 +6,20 @@ import (
 	"user_management_service/internal/config"
 	"user_management_service/internal/handler"
 	"user_management_service/internal/messaging"
+	"user_management_service/internal/metrics"
 	"user_management_service/internal/middleware"
+	"user_management_service/internal/tracing"
 
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
+	// 0) Tracing (OTEL_TRACES_EXPORTER=otlp|file|none)
+	defer tracing.Init()()
+
+	// 0b) Prometheus consumer/DB metrics on METRICS_ADDR (default :9100)
+	metrics.Serve()
+
 	// 1) Database setup
 	db := config.SetupDatabase()
 	sqlDB, _ := db.DB()
@@ -2,8 +2,10 @@ package config
 
 import (
 	"os"
+	"user_management_service/internal/metrics"
 	"user_management_service/internal/model"
 
+	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -20,14 +22,34 @@ func SetupDatabase() *gorm.DB {
 	if err != nil {
 		panic(err)
 	}
+	metrics.WatchGorm(db)
 
-	// Migrate the User model
-	db.AutoMigrate(&model.User{})
+	// Migrate the User model and the admin audit trail
+	db.AutoMigrate(&model.User{}, &model.AuditEntry{})
 
 	// Seed default admin user (username: admin / password: admin)
 	passHash, _ := bcrypt.GenerateFromPassword([]byte("admin"), bcrypt.DefaultCost)
 	admin := model.User{Username: "admin", PasswordHash: string(passHash), Role: "institution_representative"}
 	db.FirstOrCreate(&admin, model.User{Username: "admin"})
 
+	seedPlatformAdmin(db)
 	return db
 }
+
+// seedPlatformAdmin creates the first platform admin from
+// PLATFORM_ADMIN_USERNAME (default platform_admin) and
+// PLATFORM_ADMIN_PASSWORD; without a password nobody is seeded. An
+// existing account of that name is left alone.
+func seedPlatformAdmin(db *gorm.DB) {
+	password := os.Getenv("PLATFORM_ADMIN_PASSWORD")
+	if password == "" {
+		return
+	}
+	username := os.Getenv("PLATFORM_ADMIN_USERNAME")
+	if username == "" {
+		username = "platform_admin"
+	}
+	passHash, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	admin := model.User{ID: uuid.NewString(), Username: username, PasswordHash: string(passHash), Role: model.RolePlatformAdmin}
+	db.FirstOrCreate(&admin, model.User{Username: username})
+}
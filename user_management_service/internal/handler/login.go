@@ -35,7 +35,16 @@ func Login(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		token, err := jwtutil.GenerateToken(user.ID, user.Username, user.Role, user.StudentID)
+		if user.Locked {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Account locked"})
+			return
+		}
+		if user.PasswordResetRequired {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Password reset required: change your password first"})
+			return
+		}
+
+		token, err := jwtutil.GenerateToken(user.ID, user.Username, user.Role, user.Roles(), user.StudentID, user.BilledInstitution(), user.TokenVersion)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
 			return
@@ -44,7 +53,8 @@ func Login(db *gorm.DB) gin.HandlerFunc {
 		c.JSON(http.StatusOK, gin.H{
 			"token":  token,
 			"role":   user.Role, // add role to response
-			"userId": user.ID,   // add userId for completeness
+			"roles":  user.Roles(),
+			"userId": user.ID, // add userId for completeness
 		})
 	}
 }
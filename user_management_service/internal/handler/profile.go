@@ -17,9 +17,11 @@ func Profile(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 		c.JSON(http.StatusOK, gin.H{
-			"user_id":    u.ID,
-			"role":       u.Role,
-			"student_id": u.StudentID,
+			"user_id":     u.ID,
+			"role":        u.Role,
+			"roles":       u.Roles(),
+			"student_id":  u.StudentID,
+			"institution": u.BilledInstitution(),
 		})
 	}
 }
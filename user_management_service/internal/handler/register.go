@@ -12,10 +12,11 @@ import (
 
 // Struct για το request σώμα
 type RegisterRequest struct {
-	Username  string `json:"username" binding:"omitempty"`
-	Password  string `json:"password" binding:"required,min=6"`
-	Role      string `json:"role" binding:"required,oneof=student instructor institution_representative"`
-	StudentID string `json:"student_id,omitempty"` // Add student_id field
+	Username    string `json:"username" binding:"omitempty"`
+	Password    string `json:"password" binding:"required,min=6"`
+	Role        string `json:"role" binding:"required,oneof=student instructor institution_representative"`
+	StudentID   string `json:"student_id,omitempty"`  // Add student_id field
+	Institution string `json:"institution,omitempty"` // refused: see model.InstitutionSource
 }
 
 // Handler function
@@ -33,6 +34,11 @@ func Register(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		if req.Institution != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": model.ErrSelfDeclaredInstitution})
+			return
+		}
+
 		// Έλεγχος αν το username υπάρχει ήδη
 		var existingUser model.User
 		if req.Username != "" && db.Where("username = ?", req.Username).First(&existingUser).Error == nil {
@@ -11,9 +11,10 @@ import (
 )
 
 type UpsertRequest struct {
-	Username  string `json:"username" binding:"required"`
-	Role      string `json:"role" binding:"required,oneof=student instructor institution_representative"`
-	StudentID string `json:"student_id,omitempty"`
+	Username    string `json:"username" binding:"required"`
+	Role        string `json:"role" binding:"required,oneof=student instructor institution_representative"`
+	StudentID   string `json:"student_id,omitempty"`
+	Institution string `json:"institution,omitempty"` // from google_auth_service's INSTITUTION_DOMAINS
 }
 
 func UpsertUser(db *gorm.DB) gin.HandlerFunc {
@@ -28,10 +29,14 @@ func UpsertUser(db *gorm.DB) gin.HandlerFunc {
 		if err := db.Where("username = ?", req.Username).First(&u).Error; err != nil {
 			// create new
 			u = model.User{
-				ID:        uuid.NewString(),
-				Username:  req.Username,
-				Role:      req.Role,
-				StudentID: req.StudentID,
+				ID:          uuid.NewString(),
+				Username:    req.Username,
+				Role:        req.Role,
+				StudentID:   req.StudentID,
+				Institution: req.Institution,
+			}
+			if u.Institution != "" {
+				u.InstitutionSource = model.InstitutionByEmailDomain
 			}
 			db.Create(&u)
 		} else {
@@ -43,9 +48,15 @@ func UpsertUser(db *gorm.DB) gin.HandlerFunc {
 			if req.StudentID != "" && u.StudentID != req.StudentID {
 				u.StudentID = req.StudentID
 			}
+			// the domain mapping fills in an institution but never replaces
+			// one an admin or representative assigned
+			if req.Institution != "" && (u.InstitutionSource == "" || u.InstitutionSource == model.InstitutionByEmailDomain) {
+				u.Institution = req.Institution
+				u.InstitutionSource = model.InstitutionByEmailDomain
+			}
 			db.Save(&u)
 		}
 
-		c.JSON(http.StatusOK, gin.H{"user_id": u.ID, "role": u.Role})
+		c.JSON(http.StatusOK, gin.H{"user_id": u.ID, "role": u.Role, "institution": u.BilledInstitution()})
 	}
 }
@@ -0,0 +1,376 @@
+package messaging
+
+// Platform admin RPCs (users.*) on the auth.request queue. The orchestrator
+// only forwards them for platform_admin callers and names the caller in
+// Actor; every request, refused or not, is written to the admin_audit
+// table. The one exception is users.create, which institution
+// representatives send to add accounts to the institution they were
+// assigned: it checks the actor's account itself.
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"user_management_service/internal/model"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// AdminRequest is the payload of every users.* request; each key reads the
+// fields it needs.
+type AdminRequest struct {
+	Actor    string   `json:"actor"`
+	Username string   `json:"username,omitempty"`
+	Role     string   `json:"role,omitempty"`
+	Roles    []string `json:"roles,omitempty"` // set_role: every role to hold, primary first
+	Search   string   `json:"search,omitempty"`
+	Page     int      `json:"page,omitempty"`
+	PageSize int      `json:"page_size,omitempty"`
+	// set_institution: the institution, already checked to be approved
+	Institution string `json:"institution,omitempty"`
+	// create: the new account; Role is student or instructor
+	Password  string `json:"password,omitempty"`
+	StudentID string `json:"student_id,omitempty"`
+}
+
+// UserView is a user account as admins see it, without the password hash.
+type UserView struct {
+	ID                    string    `json:"id"`
+	Username              string    `json:"username"`
+	Role                  string    `json:"role"`
+	Roles                 []string  `json:"roles"`
+	StudentID             string    `json:"student_id,omitempty"`
+	Institution           string    `json:"institution,omitempty"`
+	InstitutionSource     string    `json:"institution_source,omitempty"`
+	Locked                bool      `json:"locked"`
+	PasswordResetRequired bool      `json:"password_reset_required"`
+	CreatedAt             time.Time `json:"created_at"`
+	UpdatedAt             time.Time `json:"updated_at"`
+}
+
+// AdminResponse answers a users.* request. Status is "ok", "invalid",
+// "not_found", "conflict" or "error".
+type AdminResponse struct {
+	Status            string             `json:"status"`
+	Message           string             `json:"message,omitempty"`
+	User              *UserView          `json:"user,omitempty"`
+	Users             []UserView         `json:"users,omitempty"`
+	Audit             []model.AuditEntry `json:"audit,omitempty"`
+	Total             int                `json:"total,omitempty"`
+	Page              int                `json:"page,omitempty"`
+	PageSize          int                `json:"page_size,omitempty"`
+	TemporaryPassword string             `json:"temporary_password,omitempty"`
+}
+
+// bumped revokes the tokens issued so far (see model.User.TokenVersion).
+var bumped = gorm.Expr("token_version + 1")
+
+var validRoles = map[string]bool{
+	model.RoleStudent:                   true,
+	model.RoleInstructor:                true,
+	model.RoleInstitutionRepresentative: true,
+	model.RolePlatformAdmin:             true,
+}
+
+// IsAdminEvent reports whether event is one of the users.* requests.
+func IsAdminEvent(event string) bool {
+	return strings.HasPrefix(event, "users.")
+}
+
+// HandleAdmin runs the users.* request event and audits it.
+func HandleAdmin(db *gorm.DB, event string, body []byte) AdminResponse {
+	var req AdminRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return AdminResponse{Status: "invalid", Message: "Invalid JSON"}
+	}
+	action := strings.TrimPrefix(event, "users.")
+
+	var resp AdminResponse
+	if req.Actor == "" {
+		resp = AdminResponse{Status: "invalid", Message: "actor required"}
+	} else {
+		resp = runAdmin(db, action, req)
+	}
+
+	status := resp.Status
+	if status != "ok" {
+		status += ": " + resp.Message
+	}
+	detail := ""
+	switch action {
+	case "set_role":
+		detail = "roles=" + strings.Join(requestedRoles(req), ",")
+	case "set_institution":
+		detail = "institution=" + req.Institution
+	case "create":
+		detail = "role=" + req.Role
+		if resp.User != nil {
+			detail += ",institution=" + resp.User.Institution
+		}
+	}
+	entry := model.AuditEntry{Actor: req.Actor, Action: action, Target: req.Username, Detail: detail, Status: status}
+	if err := db.Create(&entry).Error; err != nil {
+		log.Printf("[Admin] ❌ audit %s on %q by %q: %v", action, req.Username, req.Actor, err)
+	}
+	log.Printf("[Admin] %s on %q by %q: %s", action, req.Username, req.Actor, status)
+	return resp
+}
+
+func runAdmin(db *gorm.DB, action string, req AdminRequest) AdminResponse {
+	switch action {
+	case "list":
+		return listUsers(db, req)
+	case "audit":
+		return listAudit(db, req)
+	case "create":
+		return createMember(db, req)
+	}
+
+	if req.Username == "" {
+		return AdminResponse{Status: "invalid", Message: "username required"}
+	}
+	var user model.User
+	if err := db.Where("username = ?", req.Username).First(&user).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		return AdminResponse{Status: "not_found", Message: "User not found"}
+	} else if err != nil {
+		return AdminResponse{Status: "error", Message: "Failed to load user"}
+	}
+	// Admins cannot lock themselves out
+	if user.Username == req.Actor && action != "get" && action != "reset_password" && action != "set_institution" {
+		return AdminResponse{Status: "conflict", Message: "You cannot " + strings.ReplaceAll(action, "_", " ") + " your own account"}
+	}
+
+	switch action {
+	case "get":
+		return AdminResponse{Status: "ok", User: view(user)}
+	case "set_role":
+		roles := requestedRoles(req)
+		if len(roles) == 0 {
+			return AdminResponse{Status: "invalid", Message: "role or roles required"}
+		}
+		for _, role := range roles {
+			if !validRoles[role] {
+				return AdminResponse{Status: "invalid", Message: "Unknown role " + role}
+			}
+			if role == model.RoleStudent && user.StudentID == "" {
+				return AdminResponse{Status: "invalid", Message: "A student needs a student ID"}
+			}
+		}
+		return update(db, &user, map[string]interface{}{"role": roles[0], "extra_roles": strings.Join(roles[1:], ","), "token_version": bumped})
+	case "set_institution":
+		if req.Institution == "" {
+			return AdminResponse{Status: "invalid", Message: "institution required"}
+		}
+		fields := map[string]interface{}{"institution": req.Institution, "institution_source": model.InstitutionByAdmin}
+		// Tokens carry the institution billed for uploads and notified;
+		// repeating the same assignment revokes nothing
+		if user.Institution != req.Institution || user.InstitutionSource != model.InstitutionByAdmin {
+			fields["token_version"] = bumped
+		}
+		return update(db, &user, fields)
+	case "lock":
+		return update(db, &user, map[string]interface{}{"locked": true, "token_version": bumped})
+	case "unlock":
+		return update(db, &user, map[string]interface{}{"locked": false})
+	case "reset_password":
+		password, err := temporaryPassword()
+		if err != nil {
+			return AdminResponse{Status: "error", Message: "Failed to generate a password"}
+		}
+		hash, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		resp := update(db, &user, map[string]interface{}{"password_hash": string(hash), "password_reset_required": true, "token_version": bumped})
+		if resp.Status == "ok" {
+			resp.TemporaryPassword = password
+		}
+		return resp
+	case "delete":
+		if err := db.Where("username = ?", user.Username).Delete(&model.User{}).Error; err != nil {
+			return AdminResponse{Status: "error", Message: "Failed to delete user"}
+		}
+		return AdminResponse{Status: "ok", User: view(user)}
+	default:
+		return AdminResponse{Status: "invalid", Message: "Unknown admin request"}
+	}
+}
+
+// createMember adds a student or instructor account to the institution the
+// actor, a representative, was assigned.
+func createMember(db *gorm.DB, req AdminRequest) AdminResponse {
+	var actor model.User
+	if err := db.Where("username = ?", req.Actor).First(&actor).Error; err != nil {
+		return AdminResponse{Status: "not_found", Message: "Actor not found"}
+	}
+	if !hasRole(actor, model.RoleInstitutionRepresentative) || actor.BilledInstitution() == "" {
+		return AdminResponse{Status: "conflict", Message: "You represent no approved institution"}
+	}
+	if req.Username == "" || req.Password == "" {
+		return AdminResponse{Status: "invalid", Message: "username and password required"}
+	}
+	if req.Role != model.RoleStudent && req.Role != model.RoleInstructor {
+		return AdminResponse{Status: "invalid", Message: "role must be student or instructor"}
+	}
+	if req.Role == model.RoleStudent && req.StudentID == "" {
+		return AdminResponse{Status: "invalid", Message: "A student needs a student ID"}
+	}
+	var existing model.User
+	if db.Where("username = ?", req.Username).First(&existing).Error == nil {
+		return AdminResponse{Status: "conflict", Message: "Username already registered"}
+	}
+	if req.StudentID != "" && db.Where("student_id = ?", req.StudentID).First(&existing).Error == nil {
+		return AdminResponse{Status: "conflict", Message: "Student ID already registered"}
+	}
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	user := model.User{
+		ID:                uuid.NewString(),
+		Username:          req.Username,
+		PasswordHash:      string(hash),
+		Role:              req.Role,
+		StudentID:         req.StudentID,
+		Institution:       actor.Institution,
+		InstitutionSource: model.InstitutionByRepresentative,
+	}
+	if err := db.Create(&user).Error; err != nil {
+		return AdminResponse{Status: "error", Message: "Failed to create user"}
+	}
+	return AdminResponse{Status: "ok", User: view(user)}
+}
+
+func hasRole(u model.User, role string) bool {
+	for _, r := range u.Roles() {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// requestedRoles is the role set a set_role request asks for, without
+// duplicates: Roles, or just Role.
+func requestedRoles(req AdminRequest) []string {
+	roles := req.Roles
+	if len(roles) == 0 && req.Role != "" {
+		roles = []string{req.Role}
+	}
+	seen := make(map[string]bool, len(roles))
+	var out []string
+	for _, r := range roles {
+		if !seen[r] {
+			seen[r] = true
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+func update(db *gorm.DB, user *model.User, fields map[string]interface{}) AdminResponse {
+	// By username: the seeded accounts may have no ID
+	err := db.Model(&model.User{}).Where("username = ?", user.Username).Updates(fields).Error
+	if err == nil {
+		err = db.Where("username = ?", user.Username).First(user).Error
+	}
+	if err != nil {
+		return AdminResponse{Status: "error", Message: "Failed to update user"}
+	}
+	return AdminResponse{Status: "ok", User: view(*user)}
+}
+
+// listUsers pages through the users whose username, student ID or
+// institution contains Search, optionally only those holding Role (as
+// their primary role or another).
+func listUsers(db *gorm.DB, req AdminRequest) AdminResponse {
+	page, size := paging(req)
+	q := db.Model(&model.User{})
+	if req.Search != "" {
+		like := "%" + req.Search + "%"
+		q = q.Where("username LIKE ? OR student_id LIKE ? OR institution LIKE ?", like, like, like)
+	}
+	if req.Role != "" {
+		q = q.Where("role = ? OR ',' || extra_roles || ',' LIKE ?", req.Role, "%,"+req.Role+",%")
+	}
+	q = q.Session(&gorm.Session{}) // reused for the count and the page
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return AdminResponse{Status: "error", Message: "Failed to count users"}
+	}
+	var users []model.User
+	if err := q.Order("username").Limit(size).Offset((page - 1) * size).Find(&users).Error; err != nil {
+		return AdminResponse{Status: "error", Message: "Failed to list users"}
+	}
+	resp := AdminResponse{Status: "ok", Users: []UserView{}, Total: int(total), Page: page, PageSize: size}
+	for _, u := range users {
+		resp.Users = append(resp.Users, *view(u))
+	}
+	return resp
+}
+
+// listAudit pages through the audit trail, newest first, optionally only
+// the entries whose actor or target is Search.
+func listAudit(db *gorm.DB, req AdminRequest) AdminResponse {
+	page, size := paging(req)
+	q := db.Model(&model.AuditEntry{})
+	if req.Search != "" {
+		q = q.Where("actor = ? OR target = ?", req.Search, req.Search)
+	}
+	q = q.Session(&gorm.Session{})
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return AdminResponse{Status: "error", Message: "Failed to count audit entries"}
+	}
+	resp := AdminResponse{Status: "ok", Audit: []model.AuditEntry{}, Total: int(total), Page: page, PageSize: size}
+	if err := q.Order("id DESC").Limit(size).Offset((page - 1) * size).Find(&resp.Audit).Error; err != nil {
+		return AdminResponse{Status: "error", Message: "Failed to list audit entries"}
+	}
+	return resp
+}
+
+func paging(req AdminRequest) (page, size int) {
+	page, size = req.Page, req.PageSize
+	if page < 1 {
+		page = 1
+	}
+	if size < 1 {
+		size = defaultPageSize
+	}
+	if size > maxPageSize {
+		size = maxPageSize
+	}
+	return page, size
+}
+
+func view(u model.User) *UserView {
+	return &UserView{
+		ID:                    u.ID,
+		Username:              u.Username,
+		Role:                  u.Role,
+		Roles:                 u.Roles(),
+		StudentID:             u.StudentID,
+		Institution:           u.Institution,
+		InstitutionSource:     u.InstitutionSource,
+		Locked:                u.Locked,
+		PasswordResetRequired: u.PasswordResetRequired,
+		CreatedAt:             u.CreatedAt,
+		UpdatedAt:             u.UpdatedAt,
+	}
+}
+
+// temporaryPassword is handed to the admin once, to pass on to the user.
+func temporaryPassword() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -2,9 +2,14 @@
 package messaging
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"log"
+	"user_management_service/internal/health"
+	"user_management_service/internal/metrics"
 	"user_management_service/internal/model"
+	"user_management_service/internal/tracing"
 	"user_management_service/pkg/jwt"
 
 	"github.com/google/uuid"
@@ -15,21 +20,26 @@ import (
 )
 
 type AuthRequest struct {
-	Type        string `json:"type"` // "register" ή "login"
+	Type        string `json:"type"` // "register", "login", "change_password" ή "session"
 	Username    string `json:"username,omitempty"`
 	Password    string `json:"password,omitempty"`
 	Role        string `json:"role,omitempty"`
-	StudentID   string `json:"student_id,omitempty"` // Add student_id field
+	StudentID   string `json:"student_id,omitempty"`  // Add student_id field
+	Institution string `json:"institution,omitempty"` // refused: see model.InstitutionSource
 	OldPassword string `json:"old_password,omitempty"`
 	NewPassword string `json:"new_password,omitempty"`
 }
 
 type AuthResponse struct {
-	Status  string `json:"status"`            // "ok" ή "error"
-	Message string `json:"message,omitempty"` // λόγος σφάλματος
-	Token   string `json:"token,omitempty"`
-	Role    string `json:"role,omitempty"`
-	UserID  string `json:"userId,omitempty"`
+	Status  string   `json:"status"`            // "ok" ή "error"
+	Message string   `json:"message,omitempty"` // λόγος σφάλματος
+	Token   string   `json:"token,omitempty"`
+	Role    string   `json:"role,omitempty"`
+	Roles   []string `json:"roles,omitempty"`
+	UserID  string   `json:"userId,omitempty"`
+	// session: what the orchestrator checks a token against
+	TokenVersion int  `json:"token_version,omitempty"`
+	Locked       bool `json:"locked,omitempty"`
 }
 
 func ConsumeAuthQueue(db *gorm.DB) {
@@ -42,10 +52,25 @@ func ConsumeAuthQueue(db *gorm.DB) {
 
 	go func() {
 		for d := range msgs {
+			if health.IsPing(d) {
+				health.Pong(Channel, d)
+				continue
+			}
+			ctx, span := tracing.StartConsume(d)
+			done := metrics.Track(&d)
+			if event, _ := d.Headers["x-event-type"].(string); IsAdminEvent(event) {
+				reply(ctx, d, HandleAdmin(db, event, d.Body))
+				d.Ack(false)
+				done()
+				span.End()
+				continue
+			}
 			var req AuthRequest
 			if err := json.Unmarshal(d.Body, &req); err != nil {
 				log.Println("Invalid auth request:", err)
 				d.Nack(false, false)
+				done()
+				tracing.End(span, err)
 				continue
 			}
 			var resp AuthResponse
@@ -62,6 +87,16 @@ func ConsumeAuthQueue(db *gorm.DB) {
 					role = "student"
 				}
 
+				if !model.SignupRole(role) {
+					resp = AuthResponse{Status: "error", Message: "Role not allowed"}
+					goto send
+				}
+
+				if req.Institution != "" {
+					resp = AuthResponse{Status: "error", Message: model.ErrSelfDeclaredInstitution}
+					goto send
+				}
+
 				if role == "student" && req.StudentID == "" {
 					resp = AuthResponse{Status: "error", Message: "Student ID required for student registration"}
 					goto send
@@ -109,12 +144,16 @@ func ConsumeAuthQueue(db *gorm.DB) {
 				}
 				if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
 					resp = AuthResponse{Status: "error", Message: "Invalid credentials"}
+				} else if user.Locked {
+					resp = AuthResponse{Status: "error", Message: "Account locked"}
+				} else if user.PasswordResetRequired {
+					resp = AuthResponse{Status: "error", Message: "Password reset required: change your password first"}
 				} else {
-					token, err := jwt.GenerateToken(user.ID, user.Username, user.Role, user.StudentID)
+					token, err := jwt.GenerateToken(user.ID, user.Username, user.Role, user.Roles(), user.StudentID, user.BilledInstitution(), user.TokenVersion)
 					if err != nil {
 						resp = AuthResponse{Status: "error", Message: "Token generation failed"}
 					} else {
-						resp = AuthResponse{Status: "ok", Token: token, Role: user.Role, UserID: user.ID}
+						resp = AuthResponse{Status: "ok", Token: token, Role: user.Role, Roles: user.Roles(), UserID: user.ID}
 					}
 				}
 				// change_password
@@ -126,26 +165,48 @@ func ConsumeAuthQueue(db *gorm.DB) {
 					resp = AuthResponse{Status: "error", Message: "Invalid credentials"}
 				} else {
 					newHash, _ := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
-					if err := db.Model(&user).Update("password_hash", string(newHash)).Error; err != nil {
+					if err := db.Model(&model.User{}).Where("username = ?", user.Username).Updates(map[string]interface{}{
+						"password_hash":           string(newHash),
+						"password_reset_required": false,
+					}).Error; err != nil {
 						resp = AuthResponse{Status: "error", Message: "Failed to update password"}
 					} else {
 						resp = AuthResponse{Status: "ok"}
 					}
 				}
+				// session: is a token for this account still good?
+			} else if req.Type == "session" {
+				var user model.User
+				if err := db.Where("username = ?", req.Username).First(&user).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+					resp = AuthResponse{Status: "not_found", Message: "User not found"}
+				} else if err != nil {
+					resp = AuthResponse{Status: "error", Message: "Failed to load user"}
+				} else {
+					resp = AuthResponse{Status: "ok", TokenVersion: user.TokenVersion, Locked: user.Locked}
+				}
 			} else {
 				resp = AuthResponse{Status: "error", Message: "Unknown request type"}
 			}
 		send:
 			// send RPC reply
-			body, _ := json.Marshal(resp)
-			if d.ReplyTo != "" {
-				Channel.Publish("", d.ReplyTo, false, false, amqp.Publishing{
-					ContentType:   "application/json",
-					CorrelationId: d.CorrelationId,
-					Body:          body,
-				})
-			}
+			reply(ctx, d, resp)
 			d.Ack(false)
+			done()
+			span.End()
 		}
 	}()
 }
+
+// reply answers the RPC request d with resp.
+func reply(ctx context.Context, d amqp.Delivery, resp interface{}) {
+	if d.ReplyTo == "" {
+		return
+	}
+	body, _ := json.Marshal(resp)
+	Channel.Publish("", d.ReplyTo, false, false, amqp.Publishing{
+		Headers:       tracing.Inject(ctx, nil),
+		ContentType:   "application/json",
+		CorrelationId: d.CorrelationId,
+		Body:          body,
+	})
+}
@@ -0,0 +1,26 @@
+package metrics
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// WatchGorm counts every failed statement issued through db. Lookups that
+// simply find nothing are not errors.
+func WatchGorm(db *gorm.DB) {
+	count := func(op string) func(*gorm.DB) {
+		return func(tx *gorm.DB) {
+			if tx.Error != nil && !errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+				dbError(op)
+			}
+		}
+	}
+	cb := db.Callback()
+	cb.Create().After("gorm:create").Register("metrics:create", count("create"))
+	cb.Query().After("gorm:query").Register("metrics:query", count("query"))
+	cb.Update().After("gorm:update").Register("metrics:update", count("update"))
+	cb.Delete().After("gorm:delete").Register("metrics:delete", count("delete"))
+	cb.Row().After("gorm:row").Register("metrics:row", count("row"))
+	cb.Raw().After("gorm:raw").Register("metrics:raw", count("raw"))
+}
@@ -38,6 +38,7 @@ func JWTAuthMiddleware() gin.HandlerFunc {
 		c.Set("username", claims.Username)
 		c.Set("role", claims.Role)
 		c.Set("student_id", claims.StudentID) // Add student_id to context
+		c.Set("institution", claims.Institution)
 
 		c.Next()
 	}
@@ -1,13 +1,93 @@
 package model
 
-import "time"
+import (
+	"strings"
+	"time"
+)
+
+// Roles a user can hold. PlatformAdmin is never granted by registration,
+// only by another platform admin or the seed account.
+const (
+	RoleStudent                   = "student"
+	RoleInstructor                = "instructor"
+	RoleInstitutionRepresentative = "institution_representative"
+	RolePlatformAdmin             = "platform_admin"
+)
+
+// SignupRole reports whether a user may pick role when signing up.
+func SignupRole(role string) bool {
+	switch role {
+	case RoleStudent, RoleInstructor, RoleInstitutionRepresentative:
+		return true
+	}
+	return false
+}
+
+// Who assigned a user's institution. Signup never does: the institution
+// billed for a user's uploads is the platform's decision, not the user's.
+const (
+	InstitutionByAdmin          = "admin"          // a platform admin, or the approval of one the user registered
+	InstitutionByRepresentative = "representative" // the representative who created the account
+	InstitutionByEmailDomain    = "email_domain"   // INSTITUTION_DOMAINS, on Google sign-in
+)
+
+// ErrSelfDeclaredInstitution refuses a signup that names its institution.
+const ErrSelfDeclaredInstitution = "An institution is assigned by a platform admin or your institution's representative, not at signup"
 
 type User struct {
 	ID           string `gorm:"primaryKey"`
 	Username     string `gorm:"uniqueIndex"`
 	PasswordHash string
 	Role         string
-	StudentID    string // optional school ID for students
+	// ExtraRoles are the roles held besides Role, comma-separated
+	ExtraRoles  string
+	StudentID   string // optional school ID for students
+	Institution string `gorm:"index"` // institution billed for this user's uploads
+	// InstitutionSource is one of the InstitutionBy* values; empty for
+	// institutions declared at signup before they were refused there,
+	// which are kept but not trusted.
+	InstitutionSource string
+	// Locked accounts cannot log in; PasswordResetRequired ones must
+	// change_password (with the temporary password) first.
+	Locked                bool
+	PasswordResetRequired bool
+	// TokenVersion is put in every token issued; locking the account,
+	// resetting its password or changing its roles bumps it, and the
+	// orchestrator refuses tokens carrying an older one.
+	TokenVersion int
 	CreatedAt    time.Time
 	UpdatedAt    time.Time
 }
+
+// Roles returns every role the user holds, Role first.
+func (u User) Roles() []string {
+	roles := []string{u.Role}
+	for _, r := range strings.Split(u.ExtraRoles, ",") {
+		if r != "" && r != u.Role {
+			roles = append(roles, r)
+		}
+	}
+	return roles
+}
+
+// BilledInstitution is the institution named in the user's tokens: only
+// one the platform assigned.
+func (u User) BilledInstitution() string {
+	if u.InstitutionSource == "" {
+		return ""
+	}
+	return u.Institution
+}
+
+// AuditEntry records one platform admin action on a user account.
+type AuditEntry struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Actor     string    `gorm:"index" json:"actor"`
+	Action    string    `json:"action"`
+	Target    string    `gorm:"index" json:"target,omitempty"`
+	Detail    string    `json:"detail,omitempty"`
+	Status    string    `json:"status"` // "ok" or why it was refused
+	CreatedAt time.Time `gorm:"index" json:"at"`
+}
+
+func (AuditEntry) TableName() string { return "admin_audit" }
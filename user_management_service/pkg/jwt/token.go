@@ -10,22 +10,30 @@ import (
 var jwtKey = []byte(os.Getenv("JWT_SECRET")) // Μπορείς να το φορτώνεις από env
 
 type Claims struct {
-	UserID    string `json:"user_id"`
-	Username  string `json:"username"`
-	Role      string `json:"role"`
-	StudentID string `json:"student_id,omitempty"`
+	UserID      string   `json:"user_id"`
+	Username    string   `json:"username"`
+	Role        string   `json:"role"`
+	Roles       []string `json:"roles,omitempty"` // every role held, Role first
+	StudentID   string   `json:"student_id,omitempty"`
+	Institution string   `json:"institution,omitempty"`
+	// TokenVersion is the account's model.User.TokenVersion at issue
+	TokenVersion int `json:"token_version,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// GenerateToken issues a JWT with username instead of email
-func GenerateToken(userID, username, role, studentID string) (string, error) {
+// GenerateToken issues a JWT with username instead of email. role is the
+// primary role; roles lists every role held.
+func GenerateToken(userID, username, role string, roles []string, studentID, institution string, tokenVersion int) (string, error) {
 	expirationTime := time.Now().Add(24 * time.Hour)
 
 	claims := &Claims{
-		UserID:    userID,
-		Username:  username,
-		Role:      role,
-		StudentID: studentID,
+		UserID:       userID,
+		Username:     username,
+		Role:         role,
+		Roles:        roles,
+		StudentID:    studentID,
+		Institution:  institution,
+		TokenVersion: tokenVersion,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 		},